@@ -0,0 +1,139 @@
+package gofakes3
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Account is an S3 account. Each account owns the buckets its users create,
+// and only sees those in ListBuckets; other accounts can only access them if a
+// bucket policy or ACL allows it.
+type Account struct {
+	// The canonical user ID of the account, which identifies it in ACLs and in
+	// the x-amz-expected-bucket-owner header.
+	ID          string
+	DisplayName string
+
+	// The access keys of the account, mapped to their secret access keys.
+	Credentials StaticCredentials
+}
+
+func (a Account) owner() UserInfo {
+	return UserInfo{ID: a.ID, DisplayName: a.DisplayName}
+}
+
+// AccountProvider is a CredentialProvider that assigns access keys to
+// accounts. If the CredentialProvider passed to WithCredentials does not
+// implement it, every access key belongs to the same account.
+type AccountProvider interface {
+	CredentialProvider
+
+	// AccountOwner returns the owner of the account the access key belongs
+	// to. If the access key ID is not known, AccountOwner MUST return an error
+	// with the code ErrInvalidAccessKeyID.
+	AccountOwner(accessKeyID string) (UserInfo, error)
+}
+
+// Accounts is an AccountProvider for a fixed list of accounts. See
+// WithAccounts.
+type Accounts []Account
+
+var _ AccountProvider = Accounts{}
+
+func (as Accounts) SecretAccessKey(accessKeyID string) (string, error) {
+	for _, account := range as {
+		if secret, ok := account.Credentials[accessKeyID]; ok {
+			return secret, nil
+		}
+	}
+	return "", ErrInvalidAccessKeyID
+}
+
+func (as Accounts) AccountOwner(accessKeyID string) (UserInfo, error) {
+	for _, account := range as {
+		if _, ok := account.Credentials[accessKeyID]; ok {
+			return account.owner(), nil
+		}
+	}
+	return UserInfo{}, ErrInvalidAccessKeyID
+}
+
+// bucketOwners records the owners of buckets in memory for backends that do
+// not implement ACLBackend, which otherwise stores the owner in the bucket's
+// ACL.
+type bucketOwners struct {
+	owners map[string]UserInfo
+	mu     sync.Mutex
+}
+
+func newBucketOwners() *bucketOwners {
+	return &bucketOwners{owners: make(map[string]UserInfo)}
+}
+
+func (bo *bucketOwners) owner(bucket string) (UserInfo, bool) {
+	bo.mu.Lock()
+	defer bo.mu.Unlock()
+
+	owner, ok := bo.owners[bucket]
+	return owner, ok
+}
+
+func (bo *bucketOwners) set(bucket string, owner UserInfo) {
+	bo.mu.Lock()
+	defer bo.mu.Unlock()
+
+	bo.owners[bucket] = owner
+}
+
+// forget removes the owner of a bucket that has been deleted, so that the
+// name can be taken by another account.
+func (bo *bucketOwners) forget(bucket string) {
+	bo.mu.Lock()
+	defer bo.mu.Unlock()
+
+	delete(bo.owners, bucket)
+}
+
+// requestOwner returns the owner of the account that made the request. It
+// returns a zero UserInfo for anonymous requests.
+func (g *GoFakeS3) requestOwner(r *http.Request) (UserInfo, error) {
+	if g.isAnonymous(r) {
+		return UserInfo{}, nil
+	}
+	if g.accounts != nil {
+		return g.accounts.AccountOwner(g.requestAccessKeyID(r))
+	}
+	return defaultOwner, nil
+}
+
+// bucketOwner returns the owner of the bucket. Buckets that were not created
+// through GoFakeS3 belong to the default account.
+func (g *GoFakeS3) bucketOwner(bucket string) (UserInfo, error) {
+	acl, err := g.bucketACL(bucket)
+	if err != nil {
+		return UserInfo{}, err
+	} else if acl.Owner == nil {
+		return defaultOwner, nil
+	}
+	return *acl.Owner, nil
+}
+
+// checkExpectedBucketOwner implements the x-amz-expected-bucket-owner and
+// x-amz-source-expected-bucket-owner headers, which fail the request if the
+// bucket is owned by another account.
+func (g *GoFakeS3) checkExpectedBucketOwner(bucket, expected string) error {
+	if expected == "" || bucket == "" {
+		return nil
+	}
+
+	owner, err := g.bucketOwner(bucket)
+	if HasErrorCode(err, ErrNoSuchBucket) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if owner.ID != expected {
+		return ErrorMessage(ErrAccessDenied, ErrAccessDenied.Message())
+	}
+	return nil
+}
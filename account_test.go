@@ -0,0 +1,206 @@
+package gofakes3_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+var (
+	aliceAccount = gofakes3.Account{
+		ID:          "a11ce00000000000000000000000000000000000000000000000000000000000",
+		DisplayName: "alice",
+		Credentials: gofakes3.StaticCredentials{"alice-access": "alice-secret"},
+	}
+	bobAccount = gofakes3.Account{
+		ID:          "b0b0000000000000000000000000000000000000000000000000000000000000",
+		DisplayName: "bob",
+		Credentials: gofakes3.StaticCredentials{"bob-access": "bob-secret"},
+	}
+)
+
+func withAccounts() testServerOption {
+	return withFakerOptions(gofakes3.WithAccounts(aliceAccount, bobAccount))
+}
+
+// backendWithoutACLs hides the optional interfaces of a Backend, so that
+// bucket owners have to be tracked by GoFakeS3 itself.
+type backendWithoutACLs struct {
+	gofakes3.Backend
+}
+
+func (ts *testServer) createBucket(svc *s3.Client, bucket string) {
+	ts.Helper()
+	_, err := svc.CreateBucket(context.TODO(), &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	ts.OK(err)
+}
+
+func TestAccountsListBuckets(t *testing.T) {
+	for _, backend := range []gofakes3.Backend{
+		s3mem.New(),
+		&backendWithoutACLs{s3mem.New()},
+	} {
+		t.Run(fmt.Sprintf("%T", backend), func(t *testing.T) {
+			ts := newTestServer(t, withAccounts(), withBackend(backend))
+			defer ts.Close()
+			alice := ts.s3ClientWithCredentials("alice-access", "alice-secret")
+			bob := ts.s3ClientWithCredentials("bob-access", "bob-secret")
+
+			ts.createBucket(alice, "alice-bucket")
+			ts.createBucket(bob, "bob-bucket")
+
+			for _, tc := range []struct {
+				svc     *s3.Client
+				account gofakes3.Account
+				bucket  string
+			}{
+				{alice, aliceAccount, "alice-bucket"},
+				{bob, bobAccount, "bob-bucket"},
+			} {
+				out, err := tc.svc.ListBuckets(context.TODO(), &s3.ListBucketsInput{})
+				ts.OK(err)
+				if len(out.Buckets) != 1 || aws.ToString(out.Buckets[0].Name) != tc.bucket {
+					t.Fatal(tc.account.DisplayName, "expected only", tc.bucket)
+				}
+				if aws.ToString(out.Owner.ID) != tc.account.ID || aws.ToString(out.Owner.DisplayName) != tc.account.DisplayName {
+					t.Fatal("unexpected owner", aws.ToString(out.Owner.ID))
+				}
+			}
+
+			_, err := bob.DeleteBucket(context.TODO(), &s3.DeleteBucketInput{Bucket: aws.String("alice-bucket")})
+			if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+				t.Fatal("expected AccessDenied, found", err)
+			}
+
+			// Once deleted, the name is free for another account:
+			_, err = alice.DeleteBucket(context.TODO(), &s3.DeleteBucketInput{Bucket: aws.String("alice-bucket")})
+			ts.OK(err)
+			ts.createBucket(bob, "alice-bucket")
+			out, err := bob.ListBuckets(context.TODO(), &s3.ListBucketsInput{})
+			ts.OK(err)
+			if len(out.Buckets) != 2 {
+				t.Fatal("expected 2 buckets, found", len(out.Buckets))
+			}
+		})
+	}
+}
+
+func TestAccountsBucketAlreadyExists(t *testing.T) {
+	ts := newTestServer(t, withAccounts())
+	defer ts.Close()
+	alice := ts.s3ClientWithCredentials("alice-access", "alice-secret")
+	bob := ts.s3ClientWithCredentials("bob-access", "bob-secret")
+
+	ts.createBucket(alice, "taken")
+
+	_, err := alice.CreateBucket(context.TODO(), &s3.CreateBucketInput{Bucket: aws.String("taken")})
+	if !hasErrorCode(err, gofakes3.ErrBucketAlreadyOwnedByYou) {
+		t.Fatal("expected BucketAlreadyOwnedByYou, found", err)
+	}
+	_, err = bob.CreateBucket(context.TODO(), &s3.CreateBucketInput{Bucket: aws.String("taken")})
+	if !hasErrorCode(err, gofakes3.ErrBucketAlreadyExists) {
+		t.Fatal("expected BucketAlreadyExists, found", err)
+	}
+}
+
+func TestAccountsCrossAccountAccess(t *testing.T) {
+	ts := newTestServer(t, withAccounts())
+	defer ts.Close()
+	alice := ts.s3ClientWithCredentials("alice-access", "alice-secret")
+	bob := ts.s3ClientWithCredentials("bob-access", "bob-secret")
+
+	ts.createBucket(alice, "shared")
+	_, err := alice.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String("shared"),
+		Key:    aws.String("object"),
+		Body:   strings.NewReader("hello"),
+	})
+	ts.OK(err)
+
+	getObject := func(svc *s3.Client) error {
+		out, err := svc.GetObject(context.TODO(), &s3.GetObjectInput{
+			Bucket: aws.String("shared"),
+			Key:    aws.String("object"),
+		})
+		if err == nil {
+			out.Body.Close()
+		}
+		return err
+	}
+
+	ts.OK(getObject(alice))
+	if err := getObject(bob); !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+
+	_, err = alice.PutBucketPolicy(context.TODO(), &s3.PutBucketPolicyInput{
+		Bucket: aws.String("shared"),
+		Policy: aws.String(`{
+			"Statement": [
+				{"Effect": "Allow", "Principal": {"CanonicalUser": "` + aliceAccount.ID + `"}, "Action": "s3:*", "Resource": ["arn:aws:s3:::shared", "arn:aws:s3:::shared/*"]},
+				{"Effect": "Allow", "Principal": {"CanonicalUser": "` + bobAccount.ID + `"}, "Action": "s3:GetObject", "Resource": "arn:aws:s3:::shared/*"}
+			]
+		}`),
+	})
+	ts.OK(err)
+	ts.OK(getObject(alice))
+	ts.OK(getObject(bob))
+
+	acl, err := alice.GetBucketAcl(context.TODO(), &s3.GetBucketAclInput{Bucket: aws.String("shared")})
+	ts.OK(err)
+	if aws.ToString(acl.Owner.ID) != aliceAccount.ID {
+		t.Fatal("unexpected bucket owner", aws.ToString(acl.Owner.ID))
+	}
+	objACL, err := alice.GetObjectAcl(context.TODO(), &s3.GetObjectAclInput{
+		Bucket: aws.String("shared"),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+	if aws.ToString(objACL.Owner.ID) != aliceAccount.ID {
+		t.Fatal("unexpected object owner", aws.ToString(objACL.Owner.ID))
+	}
+}
+
+func TestAccountsExpectedBucketOwner(t *testing.T) {
+	ts := newTestServer(t, withAccounts())
+	defer ts.Close()
+	alice := ts.s3ClientWithCredentials("alice-access", "alice-secret")
+	ts.createBucket(alice, "alice-bucket")
+
+	_, err := alice.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
+		Bucket:              aws.String("alice-bucket"),
+		ExpectedBucketOwner: aws.String(aliceAccount.ID),
+	})
+	ts.OK(err)
+
+	_, err = alice.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
+		Bucket:              aws.String("alice-bucket"),
+		ExpectedBucketOwner: aws.String(bobAccount.ID),
+	})
+	if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+
+	_, err = alice.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String("alice-bucket"),
+		Key:    aws.String("src"),
+		Body:   strings.NewReader("hello"),
+	})
+	ts.OK(err)
+	_, err = alice.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:                    aws.String("alice-bucket"),
+		Key:                       aws.String("dst"),
+		CopySource:                aws.String("alice-bucket/src"),
+		ExpectedSourceBucketOwner: aws.String(bobAccount.ID),
+	})
+	if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+}
@@ -0,0 +1,422 @@
+package gofakes3
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+)
+
+// AccessControlPolicy is the access control list (ACL) of a bucket or an
+// object, as sent and returned by the '?acl' subresource:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/acl-overview.html
+type AccessControlPolicy struct {
+	XMLName xml.Name  `xml:"AccessControlPolicy"`
+	Xmlns   string    `xml:"xmlns,attr,omitempty"`
+	Owner   *UserInfo `xml:"Owner,omitempty"`
+	Grants  []Grant   `xml:"AccessControlList>Grant"`
+}
+
+type Grant struct {
+	Grantee    Grantee    `xml:"Grantee"`
+	Permission Permission `xml:"Permission"`
+}
+
+type Permission string
+
+const (
+	PermissionFullControl Permission = "FULL_CONTROL"
+	PermissionRead        Permission = "READ"
+	PermissionReadACP     Permission = "READ_ACP"
+	PermissionWrite       Permission = "WRITE"
+	PermissionWriteACP    Permission = "WRITE_ACP"
+)
+
+func (p Permission) valid() bool {
+	switch p {
+	case PermissionFullControl, PermissionRead, PermissionReadACP, PermissionWrite, PermissionWriteACP:
+		return true
+	}
+	return false
+}
+
+type GranteeType string
+
+const (
+	GranteeCanonicalUser         GranteeType = "CanonicalUser"
+	GranteeGroup                 GranteeType = "Group"
+	GranteeAmazonCustomerByEmail GranteeType = "AmazonCustomerByEmail"
+)
+
+// The predefined groups a Grantee of type GranteeGroup can refer to:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/acl-overview.html#specifying-grantee-predefined-groups
+const (
+	AllUsersGroup           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	AuthenticatedUsersGroup = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+	LogDeliveryGroup        = "http://acs.amazonaws.com/groups/s3/LogDelivery"
+)
+
+const xmlSchemaInstance = "http://www.w3.org/2001/XMLSchema-instance"
+
+// Grantee is the subject of a Grant. Canonical users are identified by ID,
+// groups by URI, and customers by EmailAddress.
+type Grantee struct {
+	Type         GranteeType
+	ID           string
+	DisplayName  string
+	URI          string
+	EmailAddress string
+}
+
+// granteeBody is the content of the Grantee element; the type is carried in
+// an xsi:type attribute, which encoding/xml can't express in a struct tag.
+type granteeBody struct {
+	ID           string `xml:"ID,omitempty"`
+	DisplayName  string `xml:"DisplayName,omitempty"`
+	URI          string `xml:"URI,omitempty"`
+	EmailAddress string `xml:"EmailAddress,omitempty"`
+}
+
+func (g Grantee) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = append(start.Attr,
+		xml.Attr{Name: xml.Name{Local: "xmlns:xsi"}, Value: xmlSchemaInstance},
+		xml.Attr{Name: xml.Name{Local: "xsi:type"}, Value: string(g.Type)})
+	return e.EncodeElement(granteeBody{
+		ID:           g.ID,
+		DisplayName:  g.DisplayName,
+		URI:          g.URI,
+		EmailAddress: g.EmailAddress,
+	}, start)
+}
+
+func (g *Grantee) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "type" {
+			g.Type = GranteeType(attr.Value)
+		}
+	}
+	var body granteeBody
+	if err := d.DecodeElement(&body, &start); err != nil {
+		return err
+	}
+	g.ID, g.DisplayName, g.URI, g.EmailAddress = body.ID, body.DisplayName, body.URI, body.EmailAddress
+	return nil
+}
+
+// defaultOwner is the account of every access key unless an AccountProvider
+// is used, and owns the buckets that were not created through GoFakeS3.
+var defaultOwner = UserInfo{
+	ID:          "fe7272ea58be830e56fe1663b10fafef",
+	DisplayName: "GoFakeS3",
+}
+
+func ownerGrant(owner UserInfo) Grant {
+	return Grant{
+		Grantee:    Grantee{Type: GranteeCanonicalUser, ID: owner.ID, DisplayName: owner.DisplayName},
+		Permission: PermissionFullControl,
+	}
+}
+
+func groupGrant(uri string, perm Permission) Grant {
+	return Grant{Grantee: Grantee{Type: GranteeGroup, URI: uri}, Permission: perm}
+}
+
+// privateACL is the ACL of buckets and objects that were created without one.
+func privateACL(owner UserInfo) *AccessControlPolicy {
+	return &AccessControlPolicy{Owner: &owner, Grants: []Grant{ownerGrant(owner)}}
+}
+
+// cannedACL expands one of the canned ACLs that can be sent in the x-amz-acl
+// header:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/acl-overview.html#canned-acl
+func cannedACL(name string, owner, bucketOwner UserInfo) (*AccessControlPolicy, error) {
+	acl := privateACL(owner)
+
+	switch name {
+	case "private", "aws-exec-read":
+	case "public-read":
+		acl.Grants = append(acl.Grants, groupGrant(AllUsersGroup, PermissionRead))
+	case "public-read-write":
+		acl.Grants = append(acl.Grants,
+			groupGrant(AllUsersGroup, PermissionRead),
+			groupGrant(AllUsersGroup, PermissionWrite))
+	case "authenticated-read":
+		acl.Grants = append(acl.Grants, groupGrant(AuthenticatedUsersGroup, PermissionRead))
+	case "log-delivery-write":
+		acl.Grants = append(acl.Grants,
+			groupGrant(LogDeliveryGroup, PermissionWrite),
+			groupGrant(LogDeliveryGroup, PermissionReadACP))
+	case "bucket-owner-read", "bucket-owner-full-control":
+		if bucketOwner.ID != owner.ID {
+			grant := ownerGrant(bucketOwner)
+			if name == "bucket-owner-read" {
+				grant.Permission = PermissionRead
+			}
+			acl.Grants = append(acl.Grants, grant)
+		}
+	default:
+		return nil, ErrorInvalidArgument("x-amz-acl", name, "")
+	}
+
+	return acl, nil
+}
+
+// The headers that grant a permission to a list of grantees, as an
+// alternative to a canned ACL.
+var aclGrantHeaders = []struct {
+	header     string
+	permission Permission
+}{
+	{"X-Amz-Grant-Full-Control", PermissionFullControl},
+	{"X-Amz-Grant-Read", PermissionRead},
+	{"X-Amz-Grant-Read-Acp", PermissionReadACP},
+	{"X-Amz-Grant-Write", PermissionWrite},
+	{"X-Amz-Grant-Write-Acp", PermissionWriteACP},
+}
+
+// aclFromHeaders builds the ACL requested by the x-amz-acl or x-amz-grant-*
+// headers, which are read by calling get with their canonical names. It
+// returns nil if none of the headers are present.
+//
+// Objects keep these headers in their metadata, so get may also read from
+// there; that way, the ACL an object was created with is persisted by every
+// Backend.
+func aclFromHeaders(get func(header string) string, owner, bucketOwner UserInfo) (*AccessControlPolicy, error) {
+	canned := get("X-Amz-Acl")
+
+	var grants []Grant
+	for _, h := range aclGrantHeaders {
+		value := get(h.header)
+		if value == "" {
+			continue
+		}
+		grantees, err := parseACLGrantHeader(h.header, value)
+		if err != nil {
+			return nil, err
+		}
+		for _, grantee := range grantees {
+			grants = append(grants, Grant{Grantee: grantee, Permission: h.permission})
+		}
+	}
+
+	switch {
+	case canned != "" && len(grants) > 0:
+		return nil, ErrorMessage(ErrInvalidRequest, "Specifying both Canned ACLs and Header Grants is not allowed")
+	case canned != "":
+		return cannedACL(canned, owner, bucketOwner)
+	case len(grants) > 0:
+		acl := &AccessControlPolicy{Owner: &owner, Grants: grants}
+		if err := acl.validate(); err != nil {
+			return nil, err
+		}
+		return acl, nil
+	default:
+		return nil, nil
+	}
+}
+
+// isACLHeader reports whether the canonical header name is one of the headers
+// read by aclFromHeaders.
+func isACLHeader(name string) bool {
+	return name == "X-Amz-Acl" || strings.HasPrefix(name, "X-Amz-Grant-")
+}
+
+// aclFromMetadata returns the ACL an object was created with. Objects are
+// owned by the owner of their bucket, as with S3's default "bucket owner
+// enforced" object ownership.
+func aclFromMetadata(meta map[string]string, owner UserInfo) (*AccessControlPolicy, error) {
+	acl, err := aclFromHeaders(func(header string) string { return meta[header] }, owner, owner)
+	if err != nil || acl != nil {
+		return acl, err
+	}
+	return privateACL(owner), nil
+}
+
+// checkObjectACL checks the ACL headers an object is being created with. The
+// ACL is resolved for the bucket's owner, who owns the object.
+func (g *GoFakeS3) checkObjectACL(bucket string, meta map[string]string) error {
+	owner, err := g.bucketOwner(bucket)
+	if err != nil {
+		return err
+	}
+	_, err = aclFromMetadata(meta, owner)
+	return err
+}
+
+// parseACLGrantHeader parses the list of grantees in an x-amz-grant-* header,
+// i.e. 'id="111122223333", uri="http://acs.amazonaws.com/groups/global/AllUsers"'.
+func parseACLGrantHeader(header, value string) ([]Grantee, error) {
+	var grantees []Grantee
+	for _, item := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return nil, ErrorInvalidArgument(header, value, "Invalid grant header value")
+		}
+		val = strings.Trim(strings.TrimSpace(val), `"`)
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "id":
+			grantees = append(grantees, Grantee{Type: GranteeCanonicalUser, ID: val})
+		case "uri":
+			grantees = append(grantees, Grantee{Type: GranteeGroup, URI: val})
+		case "emailaddress":
+			grantees = append(grantees, Grantee{Type: GranteeAmazonCustomerByEmail, EmailAddress: val})
+		default:
+			return nil, ErrorInvalidArgument(header, value, "Invalid grant header value")
+		}
+	}
+	return grantees, nil
+}
+
+// validate checks the grants of an ACL sent by a client.
+func (acp *AccessControlPolicy) validate() error {
+	for _, grant := range acp.Grants {
+		if !grant.Permission.valid() {
+			return ErrorMessage(ErrMalformedACLError, ErrMalformedACLError.Message())
+		}
+
+		grantee := grant.Grantee
+		switch grantee.Type {
+		case GranteeCanonicalUser:
+			if grantee.ID == "" {
+				return ErrorMessage(ErrMalformedACLError, ErrMalformedACLError.Message())
+			}
+		case GranteeGroup:
+			switch grantee.URI {
+			case AllUsersGroup, AuthenticatedUsersGroup, LogDeliveryGroup:
+			default:
+				return ErrorInvalidArgument("uri", grantee.URI, "Invalid group uri")
+			}
+		case GranteeAmazonCustomerByEmail:
+			// GoFakeS3 has no accounts to look e-mail addresses up in:
+			return ErrorMessage(ErrUnresolvableGrantByEmailAddress, ErrUnresolvableGrantByEmailAddress.Message())
+		default:
+			return ErrorMessage(ErrMalformedACLError, ErrMalformedACLError.Message())
+		}
+	}
+	return nil
+}
+
+// aclRequester describes the caller of a request in the terms of an ACL.
+type aclRequester struct {
+	// The canonical user ID of the caller, or empty if the request is
+	// anonymous.
+	ID string
+}
+
+// allows reports whether the ACL grants the permission to the requester.
+//
+// Grants to the owner are ignored: the owner's access is decided by the
+// bucket policy instead, as IAM users within an account aren't granted
+// anything by the account's ACL grants.
+func (acp *AccessControlPolicy) allows(rq aclRequester, perm Permission) bool {
+	for _, grant := range acp.Grants {
+		if grant.Permission != perm && grant.Permission != PermissionFullControl {
+			continue
+		}
+
+		grantee := grant.Grantee
+		switch grantee.Type {
+		case GranteeGroup:
+			if grantee.URI == AllUsersGroup || (grantee.URI == AuthenticatedUsersGroup && rq.ID != "") {
+				return true
+			}
+		case GranteeCanonicalUser:
+			if rq.ID != "" && grantee.ID == rq.ID && (acp.Owner == nil || grantee.ID != acp.Owner.ID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// aclPermission returns the permission an ACL must grant for the action, and
+// whether it is checked against the object's ACL rather than the bucket's.
+// Actions that ACLs can't grant return an empty Permission.
+//
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/acl-overview.html#permissions
+func aclPermission(action string) (perm Permission, onObject bool) {
+	switch action {
+	case "s3:GetObject", "s3:GetObjectVersion":
+		return PermissionRead, true
+	case "s3:GetObjectAcl", "s3:GetObjectVersionAcl":
+		return PermissionReadACP, true
+	case "s3:PutObjectAcl", "s3:PutObjectVersionAcl":
+		return PermissionWriteACP, true
+
+	case "s3:ListBucket", "s3:ListBucketVersions", "s3:ListBucketMultipartUploads":
+		return PermissionRead, false
+	case "s3:PutObject", "s3:DeleteObject", "s3:DeleteObjectVersion",
+		"s3:AbortMultipartUpload", "s3:ListMultipartUploadParts":
+		return PermissionWrite, false
+	case "s3:GetBucketAcl":
+		return PermissionReadACP, false
+	case "s3:PutBucketAcl":
+		return PermissionWriteACP, false
+	}
+	return "", false
+}
+
+// aclAllows checks the ACL of the bucket, or of the object, for the
+// permission the action requires.
+func (g *GoFakeS3) aclAllows(r *http.Request, rq aclRequester, action, bucket, object string) (bool, error) {
+	perm, onObject := aclPermission(action)
+	if perm == "" {
+		return false, nil
+	}
+
+	var acl *AccessControlPolicy
+	var err error
+	if onObject {
+		acl, err = g.objectACL(bucket, object, VersionID(versionFromQuery(r.URL.Query()["versionId"])))
+	} else {
+		acl, err = g.bucketACL(bucket)
+	}
+	if HasErrorCode(err, ErrNoSuchKey) || HasErrorCode(err, ErrNoSuchVersion) || HasErrorCode(err, ErrNoSuchBucket) {
+		// Callers that can't read the object can't find out that it doesn't
+		// exist:
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return acl.allows(rq, perm), nil
+}
+
+// bucketACL returns the ACL of the bucket, which is private unless it was
+// changed through an ACLBackend.
+func (g *GoFakeS3) bucketACL(bucket string) (*AccessControlPolicy, error) {
+	if g.acls != nil {
+		acl, err := g.acls.BucketACL(bucket)
+		if err != nil || acl != nil {
+			return acl, err
+		}
+	} else if exists, err := g.storage.BucketExists(bucket); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, BucketNotFound(bucket)
+	} else if owner, ok := g.owners.owner(bucket); ok {
+		return privateACL(owner), nil
+	}
+	return privateACL(defaultOwner), nil
+}
+
+// objectACL returns the ACL that was last set on the object through an
+// ACLBackend, or failing that, the ACL it was created with.
+func (g *GoFakeS3) objectACL(bucket, object string, versionID VersionID) (*AccessControlPolicy, error) {
+	if g.acls != nil {
+		acl, err := g.acls.ObjectACL(bucket, object, versionID)
+		if err != nil || acl != nil {
+			return acl, err
+		}
+	}
+
+	obj, err := g.headObjectOrVersion(bucket, object, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, err := g.bucketOwner(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return aclFromMetadata(obj.Metadata, owner)
+}
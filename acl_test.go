@@ -0,0 +1,263 @@
+package gofakes3_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/johannesboyne/gofakes3"
+)
+
+func (ts *testServer) anonymousGet(rqpath string) int {
+	ts.Helper()
+	rs, err := httpClient().Get(ts.url(rqpath))
+	ts.OK(err)
+	rs.Body.Close()
+	return rs.StatusCode
+}
+
+func (ts *testServer) putObjectWithACL(svc *s3.Client, key string, acl s3types.ObjectCannedACL) {
+	ts.Helper()
+	_, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String(key),
+		Body:   strings.NewReader("hello"),
+		ACL:    acl,
+	})
+	ts.OK(err)
+}
+
+func hasGrant(grants []s3types.Grant, uri string, perm s3types.Permission) bool {
+	for _, grant := range grants {
+		if grant.Grantee != nil && aws.ToString(grant.Grantee.URI) == uri && grant.Permission == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func TestACLAnonymousObjectAccess(t *testing.T) {
+	ts := newTestServer(t, withCredentials())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.putObjectWithACL(svc, "public", s3types.ObjectCannedACLPublicRead)
+	ts.putObjectWithACL(svc, "private", "")
+	ts.putObjectWithACL(svc, "authenticated", s3types.ObjectCannedACLAuthenticatedRead)
+
+	if code := ts.anonymousGet("/" + defaultBucket + "/public"); code != http.StatusOK {
+		t.Fatal("expected 200 for public-read object, found", code)
+	}
+	if code := ts.anonymousGet("/" + defaultBucket + "/private"); code != http.StatusForbidden {
+		t.Fatal("expected 403 for private object, found", code)
+	}
+	if code := ts.anonymousGet("/" + defaultBucket + "/authenticated"); code != http.StatusForbidden {
+		t.Fatal("expected 403 for authenticated-read object, found", code)
+	}
+
+	// Object ACLs do not extend to the bucket:
+	if code := ts.anonymousGet("/" + defaultBucket); code != http.StatusForbidden {
+		t.Fatal("expected 403 for private bucket, found", code)
+	}
+	if code := ts.anonymousGet("/"); code != http.StatusForbidden {
+		t.Fatal("expected 403 for anonymous ListBuckets, found", code)
+	}
+}
+
+func TestACLOverwriteResetsACL(t *testing.T) {
+	ts := newTestServer(t, withCredentials())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.putObjectWithACL(svc, "object", s3types.ObjectCannedACLPublicRead)
+	ts.putObjectWithACL(svc, "object", "")
+	if code := ts.anonymousGet("/" + defaultBucket + "/object"); code != http.StatusForbidden {
+		t.Fatal("expected 403 after overwrite, found", code)
+	}
+}
+
+func TestACLCopyObjectDoesNotCopyACL(t *testing.T) {
+	ts := newTestServer(t, withCredentials())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.putObjectWithACL(svc, "src", s3types.ObjectCannedACLPublicRead)
+	_, err := svc.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:     aws.String(defaultBucket),
+		Key:        aws.String("dst"),
+		CopySource: aws.String(defaultBucket + "/src"),
+	})
+	ts.OK(err)
+	if code := ts.anonymousGet("/" + defaultBucket + "/dst"); code != http.StatusForbidden {
+		t.Fatal("expected 403 for copied object, found", code)
+	}
+
+	_, err = svc.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:     aws.String(defaultBucket),
+		Key:        aws.String("dst-public"),
+		CopySource: aws.String(defaultBucket + "/src"),
+		ACL:        s3types.ObjectCannedACLPublicRead,
+	})
+	ts.OK(err)
+	if code := ts.anonymousGet("/" + defaultBucket + "/dst-public"); code != http.StatusOK {
+		t.Fatal("expected 200 for copied public-read object, found", code)
+	}
+}
+
+func TestObjectACLRoundTrip(t *testing.T) {
+	ts := newTestServer(t, withCredentials())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.putObjectWithACL(svc, "object", "")
+
+	out, err := svc.GetObjectAcl(context.TODO(), &s3.GetObjectAclInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+	if len(out.Grants) != 1 || out.Grants[0].Permission != s3types.PermissionFullControl {
+		t.Fatal("expected a single FULL_CONTROL grant, found", out.Grants)
+	}
+	if out.Owner == nil || aws.ToString(out.Owner.ID) == "" {
+		t.Fatal("expected owner")
+	}
+
+	_, err = svc.PutObjectAcl(context.TODO(), &s3.PutObjectAclInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+		AccessControlPolicy: &s3types.AccessControlPolicy{
+			Owner: out.Owner,
+			Grants: []s3types.Grant{
+				{Grantee: out.Grants[0].Grantee, Permission: s3types.PermissionFullControl},
+				{
+					Grantee:    &s3types.Grantee{Type: s3types.TypeGroup, URI: aws.String(gofakes3.AllUsersGroup)},
+					Permission: s3types.PermissionRead,
+				},
+			},
+		},
+	})
+	ts.OK(err)
+
+	out, err = svc.GetObjectAcl(context.TODO(), &s3.GetObjectAclInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+	if !hasGrant(out.Grants, gofakes3.AllUsersGroup, s3types.PermissionRead) {
+		t.Fatal("expected AllUsers READ grant, found", out.Grants)
+	}
+	if code := ts.anonymousGet("/" + defaultBucket + "/object"); code != http.StatusOK {
+		t.Fatal("expected 200 after granting AllUsers READ, found", code)
+	}
+
+	_, err = svc.PutObjectAcl(context.TODO(), &s3.PutObjectAclInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+		ACL:    s3types.ObjectCannedACLPrivate,
+	})
+	ts.OK(err)
+	if code := ts.anonymousGet("/" + defaultBucket + "/object"); code != http.StatusForbidden {
+		t.Fatal("expected 403 after resetting to private, found", code)
+	}
+
+	_, err = svc.GetObjectAcl(context.TODO(), &s3.GetObjectAclInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("missing"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchKey) {
+		t.Fatal("expected NoSuchKey, found", err)
+	}
+}
+
+func TestBucketACL(t *testing.T) {
+	ts := newTestServer(t, withCredentials())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.CreateBucket(context.TODO(), &s3.CreateBucketInput{
+		Bucket: aws.String("public"),
+		ACL:    s3types.BucketCannedACLPublicRead,
+	})
+	ts.OK(err)
+	ts.backendPutString("public", "object", nil, "hello")
+
+	out, err := svc.GetBucketAcl(context.TODO(), &s3.GetBucketAclInput{Bucket: aws.String("public")})
+	ts.OK(err)
+	if !hasGrant(out.Grants, gofakes3.AllUsersGroup, s3types.PermissionRead) {
+		t.Fatal("expected AllUsers READ grant, found", out.Grants)
+	}
+
+	if code := ts.anonymousGet("/public"); code != http.StatusOK {
+		t.Fatal("expected 200 listing public-read bucket, found", code)
+	}
+	// Bucket ACLs do not extend to the objects:
+	if code := ts.anonymousGet("/public/object"); code != http.StatusForbidden {
+		t.Fatal("expected 403 for private object, found", code)
+	}
+
+	_, err = svc.PutBucketAcl(context.TODO(), &s3.PutBucketAclInput{
+		Bucket: aws.String("public"),
+		ACL:    s3types.BucketCannedACLPrivate,
+	})
+	ts.OK(err)
+	if code := ts.anonymousGet("/public"); code != http.StatusForbidden {
+		t.Fatal("expected 403 listing private bucket, found", code)
+	}
+
+	out, err = svc.GetBucketAcl(context.TODO(), &s3.GetBucketAclInput{Bucket: aws.String(defaultBucket)})
+	ts.OK(err)
+	if len(out.Grants) != 1 || out.Grants[0].Permission != s3types.PermissionFullControl {
+		t.Fatal("expected a single FULL_CONTROL grant, found", out.Grants)
+	}
+}
+
+func TestACLInvalid(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.putObjectWithACL(svc, "object", "")
+
+	_, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+		Body:   strings.NewReader("hello"),
+		ACL:    "bogus",
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+		t.Fatal("expected InvalidArgument, found", err)
+	}
+
+	_, err = svc.PutObjectAcl(context.TODO(), &s3.PutObjectAclInput{
+		Bucket:    aws.String(defaultBucket),
+		Key:       aws.String("object"),
+		ACL:       s3types.ObjectCannedACLPublicRead,
+		GrantRead: aws.String(`uri="` + gofakes3.AllUsersGroup + `"`),
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+		t.Fatal("expected InvalidRequest, found", err)
+	}
+
+	_, err = svc.PutObjectAcl(context.TODO(), &s3.PutObjectAclInput{
+		Bucket:    aws.String(defaultBucket),
+		Key:       aws.String("object"),
+		GrantRead: aws.String(`emailAddress="someone@example.com"`),
+	})
+	if !hasErrorCode(err, gofakes3.ErrUnresolvableGrantByEmailAddress) {
+		t.Fatal("expected UnresolvableGrantByEmailAddress, found", err)
+	}
+
+	_, err = svc.PutObjectAcl(context.TODO(), &s3.PutObjectAclInput{
+		Bucket:    aws.String(defaultBucket),
+		Key:       aws.String("object"),
+		GrantRead: aws.String(`uri="http://example.com/not-a-group"`),
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+		t.Fatal("expected InvalidArgument, found", err)
+	}
+}
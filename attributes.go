@@ -0,0 +1,203 @@
+package gofakes3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ObjectAttribute is one of the attributes GetObjectAttributes can be asked
+// for in the x-amz-object-attributes header.
+type ObjectAttribute string
+
+const (
+	ObjectAttributeETag         ObjectAttribute = "ETag"
+	ObjectAttributeChecksum     ObjectAttribute = "Checksum"
+	ObjectAttributeObjectParts  ObjectAttribute = "ObjectParts"
+	ObjectAttributeStorageClass ObjectAttribute = "StorageClass"
+	ObjectAttributeObjectSize   ObjectAttribute = "ObjectSize"
+)
+
+var objectAttributes = []ObjectAttribute{
+	ObjectAttributeETag,
+	ObjectAttributeChecksum,
+	ObjectAttributeObjectParts,
+	ObjectAttributeStorageClass,
+	ObjectAttributeObjectSize,
+}
+
+// The metadata key multipart objects keep the sizes and checksums of their
+// parts in, encoded by encodeObjectParts. It is never returned as a header.
+const partsMetadataKey = "X-Amz-Object-Parts"
+
+// The metadata key multipart objects keep their ETag in, which S3 makes from
+// the MD5s of the parts rather than of the contents. See ObjectETag.
+const multipartETagMetadataKey = "X-Amz-Multipart-Etag"
+
+// isPartsMetadata reports whether the metadata key describes the parts of a
+// multipart object. Such keys are never returned as headers, and are not
+// kept when the object is overwritten or copied.
+func isPartsMetadata(key string) bool {
+	return key == partsMetadataKey || key == multipartETagMetadataKey
+}
+
+// GetObjectAttributesResponse is returned by GetObjectAttributes. Only the
+// attributes the request asks for are set.
+type GetObjectAttributesResponse struct {
+	XMLName      xml.Name                  `xml:"GetObjectAttributesResponse"`
+	Xmlns        string                    `xml:"xmlns,attr"`
+	ETag         string                    `xml:"ETag,omitempty"`
+	Checksum     *ObjectAttributesChecksum `xml:"Checksum,omitempty"`
+	ObjectParts  *GetObjectAttributesParts `xml:"ObjectParts,omitempty"`
+	StorageClass StorageClass              `xml:"StorageClass,omitempty"`
+	ObjectSize   *int64                    `xml:"ObjectSize,omitempty"`
+}
+
+type ObjectAttributesChecksum struct {
+	Checksums
+	ChecksumType ChecksumType `xml:"ChecksumType,omitempty"`
+}
+
+type GetObjectAttributesParts struct {
+	PartsCount           int                    `xml:"PartsCount"`
+	PartNumberMarker     int                    `xml:"PartNumberMarker"`
+	NextPartNumberMarker int                    `xml:"NextPartNumberMarker"`
+	MaxParts             int                    `xml:"MaxParts"`
+	IsTruncated          bool                   `xml:"IsTruncated"`
+	Parts                []ObjectAttributesPart `xml:"Part"`
+}
+
+type ObjectAttributesPart struct {
+	PartNumber int   `xml:"PartNumber"`
+	Size       int64 `xml:"Size"`
+	Checksums
+}
+
+// parseObjectAttributes parses the comma separated list of attributes in the
+// x-amz-object-attributes header.
+func parseObjectAttributes(value string) (map[ObjectAttribute]bool, error) {
+	selected := make(map[ObjectAttribute]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		var found bool
+		for _, attr := range objectAttributes {
+			if strings.EqualFold(name, string(attr)) {
+				selected[attr], found = true, true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrorInvalidArgument("x-amz-object-attributes", value, "Invalid attribute name specified.")
+		}
+	}
+	return selected, nil
+}
+
+// objectPart is a part of a multipart object, as it is kept in the object's
+// metadata.
+type objectPart struct {
+	Number   int
+	Size     int64
+	Checksum string
+}
+
+// encodeObjectParts encodes the parts of a multipart object as a comma
+// separated list of "number:size" or "number:size:checksum".
+func encodeObjectParts(parts []objectPart) string {
+	fields := make([]string, 0, len(parts))
+	for _, part := range parts {
+		field := fmt.Sprintf("%d:%d", part.Number, part.Size)
+		if part.Checksum != "" {
+			field += ":" + part.Checksum
+		}
+		fields = append(fields, field)
+	}
+	return strings.Join(fields, ",")
+}
+
+// objectParts returns the parts of a multipart object, or nil if the object
+// was not uploaded in parts.
+func objectParts(meta map[string]string) ([]objectPart, error) {
+	value, ok := meta[partsMetadataKey]
+	if !ok || value == "" {
+		return nil, nil
+	}
+
+	fields := strings.Split(value, ",")
+	parts := make([]objectPart, 0, len(fields))
+	for _, field := range fields {
+		var part objectPart
+		values := strings.SplitN(field, ":", 3)
+		if len(values) < 2 {
+			return nil, ErrorMessagef(ErrInternal, "invalid part stored in metadata: %q", field)
+		}
+		number, err := strconv.Atoi(values[0])
+		if err != nil {
+			return nil, ErrorMessagef(ErrInternal, "invalid part stored in metadata: %v", err)
+		}
+		size, err := strconv.ParseInt(values[1], 10, 64)
+		if err != nil {
+			return nil, ErrorMessagef(ErrInternal, "invalid part stored in metadata: %v", err)
+		}
+		part.Number, part.Size = number, size
+		if len(values) == 3 {
+			part.Checksum = values[2]
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// parsePartNumber parses the partNumber parameter of a GetObject or
+// HeadObject request, which reads a single part of a multipart object. It
+// returns 0 if the request has none.
+func parsePartNumber(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("partNumber")
+	if value == "" {
+		return 0, nil
+	}
+	partNumber, err := strconv.Atoi(value)
+	if err != nil || partNumber < 1 || partNumber > MaxUploadPartNumber {
+		return 0, ErrorInvalidArgument("partNumber", value, "Part number must be an integer between 1 and 10000, inclusive")
+	}
+	if r.Header.Get("Range") != "" {
+		return 0, ErrorMessage(ErrInvalidRequest, "Cannot specify both Range header and partNumber query parameter")
+	}
+	return partNumber, nil
+}
+
+// objectPartRange returns the range of the contents of an object that holds
+// the part with the given number, counting from 1, for GetObject and
+// HeadObject requests with the partNumber parameter. The part count is 0 if
+// the object was not uploaded in parts, in which case it is read as a single
+// part.
+func objectPartRange(meta map[string]string, size int64, partNumber int) (rnge *ObjectRangeRequest, count int, err error) {
+	parts, err := objectParts(meta)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(parts) == 0 {
+		if partNumber != 1 {
+			return nil, 0, ErrInvalidPartNumber
+		}
+		if size == 0 {
+			return nil, 0, nil
+		}
+		return &ObjectRangeRequest{Start: 0, End: size - 1}, 0, nil
+	}
+	if partNumber > len(parts) {
+		return nil, len(parts), ErrInvalidPartNumber
+	}
+
+	var start int64
+	for _, part := range parts[:partNumber-1] {
+		start += part.Size
+	}
+	part := parts[partNumber-1]
+	if part.Size == 0 {
+		return nil, len(parts), nil
+	}
+	return &ObjectRangeRequest{Start: start, End: start + part.Size - 1}, len(parts), nil
+}
@@ -0,0 +1,222 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/johannesboyne/gofakes3"
+)
+
+var allObjectAttributes = []s3types.ObjectAttributes{
+	s3types.ObjectAttributesEtag,
+	s3types.ObjectAttributesChecksum,
+	s3types.ObjectAttributesObjectParts,
+	s3types.ObjectAttributesStorageClass,
+	s3types.ObjectAttributesObjectSize,
+}
+
+func TestGetObjectAttributes(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:            aws.String(defaultBucket),
+		Key:               aws.String("object"),
+		Body:              strings.NewReader("hello"),
+		ChecksumAlgorithm: s3types.ChecksumAlgorithmCrc32,
+	})
+	ts.OK(err)
+
+	out, err := svc.GetObjectAttributes(context.TODO(), &s3.GetObjectAttributesInput{
+		Bucket:           aws.String(defaultBucket),
+		Key:              aws.String("object"),
+		ObjectAttributes: allObjectAttributes,
+	})
+	ts.OK(err)
+	if aws.ToString(out.ETag) != hashMD5Bytes([]byte("hello")).Hex() {
+		t.Fatal("unexpected ETag", aws.ToString(out.ETag))
+	}
+	if aws.ToInt64(out.ObjectSize) != 5 {
+		t.Fatal("unexpected size", aws.ToInt64(out.ObjectSize))
+	}
+	if out.StorageClass != s3types.StorageClassStandard {
+		t.Fatal("unexpected storage class", out.StorageClass)
+	}
+	if out.Checksum == nil || aws.ToString(out.Checksum.ChecksumCRC32) == "" || out.Checksum.ChecksumType != s3types.ChecksumTypeFullObject {
+		t.Fatal("unexpected checksum", out.Checksum)
+	}
+	if out.ObjectParts != nil {
+		t.Fatal("unexpected parts for a single part object")
+	}
+	if out.LastModified == nil {
+		t.Fatal("missing Last-Modified")
+	}
+
+	// Only the attributes asked for are returned:
+	out, err = svc.GetObjectAttributes(context.TODO(), &s3.GetObjectAttributesInput{
+		Bucket:           aws.String(defaultBucket),
+		Key:              aws.String("object"),
+		ObjectAttributes: []s3types.ObjectAttributes{s3types.ObjectAttributesObjectSize},
+	})
+	ts.OK(err)
+	if out.ETag != nil || out.Checksum != nil || aws.ToInt64(out.ObjectSize) != 5 {
+		t.Fatal("unexpected attributes")
+	}
+
+	_, err = svc.GetObjectAttributes(context.TODO(), &s3.GetObjectAttributesInput{
+		Bucket:           aws.String(defaultBucket),
+		Key:              aws.String("object"),
+		ObjectAttributes: []s3types.ObjectAttributes{"Bogus"},
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+		t.Fatal("expected InvalidArgument, found", err)
+	}
+
+	_, err = svc.GetObjectAttributes(context.TODO(), &s3.GetObjectAttributesInput{
+		Bucket:           aws.String(defaultBucket),
+		Key:              aws.String("missing"),
+		ObjectAttributes: allObjectAttributes,
+	})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchKey) {
+		t.Fatal("expected NoSuchKey, found", err)
+	}
+}
+
+func TestGetObjectAttributesMultipart(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	mpu, err := svc.CreateMultipartUpload(context.TODO(), &s3.CreateMultipartUploadInput{
+		Bucket:            aws.String(defaultBucket),
+		Key:               aws.String("object"),
+		ChecksumAlgorithm: s3types.ChecksumAlgorithmCrc32,
+	})
+	ts.OK(err)
+
+	bodies := []string{"abc", "defg", "hi"}
+	var completed []s3types.CompletedPart
+	for idx, body := range bodies {
+		out, err := svc.UploadPart(context.TODO(), &s3.UploadPartInput{
+			Bucket:            aws.String(defaultBucket),
+			Key:               aws.String("object"),
+			UploadId:          mpu.UploadId,
+			PartNumber:        aws.Int32(int32(idx + 1)),
+			Body:              bytes.NewReader([]byte(body)),
+			ChecksumAlgorithm: s3types.ChecksumAlgorithmCrc32,
+		})
+		ts.OK(err)
+		completed = append(completed, s3types.CompletedPart{
+			ETag:          out.ETag,
+			PartNumber:    aws.Int32(int32(idx + 1)),
+			ChecksumCRC32: out.ChecksumCRC32,
+		})
+	}
+	_, err = svc.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(defaultBucket),
+		Key:             aws.String("object"),
+		UploadId:        mpu.UploadId,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: completed},
+	})
+	ts.OK(err)
+
+	out, err := svc.GetObjectAttributes(context.TODO(), &s3.GetObjectAttributesInput{
+		Bucket:           aws.String(defaultBucket),
+		Key:              aws.String("object"),
+		ObjectAttributes: allObjectAttributes,
+		MaxParts:         aws.Int32(2),
+	})
+	ts.OK(err)
+	if out.Checksum == nil || !strings.HasSuffix(aws.ToString(out.Checksum.ChecksumCRC32), "-3") {
+		t.Fatal("unexpected checksum", out.Checksum)
+	}
+	if aws.ToInt64(out.ObjectSize) != 9 {
+		t.Fatal("unexpected size", aws.ToInt64(out.ObjectSize))
+	}
+
+	parts := out.ObjectParts
+	if parts == nil || aws.ToInt32(parts.TotalPartsCount) != 3 {
+		t.Fatal("expected 3 parts, found", parts)
+	}
+	if len(parts.Parts) != 2 || !aws.ToBool(parts.IsTruncated) || aws.ToString(parts.NextPartNumberMarker) != "2" {
+		t.Fatal("unexpected first page", len(parts.Parts), aws.ToBool(parts.IsTruncated), aws.ToString(parts.NextPartNumberMarker))
+	}
+	for idx, part := range parts.Parts {
+		if aws.ToInt32(part.PartNumber) != int32(idx+1) || aws.ToInt64(part.Size) != int64(len(bodies[idx])) {
+			t.Fatal("unexpected part", idx, aws.ToInt32(part.PartNumber), aws.ToInt64(part.Size))
+		}
+		if aws.ToString(part.ChecksumCRC32) != aws.ToString(completed[idx].ChecksumCRC32) {
+			t.Fatal("unexpected part checksum", idx)
+		}
+	}
+
+	out, err = svc.GetObjectAttributes(context.TODO(), &s3.GetObjectAttributesInput{
+		Bucket:           aws.String(defaultBucket),
+		Key:              aws.String("object"),
+		ObjectAttributes: []s3types.ObjectAttributes{s3types.ObjectAttributesObjectParts},
+		MaxParts:         aws.Int32(2),
+		PartNumberMarker: parts.NextPartNumberMarker,
+	})
+	ts.OK(err)
+	parts = out.ObjectParts
+	if len(parts.Parts) != 1 || aws.ToInt32(parts.Parts[0].PartNumber) != 3 || aws.ToBool(parts.IsTruncated) {
+		t.Fatal("unexpected second page", parts)
+	}
+
+	// The copy of a multipart object is not one:
+	_, err = svc.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:     aws.String(defaultBucket),
+		Key:        aws.String("copy"),
+		CopySource: aws.String(defaultBucket + "/object"),
+	})
+	ts.OK(err)
+	out, err = svc.GetObjectAttributes(context.TODO(), &s3.GetObjectAttributesInput{
+		Bucket:           aws.String(defaultBucket),
+		Key:              aws.String("copy"),
+		ObjectAttributes: allObjectAttributes,
+	})
+	ts.OK(err)
+	if out.ObjectParts != nil || out.Checksum != nil {
+		t.Fatal("unexpected parts or checksum for copy")
+	}
+}
+
+func TestGetObjectAttributesVersion(t *testing.T) {
+	ts := newTestServer(t, withVersioning())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	first, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+		Body:   strings.NewReader("first"),
+	})
+	ts.OK(err)
+	_, err = svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+		Body:   strings.NewReader("second version"),
+	})
+	ts.OK(err)
+
+	out, err := svc.GetObjectAttributes(context.TODO(), &s3.GetObjectAttributesInput{
+		Bucket:           aws.String(defaultBucket),
+		Key:              aws.String("object"),
+		VersionId:        first.VersionId,
+		ObjectAttributes: allObjectAttributes,
+	})
+	ts.OK(err)
+	if aws.ToInt64(out.ObjectSize) != int64(len("first")) {
+		t.Fatal("unexpected size", aws.ToInt64(out.ObjectSize))
+	}
+	if aws.ToString(out.VersionId) != aws.ToString(first.VersionId) {
+		t.Fatal("unexpected version", aws.ToString(out.VersionId))
+	}
+}
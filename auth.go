@@ -0,0 +1,240 @@
+package gofakes3
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CredentialProvider supplies the secret access keys used to verify request
+// signatures. See WithCredentials.
+type CredentialProvider interface {
+	// SecretAccessKey returns the secret paired with the access key ID. If the
+	// access key ID is not known, SecretAccessKey MUST return an error with the
+	// code ErrInvalidAccessKeyID.
+	SecretAccessKey(accessKeyID string) (secret string, err error)
+}
+
+// StaticCredentials is a CredentialProvider that maps access key IDs to
+// secret access keys.
+type StaticCredentials map[string]string
+
+var _ CredentialProvider = StaticCredentials{}
+
+func (s StaticCredentials) SecretAccessKey(accessKeyID string) (string, error) {
+	secret, ok := s[accessKeyID]
+	if !ok {
+		return "", ErrInvalidAccessKeyID
+	}
+	return secret, nil
+}
+
+// authMiddleware verifies the AWS Signature Version 4 of each request before
+// it is routed. It is only installed if WithCredentials was used.
+func (g *GoFakeS3) authMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		// Browsers never sign CORS preflight requests:
+		if rq.Method == http.MethodOptions {
+			handler.ServeHTTP(w, rq)
+			return
+		}
+
+		auth, err := g.authenticate(rq)
+		if err != nil {
+			g.httpError(w, rq, err)
+			return
+		}
+
+		// Anonymous requests are let through, to be authorised against the
+		// bucket's policy and ACLs. Browser uploads are anonymous too, as they
+		// carry their signature in the form:
+		if auth != nil {
+			rq = rq.WithContext(context.WithValue(rq.Context(), requestAuthKey{}, auth))
+		}
+		handler.ServeHTTP(w, rq)
+	})
+}
+
+// requestAuth describes the credentials that a request was signed with. It is
+// attached to the request's context by authMiddleware.
+type requestAuth struct {
+	AccessKeyID string
+
+	// Only set if the payload is sent in signed chunks, i.e. if
+	// X-Amz-Content-Sha256 is STREAMING-AWS4-HMAC-SHA256-PAYLOAD or
+	// STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER.
+	chunkSigner *chunkSigner
+}
+
+type requestAuthKey struct{}
+
+// authFromRequest returns the credentials that rq was signed with, or nil if
+// authentication is not enabled or the request is anonymous.
+func authFromRequest(rq *http.Request) *requestAuth {
+	auth, _ := rq.Context().Value(requestAuthKey{}).(*requestAuth)
+	return auth
+}
+
+// authenticate checks the signature of rq, which may have been sent in the
+// Authorization header, or in the query string if the request was presigned.
+// It returns nil if the request is not signed at all.
+func (g *GoFakeS3) authenticate(rq *http.Request) (*requestAuth, error) {
+	hdr := rq.Header.Get("Authorization")
+	query := rq.URL.Query()
+
+	if query.Has("X-Amz-Algorithm") || query.Has("X-Amz-Signature") {
+		if hdr != "" {
+			return nil, ErrorInvalidArgument("Authorization", hdr,
+				"Only one auth mechanism allowed; only the X-Amz-Algorithm query parameter, Signature query string parameter or the Authorization header should be specified")
+		}
+		return g.authenticatePresigned(rq, query)
+	}
+
+	if hdr == "" {
+		return nil, nil
+	}
+	return g.authenticateHeader(rq, hdr, query)
+}
+
+// authenticateHeader checks the signature in the Authorization header of rq.
+// The signing time is checked against the credential scope, but not against
+// the server's clock; that is left to timeSkewMiddleware, which runs first.
+//
+// If the client has signed the payload's hash, rq.Body is replaced with a
+// reader that fails with ErrXAmzContentSHA256Mismatch if the body doesn't
+// match it.
+func (g *GoFakeS3) authenticateHeader(rq *http.Request, hdr string, query url.Values) (*requestAuth, error) {
+	sig, err := parseSignV4Header(hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sig.parseTime(rq.Header); err != nil {
+		return nil, err
+	}
+
+	payloadHash := rq.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		return nil, ErrorMessage(ErrInvalidRequest, "Missing required header for this request: x-amz-content-sha256")
+	}
+
+	key, err := g.verifySignature(rq, sig, query, payloadHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyPayloadHash(rq, payloadHash); err != nil {
+		return nil, err
+	}
+
+	auth := &requestAuth{AccessKeyID: sig.AccessKeyID}
+	if payloadHash == streamingPayload || payloadHash == streamingPayloadTrailer {
+		auth.chunkSigner = newChunkSigner(sig, key)
+	}
+	return auth, nil
+}
+
+// authenticatePresigned checks the signature in the X-Amz-* query parameters
+// of rq. Instead of the skew limit, presigned requests are checked against
+// X-Amz-Expires using the server's TimeSource.
+func (g *GoFakeS3) authenticatePresigned(rq *http.Request, query url.Values) (*requestAuth, error) {
+	sig, err := parseSignV4Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	now := g.timeSource.Now()
+	if expiresAt := sig.Time.Add(sig.Expires); now.After(expiresAt) {
+		return nil, requestExpired(sig.Expires, expiresAt, now)
+	}
+	if g.timeSkew != 0 && sig.Time.Sub(now) > g.timeSkew {
+		return nil, ErrorMessage(ErrAccessDenied, "Request is not valid yet")
+	}
+
+	// Presigned URLs can't know the hash of the payload they will be used to
+	// upload, unless the client chose to sign one in the query string:
+	payloadHash := query.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = unsignedPayload
+	}
+
+	// The signature can't be part of the request that it signs:
+	signedQuery := make(url.Values, len(query))
+	for k, v := range query {
+		signedQuery[k] = v
+	}
+	signedQuery.Del("X-Amz-Signature")
+
+	if _, err := g.verifySignature(rq, sig, signedQuery, payloadHash); err != nil {
+		return nil, err
+	}
+	if err := verifyPayloadHash(rq, payloadHash); err != nil {
+		return nil, err
+	}
+	return &requestAuth{AccessKeyID: sig.AccessKeyID}, nil
+}
+
+// verifySignature checks sig against rq, returning the signing key if the
+// signature is valid.
+func (g *GoFakeS3) verifySignature(rq *http.Request, sig *signatureV4, query url.Values, payloadHash string) ([]byte, error) {
+	secret, err := g.credentials.SecretAccessKey(sig.AccessKeyID)
+	if HasErrorCode(err, ErrInvalidAccessKeyID) {
+		return nil, invalidAccessKeyID(sig.AccessKeyID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	key := signingKey(secret, sig.Scope)
+	if err := sig.verify(rq, query, key, payloadHash); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// verifyPayloadHash replaces rq.Body with a reader that checks the body
+// against payloadHash, unless the payload is unsigned or is sent in signed
+// chunks.
+func verifyPayloadHash(rq *http.Request, payloadHash string) error {
+	if payloadHash == unsignedPayload || strings.HasPrefix(payloadHash, "STREAMING-") {
+		return nil
+	}
+	rdr, err := newContentSHA256Reader(rq.Body, payloadHash)
+	if err != nil {
+		return err
+	}
+	rq.Body = &readCloser{rdr, rq.Body}
+	return nil
+}
+
+// parseTime assigns the signing time from the X-Amz-Date header, or the Date
+// header if X-Amz-Date is not present.
+func (sig *signatureV4) parseTime(hdr http.Header) (err error) {
+	if amzDate := hdr.Get("X-Amz-Date"); amzDate != "" {
+		sig.Time, err = time.Parse(signV4TimeFormat, amzDate)
+		sig.TimeText = amzDate
+
+	} else if date := hdr.Get("Date"); date != "" {
+		sig.Time, err = http.ParseTime(date)
+		sig.TimeText = sig.Time.UTC().Format(signV4TimeFormat)
+	}
+
+	if err != nil || sig.Time.IsZero() {
+		return ErrorMessage(ErrAccessDenied, "AWS authentication requires a valid Date or x-amz-date header")
+	}
+
+	if sig.Time.UTC().Format(signV4ScopeFormat) != sig.Scope.Date {
+		return ErrorMessagef(ErrAuthorizationHeaderMalformed,
+			"The authorization header is malformed; Invalid credential date %q. Date is not the same as X-Amz-Date: %q.", sig.Scope.Date, sig.TimeText)
+	}
+
+	return nil
+}
+
+// readCloser replaces the Reader of an io.ReadCloser while keeping its Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
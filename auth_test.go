@@ -0,0 +1,300 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/johannesboyne/gofakes3"
+)
+
+var testCredentials = gofakes3.StaticCredentials{
+	"dummy-access": "dummy-secret",
+}
+
+func withCredentials() testServerOption {
+	return withFakerOptions(gofakes3.WithCredentials(testCredentials))
+}
+
+func TestAuthSignedRequest(t *testing.T) {
+	ts := newTestServer(t, withCredentials())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("dir/file with spaces+plus"),
+		Body:   bytes.NewReader([]byte("hello")),
+	})
+	ts.OK(err)
+
+	out, err := svc.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("dir/file with spaces+plus"),
+	})
+	ts.OK(err)
+	defer out.Body.Close()
+	body, err := io.ReadAll(out.Body)
+	ts.OK(err)
+	if string(body) != "hello" {
+		t.Fatal("unexpected body", string(body))
+	}
+
+	list, err := svc.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
+		Bucket: aws.String(defaultBucket),
+		Prefix: aws.String("dir/"),
+	})
+	ts.OK(err)
+	if len(list.Contents) != 1 {
+		t.Fatal("expected 1 object, found", len(list.Contents))
+	}
+}
+
+func TestAuthSignedRequestHostBucket(t *testing.T) {
+	ts := newTestServer(t, withCredentials(), withHostBucket())
+	defer ts.Close()
+	ts.backendPutString(defaultBucket, "dir/object", nil, "hello")
+
+	rq, err := http.NewRequest("GET", ts.server.URL+"/dir/object", nil)
+	ts.OK(err)
+	rq.Host = defaultBucket + ".localhost"
+
+	const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	rq.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+	creds := aws.Credentials{AccessKeyID: "dummy-access", SecretAccessKey: "dummy-secret"}
+	ts.OK(v4.NewSigner().SignHTTP(context.TODO(), creds, rq, emptySHA256, "s3", "region", time.Now()))
+
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	ts.OK(err)
+	if rs.StatusCode != http.StatusOK || string(body) != "hello" {
+		t.Fatal("unexpected response", rs.StatusCode, string(body))
+	}
+}
+
+func TestAuthWrongSecret(t *testing.T) {
+	ts := newTestServer(t, withCredentials())
+	defer ts.Close()
+	svc := ts.s3ClientWithCredentials("dummy-access", "wrong-secret")
+
+	_, err := svc.ListBuckets(context.TODO(), &s3.ListBucketsInput{})
+	if !hasErrorCode(err, gofakes3.ErrSignatureDoesNotMatch) {
+		t.Fatal("expected SignatureDoesNotMatch, found", err)
+	}
+}
+
+func TestAuthUnknownAccessKey(t *testing.T) {
+	ts := newTestServer(t, withCredentials())
+	defer ts.Close()
+	svc := ts.s3ClientWithCredentials("unknown-access", "dummy-secret")
+
+	_, err := svc.ListBuckets(context.TODO(), &s3.ListBucketsInput{})
+	if !hasErrorCode(err, gofakes3.ErrInvalidAccessKeyID) {
+		t.Fatal("expected InvalidAccessKeyId, found", err)
+	}
+}
+
+func TestAuthAnonymousDenied(t *testing.T) {
+	ts := newTestServer(t, withCredentials())
+	defer ts.Close()
+	ts.backendPutString(defaultBucket, "object", nil, "hello")
+
+	rs, err := httpClient().Get(ts.url("/" + defaultBucket + "/object"))
+	ts.OK(err)
+	defer rs.Body.Close()
+	if rs.StatusCode != http.StatusForbidden {
+		t.Fatal("expected 403, found", rs.StatusCode)
+	}
+}
+
+func TestAuthDisabledByDefault(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3ClientWithCredentials("anything", "goes")
+
+	_, err := svc.ListBuckets(context.TODO(), &s3.ListBucketsInput{})
+	ts.OK(err)
+}
+
+func TestAuthPresigned(t *testing.T) {
+	timeSource := gofakes3.FixedTimeSource(time.Now().UTC())
+	ts := newTestServer(t, withCredentials(), withTimeSource(timeSource))
+	defer ts.Close()
+	presigner := s3.NewPresignClient(ts.s3Client())
+
+	put, err := presigner.PresignPutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	}, s3.WithPresignExpires(time.Minute))
+	ts.OK(err)
+
+	rq, err := http.NewRequest(put.Method, put.URL, bytes.NewReader([]byte("hello")))
+	ts.OK(err)
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+
+	get, err := presigner.PresignGetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket:              aws.String(defaultBucket),
+		Key:                 aws.String("object"),
+		ResponseContentType: aws.String("text/x-presigned"),
+	}, s3.WithPresignExpires(time.Minute))
+	ts.OK(err)
+
+	rs, err = httpClient().Get(get.URL)
+	ts.OK(err)
+	body, err := io.ReadAll(rs.Body)
+	rs.Body.Close()
+	ts.OK(err)
+	if rs.StatusCode != http.StatusOK || string(body) != "hello" {
+		t.Fatal("unexpected response", rs.StatusCode, string(body))
+	}
+	if ct := rs.Header.Get("Content-Type"); ct != "text/x-presigned" {
+		t.Fatal("response-content-type override was not applied, found", ct)
+	}
+
+	// Tampering with any signed part of the request invalidates it:
+	rs, err = httpClient().Get(strings.Replace(get.URL, "x-presigned", "x-tampered", 1))
+	ts.OK(err)
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusForbidden {
+		t.Fatal("expected 403 for tampered request, found", rs.StatusCode)
+	}
+
+	timeSource.Advance(2 * time.Minute)
+	rs, err = httpClient().Get(get.URL)
+	ts.OK(err)
+	body, err = io.ReadAll(rs.Body)
+	rs.Body.Close()
+	ts.OK(err)
+	if rs.StatusCode != http.StatusForbidden || !strings.Contains(string(body), "Request has expired") {
+		t.Fatal("expected expired request, found", rs.StatusCode, string(body))
+	}
+}
+
+// streamingRequest builds a STREAMING-AWS4-HMAC-SHA256-PAYLOAD request that
+// sends each of the chunks with its own signature. If tamper is set, the last
+// byte of the final data chunk is changed after it has been signed.
+func (ts *testServer) streamingRequest(method, rqpath string, chunks []string, tamper bool) *http.Request {
+	ts.Helper()
+
+	encode := func(signatures []string) []byte {
+		var buf bytes.Buffer
+		for i, chunk := range append(chunks, "") {
+			fmt.Fprintf(&buf, "%x;chunk-signature=%s\r\n%s\r\n", len(chunk), signatures[i], chunk)
+		}
+		return buf.Bytes()
+	}
+
+	var decodedSize int
+	placeholders := make([]string, len(chunks)+1)
+	for i := range placeholders {
+		placeholders[i] = strings.Repeat("0", 64)
+	}
+	for _, chunk := range chunks {
+		decodedSize += len(chunk)
+	}
+
+	rq, err := http.NewRequest(method, ts.url(rqpath), nil)
+	ts.OK(err)
+	rq.ContentLength = int64(len(encode(placeholders)))
+	rq.Header.Set("Content-Encoding", "aws-chunked")
+	rq.Header.Set("X-Amz-Content-Sha256", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD")
+	rq.Header.Set("X-Amz-Decoded-Content-Length", strconv.Itoa(decodedSize))
+
+	signedAt := time.Now()
+	creds := aws.Credentials{AccessKeyID: "dummy-access", SecretAccessKey: "dummy-secret"}
+	ts.OK(v4.NewSigner().SignHTTP(context.TODO(), creds, rq, "STREAMING-AWS4-HMAC-SHA256-PAYLOAD", "s3", "region", signedAt))
+
+	auth := rq.Header.Get("Authorization")
+	seed, err := hex.DecodeString(auth[strings.LastIndex(auth, "=")+1:])
+	ts.OK(err)
+
+	signer := v4.NewStreamSigner(creds, "s3", "region", seed)
+	signatures := make([]string, 0, len(chunks)+1)
+	for _, chunk := range append(chunks, "") {
+		sig, err := signer.GetSignature(context.TODO(), nil, []byte(chunk), signedAt)
+		ts.OK(err)
+		signatures = append(signatures, hex.EncodeToString(sig))
+	}
+
+	body := encode(signatures)
+	if tamper {
+		// The final chunk is empty, so the last data byte precedes its header
+		// and the data chunk's trailing "\r\n":
+		last := bytes.LastIndex(body, []byte("\r\n0;")) - 1
+		body[last]++
+	}
+	rq.Body = io.NopCloser(bytes.NewReader(body))
+	return rq
+}
+
+func TestAuthStreamingUpload(t *testing.T) {
+	ts := newTestServer(t, withCredentials())
+	defer ts.Close()
+	chunks := []string{strings.Repeat("a", 8192), strings.Repeat("b", 100)}
+
+	rs, err := httpClient().Do(ts.streamingRequest("PUT", "/"+defaultBucket+"/object", chunks, false))
+	ts.OK(err)
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	ts.assertObject(defaultBucket, "object", nil, strings.Join(chunks, ""))
+
+	rs, err = httpClient().Do(ts.streamingRequest("PUT", "/"+defaultBucket+"/tampered", chunks, true))
+	ts.OK(err)
+	body, err := io.ReadAll(rs.Body)
+	rs.Body.Close()
+	ts.OK(err)
+	if rs.StatusCode != http.StatusForbidden || !strings.Contains(string(body), string(gofakes3.ErrSignatureDoesNotMatch)) {
+		t.Fatal("expected SignatureDoesNotMatch, found", rs.StatusCode, string(body))
+	}
+	if exists, _ := ts.backendObjectExists(defaultBucket, "tampered"); exists {
+		t.Fatal("tampered object should not have been stored")
+	}
+}
+
+func TestAuthStreamingUploadPart(t *testing.T) {
+	ts := newTestServer(t, withCredentials())
+	defer ts.Close()
+	chunks := []string{strings.Repeat("a", 8192), strings.Repeat("b", 100)}
+	uploadID := ts.createMultipartUpload(defaultBucket, "object", nil)
+	partPath := "/" + defaultBucket + "/object?partNumber=1&uploadId=" + uploadID
+
+	rs, err := httpClient().Do(ts.streamingRequest("PUT", partPath, chunks, true))
+	ts.OK(err)
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusForbidden {
+		t.Fatal("expected 403 for tampered part, found", rs.StatusCode)
+	}
+
+	rs, err = httpClient().Do(ts.streamingRequest("PUT", partPath, chunks, false))
+	ts.OK(err)
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+
+	etag := rs.Header.Get("ETag")
+	ts.assertCompleteUpload(defaultBucket, "object", uploadID, []s3types.CompletedPart{
+		{ETag: aws.String(etag), PartNumber: aws.Int32(1)},
+	}, []byte(strings.Join(chunks, "")))
+}
@@ -0,0 +1,338 @@
+package gofakes3
+
+import (
+	"net/http"
+	"strings"
+)
+
+// authorizeRoute authorises a request before routeBase dispatches it. Requests
+// that act on several objects are authorised by their handlers instead, but
+// are still subject to the x-amz-expected-bucket-owner header.
+func (g *GoFakeS3) authorizeRoute(r *http.Request, bucket, object string) error {
+	if action := policyAction(r, bucket, object); action != "" {
+		if err := g.authorize(r, action, bucket, object); err != nil {
+			return err
+		}
+	} else if bucket == "" && g.isAnonymous(r) {
+		// Anonymous callers own no buckets to list:
+		return ErrorMessage(ErrAccessDenied, ErrAccessDenied.Message())
+	}
+	return g.checkExpectedBucketOwner(bucket, r.Header.Get("x-amz-expected-bucket-owner"))
+}
+
+// authorize returns ErrAccessDenied unless the caller of r may perform the
+// action on the bucket, or on the object if one is given. This follows S3's
+// evaluation logic, simplified so that every user of an account has full
+// access to the account's buckets:
+//
+//   - An explicit Deny in the bucket policy denies the request.
+//   - An Allow in the bucket policy, or a grant in the ACL, allows it.
+//   - Requests from the account that owns the bucket are allowed, unless the
+//     bucket has a policy, which then denies them implicitly.
+//   - Other requests are denied, including anonymous requests, which are only
+//     possible if authentication is enabled.
+//
+// The owner may always manage a bucket's policy unless a statement explicitly
+// denies it, as in S3, so that a policy can't lock everyone out of the
+// bucket. Requests to create a bucket that exists, and requests for buckets
+// that do not, are left to the handler to report, apart from anonymous
+// attempts to create one.
+func (g *GoFakeS3) authorize(r *http.Request, action, bucket, object string) error {
+	accessKeyID := g.requestAccessKeyID(r)
+	requester, err := g.requestOwner(r)
+	if err != nil {
+		return err
+	}
+
+	owner, err := g.bucketOwner(bucket)
+	if HasErrorCode(err, ErrNoSuchBucket) {
+		if requester.ID == "" && action == "s3:CreateBucket" {
+			return ErrorMessage(ErrAccessDenied, ErrAccessDenied.Message())
+		}
+		return nil
+	} else if err != nil {
+		return err
+	} else if action == "s3:CreateBucket" {
+		// The bucket is taken; the handler reports by whom:
+		return nil
+	}
+	isOwner := requester.ID != "" && requester.ID == owner.ID
+
+	raw, err := g.policies.BucketPolicy(bucket)
+	hasPolicy := !HasErrorCode(err, ErrNoSuchBucketPolicy)
+	if hasPolicy && err != nil {
+		return err
+	}
+
+	if hasPolicy {
+		policy, err := parseBucketPolicy(bucket, raw)
+		if err != nil {
+			return err
+		}
+
+		decision := policy.evaluate(&policyRequest{
+			AccessKeyID:     accessKeyID,
+			CanonicalUserID: requester.ID,
+			Action:          action,
+			Resource:        policyResourceARN(bucket, object),
+			Context:         g.policyContext(r),
+		})
+		switch decision {
+		case policyAllowed:
+			return nil
+		case policyExplicitDeny:
+			g.log.Print(LogInfo, "policy denied", action, "on", policyResourceARN(bucket, object))
+			return ErrorMessage(ErrAccessDenied, ErrAccessDenied.Message())
+		}
+	} else if isOwner {
+		return nil
+	}
+
+	if allowed, err := g.aclAllows(r, aclRequester{ID: requester.ID}, action, bucket, object); err != nil {
+		return err
+	} else if allowed {
+		return nil
+	}
+
+	if isOwner && isBucketPolicyAction(action) {
+		return nil
+	}
+
+	g.log.Print(LogInfo, "denied", action, "on", policyResourceARN(bucket, object))
+	return ErrorMessage(ErrAccessDenied, ErrAccessDenied.Message())
+}
+
+// isAnonymous reports whether authentication is enabled, but the request was
+// not signed.
+func (g *GoFakeS3) isAnonymous(r *http.Request) bool {
+	return g.credentials != nil && g.requestAccessKeyID(r) == ""
+}
+
+func isBucketPolicyAction(action string) bool {
+	switch action {
+	case "s3:GetBucketPolicy", "s3:PutBucketPolicy", "s3:DeleteBucketPolicy":
+		return true
+	}
+	return false
+}
+
+// requestAccessKeyID returns the access key ID a policy's principals are
+// matched against. If authentication is disabled, the access key ID is taken
+// from the request's signature without checking it, so that policies can be
+// tested with any client.
+func (g *GoFakeS3) requestAccessKeyID(r *http.Request) string {
+	if auth := authFromRequest(r); auth != nil {
+		return auth.AccessKeyID
+	}
+
+	// Browser uploads carry their credential in the form, which is checked by
+	// verifyPostPolicySignature when authentication is enabled:
+	if r.MultipartForm != nil {
+		for name, values := range r.MultipartForm.Value {
+			if strings.EqualFold(name, "x-amz-credential") {
+				accessKeyID, _, _ := strings.Cut(values[0], "/")
+				return accessKeyID
+			}
+		}
+	}
+
+	if g.credentials != nil {
+		return ""
+	}
+
+	if hdr := r.Header.Get("Authorization"); hdr != "" {
+		if sig, err := parseSignV4Header(hdr); err == nil {
+			return sig.AccessKeyID
+		}
+	} else if credential := r.URL.Query().Get("X-Amz-Credential"); credential != "" {
+		accessKeyID, _, _ := strings.Cut(credential, "/")
+		return accessKeyID
+	}
+	return ""
+}
+
+// policyAction returns the IAM action that authorises the request, as listed
+// here:
+// https://docs.aws.amazon.com/service-authorization/latest/reference/list_amazons3.html
+//
+// It returns an empty string for requests that are not made against a bucket,
+// and for requests that act on several objects, which are authorised by their
+// handlers. The cases follow the order of routeBase.
+func policyAction(r *http.Request, bucket, object string) string {
+	if bucket == "" {
+		return ""
+	}
+
+	query := r.URL.Query()
+	has := func(key string) bool {
+		_, ok := query[key]
+		return ok
+	}
+
+	switch {
+	case query.Get("uploadId") != "":
+		switch r.Method {
+		case "GET":
+			return "s3:ListMultipartUploadParts"
+		case "PUT", "POST":
+			return "s3:PutObject"
+		case "DELETE":
+			return "s3:AbortMultipartUpload"
+		}
+
+	case has("uploads"):
+		switch r.Method {
+		case "GET":
+			return "s3:ListBucketMultipartUploads"
+		case "POST":
+			return "s3:PutObject"
+		}
+
+	case has("policy"):
+		switch r.Method {
+		case "GET":
+			return "s3:GetBucketPolicy"
+		case "PUT":
+			return "s3:PutBucketPolicy"
+		case "DELETE":
+			return "s3:DeleteBucketPolicy"
+		}
+
+	case has("encryption") && object == "":
+		switch r.Method {
+		case "GET":
+			return "s3:GetEncryptionConfiguration"
+		case "PUT", "DELETE":
+			return "s3:PutEncryptionConfiguration"
+		}
+
+	case has("lifecycle") && object == "":
+		switch r.Method {
+		case "GET":
+			return "s3:GetLifecycleConfiguration"
+		case "PUT", "DELETE":
+			return "s3:PutLifecycleConfiguration"
+		}
+
+	case has("object-lock") && object == "":
+		switch r.Method {
+		case "GET":
+			return "s3:GetBucketObjectLockConfiguration"
+		case "PUT":
+			return "s3:PutBucketObjectLockConfiguration"
+		}
+
+	case has("retention") && object != "":
+		switch r.Method {
+		case "GET":
+			return "s3:GetObjectRetention"
+		case "PUT":
+			return "s3:PutObjectRetention"
+		}
+
+	case has("legal-hold") && object != "":
+		switch r.Method {
+		case "GET":
+			return "s3:GetObjectLegalHold"
+		case "PUT":
+			return "s3:PutObjectLegalHold"
+		}
+
+	case has("restore") && object != "" && r.Method == "POST":
+		return "s3:RestoreObject"
+
+	case has("acl"):
+		versioned := versionFromQuery(query["versionId"]) != ""
+		switch {
+		case object == "" && r.Method == "GET":
+			return "s3:GetBucketAcl"
+		case object == "" && r.Method == "PUT":
+			return "s3:PutBucketAcl"
+		case r.Method == "GET" && versioned:
+			return "s3:GetObjectVersionAcl"
+		case r.Method == "GET":
+			return "s3:GetObjectAcl"
+		case r.Method == "PUT" && versioned:
+			return "s3:PutObjectVersionAcl"
+		case r.Method == "PUT":
+			return "s3:PutObjectAcl"
+		}
+
+	case has("tagging") && object != "":
+		versioned := versionFromQuery(query["versionId"]) != ""
+		switch {
+		case r.Method == "GET" && versioned:
+			return "s3:GetObjectVersionTagging"
+		case r.Method == "GET":
+			return "s3:GetObjectTagging"
+		case r.Method == "PUT" && versioned:
+			return "s3:PutObjectVersionTagging"
+		case r.Method == "PUT":
+			return "s3:PutObjectTagging"
+		case r.Method == "DELETE" && versioned:
+			return "s3:DeleteObjectVersionTagging"
+		case r.Method == "DELETE":
+			return "s3:DeleteObjectTagging"
+		}
+
+	case has("attributes") && object != "" && r.Method == "GET":
+		if versionFromQuery(query["versionId"]) != "" {
+			return "s3:GetObjectVersionAttributes"
+		}
+		return "s3:GetObjectAttributes"
+
+	case has("versioning"):
+		switch r.Method {
+		case "GET":
+			return "s3:GetBucketVersioning"
+		case "PUT":
+			return "s3:PutBucketVersioning"
+		}
+
+	case has("versions"):
+		return "s3:ListBucketVersions"
+
+	case versionFromQuery(query["versionId"]) != "":
+		switch r.Method {
+		case "GET", "HEAD":
+			return "s3:GetObjectVersion"
+		case "DELETE":
+			return "s3:DeleteObjectVersion"
+		}
+
+	case object != "":
+		switch r.Method {
+		case "GET", "HEAD":
+			return "s3:GetObject"
+		case "PUT":
+			return "s3:PutObject"
+		case "DELETE":
+			return "s3:DeleteObject"
+		}
+
+	case has("tagging"):
+		switch r.Method {
+		case "GET":
+			return "s3:GetBucketTagging"
+		case "PUT", "DELETE":
+			return "s3:PutBucketTagging"
+		}
+
+	default:
+		switch r.Method {
+		case "GET":
+			if has("location") {
+				return "s3:GetBucketLocation"
+			}
+			return "s3:ListBucket"
+		case "HEAD":
+			return "s3:ListBucket"
+		case "PUT":
+			return "s3:CreateBucket"
+		case "DELETE":
+			return "s3:DeleteBucket"
+		}
+	}
+
+	return ""
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 
 	"io"
+	"strings"
 	"time"
 )
 
@@ -24,6 +25,11 @@ type Object struct {
 	Hash     []byte
 	Range    *ObjectRange
 
+	// LastModified is when the object was last written. It may be zero if
+	// the backend does not record it, in which case the Last-Modified time
+	// GoFakeS3 keeps in the metadata is used.
+	LastModified time.Time
+
 	// VersionID will be empty if bucket versioning has not been enabled.
 	VersionID VersionID
 
@@ -141,8 +147,26 @@ type PutConditions struct {
 	IfNoneMatch *string
 }
 
+// DeleteConditions represents the conditional headers for S3 DeleteObject
+// operations, and the conditions of each object of a DeleteObjects request.
+// These conditions are checked atomically before deleting the object.
+type DeleteConditions struct {
+	// IfMatch specifies that the object should only be deleted if its ETag
+	// matches this value.
+	IfMatch *string
+
+	// IfMatchLastModifiedTime specifies that the object should only be
+	// deleted if it was last modified at this time, to the second.
+	IfMatchLastModifiedTime *time.Time
+
+	// IfMatchSize specifies that the object should only be deleted if it has
+	// this size in bytes.
+	IfMatchSize *int64
+}
+
 // ConditionalObjectInfo represents the current state of an object for conditional checking.
-// Backends should provide this information to the shared CheckPutConditions function.
+// Backends should provide this information to the shared CheckPutConditions
+// and CheckDeleteConditions functions.
 type ConditionalObjectInfo struct {
 	// Exists indicates whether the object exists
 	Exists bool
@@ -150,6 +174,18 @@ type ConditionalObjectInfo struct {
 	// Hash is the MD5 hash of the object content (used for ETag comparison)
 	// Only required if Exists is true
 	Hash []byte
+
+	// Size is the size of the object content, which CheckDeleteConditions
+	// compares.
+	Size int64
+
+	// LastModified is when the object was last modified. It may be zero if
+	// Metadata holds the Last-Modified time GoFakeS3 stores.
+	LastModified time.Time
+
+	// Metadata is the metadata of the object, which holds the ETag of
+	// objects uploaded in parts. See ObjectETag.
+	Metadata map[string]string
 }
 
 // ObjectInfo is a deprecated alias for ConditionalObjectInfo.
@@ -161,6 +197,18 @@ func FormatETag(hash []byte) string {
 	return `"` + hex.EncodeToString(hash) + `"`
 }
 
+// ObjectETag returns the ETag of an object with the given hash and metadata.
+// This is the formatted hash, except for objects uploaded in parts: as in S3,
+// their ETag is the MD5 of the MD5s of the parts followed by the number of
+// parts, which CompleteMultipartUpload keeps in the metadata. Backends should
+// use it wherever they report the ETag of an object.
+func ObjectETag(hash []byte, meta map[string]string) string {
+	if etag := meta[multipartETagMetadataKey]; etag != "" {
+		return etag
+	}
+	return FormatETag(hash)
+}
+
 // CheckPutConditions validates conditional headers for PutObject operations.
 // This is a shared implementation that all backends can use.
 func CheckPutConditions(conditions *PutConditions, objectInfo *ConditionalObjectInfo) error {
@@ -181,7 +229,7 @@ func CheckPutConditions(conditions *PutConditions, objectInfo *ConditionalObject
 		if len(expectedETag) >= 2 && expectedETag[0] == '"' && expectedETag[len(expectedETag)-1] == '"' {
 			expectedETag = expectedETag[1 : len(expectedETag)-1]
 		}
-		actualETag := hex.EncodeToString(objectInfo.Hash)
+		actualETag := strings.Trim(ObjectETag(objectInfo.Hash, objectInfo.Metadata), `"`)
 		if expectedETag != actualETag {
 			return ErrorMessage(ErrPreconditionFailed, "The ETag does not match")
 		}
@@ -190,6 +238,36 @@ func CheckPutConditions(conditions *PutConditions, objectInfo *ConditionalObject
 	return nil
 }
 
+// CheckDeleteConditions validates conditional headers for DeleteObject
+// operations. This is a shared implementation that all backends can use.
+func CheckDeleteConditions(conditions *DeleteConditions, objectInfo *ConditionalObjectInfo) error {
+	if conditions.IfMatch == nil && conditions.IfMatchLastModifiedTime == nil && conditions.IfMatchSize == nil {
+		return nil
+	}
+	if !objectInfo.Exists {
+		return ErrorMessage(ErrPreconditionFailed, "The object does not exist")
+	}
+
+	if conditions.IfMatch != nil {
+		if !etagsMatch(*conditions.IfMatch, ObjectETag(objectInfo.Hash, objectInfo.Metadata), false) {
+			return ErrorMessage(ErrPreconditionFailed, "The ETag does not match")
+		}
+	}
+
+	if conditions.IfMatchLastModifiedTime != nil {
+		lastModified := objectLastModified(&Object{Metadata: objectInfo.Metadata, LastModified: objectInfo.LastModified})
+		if !conditions.IfMatchLastModifiedTime.Truncate(time.Second).Equal(lastModified) {
+			return ErrorMessage(ErrPreconditionFailed, "The last modified time does not match")
+		}
+	}
+
+	if conditions.IfMatchSize != nil && *conditions.IfMatchSize != objectInfo.Size {
+		return ErrorMessage(ErrPreconditionFailed, "The size does not match")
+	}
+
+	return nil
+}
+
 // Backend provides a set of operations to be implemented in order to support
 // gofakes3.
 //
@@ -289,7 +367,6 @@ type Backend interface {
 	//	Removes the null version (if there is one) of an object and inserts a
 	//	delete marker, which becomes the latest version of the object. If there
 	//	isn't a null version, Amazon S3 does not remove any objects.
-	//
 	DeleteObject(bucketName, objectName string) (ObjectDeleteResult, error)
 
 	// PutObject should assume that the key is valid. The map containing meta
@@ -298,6 +375,9 @@ type Backend interface {
 	// The size can be used if the backend needs to read the whole reader; use
 	// gofakes3.ReadAll() for this job rather than ioutil.ReadAll().
 	//
+	// The checksum of the object is added to meta once input returns io.EOF,
+	// so meta must not be stored before the whole input has been read.
+	//
 	// If conditions is not nil, the backend should check the conditions before
 	// writing the object. If conditions fail, it should return ErrPreconditionFailed
 	// or ErrConditionalRequestConflict as appropriate.
@@ -385,11 +465,56 @@ type VersionedBackend interface {
 	ListBucketVersions(bucketName string, prefix *Prefix, page *ListBucketVersionsPage) (*ListBucketVersionsResult, error)
 }
 
+// ConditionalDeleteBackend may be optionally implemented by a Backend in order
+// to support the If-Match, x-amz-if-match-last-modified-time and
+// x-amz-if-match-size headers of DeleteObject, and the conditions of the
+// objects in a DeleteObjects request.
+//
+// If you don't implement ConditionalDeleteBackend, conditional deletes return
+// ErrNotImplemented.
+type ConditionalDeleteBackend interface {
+	// DeleteObjectConditional deletes an object as DeleteObject does, but
+	// only if the current version of the object matches the conditions. The
+	// conditions must be checked with CheckDeleteConditions under the same
+	// lock or transaction that deletes the object. If they fail,
+	// DeleteObjectConditional must return ErrPreconditionFailed.
+	DeleteObjectConditional(bucketName, objectName string, conditions *DeleteConditions) (ObjectDeleteResult, error)
+}
+
+// ConditionalVersionDeleteBackend may be optionally implemented by a
+// VersionedBackend in order to support conditional requests to delete a
+// specific object version.
+//
+// If you don't implement ConditionalVersionDeleteBackend, such requests
+// return ErrNotImplemented.
+type ConditionalVersionDeleteBackend interface {
+	// DeleteObjectVersionConditional deletes an object version as
+	// DeleteObjectVersion does, but only if the version matches the
+	// conditions, which are checked as DeleteObjectConditional checks them.
+	DeleteObjectVersionConditional(bucketName, objectName string, versionID VersionID, conditions *DeleteConditions) (ObjectDeleteResult, error)
+}
+
+// ConditionalCopyBackend may be optionally implemented by a Backend in order
+// to check the If-Match and If-None-Match headers of CopyObject as it copies
+// the object.
+//
+// If you don't implement ConditionalCopyBackend, conditional copies are made
+// by reading the source and writing it with PutObject, which checks them.
+type ConditionalCopyBackend interface {
+	// CopyObjectConditional copies an object as CopyObject does, but only if
+	// the destination matches the conditions, which are checked as PutObject
+	// checks them.
+	CopyObjectConditional(srcBucket, srcKey, dstBucket, dstKey string, meta map[string]string, conditions *PutConditions) (CopyObjectResult, error)
+}
+
 // MultipartBackend may be optionally implemented by a Backend in order to
 // support S3 multiplart uploads.
 // If you don't implement MultipartBackend, GoFakeS3 will fall back to an
 // in-memory implementation which holds all parts in memory until the upload
 // gets finalised and pushed to the backend.
+//
+// Uploads encrypted with customer-provided keys (SSE-C) are only supported by
+// the in-memory implementation.
 type MultipartBackend interface {
 	CreateMultipartUpload(bucket, object string, meta map[string]string) (UploadID, error)
 	UploadPart(bucket, object string, id UploadID, partNumber int, contentLength int64, input io.Reader) (etag string, err error)
@@ -401,17 +526,212 @@ type MultipartBackend interface {
 	CompleteMultipartUpload(bucket, object string, id UploadID, input *CompleteMultipartUploadRequest) (versionID VersionID, etag string, err error)
 }
 
+// ConditionalMultipartBackend may be optionally implemented by a
+// MultipartBackend in order to support the If-Match and If-None-Match headers
+// of CompleteMultipartUpload.
+//
+// If you don't implement ConditionalMultipartBackend, conditional requests to
+// complete an upload return ErrNotImplemented.
+type ConditionalMultipartBackend interface {
+	// CompleteMultipartUploadConditional completes an upload as
+	// CompleteMultipartUpload does, but only if the object the upload
+	// replaces matches the conditions, which are checked as PutObject checks
+	// them. If they fail, the upload must be kept.
+	CompleteMultipartUploadConditional(bucket, object string, id UploadID, input *CompleteMultipartUploadRequest, conditions *PutConditions) (versionID VersionID, etag string, err error)
+}
+
+// BucketPolicyBackend may be optionally implemented by a Backend in order to
+// store bucket policies alongside the buckets they belong to.
+// If you don't implement BucketPolicyBackend, GoFakeS3 will fall back to an
+// in-memory implementation, which forgets the policies when GoFakeS3 exits.
+//
+// Policies are stored as the raw JSON document sent by the client; GoFakeS3
+// validates them before they are passed to the backend.
+type BucketPolicyBackend interface {
+	// BucketPolicy must return a gofakes3.ErrNoSuchBucket error if the bucket
+	// does not exist, and gofakes3.ErrNoSuchBucketPolicy if the bucket does
+	// not have a policy.
+	BucketPolicy(bucket string) ([]byte, error)
+
+	// PutBucketPolicy must return a gofakes3.ErrNoSuchBucket error if the
+	// bucket does not exist.
+	PutBucketPolicy(bucket string, policy []byte) error
+
+	// DeleteBucketPolicy must return a gofakes3.ErrNoSuchBucket error if the
+	// bucket does not exist. It MUST NOT return an error if the bucket
+	// does not have a policy.
+	DeleteBucketPolicy(bucket string) error
+}
+
+// BucketEncryptionBackend may be optionally implemented by a Backend in order
+// to store the default encryption of buckets alongside them. If you don't
+// implement BucketEncryptionBackend, GoFakeS3 will fall back to an in-memory
+// implementation, which forgets the configurations when GoFakeS3 exits.
+//
+// GoFakeS3 validates configurations before they are passed to the backend.
+type BucketEncryptionBackend interface {
+	// BucketEncryption must return a gofakes3.ErrNoSuchBucket error if the
+	// bucket does not exist, and gofakes3.ErrNoSuchEncryptionConfiguration
+	// if the bucket does not have a default encryption.
+	BucketEncryption(bucket string) (*ServerSideEncryptionConfiguration, error)
+
+	// PutBucketEncryption must return a gofakes3.ErrNoSuchBucket error if
+	// the bucket does not exist.
+	PutBucketEncryption(bucket string, config *ServerSideEncryptionConfiguration) error
+
+	// DeleteBucketEncryption must return a gofakes3.ErrNoSuchBucket error if
+	// the bucket does not exist. It MUST NOT return an error if the bucket
+	// does not have a default encryption.
+	DeleteBucketEncryption(bucket string) error
+}
+
+// BucketLifecycleBackend may be optionally implemented by a Backend in order
+// to store the lifecycle configuration of buckets alongside them. If you don't
+// implement BucketLifecycleBackend, GoFakeS3 will fall back to an in-memory
+// implementation, which forgets the configurations when GoFakeS3 exits.
+//
+// GoFakeS3 validates configurations before they are passed to the backend,
+// and applies them itself with GoFakeS3.ApplyLifecycle.
+type BucketLifecycleBackend interface {
+	// BucketLifecycle must return a gofakes3.ErrNoSuchBucket error if the
+	// bucket does not exist, and gofakes3.ErrNoSuchLifecycleConfiguration if
+	// the bucket does not have a lifecycle configuration.
+	BucketLifecycle(bucket string) (*LifecycleConfiguration, error)
+
+	// PutBucketLifecycle must return a gofakes3.ErrNoSuchBucket error if the
+	// bucket does not exist.
+	PutBucketLifecycle(bucket string, config *LifecycleConfiguration) error
+
+	// DeleteBucketLifecycle must return a gofakes3.ErrNoSuchBucket error if
+	// the bucket does not exist. It MUST NOT return an error if the bucket
+	// does not have a lifecycle configuration.
+	DeleteBucketLifecycle(bucket string) error
+}
+
+// BucketObjectLockBackend may be optionally implemented by a Backend in order
+// to store the Object Lock configuration of buckets alongside them. If you
+// don't implement BucketObjectLockBackend, GoFakeS3 will fall back to an
+// in-memory implementation, which forgets the configurations when GoFakeS3
+// exits.
+//
+// Object Lock can't be disabled once it is enabled for a bucket, so
+// configurations are never deleted, except with the bucket.
+type BucketObjectLockBackend interface {
+	// ObjectLockConfiguration must return a gofakes3.ErrNoSuchBucket error if
+	// the bucket does not exist, and
+	// gofakes3.ErrObjectLockConfigurationNotFound if Object Lock is not
+	// enabled for the bucket.
+	ObjectLockConfiguration(bucket string) (*ObjectLockConfiguration, error)
+
+	// PutObjectLockConfiguration must return a gofakes3.ErrNoSuchBucket error
+	// if the bucket does not exist.
+	PutObjectLockConfiguration(bucket string, config *ObjectLockConfiguration) error
+}
+
+// ObjectMetadataBackend may be optionally implemented by a Backend in order to
+// change the metadata of objects without rewriting them. It is used to change
+// the retention and legal hold of object versions through the '?retention'
+// and '?legal-hold' subresources, which respond with ErrNotImplemented
+// without it, and by lifecycle rules that transition objects to another
+// storage class, which are skipped without it.
+type ObjectMetadataBackend interface {
+	// PutObjectMetadata sets the metadata keys in meta, leaving the rest of
+	// the object, including its LastModified time and version, as it is. Keys
+	// with empty values must be removed from the metadata instead.
+	//
+	// PutObjectMetadata must return the same errors as
+	// VersionedBackend.HeadObjectVersion, or Backend.HeadObject if versionID
+	// is empty, if the object does not exist.
+	PutObjectMetadata(bucket, object string, versionID VersionID, meta map[string]string) error
+}
+
+// ACLBackend may be optionally implemented by a Backend in order to store
+// access control lists set through the '?acl' subresource. If you don't
+// implement ACLBackend, PutBucketAcl and PutObjectAcl respond with
+// ErrNotImplemented.
+//
+// The ACL an object is created with does not need to be stored here:
+// GoFakeS3 derives it from the x-amz-acl and x-amz-grant-* headers that are
+// kept in the object's metadata.
+type ACLBackend interface {
+	// BucketACL must return a gofakes3.ErrNoSuchBucket error if the bucket
+	// does not exist, and a nil ACL if PutBucketACL was never called for it.
+	BucketACL(bucket string) (*AccessControlPolicy, error)
+
+	// PutBucketACL must return a gofakes3.ErrNoSuchBucket error if the bucket
+	// does not exist.
+	PutBucketACL(bucket string, acl *AccessControlPolicy) error
+
+	// ObjectACL must return a gofakes3.ErrNoSuchBucket error if the bucket
+	// does not exist, and a gofakes3.ErrNoSuchKey error if the object does
+	// not exist. If versionID is not empty, it refers to a specific version
+	// of the object, which may not exist (gofakes3.ErrNoSuchVersion).
+	//
+	// ObjectACL must return a nil ACL if PutObjectACL has not been called
+	// since the object was last written.
+	ObjectACL(bucket, object string, versionID VersionID) (*AccessControlPolicy, error)
+
+	// PutObjectACL must return the same errors as ObjectACL if the object
+	// does not exist.
+	PutObjectACL(bucket, object string, versionID VersionID, acl *AccessControlPolicy) error
+}
+
+// ObjectTaggingBackend may be optionally implemented by a Backend in order to
+// change the tags of existing objects through the '?tagging' subresource. If
+// you don't implement ObjectTaggingBackend, PutObjectTagging and
+// DeleteObjectTagging respond with ErrNotImplemented.
+//
+// Objects keep their tags in the "X-Amz-Tagging" key of their metadata, which
+// GoFakeS3 reads them from, so that they are versioned along with the object
+// by backends that implement VersionedBackend.
+type ObjectTaggingBackend interface {
+	// PutObjectTagging replaces the "X-Amz-Tagging" metadata of the object,
+	// leaving the rest of the object as it is. If tagging is empty, the key
+	// must be removed from the metadata instead.
+	//
+	// If versionID is not empty, it refers to a specific version of the
+	// object. PutObjectTagging must return the same errors as
+	// VersionedBackend.HeadObjectVersion, or Backend.HeadObject, if the object
+	// does not exist.
+	PutObjectTagging(bucket, object string, versionID VersionID, tagging string) error
+}
+
+// BucketTaggingBackend may be optionally implemented by a Backend in order to
+// store the tags set through the bucket '?tagging' subresource. If you don't
+// implement BucketTaggingBackend, it responds with ErrNotImplemented.
+type BucketTaggingBackend interface {
+	// BucketTagging must return a gofakes3.ErrNoSuchBucket error if the bucket
+	// does not exist, and a gofakes3.ErrNoSuchTagSet error if the bucket has
+	// no tags.
+	BucketTagging(bucket string) ([]Tag, error)
+
+	// PutBucketTagging replaces the tags of the bucket. It must return a
+	// gofakes3.ErrNoSuchBucket error if the bucket does not exist.
+	PutBucketTagging(bucket string, tags []Tag) error
+
+	// DeleteBucketTagging must return a gofakes3.ErrNoSuchBucket error if the
+	// bucket does not exist.
+	DeleteBucketTagging(bucket string) error
+}
+
 // CopyObject is a helper function useful for quickly implementing CopyObject on
 // a backend that already supports GetObject and PutObject. This isn't very
 // efficient so only use this if performance isn't important.
 func CopyObject(db Backend, srcBucket, srcKey, dstBucket, dstKey string, meta map[string]string) (result CopyObjectResult, err error) {
+	return CopyObjectConditional(db, srcBucket, srcKey, dstBucket, dstKey, meta, nil)
+}
+
+// CopyObjectConditional is the CopyObject helper for backends that implement
+// ConditionalCopyBackend. The conditions are checked by PutObject as it
+// writes the copy.
+func CopyObjectConditional(db Backend, srcBucket, srcKey, dstBucket, dstKey string, meta map[string]string, conditions *PutConditions) (result CopyObjectResult, err error) {
 	c, err := db.GetObject(srcBucket, srcKey, nil)
 	if err != nil {
 		return
 	}
 	defer c.Contents.Close()
 
-	_, err = db.PutObject(dstBucket, dstKey, meta, c.Contents, c.Size, nil)
+	put, err := db.PutObject(dstBucket, dstKey, meta, c.Contents, c.Size, conditions)
 	if err != nil {
 		return
 	}
@@ -419,6 +739,7 @@ func CopyObject(db Backend, srcBucket, srcKey, dstBucket, dstKey string, meta ma
 	return CopyObjectResult{
 		ETag:         `"` + hex.EncodeToString(c.Hash) + `"`,
 		LastModified: NewContentTime(time.Now()),
+		VersionID:    put.VersionID,
 	}, nil
 }
 
@@ -431,15 +752,26 @@ func MergeMetadata(db Backend, bucketName string, objectName string, meta map[st
 			return err
 		}
 	}
-	// carry over metadata if it exists
+	// carry over metadata if it exists, except for the user metadata, content
+	// headers, ACL, tags, checksum, parts, encryption, Object Lock and storage
+	// class, which S3 resets when an object is overwritten
 	if existingObj != nil {
 		for k, v := range existingObj.Metadata {
 			// new metadata overwrites old but keep the rest
 			// TODO: check how metadata can be deleted?!
-			if _, ok := meta[k]; !ok {
+			if _, ok := meta[k]; !ok && !resetOnOverwrite(k) {
 				meta[k] = v
 			}
 		}
 	}
 	return nil
 }
+
+// resetOnOverwrite reports whether the metadata key describes the object
+// itself rather than its contents, so that it is not carried over by
+// MergeMetadata.
+func resetOnOverwrite(key string) bool {
+	return isContentMetadata(key) || isACLHeader(key) || isChecksumMetadata(key) || isEncryptionMetadata(key) ||
+		isObjectLockMetadata(key) || key == taggingMetadataKey || isPartsMetadata(key) ||
+		key == storageClassMetadataKey
+}
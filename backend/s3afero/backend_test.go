@@ -318,3 +318,52 @@ func TestMultiCreateBucket(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestMultiBucketTaggingPersists(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	multi, err := MultiBucket(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := multi.CreateBucket("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := multi.BucketTagging("test"); !gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchTagSet) {
+		t.Fatal("expected NoSuchTagSet, found", err)
+	}
+	tags := []gofakes3.Tag{{Key: "team", Value: "storage"}}
+	if err := multi.PutBucketTagging("test", tags); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new backend on the same filesystem sees the tags:
+	multi, err = MultiBucket(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := multi.BucketTagging("test")
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(found, tags) {
+		t.Fatal(found, "!=", tags)
+	}
+
+	// Tags are not listed as objects, and do not keep the bucket from being
+	// deleted:
+	list, err := multi.ListBucket("test", nil, gofakes3.ListBucketPage{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(list.Contents) != 0 {
+		t.Fatal("unexpected objects", list.Contents)
+	}
+	if err := multi.DeleteBucket("test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := multi.CreateBucket("test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := multi.BucketTagging("test"); !gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchTagSet) {
+		t.Fatal("expected NoSuchTagSet after recreating the bucket, found", err)
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/spf13/afero"
+
+	"github.com/johannesboyne/gofakes3"
 )
 
 type Metadata struct {
@@ -20,6 +22,11 @@ type Metadata struct {
 	Meta    map[string]string
 }
 
+// BucketMetadata is stored alongside the metadata of a bucket's objects.
+type BucketMetadata struct {
+	Tags []gofakes3.Tag
+}
+
 type metaPath struct {
 	bucket string
 	object string
@@ -65,6 +72,37 @@ func (ms *metaStore) metaPath(bucket string, object string) metaPath {
 	return metaPath{bucket, object + "-" + hex.EncodeToString(h.Sum(nil))}
 }
 
+// bucketMetaPath returns the path of the bucket's metadata, which can't clash
+// with the metadata of an object as those paths end with a hash.
+func (ms *metaStore) bucketMetaPath(bucket string) string {
+	return filepath.Join(bucket, "bucket.json")
+}
+
+func (ms *metaStore) loadBucketMeta(bucket string) (*BucketMetadata, error) {
+	var meta BucketMetadata
+	bts, err := afero.ReadFile(ms.fs, ms.bucketMetaPath(bucket))
+	if os.IsNotExist(err) {
+		return &meta, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bts, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func (ms *metaStore) saveBucketMeta(bucket string, meta *BucketMetadata) error {
+	bts, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := ms.fs.MkdirAll(bucket, 0777); err != nil {
+		return err
+	}
+	return afero.WriteFile(ms.fs, ms.bucketMetaPath(bucket), bts, 0666)
+}
+
 func (ms *metaStore) loadMeta(bucket string, object string, size int64, mtime time.Time) (*Metadata, error) {
 	metaPath := ms.metaPath(bucket, object)
 	fullPath := metaPath.FilePath()
@@ -42,6 +42,7 @@ type MultiBucketBackend struct {
 }
 
 var _ gofakes3.Backend = &MultiBucketBackend{}
+var _ gofakes3.BucketTaggingBackend = &MultiBucketBackend{}
 
 func MultiBucket(fs afero.Fs, opts ...MultiOption) (*MultiBucketBackend, error) {
 	if err := ensureNoOsFs("fs", fs); err != nil {
@@ -165,8 +166,9 @@ func (db *MultiBucketBackend) getBucketWithFilePrefixLocked(bucket string, prefi
 			response.Add(&gofakes3.Content{
 				Key:          objectPath,
 				LastModified: gofakes3.NewContentTime(mtime),
-				ETag:         gofakes3.FormatETag(meta.Hash),
+				ETag:         gofakes3.ObjectETag(meta.Hash, meta.Meta),
 				Size:         size,
+				StorageClass: gofakes3.StorageClassFromMetadata(meta.Meta),
 			})
 		}
 	}
@@ -212,8 +214,9 @@ func (db *MultiBucketBackend) getBucketWithArbitraryPrefixLocked(bucket string,
 		response.Add(&gofakes3.Content{
 			Key:          objectName,
 			LastModified: gofakes3.NewContentTime(mtime),
-			ETag:         gofakes3.FormatETag(meta.Hash),
+			ETag:         gofakes3.ObjectETag(meta.Hash, meta.Meta),
 			Size:         size,
+			StorageClass: gofakes3.StorageClassFromMetadata(meta.Meta),
 		})
 
 		return nil
@@ -313,6 +316,51 @@ func (db *MultiBucketBackend) BucketExists(name string) (exists bool, err error)
 	return
 }
 
+func (db *MultiBucketBackend) BucketTagging(name string) ([]gofakes3.Tag, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if err := db.ensureBucketExistsLocked(name); err != nil {
+		return nil, err
+	}
+	meta, err := db.metaStore.loadBucketMeta(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.Tags) == 0 {
+		return nil, gofakes3.ResourceError(gofakes3.ErrNoSuchTagSet, name)
+	}
+	return meta.Tags, nil
+}
+
+func (db *MultiBucketBackend) PutBucketTagging(name string, tags []gofakes3.Tag) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if err := db.ensureBucketExistsLocked(name); err != nil {
+		return err
+	}
+	meta, err := db.metaStore.loadBucketMeta(name)
+	if err != nil {
+		return err
+	}
+	meta.Tags = tags
+	return db.metaStore.saveBucketMeta(name, meta)
+}
+
+func (db *MultiBucketBackend) DeleteBucketTagging(name string) error {
+	return db.PutBucketTagging(name, nil)
+}
+
+func (db *MultiBucketBackend) ensureBucketExistsLocked(name string) error {
+	if exists, err := afero.Exists(db.bucketFs, name); err != nil {
+		return err
+	} else if !exists {
+		return gofakes3.BucketNotFound(name)
+	}
+	return nil
+}
+
 func (db *MultiBucketBackend) HeadObject(bucketName, objectName string) (*gofakes3.Object, error) {
 	db.lock.Lock()
 	defer db.lock.Unlock()
@@ -344,11 +392,12 @@ func (db *MultiBucketBackend) HeadObject(bucketName, objectName string) (*gofake
 	}
 
 	return &gofakes3.Object{
-		Name:     objectName,
-		Hash:     meta.Hash,
-		Metadata: meta.Meta,
-		Size:     size,
-		Contents: s3io.NoOpReadCloser{},
+		Name:         objectName,
+		Hash:         meta.Hash,
+		Metadata:     meta.Meta,
+		Size:         size,
+		LastModified: mtime,
+		Contents:     s3io.NoOpReadCloser{},
 	}, nil
 }
 
@@ -407,12 +456,13 @@ func (db *MultiBucketBackend) GetObject(bucketName, objectName string, rangeRequ
 	}
 
 	return &gofakes3.Object{
-		Name:     objectName,
-		Hash:     meta.Hash,
-		Metadata: meta.Meta,
-		Range:    rnge,
-		Size:     size,
-		Contents: rdr,
+		Name:         objectName,
+		Hash:         meta.Hash,
+		Metadata:     meta.Meta,
+		Range:        rnge,
+		Size:         size,
+		LastModified: mtime,
+		Contents:     rdr,
 	}, nil
 }
 
@@ -510,7 +560,15 @@ func (db *MultiBucketBackend) CopyObject(srcBucket, srcKey, dstBucket, dstKey st
 	return gofakes3.CopyObject(db, srcBucket, srcKey, dstBucket, dstKey, meta)
 }
 
+func (db *MultiBucketBackend) CopyObjectConditional(srcBucket, srcKey, dstBucket, dstKey string, meta map[string]string, conditions *gofakes3.PutConditions) (result gofakes3.CopyObjectResult, err error) {
+	return gofakes3.CopyObjectConditional(db, srcBucket, srcKey, dstBucket, dstKey, meta, conditions)
+}
+
 func (db *MultiBucketBackend) DeleteObject(bucketName, objectName string) (result gofakes3.ObjectDeleteResult, rerr error) {
+	return db.DeleteObjectConditional(bucketName, objectName, nil)
+}
+
+func (db *MultiBucketBackend) DeleteObjectConditional(bucketName, objectName string, conditions *gofakes3.DeleteConditions) (result gofakes3.ObjectDeleteResult, rerr error) {
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -522,6 +580,16 @@ func (db *MultiBucketBackend) DeleteObject(bucketName, objectName string) (resul
 		return result, gofakes3.BucketNotFound(bucketName)
 	}
 
+	if conditions != nil {
+		objectInfo, err := db.getConditionalObjectInfo(bucketName, objectName)
+		if err != nil {
+			return result, err
+		}
+		if err := gofakes3.CheckDeleteConditions(conditions, objectInfo); err != nil {
+			return result, err
+		}
+	}
+
 	return result, db.deleteObjectLocked(bucketName, objectName)
 }
 
@@ -592,7 +660,10 @@ func (db *MultiBucketBackend) getConditionalObjectInfo(bucketName, objectName st
 	}
 
 	return &gofakes3.ConditionalObjectInfo{
-		Exists: true,
-		Hash:   meta.Hash,
+		Exists:       true,
+		Hash:         meta.Hash,
+		Metadata:     meta.Meta,
+		Size:         size,
+		LastModified: mtime,
 	}, nil
 }
@@ -144,8 +144,9 @@ func (db *SingleBucketBackend) getBucketWithFilePrefixLocked(bucket string, pref
 			response.Add(&gofakes3.Content{
 				Key:          objectPath,
 				LastModified: gofakes3.NewContentTime(mtime),
-				ETag:         gofakes3.FormatETag(meta.Hash),
+				ETag:         gofakes3.ObjectETag(meta.Hash, meta.Meta),
 				Size:         size,
+				StorageClass: gofakes3.StorageClassFromMetadata(meta.Meta),
 			})
 		}
 	}
@@ -176,8 +177,9 @@ func (db *SingleBucketBackend) getBucketWithArbitraryPrefixLocked(bucket string,
 		response.Add(&gofakes3.Content{
 			Key:          objectPath,
 			LastModified: gofakes3.NewContentTime(mtime),
-			ETag:         gofakes3.FormatETag(meta.Hash),
+			ETag:         gofakes3.ObjectETag(meta.Hash, meta.Meta),
 			Size:         size,
+			StorageClass: gofakes3.StorageClassFromMetadata(meta.Meta),
 		})
 
 		return nil
@@ -250,11 +252,12 @@ func (db *SingleBucketBackend) HeadObject(bucketName, objectName string) (*gofak
 	}
 
 	return &gofakes3.Object{
-		Name:     objectName,
-		Hash:     meta.Hash,
-		Metadata: meta.Meta,
-		Size:     size,
-		Contents: s3io.NoOpReadCloser{},
+		Name:         objectName,
+		Hash:         meta.Hash,
+		Metadata:     meta.Meta,
+		Size:         size,
+		LastModified: mtime,
+		Contents:     s3io.NoOpReadCloser{},
 	}, nil
 }
 
@@ -307,12 +310,13 @@ func (db *SingleBucketBackend) GetObject(bucketName, objectName string, rangeReq
 	}
 
 	return &gofakes3.Object{
-		Name:     objectName,
-		Hash:     meta.Hash,
-		Metadata: meta.Meta,
-		Size:     size,
-		Range:    rnge,
-		Contents: rdr,
+		Name:         objectName,
+		Hash:         meta.Hash,
+		Metadata:     meta.Meta,
+		Size:         size,
+		LastModified: mtime,
+		Range:        rnge,
+		Contents:     rdr,
 	}, nil
 }
 
@@ -432,7 +436,15 @@ func (db *SingleBucketBackend) CopyObject(srcBucket, srcKey, dstBucket, dstKey s
 	return gofakes3.CopyObject(db, srcBucket, srcKey, dstBucket, dstKey, meta)
 }
 
+func (db *SingleBucketBackend) CopyObjectConditional(srcBucket, srcKey, dstBucket, dstKey string, meta map[string]string, conditions *gofakes3.PutConditions) (result gofakes3.CopyObjectResult, err error) {
+	return gofakes3.CopyObjectConditional(db, srcBucket, srcKey, dstBucket, dstKey, meta, conditions)
+}
+
 func (db *SingleBucketBackend) DeleteObject(bucketName, objectName string) (result gofakes3.ObjectDeleteResult, rerr error) {
+	return db.DeleteObjectConditional(bucketName, objectName, nil)
+}
+
+func (db *SingleBucketBackend) DeleteObjectConditional(bucketName, objectName string, conditions *gofakes3.DeleteConditions) (result gofakes3.ObjectDeleteResult, rerr error) {
 	if bucketName != db.name {
 		return result, gofakes3.BucketNotFound(bucketName)
 	}
@@ -440,6 +452,16 @@ func (db *SingleBucketBackend) DeleteObject(bucketName, objectName string) (resu
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
+	if conditions != nil {
+		objectInfo, err := db.getConditionalObjectInfo(bucketName, objectName)
+		if err != nil {
+			return result, err
+		}
+		if err := gofakes3.CheckDeleteConditions(conditions, objectInfo); err != nil {
+			return result, err
+		}
+	}
+
 	return result, db.deleteObjectLocked(bucketName, objectName)
 }
 
@@ -528,7 +550,10 @@ func (db *SingleBucketBackend) getConditionalObjectInfo(bucketName, objectName s
 	}
 
 	return &gofakes3.ConditionalObjectInfo{
-		Exists: true,
-		Hash:   meta.Hash,
+		Exists:       true,
+		Hash:         meta.Hash,
+		Metadata:     meta.Meta,
+		Size:         size,
+		LastModified: mtime,
 	}, nil
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"sync"
 
 	bolt "go.etcd.io/bbolt"
 	"gopkg.in/mgo.v2/bson"
@@ -19,12 +20,20 @@ var (
 )
 
 type Backend struct {
-	bolt           *bolt.DB
-	timeSource     gofakes3.TimeSource
-	metaBucketName []byte
+	bolt               *bolt.DB
+	timeSource         gofakes3.TimeSource
+	metaBucketName     []byte
+	versionsBucketName []byte
+
+	upgradeOnce sync.Once
+	upgradeErr  error
 }
 
 var _ gofakes3.Backend = &Backend{}
+var _ gofakes3.VersionedBackend = &Backend{}
+var _ gofakes3.ACLBackend = &Backend{}
+var _ gofakes3.ObjectTaggingBackend = &Backend{}
+var _ gofakes3.BucketTaggingBackend = &Backend{}
 
 type Option func(b *Backend)
 
@@ -40,13 +49,24 @@ func NewFile(file string, opts ...Option) (*Backend, error) {
 	if err != nil {
 		return nil, err
 	}
-	return New(db, opts...), nil
+	b := New(db, opts...)
+	if err := b.ready(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return b, nil
 }
 
+// New creates a backend that stores its buckets in the bolt database. If the
+// database was written by an older version, it is upgraded in place when it
+// is first used, and the first operation fails if the upgrade does.
 func New(bolt *bolt.DB, opts ...Option) *Backend {
 	b := &Backend{
-		bolt:           bolt,
-		metaBucketName: []byte("_meta"), // Underscore guarantees no overlap with legal S3 bucket names
+		bolt: bolt,
+
+		// Underscores guarantee no overlap with legal S3 bucket names:
+		metaBucketName:     []byte("_meta"),
+		versionsBucketName: []byte("_versions"),
 	}
 	for _, opt := range opts {
 		opt(b)
@@ -57,24 +77,41 @@ func New(bolt *bolt.DB, opts ...Option) *Backend {
 	return b
 }
 
+// ready upgrades the database the first time it is called, and returns the
+// error the upgrade failed with, if any.
+func (db *Backend) ready() error {
+	db.upgradeOnce.Do(func() { db.upgradeErr = db.upgrade() })
+	return db.upgradeErr
+}
+
+// view and update run a transaction like bolt.DB's methods, once the database
+// is up to date.
+func (db *Backend) view(fn func(tx *bolt.Tx) error) error {
+	if err := db.ready(); err != nil {
+		return err
+	}
+	return db.bolt.View(fn)
+}
+
+func (db *Backend) update(fn func(tx *bolt.Tx) error) error {
+	if err := db.ready(); err != nil {
+		return err
+	}
+	return db.bolt.Update(fn)
+}
+
+// isInternalBucket reports whether a bolt bucket holds data about the S3
+// buckets rather than an S3 bucket itself.
+func (db *Backend) isInternalBucket(name []byte) bool {
+	return bytes.Equal(name, db.metaBucketName) || bytes.Equal(name, db.versionsBucketName)
+}
+
 // metaBucket returns a utility that manages access to the metadata bucket.
 // The returned struct is valid only for the lifetime of the bolt.Tx.
-// The metadata bucket may not exist if this is an older database.
 func (db *Backend) metaBucket(tx *bolt.Tx) (*metaBucket, error) {
-	var bucket *bolt.Bucket
-	var err error
-
-	if tx.Writable() {
-		bucket, err = tx.CreateBucketIfNotExists(db.metaBucketName)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		bucket = tx.Bucket(db.metaBucketName)
-		if bucket == nil {
-			// FIXME: support legacy databases; remove when versioning is supported.
-			return nil, nil
-		}
+	bucket := tx.Bucket(db.metaBucketName)
+	if bucket == nil {
+		return nil, fmt.Errorf("gofakes3: missing bucket metadata")
 	}
 
 	return &metaBucket{
@@ -87,42 +124,27 @@ func (db *Backend) metaBucket(tx *bolt.Tx) (*metaBucket, error) {
 func (db *Backend) ListBuckets() ([]gofakes3.BucketInfo, error) {
 	var buckets []gofakes3.BucketInfo
 
-	err := db.bolt.View(func(tx *bolt.Tx) error {
+	err := db.view(func(tx *bolt.Tx) error {
 		metaBucket, err := db.metaBucket(tx)
 		if err != nil {
 			return err
 		}
 
 		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
-			if bytes.Equal(name, db.metaBucketName) {
+			if db.isInternalBucket(name) {
 				return nil
 			}
 
 			nameStr := string(name)
-			info := gofakes3.BucketInfo{Name: nameStr}
-
-			// Attempt to assign metadata. If it isn't found, we will just
-			// pretend that's fine for now. This is to support existing
-			// databases that have buckets created without associated metadata.
-			//
-			// FIXME: clean this up when there is an upgrade script to expect
-			// that it exists
-			if metaBucket != nil {
-				bucketInfo, err := metaBucket.s3Bucket(nameStr)
-				if err != nil {
-					return err
-				}
-				if bucketInfo != nil {
-					info.CreationDate = gofakes3.NewContentTime(bucketInfo.CreationDate)
-				}
-			}
-
-			// The AWS CLI will fail if there is no creation date:
-			if info.CreationDate.IsZero() {
-				info.CreationDate = gofakes3.NewContentTime(db.timeSource.Now())
+			bucketInfo, err := metaBucket.s3Bucket(nameStr)
+			if err != nil {
+				return err
 			}
 
-			buckets = append(buckets, info)
+			buckets = append(buckets, gofakes3.BucketInfo{
+				Name:         nameStr,
+				CreationDate: gofakes3.NewContentTime(bucketInfo.CreationDate),
+			})
 			return nil
 		})
 	})
@@ -137,7 +159,7 @@ func (db *Backend) ListBucket(name string, prefix *gofakes3.Prefix, page gofakes
 
 	objects := gofakes3.NewObjectList()
 
-	err := db.bolt.View(func(tx *bolt.Tx) error {
+	err := db.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(name))
 		if b == nil {
 			return gofakes3.BucketNotFound(name)
@@ -164,8 +186,16 @@ func (db *Backend) ListBucket(name string, prefix *gofakes3.Prefix, page gofakes
 			key := string(k)
 			if !prefix.Match(key, &match) {
 				continue
+			}
 
-			} else if match.CommonPrefix {
+			// Objects whose current version is a delete marker are hidden:
+			if deleted, err := isDeleteMarker(v); err != nil {
+				return fmt.Errorf("gofakes3: could not unmarshal object %q: %v", key, err)
+			} else if deleted {
+				continue
+			}
+
+			if match.CommonPrefix {
 				if match.MatchedPart == lastMatchedPart {
 					continue // Should not count towards keys
 				}
@@ -185,9 +215,10 @@ func (db *Backend) ListBucket(name string, prefix *gofakes3.Prefix, page gofakes
 				}
 				item := &gofakes3.Content{
 					Key:          string(k[:]),
-					ETag:         gofakes3.FormatETag(b.Hash),
+					ETag:         gofakes3.ObjectETag(b.Hash, b.Metadata),
 					Size:         b.Size,
 					LastModified: gofakes3.NewContentTime(b.LastModified.UTC()),
+					StorageClass: gofakes3.StorageClassFromMetadata(b.Metadata),
 				}
 				objects.Add(item)
 				lastKey = key
@@ -204,11 +235,16 @@ func (db *Backend) ListBucket(name string, prefix *gofakes3.Prefix, page gofakes
 				// forever on) that prefix.
 				nextMarker := lastKey
 				var hasMore bool
-				for nextK, _ := c.Next(); nextK != nil; nextK, _ = c.Next() {
+				for nextK, nextV := c.Next(); nextK != nil; nextK, nextV = c.Next() {
 					var nextMatch gofakes3.PrefixMatch
 					if !prefix.Match(string(nextK), &nextMatch) {
 						continue
 					}
+					if deleted, err := isDeleteMarker(nextV); err != nil {
+						return fmt.Errorf("gofakes3: could not unmarshal object %q: %v", string(nextK), err)
+					} else if deleted {
+						continue
+					}
 					if nextMatch.CommonPrefix && nextMatch.MatchedPart == lastMatchedPart {
 						nextMarker = string(nextK)
 						continue
@@ -231,7 +267,7 @@ func (db *Backend) ListBucket(name string, prefix *gofakes3.Prefix, page gofakes
 }
 
 func (db *Backend) CreateBucket(name string) error {
-	return db.bolt.Update(func(tx *bolt.Tx) error {
+	return db.update(func(tx *bolt.Tx) error {
 		{ // create bucket metadata
 			metaBucket, err := db.metaBucket(tx)
 			if err != nil {
@@ -250,6 +286,9 @@ func (db *Backend) CreateBucket(name string) error {
 			if _, err := tx.CreateBucket(nameBts); err != nil {
 				return err
 			}
+			if _, err := tx.Bucket(db.versionsBucketName).CreateBucket(nameBts); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
@@ -258,16 +297,18 @@ func (db *Backend) CreateBucket(name string) error {
 func (db *Backend) DeleteBucket(name string) error {
 	nameBts := []byte(name)
 
-	if bytes.Equal(nameBts, db.metaBucketName) {
+	if db.isInternalBucket(nameBts) {
 		return gofakes3.ResourceError(gofakes3.ErrInvalidBucketName, name)
 	}
 
-	return db.bolt.Update(func(tx *bolt.Tx) error {
+	return db.update(func(tx *bolt.Tx) error {
 		{ // delete bucket
 			b := tx.Bucket(nameBts)
 			if b == nil {
 				return gofakes3.ErrNoSuchBucket
 			}
+			// Every object with noncurrent versions also has a current
+			// version, which may be a delete marker:
 			c := b.Cursor()
 			k, _ := c.First()
 			if k != nil {
@@ -280,16 +321,14 @@ func (db *Backend) DeleteBucket(name string) error {
 			if err != nil {
 				return err
 			}
-
-			// FIXME: assumes a legacy database, where the bucket may not exist. Clean
-			// this up when there is a DB upgrade script.
-			if metaBucket != nil {
-				if err := metaBucket.deleteS3Bucket(name); err != nil {
-					return err
-				}
+			if err := metaBucket.deleteS3Bucket(name); err != nil {
+				return err
 			}
 		}
 
+		if err := tx.Bucket(db.versionsBucketName).DeleteBucket(nameBts); err != nil {
+			return err
+		}
 		return tx.DeleteBucket(nameBts)
 	})
 }
@@ -297,11 +336,11 @@ func (db *Backend) DeleteBucket(name string) error {
 func (db *Backend) ForceDeleteBucket(name string) error {
 	nameBts := []byte(name)
 
-	if bytes.Equal(nameBts, db.metaBucketName) {
+	if db.isInternalBucket(nameBts) {
 		return gofakes3.ResourceError(gofakes3.ErrInvalidBucketName, name)
 	}
 
-	return db.bolt.Update(func(tx *bolt.Tx) error {
+	return db.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket(nameBts)
 		if b == nil {
 			return gofakes3.BucketNotFound(name)
@@ -320,22 +359,20 @@ func (db *Backend) ForceDeleteBucket(name string) error {
 		if err != nil {
 			return err
 		}
-
-		// FIXME: assumes a legacy database, where the bucket may not exist. Clean
-		// this up when there is a DB upgrade script.
-		if metaBucket != nil {
-			if err := metaBucket.deleteS3Bucket(name); err != nil {
-				return err
-			}
+		if err := metaBucket.deleteS3Bucket(name); err != nil {
+			return err
 		}
 
-		// Delete the bucket itself
+		// Delete the noncurrent versions, then the bucket itself
+		if err := tx.Bucket(db.versionsBucketName).DeleteBucket(nameBts); err != nil {
+			return err
+		}
 		return tx.DeleteBucket(nameBts)
 	})
 }
 
 func (db *Backend) BucketExists(name string) (exists bool, err error) {
-	err = db.bolt.View(func(tx *bolt.Tx) error {
+	err = db.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(name))
 		exists = b != nil
 		return nil
@@ -353,9 +390,9 @@ func (db *Backend) HeadObject(bucketName, objectName string) (*gofakes3.Object,
 }
 
 func (db *Backend) GetObject(bucketName, objectName string, rangeRequest *gofakes3.ObjectRangeRequest) (*gofakes3.Object, error) {
-	var t boltObject
+	var t *boltObject
 
-	err := db.bolt.View(func(tx *bolt.Tx) error {
+	err := db.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucketName))
 		if b == nil {
 			return gofakes3.BucketNotFound(bucketName)
@@ -366,9 +403,13 @@ func (db *Backend) GetObject(bucketName, objectName string, rangeRequest *gofake
 			return gofakes3.KeyNotFound(objectName)
 		}
 
-		if err := bson.Unmarshal(v, &t); err != nil {
+		var err error
+		if t, err = decodeBoltObject(v); err != nil {
 			return fmt.Errorf("gofakes3: could not unmarshal object at %q/%q: %v", bucketName, objectName, err)
 		}
+		if t.DeleteMarker {
+			return gofakes3.KeyNotFound(objectName)
+		}
 
 		return nil
 	})
@@ -377,8 +418,7 @@ func (db *Backend) GetObject(bucketName, objectName string, rangeRequest *gofake
 		return nil, err
 	}
 
-	// FIXME: objectName here is a bit of a hack; this can be cleaned up when we have a
-	// database migration script.
+	// Objects stored before versioning have no name, so it is passed in:
 	return t.Object(objectName, rangeRequest)
 }
 
@@ -403,14 +443,14 @@ func (db *Backend) PutObject(
 	mod := db.timeSource.Now()
 	hash := md5.Sum(bts)
 
-	return result, db.bolt.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucketName))
-		if b == nil {
-			return gofakes3.BucketNotFound(bucketName)
+	return result, db.update(func(tx *bolt.Tx) error {
+		bv, err := db.bucketVersions(tx, bucketName)
+		if err != nil {
+			return err
 		}
 
 		if conditions != nil {
-			objectInfo, err := db.getConditionalObjectInfo(b, objectName)
+			objectInfo, err := db.getConditionalObjectInfo(bv.objects, objectName)
 			if err != nil {
 				return err
 			}
@@ -419,20 +459,18 @@ func (db *Backend) PutObject(
 			}
 		}
 
-		data, err := bson.Marshal(&boltObject{
+		obj := &boltObject{
 			Name:         objectName,
 			Metadata:     meta,
 			Size:         int64(len(bts)),
 			LastModified: mod,
 			Contents:     bts,
 			Hash:         hash[:],
-		})
-		if err != nil {
-			return err
 		}
-		if err := b.Put([]byte(objectName), data); err != nil {
+		if err := bv.put(obj); err != nil {
 			return err
 		}
+		result.VersionID = obj.VersionID
 		return nil
 	})
 }
@@ -441,13 +479,30 @@ func (db *Backend) CopyObject(srcBucket, srcKey, dstBucket, dstKey string, meta
 	return gofakes3.CopyObject(db, srcBucket, srcKey, dstBucket, dstKey, meta)
 }
 
+func (db *Backend) CopyObjectConditional(srcBucket, srcKey, dstBucket, dstKey string, meta map[string]string, conditions *gofakes3.PutConditions) (result gofakes3.CopyObjectResult, err error) {
+	return gofakes3.CopyObjectConditional(db, srcBucket, srcKey, dstBucket, dstKey, meta, conditions)
+}
+
 func (db *Backend) DeleteObject(bucketName, objectName string) (result gofakes3.ObjectDeleteResult, rerr error) {
-	return result, db.bolt.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucketName))
-		if b == nil {
-			return gofakes3.BucketNotFound(bucketName)
+	return db.DeleteObjectConditional(bucketName, objectName, nil)
+}
+
+func (db *Backend) DeleteObjectConditional(bucketName, objectName string, conditions *gofakes3.DeleteConditions) (result gofakes3.ObjectDeleteResult, rerr error) {
+	return result, db.update(func(tx *bolt.Tx) (err error) {
+		bv, err := db.bucketVersions(tx, bucketName)
+		if err != nil {
+			return err
 		}
-		if err := b.Delete([]byte(objectName)); err != nil {
+		if conditions != nil {
+			objectInfo, err := db.getConditionalObjectInfo(bv.objects, objectName)
+			if err != nil {
+				return err
+			}
+			if err := gofakes3.CheckDeleteConditions(conditions, objectInfo); err != nil {
+				return err
+			}
+		}
+		if result, err = bv.rm(objectName, db.timeSource.Now()); err != nil {
 			return fmt.Errorf("gofakes3: delete failed for object %q in bucket %q", objectName, bucketName)
 		}
 		return nil
@@ -455,14 +510,16 @@ func (db *Backend) DeleteObject(bucketName, objectName string) (result gofakes3.
 }
 
 func (db *Backend) DeleteMulti(bucketName string, objects ...string) (result gofakes3.MultiDeleteResult, err error) {
-	err = db.bolt.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucketName))
-		if b == nil {
-			return gofakes3.BucketNotFound(bucketName)
+	err = db.update(func(tx *bolt.Tx) error {
+		bv, err := db.bucketVersions(tx, bucketName)
+		if err != nil {
+			return err
 		}
 
+		now := db.timeSource.Now()
+
 		for _, object := range objects {
-			if err := b.Delete([]byte(object)); err != nil {
+			if _, err := bv.rm(object, now); err != nil {
 				log.Println("delete object failed:", err)
 				result.Error = append(result.Error, gofakes3.ErrorResult{
 					Code:    gofakes3.ErrInternal,
@@ -483,6 +540,135 @@ func (db *Backend) DeleteMulti(bucketName string, objects ...string) (result gof
 	return result, err
 }
 
+func (db *Backend) BucketACL(bucketName string) (acl *gofakes3.AccessControlPolicy, err error) {
+	err = db.viewS3Bucket(bucketName, func(bb *boltBucket) {
+		acl = bb.ACL
+	})
+	return acl, err
+}
+
+func (db *Backend) PutBucketACL(bucketName string, acl *gofakes3.AccessControlPolicy) error {
+	return db.updateS3Bucket(bucketName, func(bb *boltBucket) {
+		bb.ACL = acl
+	})
+}
+
+func (db *Backend) BucketTagging(bucketName string) (tags []gofakes3.Tag, err error) {
+	err = db.viewS3Bucket(bucketName, func(bb *boltBucket) {
+		tags = bb.Tags
+	})
+	if err == nil && len(tags) == 0 {
+		return nil, gofakes3.ResourceError(gofakes3.ErrNoSuchTagSet, bucketName)
+	}
+	return tags, err
+}
+
+func (db *Backend) PutBucketTagging(bucketName string, tags []gofakes3.Tag) error {
+	return db.updateS3Bucket(bucketName, func(bb *boltBucket) {
+		bb.Tags = tags
+	})
+}
+
+func (db *Backend) DeleteBucketTagging(bucketName string) error {
+	return db.PutBucketTagging(bucketName, nil)
+}
+
+// viewS3Bucket calls fn with the metadata of the bucket.
+func (db *Backend) viewS3Bucket(bucketName string, fn func(bb *boltBucket)) error {
+	return db.view(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(bucketName)) == nil {
+			return gofakes3.BucketNotFound(bucketName)
+		}
+
+		metaBucket, err := db.metaBucket(tx)
+		if err != nil {
+			return err
+		}
+		bb, err := metaBucket.s3Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		fn(bb)
+		return nil
+	})
+}
+
+// updateS3Bucket calls fn to modify the metadata of the bucket, and saves it.
+func (db *Backend) updateS3Bucket(bucketName string, fn func(bb *boltBucket)) error {
+	return db.update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(bucketName)) == nil {
+			return gofakes3.BucketNotFound(bucketName)
+		}
+
+		metaBucket, err := db.metaBucket(tx)
+		if err != nil {
+			return err
+		}
+		bb, err := metaBucket.s3Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		fn(bb)
+		return metaBucket.putS3Bucket(bucketName, bb)
+	})
+}
+
+func (db *Backend) ObjectACL(bucketName, objectName string, versionID gofakes3.VersionID) (acl *gofakes3.AccessControlPolicy, err error) {
+	err = db.view(func(tx *bolt.Tx) error {
+		bv, err := db.bucketVersions(tx, bucketName)
+		if err != nil {
+			return err
+		}
+		obj, _, _, err := bv.version(objectName, versionID)
+		if err != nil {
+			return err
+		}
+		acl = obj.ACL
+		return nil
+	})
+	return acl, err
+}
+
+func (db *Backend) PutObjectACL(bucketName, objectName string, versionID gofakes3.VersionID, acl *gofakes3.AccessControlPolicy) error {
+	return db.updateObjectVersion(bucketName, objectName, versionID, func(obj *boltObject) {
+		obj.ACL = acl
+	})
+}
+
+func (db *Backend) PutObjectTagging(bucketName, objectName string, versionID gofakes3.VersionID, tagging string) error {
+	return db.updateObjectVersion(bucketName, objectName, versionID, func(obj *boltObject) {
+		if obj.Metadata == nil {
+			obj.Metadata = make(map[string]string)
+		}
+		if tagging == "" {
+			delete(obj.Metadata, "X-Amz-Tagging")
+		} else {
+			obj.Metadata["X-Amz-Tagging"] = tagging
+		}
+	})
+}
+
+// updateObjectVersion calls fn to modify a version of an object, and saves
+// it where it was found.
+func (db *Backend) updateObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID, fn func(obj *boltObject)) error {
+	return db.update(func(tx *bolt.Tx) error {
+		bv, err := db.bucketVersions(tx, bucketName)
+		if err != nil {
+			return err
+		}
+		obj, key, store, err := bv.version(objectName, versionID)
+		if err != nil {
+			return err
+		}
+		fn(obj)
+		data, err := bson.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		return store.Put(key, data)
+	})
+}
+
 // getConditionalObjectInfo returns information about an object for conditional checking.
 // This method assumes it's called within a bolt transaction.
 func (db *Backend) getConditionalObjectInfo(bucket *bolt.Bucket, objectName string) (*gofakes3.ConditionalObjectInfo, error) {
@@ -494,8 +680,20 @@ func (db *Backend) getConditionalObjectInfo(bucket *bolt.Bucket, objectName stri
 	if err := bson.Unmarshal(existingData, &existing); err != nil {
 		return nil, fmt.Errorf("gofakes3: could not unmarshal object %q: %v", objectName, err)
 	}
+	return conditionalObjectInfo(&existing), nil
+}
+
+// conditionalObjectInfo describes a version of an object, which may be nil,
+// for the conditions of a request.
+func conditionalObjectInfo(obj *boltObject) *gofakes3.ConditionalObjectInfo {
+	if obj == nil || obj.DeleteMarker {
+		return &gofakes3.ConditionalObjectInfo{Exists: false}
+	}
 	return &gofakes3.ConditionalObjectInfo{
-		Exists: true,
-		Hash:   existing.Hash,
-	}, nil
+		Exists:       true,
+		Hash:         obj.Hash,
+		Metadata:     obj.Metadata,
+		Size:         obj.Size,
+		LastModified: obj.LastModified,
+	}
 }
@@ -290,3 +290,128 @@ func TestPaginationTerminatesPlainKeys(t *testing.T) {
 		t.Fatalf("expected a,b,c,d,e exactly once, got %v", seen)
 	}
 }
+
+func TestACL(t *testing.T) {
+	boltDB, cleanup := setupTestBucket(t, "test-bucket", []string{"a.txt"})
+	defer cleanup()
+
+	acl, err := boltDB.BucketACL("test-bucket")
+	if err != nil {
+		t.Fatal(err)
+	} else if acl != nil {
+		t.Fatal("expected no bucket ACL, found", acl)
+	}
+
+	in := &gofakes3.AccessControlPolicy{
+		Grants: []gofakes3.Grant{{
+			Grantee:    gofakes3.Grantee{Type: gofakes3.GranteeGroup, URI: gofakes3.AllUsersGroup},
+			Permission: gofakes3.PermissionRead,
+		}},
+	}
+	if err := boltDB.PutBucketACL("test-bucket", in); err != nil {
+		t.Fatal(err)
+	}
+	if err := boltDB.PutObjectACL("test-bucket", "a.txt", "", in); err != nil {
+		t.Fatal(err)
+	}
+
+	acl, err = boltDB.BucketACL("test-bucket")
+	if err != nil {
+		t.Fatal(err)
+	} else if acl == nil || len(acl.Grants) != 1 || acl.Grants[0].Grantee.URI != gofakes3.AllUsersGroup {
+		t.Fatal("unexpected bucket ACL", acl)
+	}
+
+	acl, err = boltDB.ObjectACL("test-bucket", "a.txt", "")
+	if err != nil {
+		t.Fatal(err)
+	} else if acl == nil || len(acl.Grants) != 1 || acl.Grants[0].Permission != gofakes3.PermissionRead {
+		t.Fatal("unexpected object ACL", acl)
+	}
+
+	// Overwriting the object resets its ACL:
+	if _, err := boltDB.PutObject("test-bucket", "a.txt", nil, strings.NewReader("a"), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	acl, err = boltDB.ObjectACL("test-bucket", "a.txt", "")
+	if err != nil {
+		t.Fatal(err)
+	} else if acl != nil {
+		t.Fatal("expected object ACL to be reset, found", acl)
+	}
+
+	if _, err := boltDB.ObjectACL("test-bucket", "missing", ""); !gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchKey) {
+		t.Fatal("expected NoSuchKey, found", err)
+	}
+}
+
+func TestPutObjectTagging(t *testing.T) {
+	boltDB, cleanup := setupTestBucket(t, "test-bucket", nil)
+	defer cleanup()
+
+	meta := map[string]string{"Content-Type": "text/plain", "X-Amz-Tagging": "a=1"}
+	if _, err := boltDB.PutObject("test-bucket", "a.txt", meta, strings.NewReader("a"), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := boltDB.PutObjectTagging("test-bucket", "a.txt", "", "b=2"); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := boltDB.HeadObject("test-bucket", "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	} else if obj.Metadata["X-Amz-Tagging"] != "b=2" || obj.Metadata["Content-Type"] != "text/plain" {
+		t.Fatal("unexpected metadata", obj.Metadata)
+	}
+
+	if err := boltDB.PutObjectTagging("test-bucket", "a.txt", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	obj, err = boltDB.HeadObject("test-bucket", "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	} else if _, ok := obj.Metadata["X-Amz-Tagging"]; ok {
+		t.Fatal("expected tags to be removed", obj.Metadata)
+	}
+
+	if err := boltDB.PutObjectTagging("test-bucket", "missing", "", "b=2"); !gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchKey) {
+		t.Fatal("expected NoSuchKey, found", err)
+	}
+}
+
+func TestBucketTaggingPersists(t *testing.T) {
+	boltDB, cleanup := setupTestBucket(t, "test-bucket", nil)
+	defer cleanup()
+
+	if _, err := boltDB.BucketTagging("test-bucket"); !gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchTagSet) {
+		t.Fatal("expected NoSuchTagSet, found", err)
+	}
+	if err := boltDB.PutBucketTagging("test-bucket", []gofakes3.Tag{{Key: "team", Value: "storage"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen the database:
+	path := boltDB.bolt.Path()
+	if err := boltDB.bolt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	boltDB, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer boltDB.bolt.Close()
+
+	tags, err := boltDB.BucketTagging("test-bucket")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(tags) != 1 || tags[0].Key != "team" || tags[0].Value != "storage" {
+		t.Fatal("unexpected tags", tags)
+	}
+
+	if err := boltDB.DeleteBucketTagging("test-bucket"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := boltDB.BucketTagging("test-bucket"); !gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchTagSet) {
+		t.Fatal("expected NoSuchTagSet, found", err)
+	}
+}
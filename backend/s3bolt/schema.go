@@ -5,9 +5,23 @@ package s3bolt
 // change without notice or version number changes.
 //
 // This may change in the future.
+//
+// The database holds these bolt buckets:
+//
+//   - "_meta" holds a boltBucket for each S3 bucket under "bucket/<name>",
+//     and the version of this schema under "schema".
+//   - Each S3 bucket has a bolt bucket of the same name, holding the current
+//     version of each object under its name. The current version may be a
+//     delete marker.
+//   - "_versions" holds a bolt bucket for each S3 bucket, with the noncurrent
+//     versions of each object, keyed by versionKey so that they are ordered
+//     newest first.
 
 import (
 	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/johannesboyne/gofakes3"
@@ -18,15 +32,30 @@ import (
 
 type boltBucket struct {
 	CreationDate time.Time
+	ACL          *gofakes3.AccessControlPolicy
+	Tags         []gofakes3.Tag
+
+	// Versioning is empty if versioning has never been enabled.
+	Versioning gofakes3.VersioningStatus
 }
 
 type boltObject struct {
-	Name         string
+	Name string
+
+	// VersionID is empty for the null version: objects put while versioning
+	// was not enabled, including those that predate versioning support.
+	VersionID    gofakes3.VersionID
+	DeleteMarker bool
+
 	Metadata     map[string]string
 	LastModified time.Time
 	Size         int64
 	Contents     []byte
 	Hash         []byte
+
+	// Set by PutObjectACL; objects are created with the ACL in their
+	// metadata.
+	ACL *gofakes3.AccessControlPolicy
 }
 
 func (b *boltObject) Object(objectName string, rangeRequest *gofakes3.ObjectRangeRequest) (*gofakes3.Object, error) {
@@ -42,15 +71,57 @@ func (b *boltObject) Object(objectName string, rangeRequest *gofakes3.ObjectRang
 	}
 
 	return &gofakes3.Object{
-		Name:     objectName,
-		Metadata: b.Metadata,
-		Size:     b.Size,
-		Contents: s3io.ReaderWithDummyCloser{Reader: bytes.NewReader(data)},
-		Range:    rnge,
-		Hash:     b.Hash,
+		Name:           objectName,
+		Metadata:       b.Metadata,
+		Size:           b.Size,
+		LastModified:   b.LastModified,
+		Contents:       s3io.ReaderWithDummyCloser{Reader: bytes.NewReader(data)},
+		Range:          rnge,
+		Hash:           b.Hash,
+		VersionID:      b.VersionID,
+		IsDeleteMarker: b.DeleteMarker,
 	}, nil
 }
 
+// decodeBoltObject unmarshals an object, copying the data first so that the
+// object can outlive the transaction it was read in.
+func decodeBoltObject(data []byte) (*boltObject, error) {
+	var obj boltObject
+	if err := bson.Unmarshal(append([]byte(nil), data...), &obj); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// isDeleteMarker decodes only enough of an object to tell whether it is a
+// delete marker, so listings can skip markers without decoding contents.
+func isDeleteMarker(data []byte) (bool, error) {
+	var obj struct{ DeleteMarker bool }
+	if err := bson.Unmarshal(data, &obj); err != nil {
+		return false, err
+	}
+	return obj.DeleteMarker, nil
+}
+
+// versionKey returns the key of a noncurrent version of an object. seq is
+// inverted so that later versions sort first.
+func versionKey(objectName string, seq uint64) []byte {
+	key := make([]byte, len(objectName)+9)
+	copy(key, objectName)
+	binary.BigEndian.PutUint64(key[len(objectName)+1:], math.MaxUint64-seq)
+	return key
+}
+
+// isVersionKey reports whether key is a versionKey of the object whose keys
+// start with prefix, as returned by versionPrefix.
+func isVersionKey(key, prefix []byte) bool {
+	return len(key) == len(prefix)+8 && bytes.HasPrefix(key, prefix)
+}
+
+func versionPrefix(objectName string) []byte {
+	return append([]byte(objectName), 0)
+}
+
 func bucketMetaKey(name string) []byte {
 	return []byte("bucket/" + name)
 }
@@ -66,9 +137,12 @@ func (mb *metaBucket) deleteS3Bucket(bucket string) error {
 }
 
 func (mb *metaBucket) createS3Bucket(bucket string, at time.Time) error {
-	bb := &boltBucket{
+	return mb.putS3Bucket(bucket, &boltBucket{
 		CreationDate: at,
-	}
+	})
+}
+
+func (mb *metaBucket) putS3Bucket(bucket string, bb *boltBucket) error {
 	data, err := bson.Marshal(bb)
 	if err != nil {
 		return err
@@ -82,8 +156,7 @@ func (mb *metaBucket) createS3Bucket(bucket string, at time.Time) error {
 func (mb *metaBucket) s3Bucket(bucket string) (*boltBucket, error) {
 	bts := mb.bucket.Get(bucketMetaKey(bucket))
 	if bts == nil {
-		// FIXME: should return an error once database upgrades are supported.
-		return nil, nil
+		return nil, fmt.Errorf("gofakes3: missing metadata for bucket %q", bucket)
 	}
 
 	var bb boltBucket
@@ -92,3 +165,94 @@ func (mb *metaBucket) s3Bucket(bucket string) (*boltBucket, error) {
 	}
 	return &bb, nil
 }
+
+// schemaVersion is the version of the layout described above. Databases
+// written by older versions are upgraded when they are opened.
+//
+//   - 0: buckets may have no metadata, and objects have no versions.
+//   - 1: noncurrent versions are kept in "_versions".
+const schemaVersion = 1
+
+var schemaVersionKey = []byte("schema")
+
+// schemaVersion returns the version of the layout the database was written
+// with.
+func (db *Backend) schemaVersion(tx *bolt.Tx) (uint64, error) {
+	mb := tx.Bucket(db.metaBucketName)
+	if mb == nil {
+		return 0, nil
+	}
+	v := mb.Get(schemaVersionKey)
+	if v == nil {
+		return 0, nil
+	} else if len(v) != 8 {
+		return 0, fmt.Errorf("gofakes3: invalid bolt schema version %x", v)
+	}
+	version := binary.BigEndian.Uint64(v)
+	if version > schemaVersion {
+		return 0, fmt.Errorf("gofakes3: bolt schema version %d is newer than the supported version %d", version, schemaVersion)
+	}
+	return version, nil
+}
+
+// upgrade brings the database up to date with schemaVersion. Databases that
+// are already up to date are only read, so that they may be opened read-only.
+func (db *Backend) upgrade() error {
+	var version uint64
+	err := db.bolt.View(func(tx *bolt.Tx) (err error) {
+		version, err = db.schemaVersion(tx)
+		return err
+	})
+	if err != nil || version == schemaVersion {
+		return err
+	}
+
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		// Another process may have upgraded the database in the meantime:
+		if version, err := db.schemaVersion(tx); err != nil || version == schemaVersion {
+			return err
+		}
+
+		mb, err := tx.CreateBucketIfNotExists(db.metaBucketName)
+		if err != nil {
+			return err
+		}
+		versions, err := tx.CreateBucketIfNotExists(db.versionsBucketName)
+		if err != nil {
+			return err
+		}
+		metaBucket := &metaBucket{Tx: tx, bucket: mb, metaName: db.metaBucketName}
+		now := db.timeSource.Now()
+
+		err = tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			if db.isInternalBucket(name) {
+				return nil
+			}
+
+			// Objects stored before versioning need no changes, as they are
+			// read as null versions; only the buckets need filling in.
+			if _, err := versions.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+
+			bucket := string(name)
+			bb := &boltBucket{}
+			if mb.Get(bucketMetaKey(bucket)) != nil {
+				if bb, err = metaBucket.s3Bucket(bucket); err != nil {
+					return err
+				}
+			}
+			if bb.CreationDate.IsZero() {
+				bb.CreationDate = now
+			}
+			return metaBucket.putS3Bucket(bucket, bb)
+		})
+		if err != nil {
+			return err
+		}
+
+		var v [8]byte
+		binary.BigEndian.PutUint64(v[:], schemaVersion)
+		return mb.Put(schemaVersionKey, v[:])
+	})
+}
@@ -0,0 +1,510 @@
+package s3bolt
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/internal/s3io"
+)
+
+var (
+	emptyVersionsPage = &gofakes3.ListBucketVersionsPage{}
+
+	// Version IDs are built from a sequence, so base32hex keeps them sortable
+	// in the order they were created.
+	versionIDEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+)
+
+// bucketVersions manages the versions of the objects in an S3 bucket. The
+// returned struct is valid only for the lifetime of the bolt.Tx.
+type bucketVersions struct {
+	name       string
+	versioning gofakes3.VersioningStatus
+
+	// objects holds the current version of each object, and noncurrent the
+	// rest, keyed by versionKey.
+	objects    *bolt.Bucket
+	noncurrent *bolt.Bucket
+
+	// sequence allocates version IDs and versionKeys, and is shared by all
+	// buckets so that a bucket that is deleted and created again never
+	// reuses a version ID.
+	sequence *bolt.Bucket
+}
+
+func (db *Backend) bucketVersions(tx *bolt.Tx, bucketName string) (*bucketVersions, error) {
+	objects := tx.Bucket([]byte(bucketName))
+	if objects == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+
+	metaBucket, err := db.metaBucket(tx)
+	if err != nil {
+		return nil, err
+	}
+	bb, err := metaBucket.s3Bucket(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	sequence := tx.Bucket(db.versionsBucketName)
+	noncurrent := sequence.Bucket([]byte(bucketName))
+	if noncurrent == nil {
+		return nil, fmt.Errorf("gofakes3: missing versions for bucket %q", bucketName)
+	}
+
+	return &bucketVersions{
+		name:       bucketName,
+		versioning: bb.Versioning,
+		objects:    objects,
+		noncurrent: noncurrent,
+		sequence:   sequence,
+	}, nil
+}
+
+// current returns the current version of an object, which may be a delete
+// marker, or nil if the object has no versions.
+func (bv *bucketVersions) current(objectName string) (*boltObject, error) {
+	v := bv.objects.Get([]byte(objectName))
+	if v == nil {
+		return nil, nil
+	}
+	obj, err := decodeBoltObject(v)
+	if err != nil {
+		return nil, fmt.Errorf("gofakes3: could not unmarshal object at %q/%q: %v", bv.name, objectName, err)
+	}
+	return obj, nil
+}
+
+// eachNoncurrent calls fn with the noncurrent versions of an object, newest
+// first, until fn returns false.
+func (bv *bucketVersions) eachNoncurrent(objectName string, fn func(key []byte, obj *boltObject) bool) error {
+	prefix := versionPrefix(objectName)
+	c := bv.noncurrent.Cursor()
+	for k, v := c.Seek(prefix); k != nil && isVersionKey(k, prefix); k, v = c.Next() {
+		obj, err := decodeBoltObject(v)
+		if err != nil {
+			return fmt.Errorf("gofakes3: could not unmarshal version of object at %q/%q: %v", bv.name, objectName, err)
+		}
+		if !fn(append([]byte(nil), k...), obj) {
+			break
+		}
+	}
+	return nil
+}
+
+// version finds a version of an object. An empty versionID finds the current
+// version, unless it is a delete marker. The key and bolt bucket the version
+// is stored in are returned so that it can be saved again.
+func (bv *bucketVersions) version(objectName string, versionID gofakes3.VersionID) (obj *boltObject, key []byte, store *bolt.Bucket, err error) {
+	current, err := bv.current(objectName)
+	if err != nil {
+		return nil, nil, nil, err
+	} else if current == nil {
+		return nil, nil, nil, gofakes3.KeyNotFound(objectName)
+	}
+
+	if versionID == "" {
+		if current.DeleteMarker {
+			return nil, nil, nil, gofakes3.KeyNotFound(objectName)
+		}
+		return current, []byte(objectName), bv.objects, nil
+	}
+	if current.VersionID == versionID {
+		return current, []byte(objectName), bv.objects, nil
+	}
+
+	err = bv.eachNoncurrent(objectName, func(k []byte, version *boltObject) bool {
+		if version.VersionID == versionID {
+			obj, key = version, k
+		}
+		return obj == nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	} else if obj == nil {
+		return nil, nil, nil, gofakes3.ErrNoSuchVersion
+	}
+	return obj, key, bv.noncurrent, nil
+}
+
+// put makes obj the current version of its object, assigning it a version ID
+// if versioning is enabled. Otherwise obj is the null version, and replaces
+// the previous null version.
+func (bv *bucketVersions) put(obj *boltObject) error {
+	if bv.versioning == gofakes3.VersioningEnabled {
+		seq, err := bv.sequence.NextSequence()
+		if err != nil {
+			return err
+		}
+		var id [8]byte
+		binary.BigEndian.PutUint64(id[:], seq)
+		obj.VersionID = gofakes3.VersionID("3/" + versionIDEncoding.EncodeToString(id[:]))
+
+	} else {
+		obj.VersionID = ""
+		var nullKey []byte
+		err := bv.eachNoncurrent(obj.Name, func(k []byte, version *boltObject) bool {
+			if version.VersionID == "" {
+				nullKey = k
+			}
+			return nullKey == nil
+		})
+		if err != nil {
+			return err
+		}
+		if nullKey != nil {
+			if err := bv.noncurrent.Delete(nullKey); err != nil {
+				return err
+			}
+		}
+	}
+
+	name := []byte(obj.Name)
+	current, err := bv.current(obj.Name)
+	if err != nil {
+		return err
+	}
+	if current != nil && (current.VersionID != "" || obj.VersionID != "") {
+		// The current version is kept unless it is the null version being
+		// replaced:
+		seq, err := bv.sequence.NextSequence()
+		if err != nil {
+			return err
+		}
+		data := append([]byte(nil), bv.objects.Get(name)...)
+		if err := bv.noncurrent.Put(versionKey(obj.Name, seq), data); err != nil {
+			return err
+		}
+	}
+
+	data, err := bson.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return bv.objects.Put(name, data)
+}
+
+// rm deletes an object. If the bucket has ever been versioned, this adds a
+// delete marker rather than removing any versions.
+func (bv *bucketVersions) rm(objectName string, at time.Time) (result gofakes3.ObjectDeleteResult, rerr error) {
+	if bv.versioning == gofakes3.VersioningNone {
+		return result, bv.objects.Delete([]byte(objectName))
+	}
+
+	if bv.objects.Get([]byte(objectName)) == nil {
+		// S3 does not report an error when attemping to delete a key that does not exist
+		return result, nil
+	}
+
+	marker := &boltObject{Name: objectName, LastModified: at, DeleteMarker: true}
+	if err := bv.put(marker); err != nil {
+		return result, err
+	}
+	result.IsDeleteMarker = true
+	result.VersionID = marker.VersionID
+	return result, nil
+}
+
+// rmVersion permanently deletes a version of an object. If it is the current
+// version, the newest noncurrent version takes its place.
+func (bv *bucketVersions) rmVersion(objectName string, versionID gofakes3.VersionID) (result gofakes3.ObjectDeleteResult, rerr error) {
+	obj, key, store, err := bv.version(objectName, versionID)
+	if gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchKey) || gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchVersion) {
+		// S3 does not report an error when attemping to delete a key that does not exist
+		return result, nil
+	} else if err != nil {
+		return result, err
+	}
+
+	if err := store.Delete(key); err != nil {
+		return result, err
+	}
+	result.VersionID = obj.VersionID
+	result.IsDeleteMarker = obj.DeleteMarker
+
+	if store == bv.objects {
+		var nextKey []byte
+		err := bv.eachNoncurrent(objectName, func(k []byte, _ *boltObject) bool {
+			nextKey = k
+			return false
+		})
+		if err != nil {
+			return result, err
+		}
+		if nextKey != nil {
+			data := append([]byte(nil), bv.noncurrent.Get(nextKey)...)
+			if err := bv.objects.Put(key, data); err != nil {
+				return result, err
+			}
+			if err := bv.noncurrent.Delete(nextKey); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (db *Backend) VersioningConfiguration(bucketName string) (versioning gofakes3.VersioningConfiguration, rerr error) {
+	err := db.viewS3Bucket(bucketName, func(bb *boltBucket) {
+		versioning.Status = bb.Versioning
+	})
+	return versioning, err
+}
+
+func (db *Backend) SetVersioningConfiguration(bucketName string, v gofakes3.VersioningConfiguration) error {
+	if v.MFADelete.Enabled() {
+		return gofakes3.ErrNotImplemented
+	}
+
+	return db.updateS3Bucket(bucketName, func(bb *boltBucket) {
+		if v.Enabled() {
+			bb.Versioning = gofakes3.VersioningEnabled
+		} else if bb.Versioning == gofakes3.VersioningEnabled {
+			bb.Versioning = gofakes3.VersioningSuspended
+		}
+	})
+}
+
+func (db *Backend) GetObjectVersion(
+	bucketName, objectName string,
+	versionID gofakes3.VersionID,
+	rangeRequest *gofakes3.ObjectRangeRequest) (*gofakes3.Object, error) {
+	if versionID == "" {
+		return db.GetObject(bucketName, objectName, rangeRequest)
+	}
+
+	var obj *boltObject
+	err := db.view(func(tx *bolt.Tx) error {
+		bv, err := db.bucketVersions(tx, bucketName)
+		if err != nil {
+			return err
+		}
+		obj, _, _, err = bv.version(objectName, versionID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.Object(objectName, rangeRequest)
+}
+
+func (db *Backend) HeadObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID) (*gofakes3.Object, error) {
+	obj, err := db.GetObjectVersion(bucketName, objectName, versionID, nil)
+	if err != nil {
+		return nil, err
+	}
+	obj.Contents = s3io.NoOpReadCloser{}
+	return obj, nil
+}
+
+func (db *Backend) DeleteObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID) (result gofakes3.ObjectDeleteResult, rerr error) {
+	return db.DeleteObjectVersionConditional(bucketName, objectName, versionID, nil)
+}
+
+func (db *Backend) DeleteObjectVersionConditional(bucketName, objectName string, versionID gofakes3.VersionID, conditions *gofakes3.DeleteConditions) (result gofakes3.ObjectDeleteResult, rerr error) {
+	if versionID == "" {
+		return db.DeleteObjectConditional(bucketName, objectName, conditions)
+	}
+
+	return result, db.update(func(tx *bolt.Tx) (err error) {
+		bv, err := db.bucketVersions(tx, bucketName)
+		if err != nil {
+			return err
+		}
+		if conditions != nil {
+			obj, _, _, err := bv.version(objectName, versionID)
+			if err != nil && !gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchKey) && !gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchVersion) {
+				return err
+			}
+			if err := gofakes3.CheckDeleteConditions(conditions, conditionalObjectInfo(obj)); err != nil {
+				return err
+			}
+		}
+		result, err = bv.rmVersion(objectName, versionID)
+		return err
+	})
+}
+
+func (db *Backend) DeleteMultiVersions(bucketName string, objects ...gofakes3.ObjectID) (result gofakes3.MultiDeleteResult, err error) {
+	err = db.update(func(tx *bolt.Tx) error {
+		bv, err := db.bucketVersions(tx, bucketName)
+		if err != nil {
+			return err
+		}
+
+		now := db.timeSource.Now()
+
+		for _, object := range objects {
+			var err error
+			if object.VersionID != "" {
+				_, err = bv.rmVersion(object.Key, gofakes3.VersionID(object.VersionID))
+			} else {
+				_, err = bv.rm(object.Key, now)
+			}
+
+			if err != nil {
+				log.Println("delete object failed:", err)
+				errres := gofakes3.ErrorResultFromError(err)
+				errres.Key = object.Key
+				errres.VersionID = object.VersionID
+				result.Error = append(result.Error, errres)
+
+			} else {
+				result.Deleted = append(result.Deleted, object)
+			}
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+func (db *Backend) ListBucketVersions(
+	bucketName string,
+	prefix *gofakes3.Prefix,
+	page *gofakes3.ListBucketVersionsPage,
+) (*gofakes3.ListBucketVersionsResult, error) {
+	if prefix == nil {
+		prefix = emptyPrefix
+	}
+	if page == nil {
+		page = emptyVersionsPage
+	}
+
+	result := gofakes3.NewListBucketVersionsResult(bucketName, prefix, page)
+
+	// The frontend reports null versions as "null", which may come back as a
+	// marker:
+	versionIDMarker := page.VersionIDMarker
+	if versionIDMarker == "null" {
+		versionIDMarker = ""
+	}
+
+	err := db.view(func(tx *bolt.Tx) error {
+		bv, err := db.bucketVersions(tx, bucketName)
+		if err != nil {
+			return err
+		}
+
+		c := bv.objects.Cursor()
+		var match gofakes3.PrefixMatch
+
+		var k, v []byte
+		if page.HasKeyMarker {
+			k, v = c.Seek([]byte(page.KeyMarker))
+			if !page.HasVersionIDMarker && string(k) == page.KeyMarker {
+				k, v = c.Next()
+			}
+		} else {
+			k, v = c.First()
+		}
+
+		var cnt int64
+		var lastKey string
+		var lastVersionID gofakes3.VersionID
+
+		// add adds a version to the result, or reports false if the page is
+		// already full:
+		add := func(obj *boltObject, isLatest bool) bool {
+			if page.MaxKeys > 0 && cnt >= page.MaxKeys {
+				result.IsTruncated = true
+				return false
+			}
+			if obj.DeleteMarker {
+				result.Versions = append(result.Versions, &gofakes3.DeleteMarker{
+					Key:          obj.Name,
+					VersionID:    obj.VersionID,
+					IsLatest:     isLatest,
+					LastModified: gofakes3.NewContentTime(obj.LastModified),
+				})
+			} else {
+				result.Versions = append(result.Versions, &gofakes3.Version{
+					Key:          obj.Name,
+					VersionID:    obj.VersionID,
+					IsLatest:     isLatest,
+					LastModified: gofakes3.NewContentTime(obj.LastModified),
+					Size:         obj.Size,
+					ETag:         gofakes3.ObjectETag(obj.Hash, obj.Metadata),
+					StorageClass: gofakes3.StorageClassFromMetadata(obj.Metadata),
+				})
+			}
+			lastKey, lastVersionID = obj.Name, obj.VersionID
+			cnt++
+			return true
+		}
+
+		for ; k != nil; k, v = c.Next() {
+			key := string(k)
+			if !prefix.Match(key, &match) {
+				continue
+			}
+
+			if match.CommonPrefix {
+				if page.MaxKeys > 0 && cnt >= page.MaxKeys {
+					result.IsTruncated = true
+					break
+				}
+				result.AddPrefix(match.MatchedPart)
+				continue
+			}
+
+			current, err := decodeBoltObject(v)
+			if err != nil {
+				return fmt.Errorf("gofakes3: could not unmarshal object %q: %v", key, err)
+			}
+			// Objects stored before versioning have no name:
+			current.Name = key
+
+			// Versions up to and including the marker were listed on the
+			// previous page:
+			skipping := page.HasVersionIDMarker && key == page.KeyMarker
+			if skipping && current.VersionID == versionIDMarker {
+				skipping = false
+			} else if !skipping && !add(current, true) {
+				break
+			}
+
+			full := false
+			err = bv.eachNoncurrent(key, func(_ []byte, version *boltObject) bool {
+				version.Name = key
+				if skipping {
+					skipping = version.VersionID != versionIDMarker
+					return true
+				}
+				full = !add(version, false)
+				return !full
+			})
+			if err != nil {
+				return err
+			}
+			if skipping {
+				return gofakes3.ErrorInvalidArgument("version-id-marker", string(page.VersionIDMarker), "Invalid version id specified")
+			}
+			if full {
+				break
+			}
+		}
+
+		if result.IsTruncated {
+			result.NextKeyMarker = lastKey
+			result.NextVersionIDMarker = lastVersionID
+			if lastKey != "" && lastVersionID == "" {
+				result.NextVersionIDMarker = "null"
+			}
+		}
+		return nil
+	})
+
+	return result, err
+}
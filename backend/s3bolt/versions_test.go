@@ -0,0 +1,394 @@
+package s3bolt
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/johannesboyne/gofakes3"
+)
+
+func putString(t *testing.T, db *Backend, bucket, object, body string) gofakes3.VersionID {
+	t.Helper()
+	result, err := db.PutObject(bucket, object, nil, strings.NewReader(body), int64(len(body)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.VersionID
+}
+
+func setVersioning(t *testing.T, db *Backend, bucket string, enabled bool) {
+	t.Helper()
+	var v gofakes3.VersioningConfiguration
+	v.SetEnabled(enabled)
+	if err := db.SetVersioningConfiguration(bucket, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getVersionString(t *testing.T, db *Backend, bucket, object string, versionID gofakes3.VersionID) string {
+	t.Helper()
+	obj, err := db.GetObjectVersion(bucket, object, versionID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Contents.Close()
+	body, err := io.ReadAll(obj.Contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// listVersions returns "key@version" for each version in a bucket, with a
+// trailing "!" for delete markers and a leading "*" for the latest versions.
+func listVersions(t *testing.T, db *Backend, bucket string, page *gofakes3.ListBucketVersionsPage) (versions []string, result *gofakes3.ListBucketVersionsResult) {
+	t.Helper()
+	result, err := db.ListBucketVersions(bucket, nil, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range result.Versions {
+		var s string
+		switch item := item.(type) {
+		case *gofakes3.Version:
+			s = item.Key + "@" + string(item.VersionID)
+			if item.IsLatest {
+				s = "*" + s
+			}
+		case *gofakes3.DeleteMarker:
+			s = item.Key + "@" + string(item.VersionID) + "!"
+			if item.IsLatest {
+				s = "*" + s
+			}
+		}
+		versions = append(versions, s)
+	}
+	return versions, result
+}
+
+func TestVersions(t *testing.T) {
+	db, cleanup := setupTestBucket(t, "test-bucket", nil)
+	defer cleanup()
+
+	if v, err := db.VersioningConfiguration("test-bucket"); err != nil {
+		t.Fatal(err)
+	} else if v.Status != gofakes3.VersioningNone {
+		t.Fatal("unexpected versioning status", v.Status)
+	}
+	if _, err := db.VersioningConfiguration("missing"); !gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchBucket) {
+		t.Fatal("expected NoSuchBucket, found", err)
+	}
+
+	setVersioning(t, db, "test-bucket", true)
+	v1 := putString(t, db, "test-bucket", "a", "body 1")
+	v2 := putString(t, db, "test-bucket", "a", "body 2")
+	if v1 == "" || v2 == "" || v1 == v2 {
+		t.Fatal("unexpected versions", v1, v2)
+	}
+
+	if body := getVersionString(t, db, "test-bucket", "a", ""); body != "body 2" {
+		t.Fatal("unexpected body", body)
+	}
+	if body := getVersionString(t, db, "test-bucket", "a", v1); body != "body 1" {
+		t.Fatal("unexpected body", body)
+	}
+	if _, err := db.GetObjectVersion("test-bucket", "a", "nope", nil); !gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchVersion) {
+		t.Fatal("expected NoSuchVersion, found", err)
+	}
+
+	// Deleting the object hides it behind a delete marker (S300008):
+	result, err := db.DeleteObject("test-bucket", "a")
+	if err != nil {
+		t.Fatal(err)
+	} else if !result.IsDeleteMarker || result.VersionID == "" {
+		t.Fatal("unexpected delete result", result)
+	}
+	marker := result.VersionID
+	if _, err := db.GetObject("test-bucket", "a", nil); !gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchKey) {
+		t.Fatal("expected NoSuchKey, found", err)
+	}
+	if list, err := db.ListBucket("test-bucket", nil, gofakes3.ListBucketPage{}); err != nil {
+		t.Fatal(err)
+	} else if len(list.Contents) != 0 {
+		t.Fatal("unexpected objects", list.Contents)
+	}
+	versions, _ := listVersions(t, db, "test-bucket", nil)
+	if expected := []string{"*a@" + string(marker) + "!", "a@" + string(v2), "a@" + string(v1)}; !reflect.DeepEqual(versions, expected) {
+		t.Fatal("unexpected versions", versions, "expected", expected)
+	}
+
+	// Deleting the delete marker brings back the previous version:
+	if _, err := db.DeleteObjectVersion("test-bucket", "a", marker); err != nil {
+		t.Fatal(err)
+	}
+	if body := getVersionString(t, db, "test-bucket", "a", ""); body != "body 2" {
+		t.Fatal("unexpected body", body)
+	}
+
+	// Versions that don't exist are ignored (S300002):
+	if result, err := db.DeleteObjectVersion("test-bucket", "a", "nope"); err != nil || result.VersionID != "" {
+		t.Fatal("unexpected delete result", result, err)
+	}
+	if err := db.DeleteBucket("test-bucket"); !gofakes3.HasErrorCode(err, gofakes3.ErrBucketNotEmpty) {
+		t.Fatal("expected BucketNotEmpty, found", err)
+	}
+
+	// Deleting every version deletes the object (S300009):
+	multi, err := db.DeleteMultiVersions("test-bucket",
+		gofakes3.ObjectID{Key: "a", VersionID: string(v1)},
+		gofakes3.ObjectID{Key: "a", VersionID: string(v2)})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(multi.Deleted) != 2 || len(multi.Error) != 0 {
+		t.Fatal("unexpected delete result", multi)
+	}
+	if versions, _ := listVersions(t, db, "test-bucket", nil); len(versions) != 0 {
+		t.Fatal("unexpected versions", versions)
+	}
+	if err := db.DeleteBucket("test-bucket"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVersionsSuspended(t *testing.T) {
+	db, cleanup := setupTestBucket(t, "test-bucket", nil)
+	defer cleanup()
+
+	setVersioning(t, db, "test-bucket", true)
+	v1 := putString(t, db, "test-bucket", "a", "body 1")
+	setVersioning(t, db, "test-bucket", false)
+	if v, err := db.VersioningConfiguration("test-bucket"); err != nil {
+		t.Fatal(err)
+	} else if v.Status != gofakes3.VersioningSuspended {
+		t.Fatal("unexpected versioning status", v.Status)
+	}
+
+	// Objects put while versioning is suspended replace the null version, but
+	// earlier versions are kept (S300001):
+	if v := putString(t, db, "test-bucket", "a", "body 2"); v != "" {
+		t.Fatal("unexpected version", v)
+	}
+	putString(t, db, "test-bucket", "a", "body 3")
+	versions, _ := listVersions(t, db, "test-bucket", nil)
+	if expected := []string{"*a@", "a@" + string(v1)}; !reflect.DeepEqual(versions, expected) {
+		t.Fatal("unexpected versions", versions, "expected", expected)
+	}
+	if body := getVersionString(t, db, "test-bucket", "a", ""); body != "body 3" {
+		t.Fatal("unexpected body", body)
+	}
+	if body := getVersionString(t, db, "test-bucket", "a", v1); body != "body 1" {
+		t.Fatal("unexpected body", body)
+	}
+
+	// A delete marker replaces the null version too:
+	if result, err := db.DeleteObject("test-bucket", "a"); err != nil {
+		t.Fatal(err)
+	} else if !result.IsDeleteMarker || result.VersionID != "" {
+		t.Fatal("unexpected delete result", result)
+	}
+	versions, _ = listVersions(t, db, "test-bucket", nil)
+	if expected := []string{"*a@!", "a@" + string(v1)}; !reflect.DeepEqual(versions, expected) {
+		t.Fatal("unexpected versions", versions, "expected", expected)
+	}
+
+	// Once versioning is enabled again, the null version is kept:
+	setVersioning(t, db, "test-bucket", true)
+	v2 := putString(t, db, "test-bucket", "a", "body 4")
+	versions, _ = listVersions(t, db, "test-bucket", nil)
+	if expected := []string{"*a@" + string(v2), "a@!", "a@" + string(v1)}; !reflect.DeepEqual(versions, expected) {
+		t.Fatal("unexpected versions", versions, "expected", expected)
+	}
+}
+
+func TestListBucketVersionsPages(t *testing.T) {
+	db, cleanup := setupTestBucket(t, "test-bucket", []string{"b"})
+	defer cleanup()
+
+	setVersioning(t, db, "test-bucket", true)
+	for _, object := range []string{"a", "a", "b", "c", "c"} {
+		putString(t, db, "test-bucket", object, object)
+	}
+
+	all, _ := listVersions(t, db, "test-bucket", nil)
+	if len(all) != 6 {
+		t.Fatal("unexpected versions", all)
+	}
+
+	// Every page size must list each version exactly once, including the
+	// null version of "b", which is reported as the marker "null":
+	for maxKeys := int64(1); maxKeys <= 6; maxKeys++ {
+		var found []string
+		page := &gofakes3.ListBucketVersionsPage{MaxKeys: maxKeys}
+		for {
+			versions, result := listVersions(t, db, "test-bucket", page)
+			found = append(found, versions...)
+			if !result.IsTruncated {
+				break
+			} else if len(found) > len(all) {
+				t.Fatal(maxKeys, "pagination does not terminate", found)
+			}
+			page = &gofakes3.ListBucketVersionsPage{
+				KeyMarker:          result.NextKeyMarker,
+				HasKeyMarker:       true,
+				VersionIDMarker:    result.NextVersionIDMarker,
+				HasVersionIDMarker: true,
+				MaxKeys:            maxKeys,
+			}
+		}
+		if !reflect.DeepEqual(found, all) {
+			t.Fatal(maxKeys, "unexpected versions", found, "expected", all)
+		}
+	}
+
+	// A key marker alone starts after the key:
+	versions, _ := listVersions(t, db, "test-bucket", &gofakes3.ListBucketVersionsPage{KeyMarker: "b", HasKeyMarker: true})
+	if !reflect.DeepEqual(versions, all[4:]) {
+		t.Fatal("unexpected versions", versions)
+	}
+
+	_, err := db.ListBucketVersions("test-bucket", nil, &gofakes3.ListBucketVersionsPage{
+		KeyMarker: "a", HasKeyMarker: true, VersionIDMarker: "nope", HasVersionIDMarker: true,
+	})
+	if !gofakes3.HasErrorCode(err, gofakes3.ErrInvalidArgument) {
+		t.Fatal("expected InvalidArgument, found", err)
+	}
+}
+
+// writeLegacyDB writes a database in the layout used before versioning, which
+// has no versions, no schema version and possibly no bucket metadata.
+func writeLegacyDB(t *testing.T, file string) {
+	t.Helper()
+	legacy, err := bolt.Open(file, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = legacy.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("legacy"))
+		if err != nil {
+			return err
+		}
+		data, err := bson.Marshal(&struct {
+			Metadata     map[string]string
+			LastModified time.Time
+			Size         int64
+			Contents     []byte
+			Hash         []byte
+		}{
+			Size:     5,
+			Contents: []byte("hello"),
+			Hash:     []byte("hash"),
+		})
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("object"), data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.Close()
+}
+
+func TestUpgrade(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "gofakes3-test-*.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+	writeLegacyDB(t, tmpFile.Name())
+
+	db, err := NewFile(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.bolt.Close()
+
+	buckets, err := db.ListBuckets()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(buckets) != 1 || buckets[0].Name != "legacy" || buckets[0].CreationDate.IsZero() {
+		t.Fatal("unexpected buckets", buckets)
+	}
+	if body := getVersionString(t, db, "legacy", "object", ""); body != "hello" {
+		t.Fatal("unexpected body", body)
+	}
+
+	// Legacy objects are the null version, which is kept once versioning is
+	// enabled:
+	setVersioning(t, db, "legacy", true)
+	v1 := putString(t, db, "legacy", "object", "world")
+	versions, _ := listVersions(t, db, "legacy", nil)
+	if expected := []string{"*object@" + string(v1), "object@"}; !reflect.DeepEqual(versions, expected) {
+		t.Fatal("unexpected versions", versions, "expected", expected)
+	}
+
+	// Upgrading an up to date database changes nothing:
+	if err := db.upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := listVersions(t, db, "legacy", nil); !reflect.DeepEqual(after, versions) {
+		t.Fatal("unexpected versions", after)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "gofakes3-test-*.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	db, err := NewFile(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateBucket("test-bucket"); err != nil {
+		t.Fatal(err)
+	}
+	putString(t, db, "test-bucket", "object", "hello")
+	db.bolt.Close()
+
+	// Databases that are up to date can be read without being written to:
+	readOnly, err := bolt.Open(tmpFile.Name(), 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readOnly.Close()
+	if body := getVersionString(t, New(readOnly), "test-bucket", "object", ""); body != "hello" {
+		t.Fatal("unexpected body", body)
+	}
+}
+
+func TestUpgradeReadOnly(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "gofakes3-test-*.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+	writeLegacyDB(t, tmpFile.Name())
+
+	readOnly, err := bolt.Open(tmpFile.Name(), 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readOnly.Close()
+
+	// The upgrade fails with the first operation rather than with New:
+	db := New(readOnly)
+	if _, err := db.ListBuckets(); err == nil {
+		t.Fatal("expected the upgrade to fail")
+	}
+	if _, err := db.ListBuckets(); err == nil {
+		t.Fatal("expected the upgrade error again")
+	}
+}
@@ -26,6 +26,11 @@ type Backend struct {
 
 var _ gofakes3.Backend = &Backend{}
 var _ gofakes3.VersionedBackend = &Backend{}
+var _ gofakes3.BucketPolicyBackend = &Backend{}
+var _ gofakes3.ACLBackend = &Backend{}
+var _ gofakes3.ObjectTaggingBackend = &Backend{}
+var _ gofakes3.BucketTaggingBackend = &Backend{}
+var _ gofakes3.ObjectMetadataBackend = &Backend{}
 
 type Option func(b *Backend)
 
@@ -119,8 +124,9 @@ func (db *Backend) ListBucket(name string, prefix *gofakes3.Prefix, page gofakes
 			response.Add(&gofakes3.Content{
 				Key:          item.data.name,
 				LastModified: gofakes3.NewContentTime(item.data.lastModified),
-				ETag:         gofakes3.FormatETag(item.data.hash),
+				ETag:         gofakes3.ObjectETag(item.data.hash, item.data.metadata),
 				Size:         int64(len(item.data.body)),
+				StorageClass: gofakes3.StorageClassFromMetadata(item.data.metadata),
 			})
 		}
 
@@ -197,7 +203,16 @@ func (db *Backend) HeadObject(bucketName, objectName string) (*gofakes3.Object,
 		return nil, gofakes3.KeyNotFound(objectName)
 	}
 
-	return obj.data.toObject(nil, false)
+	result, err := obj.data.toObject(nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if bucket.versioning != gofakes3.VersioningEnabled {
+		result.VersionID = ""
+	}
+
+	return result, nil
 }
 
 func (db *Backend) GetObject(bucketName, objectName string, rangeRequest *gofakes3.ObjectRangeRequest) (*gofakes3.Object, error) {
@@ -295,7 +310,15 @@ func (db *Backend) CopyObject(srcBucket, srcKey, dstBucket, dstKey string, meta
 	return gofakes3.CopyObject(db, srcBucket, srcKey, dstBucket, dstKey, meta)
 }
 
+func (db *Backend) CopyObjectConditional(srcBucket, srcKey, dstBucket, dstKey string, meta map[string]string, conditions *gofakes3.PutConditions) (result gofakes3.CopyObjectResult, err error) {
+	return gofakes3.CopyObjectConditional(db, srcBucket, srcKey, dstBucket, dstKey, meta, conditions)
+}
+
 func (db *Backend) DeleteObject(bucketName, objectName string) (result gofakes3.ObjectDeleteResult, rerr error) {
+	return db.DeleteObjectConditional(bucketName, objectName, nil)
+}
+
+func (db *Backend) DeleteObjectConditional(bucketName, objectName string, conditions *gofakes3.DeleteConditions) (result gofakes3.ObjectDeleteResult, rerr error) {
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -304,6 +327,16 @@ func (db *Backend) DeleteObject(bucketName, objectName string) (result gofakes3.
 		return result, gofakes3.BucketNotFound(bucketName)
 	}
 
+	if conditions != nil {
+		objectInfo, err := db.getConditionalObjectInfo(bucket, objectName)
+		if err != nil {
+			return result, err
+		}
+		if err := gofakes3.CheckDeleteConditions(conditions, objectInfo); err != nil {
+			return result, err
+		}
+	}
+
 	return bucket.rm(objectName, db.timeSource.Now())
 }
 
@@ -409,6 +442,171 @@ func (db *Backend) SetVersioningConfiguration(bucketName string, v gofakes3.Vers
 	return nil
 }
 
+func (db *Backend) BucketPolicy(bucketName string) ([]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	if bucket.policy == nil {
+		return nil, gofakes3.ResourceError(gofakes3.ErrNoSuchBucketPolicy, bucketName)
+	}
+	return bucket.policy, nil
+}
+
+func (db *Backend) PutBucketPolicy(bucketName string, policy []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+	bucket.policy = policy
+	return nil
+}
+
+func (db *Backend) DeleteBucketPolicy(bucketName string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+	bucket.policy = nil
+	return nil
+}
+
+func (db *Backend) BucketACL(bucketName string) (*gofakes3.AccessControlPolicy, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	return bucket.acl, nil
+}
+
+func (db *Backend) PutBucketACL(bucketName string, acl *gofakes3.AccessControlPolicy) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+	bucket.acl = acl
+	return nil
+}
+
+func (db *Backend) BucketTagging(bucketName string) ([]gofakes3.Tag, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	if len(bucket.tags) == 0 {
+		return nil, gofakes3.ResourceError(gofakes3.ErrNoSuchTagSet, bucketName)
+	}
+	return bucket.tags, nil
+}
+
+func (db *Backend) PutBucketTagging(bucketName string, tags []gofakes3.Tag) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+	bucket.tags = tags
+	return nil
+}
+
+func (db *Backend) DeleteBucketTagging(bucketName string) error {
+	return db.PutBucketTagging(bucketName, nil)
+}
+
+func (db *Backend) ObjectACL(bucketName, objectName string, versionID gofakes3.VersionID) (*gofakes3.AccessControlPolicy, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+
+	obj, err := bucket.objectVersion(objectName, versionID)
+	if err != nil {
+		return nil, err
+	}
+	return obj.acl, nil
+}
+
+func (db *Backend) PutObjectACL(bucketName, objectName string, versionID gofakes3.VersionID, acl *gofakes3.AccessControlPolicy) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+
+	obj, err := bucket.objectVersion(objectName, versionID)
+	if err != nil {
+		return err
+	}
+	obj.acl = acl
+	return nil
+}
+
+func (db *Backend) PutObjectTagging(bucketName, objectName string, versionID gofakes3.VersionID, tagging string) error {
+	return db.setMetadata(bucketName, objectName, versionID, map[string]string{"X-Amz-Tagging": tagging})
+}
+
+func (db *Backend) PutObjectMetadata(bucketName, objectName string, versionID gofakes3.VersionID, meta map[string]string) error {
+	return db.setMetadata(bucketName, objectName, versionID, meta)
+}
+
+// setMetadata sets the metadata keys of an object version, or removes those
+// whose values are empty, leaving the rest of the object as it is.
+func (db *Backend) setMetadata(bucketName, objectName string, versionID gofakes3.VersionID, set map[string]string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	bucket := db.buckets[bucketName]
+	if bucket == nil {
+		return gofakes3.BucketNotFound(bucketName)
+	}
+
+	obj, err := bucket.objectVersion(objectName, versionID)
+	if err != nil {
+		return err
+	}
+
+	// The metadata may be shared with objects that have been returned, so it
+	// is replaced rather than modified:
+	meta := make(map[string]string, len(obj.metadata)+len(set))
+	for k, v := range obj.metadata {
+		meta[k] = v
+	}
+	for k, v := range set {
+		if v == "" {
+			delete(meta, k)
+		} else {
+			meta[k] = v
+		}
+	}
+	obj.metadata = meta
+	return nil
+}
+
 func (db *Backend) GetObjectVersion(
 	bucketName, objectName string,
 	versionID gofakes3.VersionID,
@@ -455,6 +653,10 @@ func (db *Backend) HeadObjectVersion(bucketName, objectName string, versionID go
 }
 
 func (db *Backend) DeleteObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID) (result gofakes3.ObjectDeleteResult, rerr error) {
+	return db.DeleteObjectVersionConditional(bucketName, objectName, versionID, nil)
+}
+
+func (db *Backend) DeleteObjectVersionConditional(bucketName, objectName string, versionID gofakes3.VersionID, conditions *gofakes3.DeleteConditions) (result gofakes3.ObjectDeleteResult, rerr error) {
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -463,6 +665,16 @@ func (db *Backend) DeleteObjectVersion(bucketName, objectName string, versionID
 		return result, gofakes3.BucketNotFound(bucketName)
 	}
 
+	if conditions != nil {
+		ver, err := bucket.objectVersion(objectName, versionID)
+		if err != nil && !gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchKey) && !gofakes3.HasErrorCode(err, gofakes3.ErrNoSuchVersion) {
+			return result, err
+		}
+		if err := gofakes3.CheckDeleteConditions(conditions, conditionalObjectInfo(ver)); err != nil {
+			return result, err
+		}
+	}
+
 	return bucket.rmVersion(objectName, versionID, db.timeSource.Now())
 }
 
@@ -557,7 +769,8 @@ func (db *Backend) ListBucketVersions(
 					IsLatest:     version == object.data,
 					LastModified: gofakes3.NewContentTime(version.lastModified),
 					Size:         int64(len(version.body)),
-					ETag:         gofakes3.FormatETag(version.hash),
+					ETag:         gofakes3.ObjectETag(version.hash, version.metadata),
+					StorageClass: gofakes3.StorageClassFromMetadata(version.metadata),
 				}
 				if bucket.versioning != gofakes3.VersioningNone { // S300005
 					resultVer.VersionID = version.versionID
@@ -583,13 +796,25 @@ done:
 // This method assumes the bucket lock is already held.
 func (db *Backend) getConditionalObjectInfo(bucket *bucket, objectName string) (*gofakes3.ConditionalObjectInfo, error) {
 	existing := bucket.object(objectName)
-	if existing == nil || existing.data.deleteMarker {
+	if existing == nil {
 		return &gofakes3.ConditionalObjectInfo{Exists: false}, nil
 	}
+	return conditionalObjectInfo(existing.data), nil
+}
+
+// conditionalObjectInfo describes a version of an object, which may be nil,
+// for the conditions of a request.
+func conditionalObjectInfo(data *bucketData) *gofakes3.ConditionalObjectInfo {
+	if data == nil || data.deleteMarker {
+		return &gofakes3.ConditionalObjectInfo{Exists: false}
+	}
 	return &gofakes3.ConditionalObjectInfo{
-		Exists: true,
-		Hash:   existing.data.hash,
-	}, nil
+		Exists:       true,
+		Hash:         data.hash,
+		Metadata:     data.metadata,
+		Size:         int64(len(data.body)),
+		LastModified: data.lastModified,
+	}
 }
 
 // nextVersion assumes the backend's lock is acquired
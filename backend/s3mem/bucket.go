@@ -19,6 +19,9 @@ type bucket struct {
 	versioning   gofakes3.VersioningStatus
 	versionGen   versionGenFunc
 	creationDate gofakes3.ContentTime
+	policy       []byte
+	acl          *gofakes3.AccessControlPolicy
+	tags         []gofakes3.Tag
 
 	objects *skiplist.SkipList
 }
@@ -119,6 +122,10 @@ type bucketData struct {
 	body         []byte
 	hash         []byte
 	metadata     map[string]string
+
+	// Set by PutObjectACL; objects are created with the ACL in their
+	// metadata.
+	acl *gofakes3.AccessControlPolicy
 }
 
 func (bi *bucketData) toObject(rangeRequest *gofakes3.ObjectRangeRequest, withBody bool) (obj *gofakes3.Object, err error) {
@@ -152,6 +159,7 @@ func (bi *bucketData) toObject(rangeRequest *gofakes3.ObjectRangeRequest, withBo
 		Hash:           bi.hash,
 		Metadata:       bi.metadata,
 		Size:           sz,
+		LastModified:   bi.lastModified,
 		Range:          rnge,
 		IsDeleteMarker: bi.deleteMarker,
 		VersionID:      bi.versionID,
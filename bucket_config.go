@@ -0,0 +1,75 @@
+package gofakes3
+
+import "sync"
+
+// bucketConfigs stores a configuration of each bucket in memory, for backends
+// that do not implement the interface that stores it. notFound is the error
+// reported for buckets that have no configuration.
+type bucketConfigs[T any] struct {
+	storage  Backend
+	notFound ErrorCode
+	configs  map[string]T
+	mu       sync.Mutex
+}
+
+func newBucketConfigs[T any](storage Backend, notFound ErrorCode) *bucketConfigs[T] {
+	return &bucketConfigs[T]{
+		storage:  storage,
+		notFound: notFound,
+		configs:  make(map[string]T),
+	}
+}
+
+func (bc *bucketConfigs[T]) get(bucket string) (config T, err error) {
+	if err := bc.ensureBucketExists(bucket); err != nil {
+		return config, err
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	config, ok := bc.configs[bucket]
+	if !ok {
+		return config, ResourceError(bc.notFound, bucket)
+	}
+	return config, nil
+}
+
+func (bc *bucketConfigs[T]) put(bucket string, config T) error {
+	if err := bc.ensureBucketExists(bucket); err != nil {
+		return err
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	bc.configs[bucket] = config
+	return nil
+}
+
+func (bc *bucketConfigs[T]) delete(bucket string) error {
+	if err := bc.ensureBucketExists(bucket); err != nil {
+		return err
+	}
+	bc.forget(bucket)
+	return nil
+}
+
+// forget removes the configuration of a bucket that has been deleted, so that
+// it does not apply to a new bucket with the same name.
+func (bc *bucketConfigs[T]) forget(bucket string) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	delete(bc.configs, bucket)
+}
+
+func (bc *bucketConfigs[T]) ensureBucketExists(bucket string) error {
+	exists, err := bc.storage.BucketExists(bucket)
+	if err != nil {
+		return err
+	} else if !exists {
+		return BucketNotFound(bucket)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package gofakes3
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The largest policy document S3 accepts.
+const bucketPolicySizeLimit = 20 * 1024
+
+var _ BucketPolicyBackend = &bucketPolicies{}
+
+// bucketPolicies stores bucket policies in memory for backends that do not
+// implement BucketPolicyBackend.
+type bucketPolicies struct {
+	*bucketConfigs[[]byte]
+}
+
+func newBucketPolicies(storage Backend) *bucketPolicies {
+	return &bucketPolicies{newBucketConfigs[[]byte](storage, ErrNoSuchBucketPolicy)}
+}
+
+func (bp *bucketPolicies) BucketPolicy(bucket string) ([]byte, error) {
+	return bp.get(bucket)
+}
+
+func (bp *bucketPolicies) PutBucketPolicy(bucket string, policy []byte) error {
+	return bp.put(bucket, policy)
+}
+
+func (bp *bucketPolicies) DeleteBucketPolicy(bucket string) error {
+	return bp.delete(bucket)
+}
+
+// policyContext collects the condition keys that apply to the request, listed
+// here:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/amazon-s3-policy-keys.html
+func (g *GoFakeS3) policyContext(r *http.Request) map[string]string {
+	now := g.timeSource.Now().UTC()
+	context := map[string]string{
+		"aws:securetransport": strconv.FormatBool(r.TLS != nil),
+		"aws:currenttime":     now.Format("2006-01-02T15:04:05Z"),
+		"aws:epochtime":       strconv.FormatInt(now.Unix(), 10),
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		context["aws:sourceip"] = host
+	}
+	if ua := r.UserAgent(); ua != "" {
+		context["aws:useragent"] = ua
+	}
+	if referer := r.Referer(); referer != "" {
+		context["aws:referer"] = referer
+	}
+
+	query := r.URL.Query()
+	for _, key := range []string{"prefix", "delimiter", "max-keys", "versionId"} {
+		if _, ok := query[key]; ok {
+			context["s3:"+strings.ToLower(key)] = query.Get(key)
+		}
+	}
+
+	for name, values := range r.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") && len(values) > 0 {
+			context["s3:"+name] = values[0]
+		}
+	}
+
+	return context
+}
@@ -0,0 +1,290 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/johannesboyne/gofakes3"
+)
+
+// withPolicyCredentials enables authentication with two access keys, so that
+// policies can treat them differently.
+func withPolicyCredentials() testServerOption {
+	return withFakerOptions(gofakes3.WithCredentials(gofakes3.StaticCredentials{
+		"owner-access":  "owner-secret",
+		"reader-access": "reader-secret",
+	}))
+}
+
+func (ts *testServer) putBucketPolicy(svc *s3.Client, policy string) {
+	ts.Helper()
+	_, err := svc.PutBucketPolicy(context.TODO(), &s3.PutBucketPolicyInput{
+		Bucket: aws.String(defaultBucket),
+		Policy: aws.String(policy),
+	})
+	ts.OK(err)
+}
+
+func (ts *testServer) assertGetObjectDenied(svc *s3.Client, key string, denied bool) {
+	ts.Helper()
+	out, err := svc.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String(key),
+	})
+	if denied {
+		if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+			ts.Fatal("expected AccessDenied for", key, "found", err)
+		}
+		return
+	}
+	ts.OK(err)
+	out.Body.Close()
+}
+
+func TestBucketPolicyCRUD(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.GetBucketPolicy(context.TODO(), &s3.GetBucketPolicyInput{Bucket: aws.String(defaultBucket)})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchBucketPolicy) {
+		t.Fatal("expected NoSuchBucketPolicy, found", err)
+	}
+
+	const policy = `{
+		"Version": "2012-10-17",
+		"Statement": {
+			"Effect": "Allow",
+			"Principal": "*",
+			"Action": "s3:GetObject",
+			"Resource": "arn:aws:s3:::mybucket/*"
+		}
+	}`
+	ts.putBucketPolicy(svc, policy)
+
+	out, err := svc.GetBucketPolicy(context.TODO(), &s3.GetBucketPolicyInput{Bucket: aws.String(defaultBucket)})
+	ts.OK(err)
+	if aws.ToString(out.Policy) != policy {
+		t.Fatal("unexpected policy", aws.ToString(out.Policy))
+	}
+
+	_, err = svc.DeleteBucketPolicy(context.TODO(), &s3.DeleteBucketPolicyInput{Bucket: aws.String(defaultBucket)})
+	ts.OK(err)
+
+	_, err = svc.GetBucketPolicy(context.TODO(), &s3.GetBucketPolicyInput{Bucket: aws.String(defaultBucket)})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchBucketPolicy) {
+		t.Fatal("expected NoSuchBucketPolicy, found", err)
+	}
+
+	_, err = svc.GetBucketPolicy(context.TODO(), &s3.GetBucketPolicyInput{Bucket: aws.String("nope")})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchBucket) {
+		t.Fatal("expected NoSuchBucket, found", err)
+	}
+}
+
+func TestBucketPolicyMalformed(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	for idx, policy := range []string{
+		`not json`,
+		`{"Version": "2012-10-17"}`,
+		`{"Statement": [{"Effect": "Maybe", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::mybucket/*"}]}`,
+		`{"Statement": [{"Effect": "Allow", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::mybucket/*"}]}`,
+		`{"Statement": [{"Effect": "Allow", "Principal": "*", "Resource": "arn:aws:s3:::mybucket/*"}]}`,
+		`{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "iam:PassRole", "Resource": "arn:aws:s3:::mybucket/*"}]}`,
+		`{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject"}]}`,
+		`{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::otherbucket/*"}]}`,
+		`{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::mybucket/*",
+			"Condition": {"StringSortOf": {"s3:prefix": "a"}}}]}`,
+	} {
+		_, err := svc.PutBucketPolicy(context.TODO(), &s3.PutBucketPolicyInput{
+			Bucket: aws.String(defaultBucket),
+			Policy: aws.String(policy),
+		})
+		if !hasErrorCode(err, gofakes3.ErrMalformedPolicy) {
+			t.Fatal(idx, "expected MalformedPolicy, found", err)
+		}
+	}
+}
+
+func TestBucketPolicyEvaluation(t *testing.T) {
+	ts := newTestServer(t, withPolicyCredentials())
+	defer ts.Close()
+	owner := ts.s3ClientWithCredentials("owner-access", "owner-secret")
+	reader := ts.s3ClientWithCredentials("reader-access", "reader-secret")
+
+	ts.backendPutString(defaultBucket, "public/file", nil, "hello")
+	ts.backendPutString(defaultBucket, "public/secret", nil, "hello")
+	ts.backendPutString(defaultBucket, "private/file", nil, "hello")
+
+	ts.putBucketPolicy(owner, `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{
+				"Sid": "OwnerEverything",
+				"Effect": "Allow",
+				"Principal": {"AWS": "owner-access"},
+				"Action": "s3:*",
+				"Resource": ["arn:aws:s3:::mybucket", "arn:aws:s3:::mybucket/*"]
+			},
+			{
+				"Sid": "ReaderPublic",
+				"Effect": "Allow",
+				"Principal": {"AWS": ["reader-access"]},
+				"Action": "s3:GetObject",
+				"Resource": "arn:aws:s3:::mybucket/public/*"
+			},
+			{
+				"Sid": "NobodySecrets",
+				"Effect": "Deny",
+				"Principal": "*",
+				"Action": "s3:GetObject",
+				"Resource": "arn:aws:s3:::mybucket/public/secret*"
+			}
+		]
+	}`)
+
+	ts.assertGetObjectDenied(reader, "public/file", false)
+	ts.assertGetObjectDenied(reader, "private/file", true)  // Implicit deny
+	ts.assertGetObjectDenied(reader, "public/secret", true) // Explicit deny
+	ts.assertGetObjectDenied(owner, "private/file", false)
+	ts.assertGetObjectDenied(owner, "public/secret", true) // Deny beats Allow
+
+	_, err := reader.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("public/new"),
+		Body:   bytes.NewReader([]byte("hello")),
+	})
+	if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+
+	_, err = owner.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("public/new"),
+		Body:   bytes.NewReader([]byte("hello")),
+	})
+	ts.OK(err)
+
+	// Implicitly denied callers may still manage the policy, but may not
+	// read the bucket:
+	_, err = reader.GetBucketPolicy(context.TODO(), &s3.GetBucketPolicyInput{Bucket: aws.String(defaultBucket)})
+	ts.OK(err)
+	_, err = reader.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{Bucket: aws.String(defaultBucket)})
+	if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+}
+
+func TestBucketPolicyDeleteObjects(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.backendPutString(defaultBucket, "keep/file", nil, "hello")
+	ts.backendPutString(defaultBucket, "tmp/file", nil, "hello")
+
+	ts.putBucketPolicy(svc, `{
+		"Statement": [
+			{"Effect": "Allow", "Principal": "*", "Action": "s3:*", "Resource": "arn:aws:s3:::mybucket/*"},
+			{"Effect": "Deny", "Principal": "*", "Action": "s3:DeleteObject", "Resource": "arn:aws:s3:::mybucket/keep/*"}
+		]
+	}`)
+
+	out, err := svc.DeleteObjects(context.TODO(), &s3.DeleteObjectsInput{
+		Bucket: aws.String(defaultBucket),
+		Delete: &s3types.Delete{Objects: []s3types.ObjectIdentifier{
+			{Key: aws.String("keep/file")},
+			{Key: aws.String("tmp/file")},
+		}},
+	})
+	ts.OK(err)
+
+	if len(out.Deleted) != 1 || aws.ToString(out.Deleted[0].Key) != "tmp/file" {
+		t.Fatal("unexpected deleted objects", out.Deleted)
+	}
+	if len(out.Errors) != 1 || aws.ToString(out.Errors[0].Key) != "keep/file" || aws.ToString(out.Errors[0].Code) != "AccessDenied" {
+		t.Fatal("unexpected errors", out.Errors)
+	}
+	if exists, _ := ts.backendObjectExists(defaultBucket, "keep/file"); !exists {
+		t.Fatal("denied object was deleted")
+	}
+}
+
+func TestBucketPolicyConditions(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		condition string
+		denied    bool
+	}{
+		{"secure-transport-required", `{"Bool": {"aws:SecureTransport": "true"}}`, true},
+		{"secure-transport-absent", `{"Bool": {"aws:SecureTransport": false}}`, false},
+		{"source-ip-allowed", `{"IpAddress": {"aws:SourceIp": ["10.0.0.0/8", "127.0.0.0/8"]}}`, false},
+		{"source-ip-denied", `{"IpAddress": {"aws:SourceIp": "10.0.0.0/8"}}`, true},
+		{"not-source-ip", `{"NotIpAddress": {"aws:SourceIp": "10.0.0.1"}}`, false},
+		{"missing-key", `{"StringEquals": {"s3:x-amz-server-side-encryption": "AES256"}}`, true},
+		{"missing-key-if-exists", `{"StringEqualsIfExists": {"s3:x-amz-server-side-encryption": "AES256"}}`, false},
+		{"null", `{"Null": {"s3:x-amz-server-side-encryption": "true"}}`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			defer ts.Close()
+			svc := ts.s3Client()
+			ts.backendPutString(defaultBucket, "object", nil, "hello")
+
+			ts.putBucketPolicy(svc, `{
+				"Statement": [{
+					"Effect": "Allow",
+					"Principal": "*",
+					"Action": "s3:GetObject",
+					"Resource": "arn:aws:s3:::mybucket/*",
+					"Condition": `+tc.condition+`
+				}]
+			}`)
+			ts.assertGetObjectDenied(svc, "object", tc.denied)
+		})
+	}
+}
+
+func TestBucketPolicyListPrefix(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.backendPutString(defaultBucket, "home/user/file", nil, "hello")
+
+	ts.putBucketPolicy(svc, `{
+		"Statement": [{
+			"Effect": "Allow",
+			"Principal": "*",
+			"Action": "s3:ListBucket",
+			"Resource": "arn:aws:s3:::mybucket",
+			"Condition": {"StringLike": {"s3:prefix": ["home/user/*", ""]}}
+		}]
+	}`)
+
+	for _, tc := range []struct {
+		prefix *string
+		denied bool
+	}{
+		{aws.String("home/user/"), false},
+		{aws.String("home/other/"), true},
+		{nil, true},
+	} {
+		_, err := svc.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
+			Bucket: aws.String(defaultBucket),
+			Prefix: tc.prefix,
+		})
+		if tc.denied && !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+			t.Fatal("expected AccessDenied for prefix", aws.ToString(tc.prefix), "found", err)
+		} else if !tc.denied {
+			ts.OK(err)
+		}
+	}
+}
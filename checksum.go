@@ -0,0 +1,405 @@
+package gofakes3
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// ChecksumAlgorithm is one of the algorithms S3 accepts in the
+// x-amz-sdk-checksum-algorithm and x-amz-checksum-algorithm headers.
+type ChecksumAlgorithm string
+
+const (
+	ChecksumCRC32     ChecksumAlgorithm = "CRC32"
+	ChecksumCRC32C    ChecksumAlgorithm = "CRC32C"
+	ChecksumCRC64NVME ChecksumAlgorithm = "CRC64NVME"
+	ChecksumSHA1      ChecksumAlgorithm = "SHA1"
+	ChecksumSHA256    ChecksumAlgorithm = "SHA256"
+)
+
+var checksumAlgorithms = []ChecksumAlgorithm{
+	ChecksumCRC32,
+	ChecksumCRC32C,
+	ChecksumCRC64NVME,
+	ChecksumSHA1,
+	ChecksumSHA256,
+}
+
+// ChecksumType says whether the checksum of a multipart object covers the
+// whole object, or is a checksum of the checksums of its parts.
+type ChecksumType string
+
+const (
+	ChecksumTypeFullObject ChecksumType = "FULL_OBJECT"
+	ChecksumTypeComposite  ChecksumType = "COMPOSITE"
+)
+
+const (
+	// The metadata key objects keep the type of their checksum in; the
+	// checksum itself is kept under the x-amz-checksum-* header for its
+	// algorithm.
+	checksumTypeMetadataKey = "X-Amz-Checksum-Type"
+
+	// Sent by CreateMultipartUpload to choose the algorithm of the parts:
+	checksumAlgorithmMetadataKey = "X-Amz-Checksum-Algorithm"
+
+	// Sent by PutObject and UploadPart to name the algorithm of the checksum
+	// the request carries:
+	sdkChecksumAlgorithmMetadataKey = "X-Amz-Sdk-Checksum-Algorithm"
+
+	// Sent by aws-chunked uploads to name the header that follows the final
+	// chunk, if the checksum is sent there instead of in the headers:
+	trailerMetadataKey = "X-Amz-Trailer"
+)
+
+var crc32CTable = crc32.MakeTable(crc32.Castagnoli)
+
+// The polynomial of CRC-64/NVME, in the reversed form hash/crc64 expects.
+var crc64NVMETable = crc64.MakeTable(0x9a6c9329ac4bc9b5)
+
+func parseChecksumAlgorithm(value string) (ChecksumAlgorithm, bool) {
+	for _, algorithm := range checksumAlgorithms {
+		if strings.EqualFold(value, string(algorithm)) {
+			return algorithm, true
+		}
+	}
+	return "", false
+}
+
+// header returns the x-amz-checksum-* header that carries checksums computed
+// with the algorithm, in canonical form.
+func (a ChecksumAlgorithm) header() string {
+	return textproto.CanonicalMIMEHeaderKey("x-amz-checksum-" + strings.ToLower(string(a)))
+}
+
+func (a ChecksumAlgorithm) newHash() (hash.Hash, error) {
+	switch a {
+	case ChecksumCRC32:
+		return crc32.NewIEEE(), nil
+	case ChecksumCRC32C:
+		return crc32.New(crc32CTable), nil
+	case ChecksumCRC64NVME:
+		return crc64.New(crc64NVMETable), nil
+	case ChecksumSHA1:
+		return sha1.New(), nil
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	default:
+		return nil, ErrorMessagef(ErrInvalidRequest, "Checksum algorithm %s is unsupported.", a)
+	}
+}
+
+// sum returns the base64 encoded checksum of data.
+func (a ChecksumAlgorithm) sum(data []byte) (string, error) {
+	h, err := a.newHash()
+	if err != nil {
+		return "", err
+	}
+	h.Write(data) // Hash.Write never returns an error.
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// compositeChecksum returns the checksum of a multipart object with the
+// COMPOSITE checksum type, which is the checksum of the concatenated
+// checksums of its parts followed by the number of parts.
+func (a ChecksumAlgorithm) compositeChecksum(parts []string) (string, error) {
+	h, err := a.newHash()
+	if err != nil {
+		return "", err
+	}
+	for _, part := range parts {
+		raw, err := base64.StdEncoding.DecodeString(part)
+		if err != nil {
+			return "", err
+		}
+		h.Write(raw)
+	}
+	return fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(h.Sum(nil)), len(parts)), nil
+}
+
+// defaultChecksumType returns the type multipart uploads get if
+// CreateMultipartUpload does not send x-amz-checksum-type. S3 can only
+// compute full object checksums for the CRC algorithms, and only CRC64NVME
+// defaults to one.
+func (a ChecksumAlgorithm) defaultChecksumType() ChecksumType {
+	if a == ChecksumCRC64NVME {
+		return ChecksumTypeFullObject
+	}
+	return ChecksumTypeComposite
+}
+
+func (a ChecksumAlgorithm) supportsChecksumType(typ ChecksumType) bool {
+	switch typ {
+	case ChecksumTypeComposite:
+		return a != ChecksumCRC64NVME
+	case ChecksumTypeFullObject:
+		return a != ChecksumSHA1 && a != ChecksumSHA256
+	}
+	return false
+}
+
+// Checksums holds the checksums of an object or part, as they appear in XML
+// documents. At most one of them is set.
+type Checksums struct {
+	ChecksumCRC32     string `xml:"ChecksumCRC32,omitempty"`
+	ChecksumCRC32C    string `xml:"ChecksumCRC32C,omitempty"`
+	ChecksumCRC64NVME string `xml:"ChecksumCRC64NVME,omitempty"`
+	ChecksumSHA1      string `xml:"ChecksumSHA1,omitempty"`
+	ChecksumSHA256    string `xml:"ChecksumSHA256,omitempty"`
+}
+
+func (c *Checksums) field(algorithm ChecksumAlgorithm) *string {
+	switch algorithm {
+	case ChecksumCRC32:
+		return &c.ChecksumCRC32
+	case ChecksumCRC32C:
+		return &c.ChecksumCRC32C
+	case ChecksumCRC64NVME:
+		return &c.ChecksumCRC64NVME
+	case ChecksumSHA1:
+		return &c.ChecksumSHA1
+	case ChecksumSHA256:
+		return &c.ChecksumSHA256
+	}
+	return nil
+}
+
+// Get returns the checksum computed with the algorithm, or an empty string.
+func (c Checksums) Get(algorithm ChecksumAlgorithm) string {
+	if f := c.field(algorithm); f != nil {
+		return *f
+	}
+	return ""
+}
+
+// Set sets the checksum computed with the algorithm.
+func (c *Checksums) Set(algorithm ChecksumAlgorithm, value string) {
+	if f := c.field(algorithm); f != nil {
+		*f = value
+	}
+}
+
+// objectChecksum returns the algorithm, value and type of the checksum an
+// object was stored with. The algorithm is empty if the object does not have
+// a checksum.
+func objectChecksum(meta map[string]string) (algorithm ChecksumAlgorithm, value string, typ ChecksumType) {
+	for _, algorithm := range checksumAlgorithms {
+		if value, ok := meta[algorithm.header()]; ok {
+			typ := ChecksumType(meta[checksumTypeMetadataKey])
+			if typ == "" {
+				typ = ChecksumTypeFullObject
+			}
+			return algorithm, value, typ
+		}
+	}
+	return "", "", ""
+}
+
+// isChecksumMetadata reports whether the metadata key holds an object's
+// checksum, which is only returned by GetObject and HeadObject if the
+// request enables the checksum mode.
+func isChecksumMetadata(key string) bool {
+	return strings.HasPrefix(key, "X-Amz-Checksum-")
+}
+
+// requestChecksum removes the checksum headers of a PutObject or UploadPart
+// request from meta, and returns the algorithm the object's checksum should
+// be computed with, and the checksum the request expects, if it sent one.
+// The algorithm is empty if the request did not ask for a checksum.
+//
+// If the X-Amz-Trailer header says the checksum follows the body of an
+// aws-chunked upload, trailing is true and expected is empty; the checksum
+// is checked by the checksumReader once the chunkedReader has read it.
+func requestChecksum(meta map[string]string) (algorithm ChecksumAlgorithm, expected string, trailing bool, err error) {
+	const multipleChecksums = "Expecting a single x-amz-checksum- header. Multiple checksum Types are not allowed."
+
+	for _, candidate := range checksumAlgorithms {
+		value, ok := meta[candidate.header()]
+		if !ok {
+			continue
+		}
+		if algorithm != "" {
+			return "", "", false, ErrorMessage(ErrInvalidRequest, multipleChecksums)
+		}
+		if !candidate.validChecksum(value) {
+			return "", "", false, ErrorMessagef(ErrInvalidRequest, "Value for %s header is invalid.", strings.ToLower(candidate.header()))
+		}
+		algorithm, expected = candidate, value
+	}
+
+	if trailer, ok := meta[trailerMetadataKey]; ok {
+		trailer = strings.TrimSpace(trailer)
+		name := strings.TrimPrefix(strings.ToLower(trailer), "x-amz-checksum-")
+		trailerAlgorithm, ok := parseChecksumAlgorithm(name)
+		if !ok || name == strings.ToLower(trailer) {
+			return "", "", false, ErrorMessagef(ErrInvalidRequest, "Value for x-amz-trailer header is invalid: %s", trailer)
+		}
+		if algorithm != "" {
+			return "", "", false, ErrorMessage(ErrInvalidRequest, multipleChecksums)
+		}
+		algorithm, trailing = trailerAlgorithm, true
+	}
+
+	if sdk, ok := meta[sdkChecksumAlgorithmMetadataKey]; ok {
+		sdkAlgorithm, ok := parseChecksumAlgorithm(sdk)
+		if !ok || (algorithm != "" && sdkAlgorithm != algorithm) {
+			return "", "", false, ErrorMessage(ErrInvalidRequest, "Value for x-amz-sdk-checksum-algorithm header is invalid.")
+		}
+		algorithm = sdkAlgorithm
+	}
+
+	for key := range meta {
+		if isChecksumMetadata(key) {
+			delete(meta, key)
+		}
+	}
+	delete(meta, sdkChecksumAlgorithmMetadataKey)
+	delete(meta, trailerMetadataKey)
+
+	return algorithm, expected, trailing, nil
+}
+
+// validChecksum reports whether value is a base64 encoded checksum of the
+// right size for the algorithm.
+func (a ChecksumAlgorithm) validChecksum(value string) bool {
+	h, err := a.newHash()
+	if err != nil {
+		return false
+	}
+	raw, err := base64.StdEncoding.DecodeString(value)
+	return err == nil && len(raw) == h.Size()
+}
+
+// checksumHeaders returns the headers of a request that requestChecksum
+// looks at, for requests that do not otherwise collect their metadata.
+func checksumHeaders(header http.Header) map[string]string {
+	meta := make(map[string]string)
+	for key, values := range header {
+		if isChecksumMetadata(key) || key == sdkChecksumAlgorithmMetadataKey || key == trailerMetadataKey {
+			meta[key] = values[0]
+		}
+	}
+	return meta
+}
+
+// multipartChecksum validates the x-amz-checksum-algorithm and
+// x-amz-checksum-type headers sent to CreateMultipartUpload, and leaves them
+// in meta in canonical form for the upload to use when it is completed.
+func multipartChecksum(meta map[string]string) (algorithm ChecksumAlgorithm, typ ChecksumType, err error) {
+	value, ok := meta[checksumAlgorithmMetadataKey]
+	if !ok {
+		if _, ok := meta[checksumTypeMetadataKey]; ok {
+			return "", "", ErrorMessage(ErrInvalidRequest, "The x-amz-checksum-type header can only be used with the x-amz-checksum-algorithm header.")
+		}
+		return "", "", nil
+	}
+
+	algorithm, ok = parseChecksumAlgorithm(value)
+	if !ok {
+		return "", "", ErrorMessage(ErrInvalidRequest, "Checksum algorithm provided is unsupported. Please try again with any of the valid types: [CRC32, CRC32C, CRC64NVME, SHA1, SHA256]")
+	}
+
+	typ = ChecksumType(strings.ToUpper(meta[checksumTypeMetadataKey]))
+	if typ == "" {
+		typ = algorithm.defaultChecksumType()
+	}
+	if !algorithm.supportsChecksumType(typ) {
+		return "", "", ErrorMessagef(ErrInvalidRequest, "The %s checksum type cannot be used with the %s checksum algorithm.", typ, strings.ToLower(string(algorithm)))
+	}
+
+	meta[checksumAlgorithmMetadataKey] = string(algorithm)
+	meta[checksumTypeMetadataKey] = string(typ)
+	return algorithm, typ, nil
+}
+
+// checksumReader computes the checksum of the data read from an io.Reader
+// with one of the ChecksumAlgorithms. If meta is not nil, the checksum is
+// stored in it once the reader returns EOF, which backends only store after
+// they have read the whole object.
+type checksumReader struct {
+	*hashingReader
+	algorithm ChecksumAlgorithm
+	meta      map[string]string
+
+	// If set, the expected checksum is read from the trailing headers of an
+	// aws-chunked upload once the body has been read.
+	trailer *chunkedReader
+}
+
+func newChecksumReader(inner io.Reader, algorithm ChecksumAlgorithm, expectedBase64 string, meta map[string]string) (*checksumReader, error) {
+	h, err := algorithm.newHash()
+	if err != nil {
+		return nil, err
+	}
+
+	var expected []byte
+	if expectedBase64 != "" {
+		// requestChecksum has already checked this decodes:
+		expected, _ = base64.StdEncoding.DecodeString(expectedBase64)
+	}
+
+	return &checksumReader{
+		hashingReader: &hashingReader{
+			inner:    inner,
+			expected: expected,
+			hash:     h,
+			mismatch: ErrorMessagef(ErrBadDigest, "The %s you specified did not match the calculated checksum.", algorithm),
+		},
+		algorithm: algorithm,
+		meta:      meta,
+	}, nil
+}
+
+// expectTrailer makes the reader check the data against the checksum that
+// follows the body of an aws-chunked upload, for requests that requestChecksum
+// said send their checksum in a trailer. It fails if the body is not one.
+func (c *checksumReader) expectTrailer(chunked *chunkedReader) error {
+	if chunked == nil {
+		return ErrorMessage(ErrInvalidRequest, "The x-amz-trailer header can only be used with an aws-chunked upload.")
+	}
+	c.trailer = chunked
+	return nil
+}
+
+// Value returns the base64 encoded checksum of the data read so far.
+func (c *checksumReader) Value() string {
+	return base64.StdEncoding.EncodeToString(c.Sum(nil))
+}
+
+func (c *checksumReader) Read(p []byte) (n int, err error) {
+	n, err = c.hashingReader.Read(p)
+	if err == io.EOF && c.trailer != nil {
+		if err := c.checkTrailer(); err != nil {
+			return n, err
+		}
+	}
+	if err == io.EOF && c.meta != nil {
+		c.meta[c.algorithm.header()] = c.Value()
+		c.meta[checksumTypeMetadataKey] = string(ChecksumTypeFullObject)
+	}
+	return n, err
+}
+
+func (c *checksumReader) checkTrailer() error {
+	header := c.algorithm.header()
+	value, ok := c.trailer.Trailer(header)
+	if !ok {
+		return ErrorMessagef(ErrInvalidRequest, "The %s trailer was not sent with the request.", strings.ToLower(header))
+	}
+	if !c.algorithm.validChecksum(value) {
+		return ErrorMessagef(ErrInvalidRequest, "Value for %s trailing header is invalid.", strings.ToLower(header))
+	}
+	if value != c.Value() {
+		return c.mismatch
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/johannesboyne/gofakes3"
+)
+
+// The checksums of "123456789", which is the check value in the
+// specifications of the CRC algorithms.
+var checksumCheckValues = map[s3types.ChecksumAlgorithm]string{
+	s3types.ChecksumAlgorithmCrc32:     "cbf43926",
+	s3types.ChecksumAlgorithmCrc32c:    "e3069283",
+	s3types.ChecksumAlgorithmCrc64nvme: "ae8b14860a799888",
+	s3types.ChecksumAlgorithmSha1:      "f7c3bc1d808e04732adf679965ccc34ca7ae3441",
+	s3types.ChecksumAlgorithmSha256:    "15e2b0d3c33891ebb0f1ef609ec419420c20e320ce94c65fbc8c3312448eb225",
+}
+
+func hexToBase64(value string) string {
+	raw, err := hex.DecodeString(value)
+	if err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func getObjectChecksum(out *s3.GetObjectOutput, algorithm s3types.ChecksumAlgorithm) string {
+	switch algorithm {
+	case s3types.ChecksumAlgorithmCrc32:
+		return aws.ToString(out.ChecksumCRC32)
+	case s3types.ChecksumAlgorithmCrc32c:
+		return aws.ToString(out.ChecksumCRC32C)
+	case s3types.ChecksumAlgorithmCrc64nvme:
+		return aws.ToString(out.ChecksumCRC64NVME)
+	case s3types.ChecksumAlgorithmSha1:
+		return aws.ToString(out.ChecksumSHA1)
+	case s3types.ChecksumAlgorithmSha256:
+		return aws.ToString(out.ChecksumSHA256)
+	}
+	return ""
+}
+
+func TestChecksumPutObject(t *testing.T) {
+	runWithAllBackends(t, func(t *testing.T, ts *testServer) {
+		svc := ts.s3Client()
+
+		for algorithm, check := range checksumCheckValues {
+			t.Run(string(algorithm), func(t *testing.T) {
+				key := "object-" + string(algorithm)
+				put, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+					Bucket:            aws.String(defaultBucket),
+					Key:               aws.String(key),
+					Body:              strings.NewReader("123456789"),
+					ChecksumAlgorithm: algorithm,
+				})
+				ts.OK(err)
+				if put.ChecksumType != s3types.ChecksumTypeFullObject {
+					t.Fatal("unexpected checksum type", put.ChecksumType)
+				}
+
+				out, err := svc.GetObject(context.TODO(), &s3.GetObjectInput{
+					Bucket:       aws.String(defaultBucket),
+					Key:          aws.String(key),
+					ChecksumMode: s3types.ChecksumModeEnabled,
+				})
+				ts.OK(err)
+				defer out.Body.Close()
+				if found := getObjectChecksum(out, algorithm); found != hexToBase64(check) {
+					t.Fatal("checksum mismatch:", found, "!=", hexToBase64(check))
+				}
+
+				// The checksum is only returned if it is asked for:
+				rs, err := httpClient().Head(ts.url("/" + defaultBucket + "/" + key))
+				ts.OK(err)
+				rs.Body.Close()
+				for header := range rs.Header {
+					if strings.HasPrefix(header, "X-Amz-Checksum-") || header == "X-Amz-Sdk-Checksum-Algorithm" {
+						t.Fatal("unexpected header", header)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestChecksumPutObjectMismatch(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:        aws.String(defaultBucket),
+		Key:           aws.String("object"),
+		Body:          strings.NewReader("123456789"),
+		ChecksumCRC32: aws.String(hexToBase64("00000000")),
+	})
+	if !hasErrorCode(err, gofakes3.ErrBadDigest) {
+		t.Fatal("expected BadDigest, found", err)
+	}
+	if _, err := ts.backend.HeadObject(defaultBucket, "object"); !hasErrorCode(err, gofakes3.ErrNoSuchKey) {
+		t.Fatal("expected object to be missing, found", err)
+	}
+}
+
+func TestChecksumInvalidRequest(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	for idx, headers := range []map[string]string{
+		{"x-amz-checksum-crc32": "not base64"},
+		{"x-amz-checksum-crc32": hexToBase64("00")},
+		{"x-amz-checksum-crc32": hexToBase64("cbf43926"), "x-amz-checksum-crc32c": hexToBase64("e3069283")},
+		{"x-amz-checksum-crc32": hexToBase64("cbf43926"), "x-amz-sdk-checksum-algorithm": "SHA1"},
+		{"x-amz-sdk-checksum-algorithm": "MD4"},
+	} {
+		rq, err := http.NewRequest("PUT", ts.url("/"+defaultBucket+"/object"), strings.NewReader("123456789"))
+		ts.OK(err)
+		for k, v := range headers {
+			rq.Header.Set(k, v)
+		}
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		rs.Body.Close()
+		if rs.StatusCode != http.StatusBadRequest {
+			t.Fatal(idx, "expected 400, found", rs.StatusCode)
+		}
+	}
+}
+
+func TestChecksumMultipartUpload(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	parts := [][]byte{bytes.Repeat([]byte("a"), 5*1024*1024), []byte("hello")}
+
+	upload := func(algorithm s3types.ChecksumAlgorithm, checksumType s3types.ChecksumType) (string, []s3types.CompletedPart) {
+		t.Helper()
+		mpu, err := svc.CreateMultipartUpload(context.TODO(), &s3.CreateMultipartUploadInput{
+			Bucket:            aws.String(defaultBucket),
+			Key:               aws.String("object"),
+			ChecksumAlgorithm: algorithm,
+			ChecksumType:      checksumType,
+		})
+		ts.OK(err)
+
+		var completed []s3types.CompletedPart
+		for idx, body := range parts {
+			out, err := svc.UploadPart(context.TODO(), &s3.UploadPartInput{
+				Bucket:            aws.String(defaultBucket),
+				Key:               aws.String("object"),
+				UploadId:          mpu.UploadId,
+				PartNumber:        aws.Int32(int32(idx + 1)),
+				Body:              bytes.NewReader(body),
+				ChecksumAlgorithm: algorithm,
+			})
+			ts.OK(err)
+			completed = append(completed, s3types.CompletedPart{
+				ETag:              out.ETag,
+				PartNumber:        aws.Int32(int32(idx + 1)),
+				ChecksumCRC32:     out.ChecksumCRC32,
+				ChecksumCRC64NVME: out.ChecksumCRC64NVME,
+				ChecksumSHA256:    out.ChecksumSHA256,
+			})
+		}
+		return aws.ToString(mpu.UploadId), completed
+	}
+
+	t.Run("composite", func(t *testing.T) {
+		uploadID, completed := upload(s3types.ChecksumAlgorithmSha256, "")
+
+		var partSums []byte
+		for _, body := range parts {
+			sum := sha256.Sum256(body)
+			partSums = append(partSums, sum[:]...)
+		}
+		sum := sha256.Sum256(partSums)
+		expected := fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(sum[:]), len(parts))
+
+		out, err := svc.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(defaultBucket),
+			Key:             aws.String("object"),
+			UploadId:        aws.String(uploadID),
+			MultipartUpload: &s3types.CompletedMultipartUpload{Parts: completed},
+		})
+		ts.OK(err)
+		if aws.ToString(out.ChecksumSHA256) != expected || out.ChecksumType != s3types.ChecksumTypeComposite {
+			t.Fatal("unexpected checksum", aws.ToString(out.ChecksumSHA256), out.ChecksumType)
+		}
+
+		head, err := svc.HeadObject(context.TODO(), &s3.HeadObjectInput{
+			Bucket:       aws.String(defaultBucket),
+			Key:          aws.String("object"),
+			ChecksumMode: s3types.ChecksumModeEnabled,
+		})
+		ts.OK(err)
+		if aws.ToString(head.ChecksumSHA256) != expected || head.ChecksumType != s3types.ChecksumTypeComposite {
+			t.Fatal("unexpected checksum", aws.ToString(head.ChecksumSHA256), head.ChecksumType)
+		}
+	})
+
+	t.Run("full-object", func(t *testing.T) {
+		uploadID, completed := upload(s3types.ChecksumAlgorithmCrc64nvme, "")
+		out, err := svc.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(defaultBucket),
+			Key:             aws.String("object"),
+			UploadId:        aws.String(uploadID),
+			MultipartUpload: &s3types.CompletedMultipartUpload{Parts: completed},
+		})
+		ts.OK(err)
+		if out.ChecksumType != s3types.ChecksumTypeFullObject || strings.Contains(aws.ToString(out.ChecksumCRC64NVME), "-") {
+			t.Fatal("unexpected checksum", aws.ToString(out.ChecksumCRC64NVME), out.ChecksumType)
+		}
+
+		// The SDK validates full object checksums itself:
+		get, err := svc.GetObject(context.TODO(), &s3.GetObjectInput{
+			Bucket:       aws.String(defaultBucket),
+			Key:          aws.String("object"),
+			ChecksumMode: s3types.ChecksumModeEnabled,
+		})
+		ts.OK(err)
+		defer get.Body.Close()
+		_, err = io.Copy(io.Discard, get.Body)
+		ts.OK(err)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		uploadID, completed := upload(s3types.ChecksumAlgorithmCrc32, "")
+
+		missing := append([]s3types.CompletedPart(nil), completed...)
+		missing[1].ChecksumCRC32 = nil
+		_, err := svc.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(defaultBucket),
+			Key:             aws.String("object"),
+			UploadId:        aws.String(uploadID),
+			MultipartUpload: &s3types.CompletedMultipartUpload{Parts: missing},
+		})
+		if !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+			t.Fatal("expected InvalidRequest, found", err)
+		}
+
+		wrong := append([]s3types.CompletedPart(nil), completed...)
+		wrong[1].ChecksumCRC32 = aws.String(hexToBase64("00000000"))
+		_, err = svc.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(defaultBucket),
+			Key:             aws.String("object"),
+			UploadId:        aws.String(uploadID),
+			MultipartUpload: &s3types.CompletedMultipartUpload{Parts: wrong},
+		})
+		if !hasErrorCode(err, gofakes3.ErrInvalidPart) {
+			t.Fatal("expected InvalidPart, found", err)
+		}
+
+		_, err = svc.CreateMultipartUpload(context.TODO(), &s3.CreateMultipartUploadInput{
+			Bucket:            aws.String(defaultBucket),
+			Key:               aws.String("object"),
+			ChecksumAlgorithm: s3types.ChecksumAlgorithmSha1,
+			ChecksumType:      s3types.ChecksumTypeFullObject,
+		})
+		if !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+			t.Fatal("expected InvalidRequest, found", err)
+		}
+	})
+}
+
+func TestChecksumTrailer(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	put := func(key, trailer string) *http.Response {
+		t.Helper()
+		body := "5\r\nhello\r\n0\r\n" + trailer + "\r\n"
+		rq, err := http.NewRequest("PUT", ts.url("/"+defaultBucket+"/"+key), strings.NewReader(body))
+		ts.OK(err)
+		rq.Header.Set("Content-Encoding", "aws-chunked")
+		rq.Header.Set("X-Amz-Content-Sha256", "STREAMING-UNSIGNED-PAYLOAD-TRAILER")
+		rq.Header.Set("X-Amz-Decoded-Content-Length", "5")
+		rq.Header.Set("X-Amz-Trailer", "x-amz-checksum-crc32")
+		rq.Header.Set("X-Amz-Sdk-Checksum-Algorithm", "CRC32")
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		rs.Body.Close()
+		return rs
+	}
+
+	crc := hexToBase64("3610a686") // CRC32 of "hello"
+	if rs := put("object", "x-amz-checksum-crc32:"+crc+"\r\n"); rs.StatusCode != http.StatusOK {
+		t.Fatal("unexpected status", rs.StatusCode)
+	}
+	ts.assertObject(defaultBucket, "object", nil, "hello")
+
+	out, err := ts.s3Client().GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket:       aws.String(defaultBucket),
+		Key:          aws.String("object"),
+		ChecksumMode: s3types.ChecksumModeEnabled,
+	})
+	ts.OK(err)
+	out.Body.Close()
+	if aws.ToString(out.ChecksumCRC32) != crc {
+		t.Fatal("unexpected checksum", aws.ToString(out.ChecksumCRC32))
+	}
+	if aws.ToString(out.ContentEncoding) != "" {
+		t.Fatal("unexpected content encoding", aws.ToString(out.ContentEncoding))
+	}
+
+	for key, trailer := range map[string]string{
+		"mismatch": "x-amz-checksum-crc32:" + hexToBase64("00000000") + "\r\n",
+		"missing":  "",
+		"invalid":  "x-amz-checksum-crc32:nope\r\n",
+	} {
+		if rs := put(key, trailer); rs.StatusCode != http.StatusBadRequest {
+			t.Fatal(key, "expected 400, found", rs.StatusCode)
+		}
+		if _, err := ts.backend.HeadObject(defaultBucket, key); !hasErrorCode(err, gofakes3.ErrNoSuchKey) {
+			t.Fatal(key, "expected object to be missing, found", err)
+		}
+	}
+}
@@ -1,22 +1,110 @@
 package gofakes3
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
 )
 
+// maxChunkSize is the largest chunk accepted in an aws-chunked body. S3 takes
+// at most 5 GiB in a single upload, so no chunk can be larger.
+const maxChunkSize = 5 << 30
+
+// chunkedReader decodes the body of an upload sent using the aws-chunked
+// content encoding, i.e. with an X-Amz-Content-Sha256 header of
+// STREAMING-AWS4-HMAC-SHA256-PAYLOAD:
+//
+//	<hex-size>;chunk-signature=<signature>\r\n<data>\r\n
+//
+// or, if the chunks are not signed, of STREAMING-UNSIGNED-PAYLOAD-TRAILER:
+//
+//	<hex-size>\r\n<data>\r\n
+//
+// The final, empty chunk may be followed by trailing headers, which are
+// available from Trailer once the reader has returned io.EOF. If the chunks
+// are signed, so are the trailers:
+//
+//	0;chunk-signature=<signature>\r\n
+//	x-amz-checksum-crc32:<checksum>\r\n
+//	x-amz-trailer-signature:<signature>\r\n
+//	\r\n
+//
+// If a chunkSigner is provided, each chunk's signature is checked once all of
+// its data has been read, and the final empty chunk must be read before the
+// reader returns io.EOF.
 type chunkedReader struct {
-	inner         io.Reader
+	inner         *bufio.Reader
 	chunkRemain   int
 	notFirstChunk bool
+
+	signer         *chunkSigner
+	chunkSignature string
+	chunkHash      hash.Hash
+
+	// The expected number of decoded bytes, from X-Amz-Decoded-Content-Length,
+	// or -1 if this is not checked.
+	decodedSize int64
+	decoded     int64
+
+	trailers map[string]string
 }
 
 func newChunkedReader(inner io.Reader) *chunkedReader {
 	return &chunkedReader{
-		inner:         inner,
+		inner:         bufio.NewReader(inner),
 		chunkRemain:   0,
 		notFirstChunk: false,
+		decodedSize:   -1,
+	}
+}
+
+// newSignedChunkedReader creates a chunkedReader that fails if the size of the
+// decoded body does not match decodedSize, and, if signer is not nil, if any
+// chunk's signature does not match.
+func newSignedChunkedReader(inner io.Reader, signer *chunkSigner, decodedSize int64) *chunkedReader {
+	rdr := newChunkedReader(inner)
+	rdr.decodedSize = decodedSize
+	if signer != nil {
+		rdr.signer = signer
+		rdr.chunkHash = sha256.New()
 	}
+	return rdr
+}
+
+// isStreamingPayload reports whether the X-Amz-Content-Sha256 header of a
+// request says that its body uses the aws-chunked encoding.
+func isStreamingPayload(payloadHash string) bool {
+	switch payloadHash {
+	case streamingPayload, streamingPayloadTrailer, streamingUnsignedPayloadTrailer:
+		return true
+	}
+	return false
+}
+
+// newStreamingReader decodes the body of a request for which
+// isStreamingPayload is true. If the request was authenticated and its chunks
+// are signed, the signature of every chunk is checked against the seed
+// signature from the Authorization header.
+func newStreamingReader(rq *http.Request, decodedSize int64) *chunkedReader {
+	var signer *chunkSigner
+	if auth := authFromRequest(rq); auth != nil {
+		signer = auth.chunkSigner
+	}
+	return newSignedChunkedReader(rq.Body, signer, decodedSize)
+}
+
+// Trailer returns the value of a trailing header, which is only available once
+// the reader has returned io.EOF.
+func (r *chunkedReader) Trailer(name string) (value string, ok bool) {
+	value, ok = r.trailers[textproto.CanonicalMIMEHeaderKey(name)]
+	return value, ok
 }
 
 func (r *chunkedReader) Read(p []byte) (n int, err error) {
@@ -24,6 +112,7 @@ func (r *chunkedReader) Read(p []byte) (n int, err error) {
 	for sizeToRead > 0 {
 		if r.chunkRemain > sizeToRead {
 			innerN, err := r.inner.Read(p[n : n+sizeToRead])
+			r.consumed(p[n : n+innerN])
 			r.chunkRemain -= innerN
 			sizeToRead -= innerN
 			n += innerN
@@ -32,6 +121,7 @@ func (r *chunkedReader) Read(p []byte) (n int, err error) {
 			}
 		} else if r.chunkRemain > 0 {
 			innerN, err := r.inner.Read(p[n : n+r.chunkRemain])
+			r.consumed(p[n : n+innerN])
 			r.chunkRemain -= innerN
 			n += innerN
 			sizeToRead -= innerN
@@ -47,22 +137,130 @@ func (r *chunkedReader) Read(p []byte) (n int, err error) {
 				if err != nil {
 					return n, err
 				}
+				if err := r.verifyChunk(); err != nil {
+					return n, err
+				}
 			}
 			// read next chunk header
-			chunkSize := 0
-			_, err = fmt.Fscanf(r.inner, "%x;", &chunkSize)
-			if err != nil {
+			var chunkSize int64
+			_, err = fmt.Fscanf(r.inner, "%x", &chunkSize)
+			var numErr *strconv.NumError
+			if errors.As(err, &numErr) {
+				return n, ErrorMessage(ErrIncompleteBody, "The chunk size is not valid.")
+			} else if err != nil {
 				return n, err
 			}
-			r.chunkRemain = chunkSize
-			if chunkSize == 0 {
-				return n, io.EOF
+			if chunkSize < 0 || chunkSize > maxChunkSize {
+				return n, ErrorMessagef(ErrIncompleteBody, "The chunk size %d is not valid.", chunkSize)
 			}
-			_, err = io.CopyN(io.Discard, r.inner, 16+64+2) // "chunk-signature=" + sizeOfHash + "\r\n"
+			ext, err := r.inner.ReadString('\n')
 			if err != nil {
 				return n, err
 			}
+			if r.signer != nil {
+				signature, ok := strings.CutPrefix(strings.TrimRight(ext, "\r\n"), ";chunk-signature=")
+				if !ok {
+					return n, ErrorMessage(ErrIncompleteBody, "The chunk header is missing its chunk-signature.")
+				}
+				r.chunkSignature = signature
+			}
+			r.chunkRemain = int(chunkSize)
+			if chunkSize == 0 {
+				if err := r.verifyChunk(); err != nil {
+					return n, err
+				}
+				if err := r.readTrailers(); err != nil {
+					return n, err
+				}
+				if r.decodedSize >= 0 && r.decoded != r.decodedSize {
+					return n, ErrorMessagef(ErrIncompleteBody,
+						"The decoded body was %d bytes, but X-Amz-Decoded-Content-Length was %d", r.decoded, r.decodedSize)
+				}
+				return n, io.EOF
+			}
 		}
 	}
 	return n, nil
 }
+
+func (r *chunkedReader) consumed(data []byte) {
+	r.decoded += int64(len(data))
+	if r.chunkHash != nil {
+		r.chunkHash.Write(data)
+	}
+}
+
+// verifyChunk checks the signature of the chunk whose data has just been read
+// in full.
+func (r *chunkedReader) verifyChunk() error {
+	if r.signer == nil {
+		return nil
+	}
+	err := r.signer.verify(r.chunkHash.Sum(nil), r.chunkSignature)
+	r.chunkHash.Reset()
+	return err
+}
+
+// readTrailers reads the trailing headers that follow the final chunk, up to
+// the empty line that ends the body. Bodies without trailers only have the
+// empty line, which some clients leave out.
+func (r *chunkedReader) readTrailers() error {
+	var signed strings.Builder
+	var signature string
+
+	for {
+		line, err := r.inner.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		} else if err != nil && err != io.EOF {
+			return err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return ErrorMessage(ErrIncompleteBody, "The trailing headers of the request are malformed.")
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+
+		if strings.EqualFold(name, "x-amz-trailer-signature") {
+			signature = value
+			continue
+		}
+		if r.trailers == nil {
+			r.trailers = make(map[string]string)
+		}
+		r.trailers[textproto.CanonicalMIMEHeaderKey(name)] = value
+		signed.WriteString(strings.ToLower(name) + ":" + value + "\n")
+	}
+
+	if r.signer != nil && r.trailers != nil {
+		return r.signer.verifyTrailer(signed.String(), signature)
+	}
+	return nil
+}
+
+// removeChunkedEncoding removes aws-chunked from the Content-Encoding stored
+// with an object, as the object is stored decoded. Other encodings the client
+// sent are kept.
+func removeChunkedEncoding(meta map[string]string) {
+	value, ok := meta["Content-Encoding"]
+	if !ok {
+		return
+	}
+	var encodings []string
+	for _, encoding := range strings.Split(value, ",") {
+		if encoding = strings.TrimSpace(encoding); encoding != "" && !strings.EqualFold(encoding, "aws-chunked") {
+			encodings = append(encodings, encoding)
+		}
+	}
+	if len(encodings) == 0 {
+		delete(meta, "Content-Encoding")
+	} else {
+		meta["Content-Encoding"] = strings.Join(encodings, ",")
+	}
+}
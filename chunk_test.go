@@ -1,7 +1,10 @@
 package gofakes3
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"io/ioutil"
@@ -114,3 +117,136 @@ func TestChunkedUploadFail(t *testing.T) {
 	assert.Equal(t, 0, n)
 
 }
+
+func signedChunkPayload(data string) string {
+	// Signatures are from the example in
+	// https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-streaming.html#example-signature-calculations-streaming,
+	// which uploads (65536 + 1024) * 'a':
+	payload := "10000;chunk-signature=ad80c730a21e5b8d04586a2213dd63b9a0e99e0e2307b0ade35a65485a288648\r\n"
+	payload += data[:65536]
+	payload += "\r\n"
+	payload += "400;chunk-signature=0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497\r\n"
+	payload += data[65536:]
+	payload += "\r\n"
+	payload += "0;chunk-signature=b6c6ea8a5354eaf15b3cb7646744f4275b71ea724fed81ceb9323e279d449df9\r\n\r\n"
+	return payload
+}
+
+func exampleChunkSigner() *chunkSigner {
+	sig := &signatureV4{
+		Scope:     signingScope{Date: "20130524", Region: "us-east-1", Service: "s3"},
+		Signature: "4f232c4386841ef735655705268965c44a0e4690baa4adea153f7db9fa80a0a9",
+		TimeText:  "20130524T000000Z",
+	}
+	return newChunkSigner(sig, signingKey("wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY", sig.Scope))
+}
+
+func TestSignedChunkedUploadSuccess(t *testing.T) {
+	data := strings.Repeat("a", 65536+1024)
+	rdr := newSignedChunkedReader(strings.NewReader(signedChunkPayload(data)), exampleChunkSigner(), int64(len(data)))
+	buf, err := ioutil.ReadAll(rdr)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, data, string(buf))
+}
+
+func TestSignedChunkedUploadTampered(t *testing.T) {
+	// Both the first and the last chunk are checked:
+	for _, tampered := range []string{
+		"b" + strings.Repeat("a", 65536+1024-1),
+		strings.Repeat("a", 65536+1024-1) + "b",
+	} {
+		rdr := newSignedChunkedReader(strings.NewReader(signedChunkPayload(tampered)), exampleChunkSigner(), int64(len(tampered)))
+		_, err := ioutil.ReadAll(rdr)
+		assert.True(t, HasErrorCode(err, ErrSignatureDoesNotMatch), "expected SignatureDoesNotMatch, found %v", err)
+	}
+}
+
+func TestSignedChunkedUploadMalformedHeader(t *testing.T) {
+	data := strings.Repeat("a", 65536+1024)
+	for _, payload := range []string{
+		strings.Replace(signedChunkPayload(data), ";chunk-signature=", ";chunk-signatur=", 1),
+		strings.Replace(signedChunkPayload(data), ";chunk-signature=0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497", "", 1),
+		"10000000000000000;chunk-signature=0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497\r\n",
+		"-400;chunk-signature=0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497\r\n",
+		"ffffffffff;chunk-signature=0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497\r\n",
+	} {
+		rdr := newSignedChunkedReader(strings.NewReader(payload), exampleChunkSigner(), int64(len(data)))
+		_, err := ioutil.ReadAll(rdr)
+		assert.True(t, HasErrorCode(err, ErrIncompleteBody), "expected IncompleteBody, found %v", err)
+	}
+}
+
+func TestSignedChunkedUploadDecodedLength(t *testing.T) {
+	data := strings.Repeat("a", 65536+1024)
+	for _, size := range []int64{int64(len(data)) - 1, int64(len(data)) + 1} {
+		rdr := newSignedChunkedReader(strings.NewReader(signedChunkPayload(data)), nil, size)
+		_, err := ioutil.ReadAll(rdr)
+		assert.True(t, HasErrorCode(err, ErrIncompleteBody), "expected IncompleteBody, found %v", err)
+	}
+}
+
+func TestChunkedUploadUnsignedTrailer(t *testing.T) {
+	payload := "400\r\n" + strings.Repeat("a", 1024) + "\r\n"
+	payload += "0\r\n"
+	payload += "x-amz-checksum-crc32:fFWXuQ==\r\n\r\n"
+
+	rdr := newSignedChunkedReader(strings.NewReader(payload), nil, 1024)
+	buf, err := ioutil.ReadAll(rdr)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, strings.Repeat("a", 1024), string(buf))
+
+	value, ok := rdr.Trailer("X-Amz-Checksum-Crc32")
+	assert.True(t, ok)
+	assert.Equal(t, "fFWXuQ==", value)
+}
+
+// signedTrailerPayload encodes data as a single chunk followed by the
+// trailers, signing both as a STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER
+// upload with the key and seed signature of exampleChunkSigner.
+func signedTrailerPayload(data string, trailers string) string {
+	example := exampleChunkSigner()
+	prev := example.prevSignature
+	sign := func(toSign string) string {
+		prev = hex.EncodeToString(hmacSHA256(example.key, toSign))
+		return prev
+	}
+	prefix := "20130524T000000Z\n20130524/us-east-1/s3/aws4_request\n"
+
+	payload := ""
+	for _, chunk := range []string{data, ""} {
+		sum := sha256.Sum256([]byte(chunk))
+		sig := sign("AWS4-HMAC-SHA256-PAYLOAD\n" + prefix + prev + "\n" + sha256Hex("") + "\n" + hex.EncodeToString(sum[:]))
+		payload += fmt.Sprintf("%x;chunk-signature=%s\r\n%s", len(chunk), sig, chunk)
+		if chunk != "" {
+			payload += "\r\n"
+		}
+	}
+	sig := sign("AWS4-HMAC-SHA256-TRAILER\n" + prefix + prev + "\n" + sha256Hex(trailers))
+	payload += strings.ReplaceAll(trailers, "\n", "\r\n")
+	payload += "x-amz-trailer-signature:" + sig + "\r\n\r\n"
+	return payload
+}
+
+func TestSignedChunkedUploadTrailer(t *testing.T) {
+	data := strings.Repeat("a", 1024)
+	trailers := "x-amz-checksum-crc32:fFWXuQ==\n"
+
+	rdr := newSignedChunkedReader(strings.NewReader(signedTrailerPayload(data, trailers)), exampleChunkSigner(), int64(len(data)))
+	buf, err := ioutil.ReadAll(rdr)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, data, string(buf))
+	value, _ := rdr.Trailer("x-amz-checksum-crc32")
+	assert.Equal(t, "fFWXuQ==", value)
+
+	// The trailers are covered by the trailer signature:
+	tampered := strings.Replace(signedTrailerPayload(data, trailers), "fFWXuQ==", "AAAAAA==", 1)
+	rdr = newSignedChunkedReader(strings.NewReader(tampered), exampleChunkSigner(), int64(len(data)))
+	_, err = ioutil.ReadAll(rdr)
+	assert.True(t, HasErrorCode(err, ErrSignatureDoesNotMatch), "expected SignatureDoesNotMatch, found %v", err)
+
+	// Signed uploads can't leave the chunk signatures out:
+	unsigned := "400\r\n" + data + "\r\n0\r\n\r\n"
+	rdr = newSignedChunkedReader(strings.NewReader(unsigned), exampleChunkSigner(), int64(len(data)))
+	_, err = ioutil.ReadAll(rdr)
+	assert.True(t, HasErrorCode(err, ErrIncompleteBody), "expected IncompleteBody, found %v", err)
+}
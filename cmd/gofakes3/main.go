@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"expvar"
 	"flag"
 	"fmt"
@@ -39,6 +40,9 @@ type fakeS3Flags struct {
 	hostBucketBases HostList
 	autoBucket      bool
 	insecureCORS    bool
+	credentials     CredentialList
+	restoreDelay    time.Duration
+	lifecycle       time.Duration
 	quiet           bool
 
 	boltDb              string
@@ -73,6 +77,14 @@ func (f *fakeS3Flags) attach(flagSet *flag.FlagSet) {
 		"path routing. Takes precedence over -hostbucket. Can be passed multiple times, or as a single "+
 		"comma separated list")
 
+	flagSet.Var(&f.credentials, "credentials", ""+
+		"If passed, requests must be signed with AWS Signature V4 using one of these credentials. "+
+		"Takes the form 'ACCESS_KEY_ID:SECRET_ACCESS_KEY'. Can be passed multiple times, or as a "+
+		"single comma separated list")
+
+	flagSet.DurationVar(&f.restoreDelay, "restore-delay", 0, "How long RestoreObject takes to make a GLACIER or DEEP_ARCHIVE object readable.")
+	flagSet.DurationVar(&f.lifecycle, "lifecycle-interval", time.Hour, "How often bucket lifecycle rules are applied. Pass 0 to never apply them.")
+
 	// Logging
 	flagSet.BoolVar(&f.quiet, "quiet", false, "If passed, log messages are not printed to stderr")
 
@@ -271,13 +283,20 @@ func run() error {
 		gofakes3.WithHostBucket(values.hostBucket),
 		gofakes3.WithHostBucketBase(values.hostBucketBases.Values...),
 		gofakes3.WithAutoBucket(values.autoBucket),
+		gofakes3.WithRestoreDelay(values.restoreDelay),
 	}
 
 	if values.insecureCORS {
 		options = append(options, gofakes3.WithInsecureCORS())
 	}
+	if len(values.credentials.Values) > 0 {
+		options = append(options, gofakes3.WithCredentials(values.credentials.Values))
+	}
 
 	faker := gofakes3.New(backend, options...)
+	if values.lifecycle > 0 {
+		go faker.RunLifecycle(context.Background(), values.lifecycle)
+	}
 
 	return listenAndServe(values.host, faker.Server())
 }
@@ -331,3 +350,31 @@ func (sl *HostList) Set(s string) error {
 	}
 	return nil
 }
+
+type CredentialList struct {
+	Values gofakes3.StaticCredentials
+}
+
+func (cl CredentialList) String() string {
+	keys := make([]string, 0, len(cl.Values))
+	for k := range cl.Values {
+		keys = append(keys, k)
+	}
+	return strings.Join(keys, ",")
+}
+
+func (cl CredentialList) Type() string { return "[]string" }
+
+func (cl *CredentialList) Set(s string) error {
+	if cl.Values == nil {
+		cl.Values = gofakes3.StaticCredentials{}
+	}
+	for _, part := range strings.Split(s, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || id == "" || secret == "" {
+			return fmt.Errorf("credentials must be in the form 'ACCESS_KEY_ID:SECRET_ACCESS_KEY'")
+		}
+		cl.Values[id] = secret
+	}
+	return nil
+}
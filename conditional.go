@@ -0,0 +1,91 @@
+package gofakes3
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Conditional GET and HEAD requests, as described by RFC 7232, with the
+// precedence S3 gives the headers:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetObject.html
+//
+// If-Match is evaluated first, and If-Unmodified-Since only if If-Match is
+// not sent; either fails the request with 412 Precondition Failed. Then
+// If-None-Match is evaluated, and If-Modified-Since only if If-None-Match is
+// not sent; either answers the request with 304 Not Modified.
+
+// objectLastModified returns when an object was last modified, to the
+// second, from the Last-Modified time GoFakeS3 keeps in its metadata, or from
+// the backend if it has none. It returns a zero time if neither knows.
+func objectLastModified(obj *Object) time.Time {
+	if lastModified, err := http.ParseTime(obj.Metadata["Last-Modified"]); err == nil {
+		return lastModified
+	}
+	return obj.LastModified.UTC().Truncate(time.Second)
+}
+
+// etagsMatch reports whether etag is one of the comma-separated entity tags
+// of an If-Match or If-None-Match header, or the header is '*'. The weak
+// comparison ignores the W/ prefix of weak tags, which the strong comparison
+// never matches. As S3 does, tags are matched with or without their quotes.
+func etagsMatch(header, etag string, weak bool) bool {
+	etag = strings.Trim(etag, `"`)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = candidate[2:]
+		}
+		if strings.Trim(candidate, `"`) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPreconditions fails with ErrPreconditionFailed if the If-Match or
+// If-Unmodified-Since header of a request does not hold for an object.
+func checkPreconditions(h http.Header, etag string, lastModified time.Time) error {
+	if ifMatch := h.Get("If-Match"); ifMatch != "" {
+		if !etagsMatch(ifMatch, etag, false) {
+			return ErrorMessage(ErrPreconditionFailed, ErrPreconditionFailed.Message())
+		}
+	} else if since, err := http.ParseTime(h.Get("If-Unmodified-Since")); err == nil && !lastModified.IsZero() {
+		if lastModified.After(since) {
+			return ErrorMessage(ErrPreconditionFailed, ErrPreconditionFailed.Message())
+		}
+	}
+	return nil
+}
+
+// notModified reports whether the If-None-Match or If-Modified-Since header
+// of a GET or HEAD request says the client already has the object.
+func notModified(h http.Header, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := h.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagsMatch(ifNoneMatch, etag, true)
+	}
+	since, err := http.ParseTime(h.Get("If-Modified-Since"))
+	return err == nil && !lastModified.IsZero() && !lastModified.After(since)
+}
+
+// ifRangeMatches reports whether the Range header of a request should be
+// honoured: if the request has an If-Range header, it must hold either the
+// strong ETag of the object, or exactly its Last-Modified time, or the whole
+// object is sent instead.
+func ifRangeMatches(h http.Header, etag string, lastModified time.Time) bool {
+	ifRange := h.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return ifRange == etag
+	}
+	at, err := http.ParseTime(ifRange)
+	return err == nil && !lastModified.IsZero() && at.Equal(lastModified)
+}
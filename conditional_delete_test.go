@@ -0,0 +1,198 @@
+package gofakes3_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+// backendWithoutConditions hides the optional interfaces of a Backend, so
+// that conditional requests can't be checked.
+type backendWithoutConditions struct {
+	gofakes3.Backend
+}
+
+func TestConditionalDelete(t *testing.T) {
+	runWithAllBackends(t, testConditionalDelete)
+}
+
+func testConditionalDelete(t *testing.T, ts *testServer) {
+	svc := ts.s3Client()
+	ts.putString(svc, "object", "hello")
+	head, err := svc.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+	etag, lastModified := aws.ToString(head.ETag), aws.ToTime(head.LastModified)
+
+	for idx, in := range []*s3.DeleteObjectInput{
+		{IfMatch: aws.String(`"nope"`)},
+		{IfMatchSize: aws.Int64(4)},
+		{IfMatchLastModifiedTime: aws.Time(lastModified.Add(-time.Hour))},
+		{IfMatch: aws.String(etag), IfMatchSize: aws.Int64(5), IfMatchLastModifiedTime: aws.Time(lastModified.Add(time.Hour))},
+	} {
+		in.Bucket, in.Key = aws.String(defaultBucket), aws.String("object")
+		if _, err := svc.DeleteObject(context.TODO(), in); !hasErrorCode(err, gofakes3.ErrPreconditionFailed) {
+			t.Fatal(idx, "expected PreconditionFailed, found", err)
+		}
+		if exists, _ := ts.backendObjectExists(defaultBucket, "object"); !exists {
+			t.Fatal(idx, "object deleted")
+		}
+	}
+
+	_, err = svc.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket:                  aws.String(defaultBucket),
+		Key:                     aws.String("object"),
+		IfMatch:                 aws.String(etag),
+		IfMatchSize:             aws.Int64(5),
+		IfMatchLastModifiedTime: aws.Time(lastModified),
+	})
+	ts.OK(err)
+	if exists, _ := ts.backendObjectExists(defaultBucket, "object"); exists {
+		t.Fatal("object not deleted")
+	}
+
+	_, err = svc.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket:  aws.String(defaultBucket),
+		Key:     aws.String("object"),
+		IfMatch: aws.String(etag),
+	})
+	if !hasErrorCode(err, gofakes3.ErrPreconditionFailed) {
+		t.Fatal("expected PreconditionFailed, found", err)
+	}
+}
+
+func TestConditionalDeleteMulti(t *testing.T) {
+	runWithAllBackends(t, testConditionalDeleteMulti)
+}
+
+func testConditionalDeleteMulti(t *testing.T, ts *testServer) {
+	svc := ts.s3Client()
+	for _, object := range []string{"a", "b", "c", "d"} {
+		ts.putString(svc, object, "hello")
+	}
+	head, err := svc.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("b"),
+	})
+	ts.OK(err)
+
+	out, err := svc.DeleteObjects(context.TODO(), &s3.DeleteObjectsInput{
+		Bucket: aws.String(defaultBucket),
+		Delete: &s3types.Delete{
+			Objects: []s3types.ObjectIdentifier{
+				{Key: aws.String("a"), ETag: aws.String(`"nope"`)},
+				{Key: aws.String("b"), ETag: head.ETag, Size: aws.Int64(5), LastModifiedTime: head.LastModified},
+				{Key: aws.String("c")},
+				{Key: aws.String("d"), Size: aws.Int64(6)},
+			},
+		},
+	})
+	ts.OK(err)
+
+	deleted := map[string]bool{}
+	for _, obj := range out.Deleted {
+		deleted[aws.ToString(obj.Key)] = true
+	}
+	if len(deleted) != 2 || !deleted["b"] || !deleted["c"] {
+		t.Fatal("unexpected deleted objects", deleted)
+	}
+	failed := map[string]string{}
+	for _, e := range out.Errors {
+		failed[aws.ToString(e.Key)] = aws.ToString(e.Code)
+	}
+	if len(failed) != 2 || failed["a"] != string(gofakes3.ErrPreconditionFailed) || failed["d"] != string(gofakes3.ErrPreconditionFailed) {
+		t.Fatal("unexpected errors", failed)
+	}
+
+	ts.assertLs(defaultBucket, "", nil, []string{"a", "d"})
+}
+
+func TestConditionalDeleteVersion(t *testing.T) {
+	ts := newTestServer(t, withVersioning())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.putString(svc, "object", "hello")
+	ts.putString(svc, "object", "hello world")
+	versions, err := svc.ListObjectVersions(context.TODO(), &s3.ListObjectVersionsInput{Bucket: aws.String(defaultBucket)})
+	ts.OK(err)
+	if len(versions.Versions) != 2 {
+		t.Fatal("unexpected versions", len(versions.Versions))
+	}
+	var old s3types.ObjectVersion
+	for _, version := range versions.Versions {
+		if !aws.ToBool(version.IsLatest) {
+			old = version
+		}
+	}
+
+	deleteVersion := func(size int64) error {
+		_, err := svc.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+			Bucket:      aws.String(defaultBucket),
+			Key:         aws.String("object"),
+			VersionId:   old.VersionId,
+			IfMatch:     old.ETag,
+			IfMatchSize: aws.Int64(size),
+		})
+		return err
+	}
+	if err := deleteVersion(11); !hasErrorCode(err, gofakes3.ErrPreconditionFailed) {
+		t.Fatal("expected PreconditionFailed, found", err)
+	}
+	ts.OK(deleteVersion(5))
+	if err := deleteVersion(5); !hasErrorCode(err, gofakes3.ErrPreconditionFailed) {
+		t.Fatal("expected PreconditionFailed, found", err)
+	}
+}
+
+func TestConditionalDeleteMultiDeleteMarker(t *testing.T) {
+	ts := newTestServer(t, withVersioning())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.putString(svc, "object", "hello")
+	out, err := svc.DeleteObjects(context.TODO(), &s3.DeleteObjectsInput{
+		Bucket: aws.String(defaultBucket),
+		Delete: &s3types.Delete{
+			Objects: []s3types.ObjectIdentifier{{Key: aws.String("object"), Size: aws.Int64(5)}},
+		},
+	})
+	ts.OK(err)
+	if len(out.Deleted) != 1 {
+		t.Fatal("unexpected deleted objects", len(out.Deleted))
+	}
+	if deleted := out.Deleted[0]; !aws.ToBool(deleted.DeleteMarker) || aws.ToString(deleted.DeleteMarkerVersionId) == "" {
+		t.Fatal("expected a delete marker, found", aws.ToBool(deleted.DeleteMarker), aws.ToString(deleted.DeleteMarkerVersionId))
+	}
+}
+
+func TestConditionalDeleteNotImplemented(t *testing.T) {
+	ts := newTestServer(t, withBackend(&backendWithoutConditions{s3mem.New()}))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.putString(svc, "object", "hello")
+	_, err := svc.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket:      aws.String(defaultBucket),
+		Key:         aws.String("object"),
+		IfMatchSize: aws.Int64(5),
+	})
+	if !hasErrorCode(err, gofakes3.ErrNotImplemented) {
+		t.Fatal("expected NotImplemented, found", err)
+	}
+
+	_, err = svc.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+}
@@ -0,0 +1,123 @@
+package gofakes3_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+)
+
+// conditionalRequest sends a GET or HEAD request for an object with the given
+// headers, and returns the status and body of the response.
+func (ts *testServer) conditionalRequest(method, object string, headers map[string]string) (int, string) {
+	ts.Helper()
+	rq, err := http.NewRequest(method, ts.url("/"+defaultBucket+"/"+object), nil)
+	ts.OK(err)
+	for k, v := range headers {
+		rq.Header.Set(k, v)
+	}
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	ts.OK(err)
+	return rs.StatusCode, string(body)
+}
+
+func TestConditionalGet(t *testing.T) {
+	runWithAllBackends(t, testConditionalGet)
+}
+
+func testConditionalGet(t *testing.T, ts *testServer) {
+	// Objects written straight to the backend have no Last-Modified metadata,
+	// so this also checks the backends report when objects were modified:
+	ts.backendPutString(defaultBucket, "object", nil, "hello world")
+	etag := `"5eb63bbbe01eeed093cb22bb8f5acdc3"` // md5("hello world")
+	past := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+	future := time.Now().Add(24 * time.Hour).UTC().Format(http.TimeFormat)
+
+	if status, _ := ts.conditionalRequest("HEAD", "object", nil); status != http.StatusOK {
+		t.Fatal("unexpected status", status)
+	}
+
+	for idx, tc := range []struct {
+		headers map[string]string
+		status  int
+	}{
+		{headers: map[string]string{"If-Match": etag}, status: http.StatusOK},
+		{headers: map[string]string{"If-Match": `"nope"`}, status: http.StatusPreconditionFailed},
+		{headers: map[string]string{"If-Match": `"nope", ` + etag}, status: http.StatusOK},
+		{headers: map[string]string{"If-Match": "*"}, status: http.StatusOK},
+		{headers: map[string]string{"If-Match": "W/" + etag}, status: http.StatusPreconditionFailed},
+		{headers: map[string]string{"If-None-Match": etag}, status: http.StatusNotModified},
+		{headers: map[string]string{"If-None-Match": "W/" + etag}, status: http.StatusNotModified},
+		{headers: map[string]string{"If-None-Match": `"nope"`}, status: http.StatusOK},
+		{headers: map[string]string{"If-Modified-Since": past}, status: http.StatusOK},
+		{headers: map[string]string{"If-Modified-Since": future}, status: http.StatusNotModified},
+		{headers: map[string]string{"If-Unmodified-Since": past}, status: http.StatusPreconditionFailed},
+		{headers: map[string]string{"If-Unmodified-Since": future}, status: http.StatusOK},
+		{headers: map[string]string{"If-Modified-Since": "not a date"}, status: http.StatusOK},
+
+		// S3 ignores If-Unmodified-Since when If-Match holds, and
+		// If-Modified-Since when If-None-Match is sent:
+		{headers: map[string]string{"If-Match": etag, "If-Unmodified-Since": past}, status: http.StatusOK},
+		{headers: map[string]string{"If-None-Match": `"nope"`, "If-Modified-Since": future}, status: http.StatusOK},
+		{headers: map[string]string{"If-None-Match": etag, "If-Modified-Since": past}, status: http.StatusNotModified},
+
+		// Preconditions are evaluated before If-None-Match:
+		{headers: map[string]string{"If-Match": `"nope"`, "If-None-Match": etag}, status: http.StatusPreconditionFailed},
+	} {
+		for _, method := range []string{"GET", "HEAD"} {
+			if status, _ := ts.conditionalRequest(method, "object", tc.headers); status != tc.status {
+				t.Fatal(idx, method, "expected status", tc.status, "found", status)
+			}
+		}
+	}
+
+	status, body := ts.conditionalRequest("GET", "object", map[string]string{"If-Match": `"nope"`})
+	if status != http.StatusPreconditionFailed || !strings.Contains(body, "<Code>"+string(gofakes3.ErrPreconditionFailed)+"</Code>") {
+		t.Fatal("unexpected response", status, body)
+	}
+}
+
+func TestConditionalGetIfRange(t *testing.T) {
+	runWithAllBackends(t, testConditionalGetIfRange)
+}
+
+func testConditionalGetIfRange(t *testing.T, ts *testServer) {
+	ts.backendPutString(defaultBucket, "object", nil, "hello world")
+	etag := `"5eb63bbbe01eeed093cb22bb8f5acdc3"` // md5("hello world")
+
+	rq, err := http.NewRequest("HEAD", ts.url("/"+defaultBucket+"/object"), nil)
+	ts.OK(err)
+	rs, err := httpClient().Do(rq)
+	ts.OK(err)
+	rs.Body.Close()
+	lastModified := rs.Header.Get("Last-Modified")
+	if lastModified == "" {
+		t.Fatal("missing Last-Modified")
+	}
+
+	for idx, tc := range []struct {
+		ifRange string
+		status  int
+		body    string
+	}{
+		{ifRange: etag, status: http.StatusPartialContent, body: "hello"},
+		{ifRange: lastModified, status: http.StatusPartialContent, body: "hello"},
+		{ifRange: `"nope"`, status: http.StatusOK, body: "hello world"},
+		{ifRange: "W/" + etag, status: http.StatusOK, body: "hello world"},
+		{ifRange: "Sat, 01 Jan 2000 00:00:00 GMT", status: http.StatusOK, body: "hello world"},
+	} {
+		status, body := ts.conditionalRequest("GET", "object", map[string]string{"Range": "bytes=0-4", "If-Range": tc.ifRange})
+		if status != tc.status || body != tc.body {
+			t.Fatal(idx, "unexpected response", status, body)
+		}
+		if status, _ := ts.conditionalRequest("HEAD", "object", map[string]string{"Range": "bytes=0-4", "If-Range": tc.ifRange}); status != tc.status {
+			t.Fatal(idx, "unexpected HEAD status", status)
+		}
+	}
+}
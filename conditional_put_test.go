@@ -9,6 +9,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/spf13/afero"
 	bolt "go.etcd.io/bbolt"
 
@@ -377,3 +378,101 @@ func testConditionalPutETagComparison(t *testing.T, ts *testServer) {
 		t.Fatal("Expected success with unquoted ETag:", err)
 	}
 }
+
+func TestConditionalCompleteMultipartUpload(t *testing.T) {
+	runWithAllBackends(t, testConditionalCompleteMultipartUpload)
+}
+
+func testConditionalCompleteMultipartUpload(t *testing.T, ts *testServer) {
+	svc := ts.s3Client()
+
+	complete := func(id string, parts []s3types.CompletedPart, ifMatch, ifNoneMatch *string) error {
+		_, err := svc.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(defaultBucket),
+			Key:             aws.String("manifest"),
+			UploadId:        aws.String(id),
+			MultipartUpload: &s3types.CompletedMultipartUpload{Parts: parts},
+			IfMatch:         ifMatch,
+			IfNoneMatch:     ifNoneMatch,
+		})
+		return err
+	}
+
+	// If-None-Match: * succeeds while the object does not exist:
+	id := ts.createMultipartUpload(defaultBucket, "manifest", nil)
+	parts := []s3types.CompletedPart{ts.uploadPart(defaultBucket, "manifest", id, 1, []byte("first"))}
+	ts.OK(complete(id, parts, nil, aws.String("*")))
+	etag := ts.calculateETagBodyByParts(parts)
+
+	// ...and fails once it does, keeping the upload so it can be retried:
+	id = ts.createMultipartUpload(defaultBucket, "manifest", nil)
+	parts = []s3types.CompletedPart{ts.uploadPart(defaultBucket, "manifest", id, 1, []byte("second"))}
+	if err := complete(id, parts, nil, aws.String("*")); !hasErrorCode(err, gofakes3.ErrPreconditionFailed) {
+		t.Fatal("expected PreconditionFailed, found", err)
+	}
+	if err := complete(id, parts, aws.String(`"nope"`), nil); !hasErrorCode(err, gofakes3.ErrPreconditionFailed) {
+		t.Fatal("expected PreconditionFailed, found", err)
+	}
+	if got := ts.backendGetString(defaultBucket, "manifest", nil); got != "first" {
+		t.Fatal("object was replaced:", got)
+	}
+
+	// If-Match compares the multipart ETag of the object:
+	ts.OK(complete(id, parts, aws.String(etag), nil))
+	if got := ts.backendGetString(defaultBucket, "manifest", nil); got != "second" {
+		t.Fatal("object was not replaced:", got)
+	}
+}
+
+func TestConditionalCopyObject(t *testing.T) {
+	runWithAllBackends(t, testConditionalCopyObject)
+
+	// Backends that can't check the conditions as they copy leave it to
+	// PutObject:
+	t.Run("without-conditional-copy", func(t *testing.T) {
+		ts := newTestServer(t, withBackend(&backendWithoutConditions{s3mem.New()}))
+		defer ts.Close()
+		testConditionalCopyObject(t, ts)
+	})
+}
+
+func testConditionalCopyObject(t *testing.T, ts *testServer) {
+	svc := ts.s3Client()
+	ts.putString(svc, "source", "source")
+
+	copyObject := func(ifMatch, ifNoneMatch *string) error {
+		_, err := svc.CopyObject(context.TODO(), &s3.CopyObjectInput{
+			Bucket:      aws.String(defaultBucket),
+			Key:         aws.String("dest"),
+			CopySource:  aws.String(defaultBucket + "/source"),
+			IfMatch:     ifMatch,
+			IfNoneMatch: ifNoneMatch,
+		})
+		return err
+	}
+
+	if err := copyObject(aws.String(`"nope"`), nil); !hasErrorCode(err, gofakes3.ErrPreconditionFailed) {
+		t.Fatal("expected PreconditionFailed, found", err)
+	}
+	ts.OK(copyObject(nil, aws.String("*")))
+	if err := copyObject(nil, aws.String("*")); !hasErrorCode(err, gofakes3.ErrPreconditionFailed) {
+		t.Fatal("expected PreconditionFailed, found", err)
+	}
+
+	ts.putString(svc, "dest", "dest")
+	head, err := svc.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("dest"),
+	})
+	ts.OK(err)
+	if err := copyObject(aws.String(`"nope"`), nil); !hasErrorCode(err, gofakes3.ErrPreconditionFailed) {
+		t.Fatal("expected PreconditionFailed, found", err)
+	}
+	if got := ts.backendGetString(defaultBucket, "dest", nil); got != "dest" {
+		t.Fatal("object was replaced:", got)
+	}
+	ts.OK(copyObject(head.ETag, nil))
+	if got := ts.backendGetString(defaultBucket, "dest", nil); got != "source" {
+		t.Fatal("object was not replaced:", got)
+	}
+}
@@ -0,0 +1,187 @@
+package gofakes3
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// copySource is the object version named by the x-amz-copy-source header of
+// CopyObject and UploadPartCopy requests.
+type copySource struct {
+	bucket    string
+	object    string
+	versionID VersionID
+}
+
+// parseCopySource parses the x-amz-copy-source header, which takes the form
+// 'bucket/key', optionally followed by '?versionId=...'. The key is
+// URL-encoded, or the whole header may be.
+func parseCopySource(source string) (src copySource, err error) {
+	parts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+	sourceDecoded := false
+	if len(parts) < 2 {
+		// The source may be fully URL-encoded (including "/" as "%2F").
+		// Try decoding and splitting again.
+		decoded, err := url.QueryUnescape(source)
+		if err != nil {
+			return src, err
+		}
+		parts = strings.SplitN(strings.TrimPrefix(decoded, "/"), "/", 2)
+		sourceDecoded = true
+	}
+	if len(parts) < 2 {
+		return src, ErrorMessage(ErrInvalidArgument, "X-Amz-Copy-Source must contain bucket and key separated by '/'")
+	}
+	src.bucket = parts[0]
+
+	key, query, _ := strings.Cut(parts[1], "?")
+	if query != "" {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return src, ErrorInvalidArgument("x-amz-copy-source", source, "Invalid copy source encoding.")
+		}
+		src.versionID = VersionID(values.Get("versionId"))
+	}
+
+	// Only decode the key if we didn't already decode the entire source,
+	// to avoid double-decoding (which corrupts "+" characters).
+	if !sourceDecoded {
+		key, err = url.QueryUnescape(key)
+		if err != nil {
+			return src, err
+		}
+	}
+	src.object = key
+	return src, nil
+}
+
+// authorizeCopySource checks that the request may read the source of a copy,
+// and that the source bucket has the expected owner.
+func (g *GoFakeS3) authorizeCopySource(r *http.Request, src copySource) error {
+	action := "s3:GetObject"
+	if src.versionID != "" {
+		action = "s3:GetObjectVersion"
+	}
+	if err := g.authorize(r, action, src.bucket, src.object); err != nil {
+		return err
+	}
+	return g.checkExpectedBucketOwner(src.bucket, r.Header.Get("x-amz-source-expected-bucket-owner"))
+}
+
+// headCopySource returns the source of a copy without its contents. As in
+// S3, a source whose current version is a delete marker is missing, and a
+// source that names a delete marker by its version is invalid.
+func (g *GoFakeS3) headCopySource(src copySource) (*Object, error) {
+	var obj *Object
+	var err error
+	if src.versionID != "" {
+		if g.versioned == nil {
+			return nil, ErrNotImplemented
+		}
+		obj, err = g.versioned.HeadObjectVersion(src.bucket, src.object, src.versionID)
+	} else {
+		obj, err = g.storage.HeadObject(src.bucket, src.object)
+	}
+	if err != nil {
+		return nil, err
+	}
+	obj.Contents.Close()
+
+	if obj.IsDeleteMarker {
+		if src.versionID != "" {
+			return nil, ErrorMessage(ErrInvalidRequest, "The source of a copy request may not specifically refer to a delete marker by version id.")
+		}
+		return nil, KeyNotFound(src.object)
+	}
+	return obj, nil
+}
+
+// getCopySource returns the source of a copy with its contents, or the range
+// of them if rnge is not nil.
+func (g *GoFakeS3) getCopySource(src copySource, rnge *ObjectRangeRequest) (*Object, error) {
+	if src.versionID != "" {
+		if g.versioned == nil {
+			return nil, ErrNotImplemented
+		}
+		return g.versioned.GetObjectVersion(src.bucket, src.object, src.versionID, rnge)
+	}
+	return g.storage.GetObject(src.bucket, src.object, rnge)
+}
+
+// checkCopySourceConditions evaluates the x-amz-copy-source-if-* headers
+// against the source of a copy, failing with ErrPreconditionFailed if they
+// do not hold. As in S3, x-amz-copy-source-if-unmodified-since is not
+// checked if x-amz-copy-source-if-match is sent, and
+// x-amz-copy-source-if-modified-since is not checked if
+// x-amz-copy-source-if-none-match is sent.
+func checkCopySourceConditions(h http.Header, obj *Object) error {
+	etag := ObjectETag(obj.Hash, obj.Metadata)
+	lastModified := objectLastModified(obj)
+
+	if ifMatch := h.Get("x-amz-copy-source-if-match"); ifMatch != "" {
+		if !etagsMatch(ifMatch, etag, false) {
+			return ErrorMessage(ErrPreconditionFailed, ErrPreconditionFailed.Message())
+		}
+	} else if since, err := http.ParseTime(h.Get("x-amz-copy-source-if-unmodified-since")); err == nil && !lastModified.IsZero() {
+		if lastModified.After(since) {
+			return ErrorMessage(ErrPreconditionFailed, ErrPreconditionFailed.Message())
+		}
+	}
+
+	if ifNoneMatch := h.Get("x-amz-copy-source-if-none-match"); ifNoneMatch != "" {
+		if etagsMatch(ifNoneMatch, etag, true) {
+			return ErrorMessage(ErrPreconditionFailed, ErrPreconditionFailed.Message())
+		}
+	} else if since, err := http.ParseTime(h.Get("x-amz-copy-source-if-modified-since")); err == nil && !lastModified.IsZero() {
+		if !lastModified.After(since) {
+			return ErrorMessage(ErrPreconditionFailed, ErrPreconditionFailed.Message())
+		}
+	}
+
+	return nil
+}
+
+// isContentMetadata reports whether the metadata key is user metadata, or one
+// of the headers that describe the contents of an object, which
+// x-amz-metadata-directive copies from the source of a copy or replaces.
+func isContentMetadata(key string) bool {
+	switch key {
+	case "Content-Type", "Content-Disposition", "Content-Encoding", "Content-Language", "Cache-Control", "Expires":
+		return true
+	}
+	return strings.HasPrefix(key, "X-Amz-Meta-")
+}
+
+// copyChangesObject reports whether a copy request changes the storage class,
+// website redirect location or encryption of the object. S3 requires copies
+// of an object onto itself to change one of them, or to replace its metadata.
+func copyChangesObject(meta map[string]string, dstSSE *customerKey) bool {
+	if dstSSE != nil || meta[storageClassMetadataKey] != "" || meta["X-Amz-Website-Redirect-Location"] != "" {
+		return true
+	}
+	for k := range meta {
+		if isEncryptionMetadata(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCopySourceRange parses the x-amz-copy-source-range header of an
+// UploadPartCopy request, which unlike the Range header must give both the
+// first and the last byte, within the source object.
+func parseCopySourceRange(header string, size int64) (*ObjectRangeRequest, error) {
+	if header == "" {
+		return nil, nil
+	}
+	rnge, err := parseRangeHeader(header)
+	if err != nil || rnge.FromEnd || rnge.End == RangeNoEnd {
+		return nil, ErrorInvalidArgument("x-amz-copy-source-range", header, "The x-amz-copy-source-range value must be of the form bytes=first-last where first and last are the zero-based offsets of the first and last bytes to copy")
+	}
+	if rnge.End >= size {
+		return nil, ErrorInvalidArgument("x-amz-copy-source-range", header, "Range specified is not valid for source object of size: "+strconv.FormatInt(size, 10))
+	}
+	return rnge, nil
+}
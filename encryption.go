@@ -0,0 +1,376 @@
+package gofakes3
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Server-side encryption with keys managed by S3 (SSE-S3) or by KMS (SSE-KMS),
+// as described here:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/serv-side-encryption.html
+//
+// GoFakeS3 does not talk to KMS. The KMS keys objects may be encrypted with are
+// looked up in the registry set with WithKMSKeys, and the contents of objects
+// encrypted with SSE-KMS are encrypted in the Backend the same way as those
+// encrypted with SSE-C, with a data key derived from the ARN of the KMS key.
+// As in S3, the ETag of such an object is therefore not the MD5 of its
+// contents. Objects encrypted with SSE-S3 are only marked as encrypted, and
+// keep their MD5 ETags.
+const (
+	sseHeader           = "X-Amz-Server-Side-Encryption"
+	sseKMSKeyIDHeader   = "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"
+	sseKMSContextHeader = "X-Amz-Server-Side-Encryption-Context"
+	sseBucketKeyHeader  = "X-Amz-Server-Side-Encryption-Bucket-Key-Enabled"
+
+	// The key S3 uses for SSE-KMS when the request does not name one, which
+	// is the AWS managed key aws/s3 of the account:
+	defaultKMSKeyARN = "arn:aws:kms:us-east-1:000000000000:key/00000000-0000-0000-0000-000000000000"
+)
+
+// ServerSideEncryption is the algorithm an object is encrypted with on the
+// server, apart from SSE-C.
+type ServerSideEncryption string
+
+const (
+	ServerSideEncryptionAES256  ServerSideEncryption = "AES256"
+	ServerSideEncryptionKMS     ServerSideEncryption = "aws:kms"
+	ServerSideEncryptionKMSDSSE ServerSideEncryption = "aws:kms:dsse"
+)
+
+func (s ServerSideEncryption) valid() bool {
+	switch s {
+	case ServerSideEncryptionAES256, ServerSideEncryptionKMS, ServerSideEncryptionKMSDSSE:
+		return true
+	}
+	return false
+}
+
+func (s ServerSideEncryption) usesKMS() bool {
+	return s == ServerSideEncryptionKMS || s == ServerSideEncryptionKMSDSSE
+}
+
+// KMSKey is a key in the registry set with WithKMSKeys.
+type KMSKey struct {
+	// The ARN of the key, such as
+	// "arn:aws:kms:us-east-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab".
+	// Requests may also refer to the key by the ID at the end of the ARN.
+	ARN string
+
+	// The aliases of the key, such as "alias/my-key". Requests may refer to
+	// the key by an alias, or by the ARN of an alias.
+	Aliases []string
+}
+
+// matches reports whether the key is the one a request refers to by id.
+func (k KMSKey) matches(id string) bool {
+	if id == k.ARN {
+		return true
+	}
+	prefix, keyID, isARN := strings.Cut(k.ARN, ":key/")
+	if isARN && id == keyID {
+		return true
+	}
+	for _, alias := range k.Aliases {
+		if id == alias || (isARN && id == prefix+":"+alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveKMSKey returns the ARN of the KMS key a request refers to by id, or
+// of the default key if id is empty. If no registry was set with WithKMSKeys,
+// any key is accepted as it is.
+func (g *GoFakeS3) resolveKMSKey(id string) (string, error) {
+	if id == "" {
+		return defaultKMSKeyARN, nil
+	}
+	if g.kmsKeys == nil {
+		return id, nil
+	}
+	for _, key := range g.kmsKeys {
+		if key.matches(id) {
+			return key.ARN, nil
+		}
+	}
+	return "", ErrorMessagef(ErrKMSNotFound, "Invalid keyId '%s'", id)
+}
+
+// objectEncryption is how an object is encrypted with SSE-S3 or SSE-KMS.
+type objectEncryption struct {
+	algorithm ServerSideEncryption
+
+	// The ARN of the KMS key, if the algorithm uses KMS.
+	kmsKeyID string
+
+	// The base64 encoded JSON encryption context sent with the request, if
+	// any.
+	context string
+
+	bucketKeyEnabled bool
+}
+
+// requestEncryption works out how an object written by a request is to be
+// encrypted, from the x-amz-server-side-encryption headers of the request,
+// which it removes from meta, or else from the default encryption of the
+// bucket. It returns nil if the object is not to be encrypted with SSE-S3 or
+// SSE-KMS, which is always the case if the request sent an SSE-C key.
+func (g *GoFakeS3) requestEncryption(bucket string, meta map[string]string, customer *customerKey) (*objectEncryption, error) {
+	var (
+		algorithm = ServerSideEncryption(meta[sseHeader])
+		keyID     = meta[sseKMSKeyIDHeader]
+		context   = meta[sseKMSContextHeader]
+		bucketKey = meta[sseBucketKeyHeader]
+	)
+	for _, key := range []string{sseHeader, sseKMSKeyIDHeader, sseKMSContextHeader, sseBucketKeyHeader} {
+		delete(meta, key)
+	}
+
+	if customer != nil {
+		if algorithm != "" || keyID != "" {
+			return nil, ErrorMessage(ErrInvalidArgument, "Server Side Encryption with Customer provided key is incompatible with the encryption method specified")
+		}
+		return nil, nil
+	}
+
+	if algorithm == "" {
+		if keyID != "" || context != "" {
+			return nil, ErrorInvalidArgument(strings.ToLower(sseHeader), "",
+				"Server Side Encryption with AWS KMS managed key requires HTTP header x-amz-server-side-encryption : aws:kms")
+		}
+		return g.bucketDefaultEncryption(bucket)
+	}
+	if !algorithm.valid() {
+		return nil, ErrorInvalidArgument(strings.ToLower(sseHeader), string(algorithm),
+			"The encryption method specified is not supported")
+	}
+
+	enc := &objectEncryption{algorithm: algorithm}
+	if !algorithm.usesKMS() {
+		if keyID != "" || context != "" {
+			return nil, ErrorInvalidArgument(strings.ToLower(sseHeader), string(algorithm),
+				"Server Side Encryption with AWS KMS managed key requires HTTP header x-amz-server-side-encryption : aws:kms")
+		}
+		return enc, nil
+	}
+
+	var err error
+	if enc.kmsKeyID, err = g.resolveKMSKey(keyID); err != nil {
+		return nil, err
+	}
+	if context != "" {
+		raw, err := base64.StdEncoding.DecodeString(context)
+		if err != nil || !json.Valid(raw) {
+			return nil, ErrorInvalidArgument(strings.ToLower(sseKMSContextHeader), context,
+				"The encryption context was not valid base64 encoded JSON.")
+		}
+		enc.context = context
+	}
+	if bucketKey != "" {
+		if enc.bucketKeyEnabled, err = strconv.ParseBool(bucketKey); err != nil {
+			return nil, ErrorInvalidArgument(strings.ToLower(sseBucketKeyHeader), bucketKey,
+				"The bucket key setting must be true or false.")
+		}
+	}
+	return enc, nil
+}
+
+// bucketDefaultEncryption returns how new objects in the bucket are encrypted
+// if the request that writes them does not say, or nil if the bucket has no
+// default encryption.
+func (g *GoFakeS3) bucketDefaultEncryption(bucket string) (*objectEncryption, error) {
+	config, err := g.encryption.BucketEncryption(bucket)
+	if HasErrorCode(err, ErrNoSuchEncryptionConfiguration) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	rule := config.Rules[0]
+	enc := &objectEncryption{
+		algorithm:        rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm,
+		bucketKeyEnabled: rule.BucketKeyEnabled,
+	}
+	if enc.algorithm.usesKMS() {
+		if enc.kmsKeyID, err = g.resolveKMSKey(rule.ApplyServerSideEncryptionByDefault.KMSMasterKeyID); err != nil {
+			return nil, err
+		}
+	}
+	return enc, nil
+}
+
+// storedEncryption returns how an object or upload is encrypted with SSE-S3
+// or SSE-KMS, from its metadata, or nil if it isn't.
+func storedEncryption(meta map[string]string) *objectEncryption {
+	algorithm := ServerSideEncryption(meta[sseHeader])
+	if algorithm == "" {
+		return nil
+	}
+	bucketKeyEnabled, _ := strconv.ParseBool(meta[sseBucketKeyHeader])
+	return &objectEncryption{
+		algorithm:        algorithm,
+		kmsKeyID:         meta[sseKMSKeyIDHeader],
+		context:          meta[sseKMSContextHeader],
+		bucketKeyEnabled: bucketKeyEnabled,
+	}
+}
+
+// setMetadata records in the metadata of an object or upload how it is
+// encrypted.
+func (e *objectEncryption) setMetadata(meta map[string]string) {
+	if e == nil {
+		return
+	}
+	meta[sseHeader] = string(e.algorithm)
+	if e.kmsKeyID != "" {
+		meta[sseKMSKeyIDHeader] = e.kmsKeyID
+	}
+	if e.context != "" {
+		meta[sseKMSContextHeader] = e.context
+	}
+	if e.bucketKeyEnabled {
+		meta[sseBucketKeyHeader] = "true"
+	}
+}
+
+// writeHeaders echoes how the object is encrypted, which S3 returns from every
+// request that writes or reads it.
+func (e *objectEncryption) writeHeaders(w http.ResponseWriter) {
+	if e == nil {
+		return
+	}
+	w.Header().Set(sseHeader, string(e.algorithm))
+	if e.kmsKeyID != "" {
+		w.Header().Set(sseKMSKeyIDHeader, e.kmsKeyID)
+	}
+	if e.context != "" {
+		w.Header().Set(sseKMSContextHeader, e.context)
+	}
+	if e.bucketKeyEnabled {
+		w.Header().Set(sseBucketKeyHeader, "true")
+	}
+}
+
+// dataKey returns the key the contents of an object encrypted with SSE-KMS
+// are encrypted with, or nil if the object is not encrypted with SSE-KMS. The
+// key is derived from the ARN of the KMS key, so that no key material has to
+// be kept.
+func (e *objectEncryption) dataKey() *customerKey {
+	if e == nil || !e.algorithm.usesKMS() {
+		return nil
+	}
+	sum := sha256.Sum256([]byte("gofakes3 kms data key:" + e.kmsKeyID))
+	return &customerKey{key: sum[:]}
+}
+
+// kmsDataKey returns the key the contents of an object or upload encrypted
+// with SSE-KMS are encrypted with in the Backend, or nil if they are not.
+func kmsDataKey(meta map[string]string) *customerKey {
+	if _, ok := meta[sseNonceMetadataKey]; !ok {
+		return nil
+	}
+	return storedEncryption(meta).dataKey()
+}
+
+// newObjectEncryption records in the metadata of an object or upload how it
+// is encrypted, with SSE-C if customer is not nil, or else as enc says. It
+// returns the key and nonce the contents are to be encrypted with, or a nil
+// key if they are not encrypted in the Backend.
+func newObjectEncryption(meta map[string]string, customer *customerKey, enc *objectEncryption) (key *customerKey, nonce []byte, err error) {
+	if customer != nil {
+		nonce, err = customer.newObjectMetadata(meta)
+		return customer, nonce, err
+	}
+	enc.setMetadata(meta)
+	if key = enc.dataKey(); key != nil {
+		nonce, err = newNonce(meta)
+	}
+	return key, nonce, err
+}
+
+// newNonce records a new nonce in the metadata of an object or upload whose
+// contents are encrypted in the Backend, and returns it.
+func newNonce(meta map[string]string) ([]byte, error) {
+	nonce := make([]byte, sseNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	meta[sseNonceMetadataKey] = base64.StdEncoding.EncodeToString(nonce)
+	return nonce, nil
+}
+
+// isEncryptionMetadata reports whether the metadata key describes how an
+// object is encrypted, with any form of server-side encryption.
+func isEncryptionMetadata(key string) bool {
+	return strings.HasPrefix(key, sseHeader)
+}
+
+// ServerSideEncryptionConfiguration is the default encryption of a bucket,
+// set with PutBucketEncryption.
+type ServerSideEncryptionConfiguration struct {
+	XMLName xml.Name                   `xml:"ServerSideEncryptionConfiguration"`
+	Xmlns   string                     `xml:"xmlns,attr,omitempty"`
+	Rules   []ServerSideEncryptionRule `xml:"Rule"`
+}
+
+type ServerSideEncryptionRule struct {
+	ApplyServerSideEncryptionByDefault ServerSideEncryptionByDefault `xml:"ApplyServerSideEncryptionByDefault"`
+	BucketKeyEnabled                   bool                          `xml:"BucketKeyEnabled,omitempty"`
+}
+
+type ServerSideEncryptionByDefault struct {
+	SSEAlgorithm   ServerSideEncryption `xml:"SSEAlgorithm"`
+	KMSMasterKeyID string               `xml:"KMSMasterKeyID,omitempty"`
+}
+
+// validateEncryptionConfiguration checks the configuration sent with
+// PutBucketEncryption.
+func (g *GoFakeS3) validateEncryptionConfiguration(config *ServerSideEncryptionConfiguration) error {
+	if len(config.Rules) != 1 {
+		return ErrorMessage(ErrMalformedXML, ErrMalformedXML.Message())
+	}
+
+	def := config.Rules[0].ApplyServerSideEncryptionByDefault
+	if !def.SSEAlgorithm.valid() {
+		return ErrorMessage(ErrMalformedXML, ErrMalformedXML.Message())
+	}
+	if def.KMSMasterKeyID != "" {
+		if !def.SSEAlgorithm.usesKMS() {
+			return ErrorMessage(ErrInvalidArgument, "a KMSMasterKeyID is not applicable if the default sse algorithm is not aws:kms or aws:kms:dsse")
+		}
+		if _, err := g.resolveKMSKey(def.KMSMasterKeyID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ BucketEncryptionBackend = &bucketEncryptions{}
+
+// bucketEncryptions stores the default encryption of buckets in memory for
+// backends that do not implement BucketEncryptionBackend.
+type bucketEncryptions struct {
+	*bucketConfigs[*ServerSideEncryptionConfiguration]
+}
+
+func newBucketEncryptions(storage Backend) *bucketEncryptions {
+	return &bucketEncryptions{newBucketConfigs[*ServerSideEncryptionConfiguration](storage, ErrNoSuchEncryptionConfiguration)}
+}
+
+func (be *bucketEncryptions) BucketEncryption(bucket string) (*ServerSideEncryptionConfiguration, error) {
+	return be.get(bucket)
+}
+
+func (be *bucketEncryptions) PutBucketEncryption(bucket string, config *ServerSideEncryptionConfiguration) error {
+	return be.put(bucket, config)
+}
+
+func (be *bucketEncryptions) DeleteBucketEncryption(bucket string) error {
+	return be.delete(bucket)
+}
@@ -0,0 +1,370 @@
+package gofakes3_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/johannesboyne/gofakes3"
+)
+
+const testKMSKeyARN = "arn:aws:kms:us-east-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+func withKMSKeys() testServerOption {
+	return withFakerOptions(gofakes3.WithKMSKeys(gofakes3.KMSKey{
+		ARN:     testKMSKeyARN,
+		Aliases: []string{"alias/test"},
+	}))
+}
+
+func md5ETag(contents string) string {
+	sum := md5.Sum([]byte(contents))
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (ts *testServer) getObjectString(svc *s3.Client, object string, rnge string) (*s3.GetObjectOutput, string) {
+	ts.Helper()
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String(object),
+	}
+	if rnge != "" {
+		input.Range = aws.String(rnge)
+	}
+	out, err := svc.GetObject(context.TODO(), input)
+	ts.OK(err)
+	defer out.Body.Close()
+	body, err := io.ReadAll(out.Body)
+	ts.OK(err)
+	return out, string(body)
+}
+
+func TestServerSideEncryptionKMS(t *testing.T) {
+	runWithAllBackends(t, func(t *testing.T, ts *testServer) {
+		svc := ts.s3Client()
+		contents := strings.Repeat("0123456789", 10)
+
+		put, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+			Bucket:               aws.String(defaultBucket),
+			Key:                  aws.String("object"),
+			Body:                 strings.NewReader(contents),
+			ServerSideEncryption: s3types.ServerSideEncryptionAwsKms,
+			SSEKMSKeyId:          aws.String(testKMSKeyARN),
+		})
+		ts.OK(err)
+		if put.ServerSideEncryption != s3types.ServerSideEncryptionAwsKms || aws.ToString(put.SSEKMSKeyId) != testKMSKeyARN {
+			t.Fatal("unexpected encryption headers", put.ServerSideEncryption, aws.ToString(put.SSEKMSKeyId))
+		}
+		etag := aws.ToString(put.ETag)
+		if etag == md5ETag(contents) {
+			t.Fatal("ETag of an SSE-KMS object is the MD5 of its contents")
+		}
+		if stored := ts.backendGetString(defaultBucket, "object", nil); stored == contents {
+			t.Fatal("object was not encrypted")
+		}
+
+		out, body := ts.getObjectString(svc, "object", "")
+		if body != contents {
+			t.Fatal("unexpected contents", body)
+		}
+		if aws.ToString(out.ETag) != etag {
+			t.Fatal("ETag mismatch", aws.ToString(out.ETag), etag)
+		}
+		if out.ServerSideEncryption != s3types.ServerSideEncryptionAwsKms || aws.ToString(out.SSEKMSKeyId) != testKMSKeyARN {
+			t.Fatal("unexpected encryption headers", out.ServerSideEncryption, aws.ToString(out.SSEKMSKeyId))
+		}
+
+		if _, body := ts.getObjectString(svc, "object", "bytes=25-74"); body != contents[25:75] {
+			t.Fatal("unexpected range", body)
+		}
+
+		head, err := svc.HeadObject(context.TODO(), &s3.HeadObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("object"),
+		})
+		ts.OK(err)
+		if aws.ToString(head.ETag) != etag || head.ServerSideEncryption != s3types.ServerSideEncryptionAwsKms {
+			t.Fatal("unexpected HEAD", aws.ToString(head.ETag), head.ServerSideEncryption)
+		}
+
+		list, err := svc.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
+			Bucket: aws.String(defaultBucket),
+		})
+		ts.OK(err)
+		if len(list.Contents) != 1 || aws.ToString(list.Contents[0].ETag) != etag {
+			t.Fatal("unexpected listing", list.Contents)
+		}
+
+		// Copying an unencrypted object over it leaves it unencrypted:
+		ts.backendPutString(defaultBucket, "plain", nil, contents)
+		copied, err := svc.CopyObject(context.TODO(), &s3.CopyObjectInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("object"),
+			CopySource: aws.String(defaultBucket + "/plain"),
+		})
+		ts.OK(err)
+		if copied.ServerSideEncryption != "" || aws.ToString(copied.CopyObjectResult.ETag) != md5ETag(contents) {
+			t.Fatal("unexpected copy", copied.ServerSideEncryption, aws.ToString(copied.CopyObjectResult.ETag))
+		}
+	})
+}
+
+func TestServerSideEncryptionS3(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	put, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:               aws.String(defaultBucket),
+		Key:                  aws.String("object"),
+		Body:                 strings.NewReader("hello"),
+		ServerSideEncryption: s3types.ServerSideEncryptionAes256,
+	})
+	ts.OK(err)
+	if put.ServerSideEncryption != s3types.ServerSideEncryptionAes256 || aws.ToString(put.ETag) != md5ETag("hello") {
+		t.Fatal("unexpected response", put.ServerSideEncryption, aws.ToString(put.ETag))
+	}
+
+	out, body := ts.getObjectString(svc, "object", "")
+	if body != "hello" || out.ServerSideEncryption != s3types.ServerSideEncryptionAes256 || out.SSEKMSKeyId != nil {
+		t.Fatal("unexpected object", body, out.ServerSideEncryption, aws.ToString(out.SSEKMSKeyId))
+	}
+}
+
+func TestServerSideEncryptionKMSKeys(t *testing.T) {
+	ts := newTestServer(t, withKMSKeys())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	for _, keyID := range []string{
+		testKMSKeyARN,
+		"1234abcd-12ab-34cd-56ef-1234567890ab",
+		"alias/test",
+		"arn:aws:kms:us-east-1:111122223333:alias/test",
+	} {
+		put, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+			Bucket:               aws.String(defaultBucket),
+			Key:                  aws.String("object"),
+			Body:                 strings.NewReader("hello"),
+			ServerSideEncryption: s3types.ServerSideEncryptionAwsKms,
+			SSEKMSKeyId:          aws.String(keyID),
+		})
+		ts.OK(err)
+		if aws.ToString(put.SSEKMSKeyId) != testKMSKeyARN {
+			t.Fatal("key", keyID, "resolved to", aws.ToString(put.SSEKMSKeyId))
+		}
+	}
+
+	_, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:               aws.String(defaultBucket),
+		Key:                  aws.String("object"),
+		Body:                 strings.NewReader("hello"),
+		ServerSideEncryption: s3types.ServerSideEncryptionAwsKms,
+		SSEKMSKeyId:          aws.String("alias/unknown"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrKMSNotFound) {
+		t.Fatal("expected KMS.NotFoundException, found", err)
+	}
+
+	// Without a key ID, the AWS managed key is used:
+	put, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:               aws.String(defaultBucket),
+		Key:                  aws.String("object"),
+		Body:                 strings.NewReader("hello"),
+		ServerSideEncryption: s3types.ServerSideEncryptionAwsKms,
+	})
+	ts.OK(err)
+	if keyID := aws.ToString(put.SSEKMSKeyId); keyID == "" || keyID == testKMSKeyARN {
+		t.Fatal("unexpected default key", keyID)
+	}
+}
+
+func TestServerSideEncryptionInvalid(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	for _, tc := range []struct {
+		name  string
+		input *s3.PutObjectInput
+	}{
+		{"unknown algorithm", &s3.PutObjectInput{
+			ServerSideEncryption: "AES512",
+		}},
+		{"key without aws:kms", &s3.PutObjectInput{
+			ServerSideEncryption: s3types.ServerSideEncryptionAes256,
+			SSEKMSKeyId:          aws.String(testKMSKeyARN),
+		}},
+		{"key without algorithm", &s3.PutObjectInput{
+			SSEKMSKeyId: aws.String(testKMSKeyARN),
+		}},
+		{"with SSE-C", &s3.PutObjectInput{
+			ServerSideEncryption: s3types.ServerSideEncryptionAwsKms,
+			SSECustomerAlgorithm: aws.String("AES256"),
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.input.Bucket = aws.String(defaultBucket)
+			tc.input.Key = aws.String("object")
+			tc.input.Body = strings.NewReader("hello")
+			if tc.input.SSECustomerAlgorithm != nil {
+				tc.input.SSECustomerKey, tc.input.SSECustomerKeyMD5 = customerKeyPointers('a')
+			}
+			_, err := svc.PutObject(context.TODO(), tc.input)
+			if !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+				t.Fatal("expected InvalidArgument, found", err)
+			}
+		})
+	}
+}
+
+func TestBucketEncryption(t *testing.T) {
+	ts := newTestServer(t, withKMSKeys())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.GetBucketEncryption(context.TODO(), &s3.GetBucketEncryptionInput{
+		Bucket: aws.String(defaultBucket),
+	})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchEncryptionConfiguration) {
+		t.Fatal("expected ServerSideEncryptionConfigurationNotFoundError, found", err)
+	}
+
+	putEncryption := func(algorithm s3types.ServerSideEncryption, keyID string) error {
+		rule := s3types.ServerSideEncryptionRule{
+			ApplyServerSideEncryptionByDefault: &s3types.ServerSideEncryptionByDefault{
+				SSEAlgorithm: algorithm,
+			},
+			BucketKeyEnabled: aws.Bool(true),
+		}
+		if keyID != "" {
+			rule.ApplyServerSideEncryptionByDefault.KMSMasterKeyID = aws.String(keyID)
+		}
+		_, err := svc.PutBucketEncryption(context.TODO(), &s3.PutBucketEncryptionInput{
+			Bucket: aws.String(defaultBucket),
+			ServerSideEncryptionConfiguration: &s3types.ServerSideEncryptionConfiguration{
+				Rules: []s3types.ServerSideEncryptionRule{rule},
+			},
+		})
+		return err
+	}
+
+	if err := putEncryption(s3types.ServerSideEncryptionAwsKms, "alias/unknown"); !hasErrorCode(err, gofakes3.ErrKMSNotFound) {
+		t.Fatal("expected KMS.NotFoundException, found", err)
+	}
+	if err := putEncryption(s3types.ServerSideEncryptionAes256, testKMSKeyARN); !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+		t.Fatal("expected InvalidArgument, found", err)
+	}
+	ts.OK(putEncryption(s3types.ServerSideEncryptionAwsKms, "alias/test"))
+
+	config, err := svc.GetBucketEncryption(context.TODO(), &s3.GetBucketEncryptionInput{
+		Bucket: aws.String(defaultBucket),
+	})
+	ts.OK(err)
+	rules := config.ServerSideEncryptionConfiguration.Rules
+	if len(rules) != 1 ||
+		rules[0].ApplyServerSideEncryptionByDefault.SSEAlgorithm != s3types.ServerSideEncryptionAwsKms ||
+		aws.ToString(rules[0].ApplyServerSideEncryptionByDefault.KMSMasterKeyID) != "alias/test" ||
+		!aws.ToBool(rules[0].BucketKeyEnabled) {
+		t.Fatal("unexpected configuration", rules)
+	}
+
+	t.Run("put", func(t *testing.T) {
+		put, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("object"),
+			Body:   strings.NewReader("hello"),
+		})
+		ts.OK(err)
+		if put.ServerSideEncryption != s3types.ServerSideEncryptionAwsKms ||
+			aws.ToString(put.SSEKMSKeyId) != testKMSKeyARN ||
+			!aws.ToBool(put.BucketKeyEnabled) {
+			t.Fatal("default encryption not applied", put.ServerSideEncryption, aws.ToString(put.SSEKMSKeyId))
+		}
+		if aws.ToString(put.ETag) == md5ETag("hello") {
+			t.Fatal("ETag of an SSE-KMS object is the MD5 of its contents")
+		}
+
+		// Headers sent with the request take precedence:
+		put, err = svc.PutObject(context.TODO(), &s3.PutObjectInput{
+			Bucket:               aws.String(defaultBucket),
+			Key:                  aws.String("sse-s3"),
+			Body:                 strings.NewReader("hello"),
+			ServerSideEncryption: s3types.ServerSideEncryptionAes256,
+		})
+		ts.OK(err)
+		if put.ServerSideEncryption != s3types.ServerSideEncryptionAes256 || put.SSEKMSKeyId != nil {
+			t.Fatal("unexpected encryption", put.ServerSideEncryption, aws.ToString(put.SSEKMSKeyId))
+		}
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		ts.backendPutString(defaultBucket, "plain", nil, "hello")
+		copied, err := svc.CopyObject(context.TODO(), &s3.CopyObjectInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("copy"),
+			CopySource: aws.String(defaultBucket + "/plain"),
+		})
+		ts.OK(err)
+		if copied.ServerSideEncryption != s3types.ServerSideEncryptionAwsKms {
+			t.Fatal("default encryption not applied", copied.ServerSideEncryption)
+		}
+		if stored := ts.backendGetString(defaultBucket, "copy", nil); stored == "hello" {
+			t.Fatal("object was not encrypted")
+		}
+		if _, body := ts.getObjectString(svc, "copy", ""); body != "hello" {
+			t.Fatal("unexpected contents", body)
+		}
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		mpu, err := svc.CreateMultipartUpload(context.TODO(), &s3.CreateMultipartUploadInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("multipart"),
+		})
+		ts.OK(err)
+		if mpu.ServerSideEncryption != s3types.ServerSideEncryptionAwsKms {
+			t.Fatal("default encryption not applied", mpu.ServerSideEncryption)
+		}
+		uploadID := aws.ToString(mpu.UploadId)
+		parts := []s3types.CompletedPart{
+			ts.uploadPart(defaultBucket, "multipart", uploadID, 1, []byte(strings.Repeat("a", 5*1024*1024))),
+			ts.uploadPart(defaultBucket, "multipart", uploadID, 2, []byte("bc")),
+		}
+		done, err := svc.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(defaultBucket),
+			Key:             aws.String("multipart"),
+			UploadId:        aws.String(uploadID),
+			MultipartUpload: &s3types.CompletedMultipartUpload{Parts: parts},
+		})
+		ts.OK(err)
+		if done.ServerSideEncryption != s3types.ServerSideEncryptionAwsKms {
+			t.Fatal("unexpected encryption", done.ServerSideEncryption)
+		}
+
+		if _, body := ts.getObjectString(svc, "multipart", "bytes=5242878-"); body != "aabc" {
+			t.Fatal("unexpected contents", body)
+		}
+	})
+
+	_, err = svc.DeleteBucketEncryption(context.TODO(), &s3.DeleteBucketEncryptionInput{
+		Bucket: aws.String(defaultBucket),
+	})
+	ts.OK(err)
+	put, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+		Body:   strings.NewReader("hello"),
+	})
+	ts.OK(err)
+	if put.ServerSideEncryption != "" || aws.ToString(put.ETag) != md5ETag("hello") {
+		t.Fatal("encryption applied after the configuration was deleted", put.ServerSideEncryption)
+	}
+}
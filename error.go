@@ -14,14 +14,35 @@ import (
 const (
 	ErrNone ErrorCode = ""
 
+	// Access to the resource was refused. This is also returned for anonymous
+	// requests when authentication is enabled with WithCredentials.
+	ErrAccessDenied ErrorCode = "AccessDenied"
+
+	// The Authorization header could not be parsed, or its credential scope
+	// does not match the request.
+	ErrAuthorizationHeaderMalformed ErrorCode = "AuthorizationHeaderMalformed"
+
+	// The X-Amz-* query parameters of a presigned request are missing or
+	// invalid.
+	ErrAuthorizationQueryParametersError ErrorCode = "AuthorizationQueryParametersError"
+
 	// The Content-MD5 you specified did not match what we received.
 	ErrBadDigest ErrorCode = "BadDigest"
 
+	// The bucket name is taken by another account.
 	ErrBucketAlreadyExists ErrorCode = "BucketAlreadyExists"
 
+	// The bucket name is taken by the account that tried to create it.
+	ErrBucketAlreadyOwnedByYou ErrorCode = "BucketAlreadyOwnedByYou"
+
 	// Raised when attempting to delete a bucket that still contains items.
 	ErrBucketNotEmpty ErrorCode = "BucketNotEmpty"
 
+	// The size of a browser upload was outside the policy's
+	// content-length-range.
+	ErrEntityTooLarge ErrorCode = "EntityTooLarge"
+	ErrEntityTooSmall ErrorCode = "EntityTooSmall"
+
 	// "Indicates that the versioning configuration specified in the request is invalid"
 	ErrIllegalVersioningConfiguration ErrorCode = "IllegalVersioningConfigurationException"
 
@@ -41,17 +62,40 @@ const (
 
 	ErrInvalidArgument ErrorCode = "InvalidArgument"
 
+	// The access key ID in the request signature is not known to the
+	// CredentialProvider.
+	ErrInvalidAccessKeyID ErrorCode = "InvalidAccessKeyId"
+
 	// https://docs.aws.amazon.com/AmazonS3/latest/dev/BucketRestrictions.html#bucketnamingrules
 	ErrInvalidBucketName ErrorCode = "InvalidBucketName"
 
 	// The Content-MD5 you specified is not valid.
 	ErrInvalidDigest ErrorCode = "InvalidDigest"
 
+	// The algorithm of a server-side encryption request is not AES256.
+	ErrInvalidEncryptionAlgorithm ErrorCode = "InvalidEncryptionAlgorithmError"
+
+	// The object is archived by its storage class and must be restored
+	// before it can be read.
+	ErrInvalidObjectState ErrorCode = "InvalidObjectState"
+
+	// The policy of a browser upload could not be parsed.
+	ErrInvalidPolicyDocument ErrorCode = "InvalidPolicyDocument"
+
+	// The part number of a GetObject or HeadObject request is not one of the
+	// parts of the object.
+	ErrInvalidPartNumber ErrorCode = "InvalidPartNumber"
+
 	ErrInvalidRange         ErrorCode = "InvalidRange"
+	ErrInvalidTag           ErrorCode = "InvalidTag"
 	ErrInvalidToken         ErrorCode = "InvalidToken"
 	ErrKeyTooLong           ErrorCode = "KeyTooLongError" // This is not a typo: Error is part of the string, but redundant in the constant name
 	ErrMalformedPOSTRequest ErrorCode = "MalformedPOSTRequest"
 
+	// The KMS key a request refers to is not in the registry set with
+	// WithKMSKeys.
+	ErrKMSNotFound ErrorCode = "KMS.NotFoundException"
+
 	// One or more of the specified parts could not be found. The part might
 	// not have been uploaded, or the specified entity tag might not have
 	// matched the part's entity tag.
@@ -61,18 +105,52 @@ const (
 	// specified in order by part number.
 	ErrInvalidPartOrder ErrorCode = "InvalidPartOrder"
 
-	ErrInvalidURI ErrorCode = "InvalidURI"
+	// The request is not valid in the current state of the bucket, such as
+	// suspending versioning of a bucket with Object Lock enabled.
+	ErrInvalidBucketState ErrorCode = "InvalidBucketState"
+
+	ErrInvalidRequest ErrorCode = "InvalidRequest"
+	ErrInvalidURI     ErrorCode = "InvalidURI"
+
+	// The storage class of an upload is not one S3 supports.
+	ErrInvalidStorageClass ErrorCode = "InvalidStorageClass"
 
 	ErrMetadataTooLarge ErrorCode = "MetadataTooLarge"
 	ErrMethodNotAllowed ErrorCode = "MethodNotAllowed"
 	ErrMalformedXML     ErrorCode = "MalformedXML"
 
+	// The XML of an ACL was not well-formed, or did not validate against the
+	// schema.
+	ErrMalformedACLError ErrorCode = "MalformedACLError"
+
+	// The bucket policy document is not valid JSON, or does not validate
+	// against the policy grammar.
+	ErrMalformedPolicy ErrorCode = "MalformedPolicy"
+
 	// You must provide the Content-Length HTTP header.
 	ErrMissingContentLength ErrorCode = "MissingContentLength"
 
 	// See BucketNotFound() for a helper function for this error:
 	ErrNoSuchBucket ErrorCode = "NoSuchBucket"
 
+	// The specified bucket does not have a bucket policy.
+	ErrNoSuchBucketPolicy ErrorCode = "NoSuchBucketPolicy"
+
+	// The bucket has no tags.
+	ErrNoSuchTagSet ErrorCode = "NoSuchTagSet"
+
+	// The object version has no retention or legal hold.
+	ErrNoSuchObjectLockConfiguration ErrorCode = "NoSuchObjectLockConfiguration"
+
+	// Object Lock is not enabled for the bucket.
+	ErrObjectLockConfigurationNotFound ErrorCode = "ObjectLockConfigurationNotFoundError"
+
+	// The bucket has no default encryption.
+	ErrNoSuchEncryptionConfiguration ErrorCode = "ServerSideEncryptionConfigurationNotFoundError"
+
+	// The bucket has no lifecycle configuration.
+	ErrNoSuchLifecycleConfiguration ErrorCode = "NoSuchLifecycleConfiguration"
+
 	// The specified bucket does not exist.
 	ErrNonExistentBucket ErrorCode = "NonExistentBucket"
 
@@ -94,10 +172,25 @@ const (
 	// A conflicting conditional operation is currently in progress against this resource
 	ErrConditionalRequestConflict ErrorCode = "ConditionalRequestConflict"
 
+	// The object is already being restored from its archive.
+	ErrRestoreAlreadyInProgress ErrorCode = "RestoreAlreadyInProgress"
+
 	ErrRequestTimeTooSkewed ErrorCode = "RequestTimeTooSkewed"
 	ErrTooManyBuckets       ErrorCode = "TooManyBuckets"
 	ErrNotImplemented       ErrorCode = "NotImplemented"
 
+	// An ACL grants a permission to an e-mail address that does not belong
+	// to any account.
+	ErrUnresolvableGrantByEmailAddress ErrorCode = "UnresolvableGrantByEmailAddress"
+
+	// The signature GoFakeS3 calculated for the request does not match the
+	// signature the client sent.
+	ErrSignatureDoesNotMatch ErrorCode = "SignatureDoesNotMatch"
+
+	// The request body did not match the hash sent in the X-Amz-Content-Sha256
+	// header.
+	ErrXAmzContentSHA256Mismatch ErrorCode = "XAmzContentSHA256Mismatch"
+
 	ErrInternal ErrorCode = "InternalError"
 )
 
@@ -228,14 +321,56 @@ func (e ErrorCode) Message() string {
 		return `Bucket name must match the regex "^[a-zA-Z0-9.\-_]{1,255}$"`
 	case ErrNoSuchBucket:
 		return "The specified bucket does not exist"
+	case ErrBucketAlreadyExists:
+		return "The requested bucket name is not available. The bucket namespace is shared by all users of the system. Please select a different name and try again."
+	case ErrBucketAlreadyOwnedByYou:
+		return "Your previous request to create the named bucket succeeded and you already own it."
+	case ErrNoSuchBucketPolicy:
+		return "The bucket policy does not exist"
+	case ErrNoSuchTagSet:
+		return "The TagSet does not exist"
+	case ErrNoSuchEncryptionConfiguration:
+		return "The server side encryption configuration was not found"
+	case ErrNoSuchLifecycleConfiguration:
+		return "The lifecycle configuration does not exist"
+	case ErrNoSuchObjectLockConfiguration:
+		return "The specified object does not have a ObjectLock configuration"
+	case ErrObjectLockConfigurationNotFound:
+		return "Object Lock configuration does not exist for this bucket"
+	case ErrMalformedACLError:
+		return "The XML you provided was not well-formed or did not validate against our published schema"
+	case ErrUnresolvableGrantByEmailAddress:
+		return "The e-mail address you provided does not match any account on record."
 	case ErrRequestTimeTooSkewed:
 		return "The difference between the request time and the current time is too large"
 	case ErrMalformedXML:
 		return "The XML you provided was not well-formed or did not validate against our published schema"
+	case ErrInvalidPartNumber:
+		return "The requested partnumber is not satisfiable"
 	case ErrPreconditionFailed:
 		return "At least one of the preconditions you specified did not hold"
 	case ErrConditionalRequestConflict:
 		return "A conflicting conditional operation is currently in progress against this resource"
+	case ErrAccessDenied:
+		return "Access Denied"
+	case ErrEntityTooLarge:
+		return "Your proposed upload exceeds the maximum allowed size"
+	case ErrEntityTooSmall:
+		return "Your proposed upload is smaller than the minimum allowed size"
+	case ErrInvalidAccessKeyID:
+		return "The AWS Access Key Id you provided does not exist in our records."
+	case ErrSignatureDoesNotMatch:
+		return "The request signature we calculated does not match the signature you provided. Check your key and signing method."
+	case ErrXAmzContentSHA256Mismatch:
+		return "The provided 'x-amz-content-sha256' header does not match what was computed."
+	case ErrInvalidEncryptionAlgorithm:
+		return "The encryption request you specified is not valid. The valid value is AES256."
+	case ErrInvalidStorageClass:
+		return "The storage class you specified is not valid"
+	case ErrInvalidObjectState:
+		return "The operation is not valid for the object's storage class"
+	case ErrRestoreAlreadyInProgress:
+		return "Object restore is already in progress"
 	default:
 		return ""
 	}
@@ -244,16 +379,23 @@ func (e ErrorCode) Message() string {
 func (e ErrorCode) Status() int {
 	switch e {
 	case ErrBucketAlreadyExists,
+		ErrBucketAlreadyOwnedByYou,
 		ErrBucketNotEmpty:
 		return http.StatusConflict
 
-	case ErrConditionalRequestConflict:
+	case ErrConditionalRequestConflict,
+		ErrInvalidBucketState,
+		ErrRestoreAlreadyInProgress:
 		return http.StatusConflict
 
 	case ErrPreconditionFailed:
 		return http.StatusPreconditionFailed
 
-	case ErrBadDigest,
+	case ErrAuthorizationHeaderMalformed,
+		ErrAuthorizationQueryParametersError,
+		ErrBadDigest,
+		ErrEntityTooLarge,
+		ErrEntityTooSmall,
 		ErrIllegalVersioningConfiguration,
 		ErrIncompleteBody,
 		ErrIncorrectNumberOfFilesInPostRequest,
@@ -261,28 +403,49 @@ func (e ErrorCode) Status() int {
 		ErrInvalidArgument,
 		ErrInvalidBucketName,
 		ErrInvalidDigest,
+		ErrInvalidEncryptionAlgorithm,
 		ErrInvalidPart,
 		ErrInvalidPartOrder,
+		ErrInvalidPolicyDocument,
+		ErrInvalidRequest,
+		ErrInvalidStorageClass,
+		ErrInvalidTag,
 		ErrInvalidToken,
 		ErrInvalidURI,
 		ErrKeyTooLong,
+		ErrKMSNotFound,
 		ErrMetadataTooLarge,
 		ErrMethodNotAllowed,
 		ErrMalformedPOSTRequest,
+		ErrMalformedACLError,
+		ErrMalformedPolicy,
 		ErrMalformedXML,
-		ErrTooManyBuckets:
+		ErrTooManyBuckets,
+		ErrUnresolvableGrantByEmailAddress,
+		ErrXAmzContentSHA256Mismatch:
 		return http.StatusBadRequest
 
-	case ErrRequestTimeTooSkewed:
+	case ErrAccessDenied,
+		ErrInvalidAccessKeyID,
+		ErrInvalidObjectState,
+		ErrRequestTimeTooSkewed,
+		ErrSignatureDoesNotMatch:
 		return http.StatusForbidden
 
-	case ErrInvalidRange:
+	case ErrInvalidPartNumber,
+		ErrInvalidRange:
 		return http.StatusRequestedRangeNotSatisfiable
 
 	case ErrNoSuchBucket,
+		ErrNoSuchBucketPolicy,
+		ErrNoSuchEncryptionConfiguration,
 		ErrNoSuchKey,
+		ErrNoSuchLifecycleConfiguration,
+		ErrNoSuchObjectLockConfiguration,
+		ErrNoSuchTagSet,
 		ErrNoSuchUpload,
-		ErrNoSuchVersion:
+		ErrNoSuchVersion,
+		ErrObjectLockConfigurationNotFound:
 		return http.StatusNotFound
 
 	case ErrNotImplemented:
@@ -358,6 +521,60 @@ func requestTimeTooSkewed(at time.Time, max time.Duration) error {
 	}
 }
 
+type invalidAccessKeyIDResponse struct {
+	ErrorResponse
+	AWSAccessKeyID string `xml:"AWSAccessKeyId"`
+}
+
+var _ errorResponse = &invalidAccessKeyIDResponse{}
+
+func invalidAccessKeyID(accessKeyID string) error {
+	code := ErrInvalidAccessKeyID
+	return &invalidAccessKeyIDResponse{
+		ErrorResponse{Code: code, Message: code.Message()},
+		accessKeyID,
+	}
+}
+
+// signatureDoesNotMatchResponse includes the string to sign and the
+// canonical request, like S3 does, so clients can work out where their
+// signature went wrong.
+type signatureDoesNotMatchResponse struct {
+	ErrorResponse
+	AWSAccessKeyID    string `xml:"AWSAccessKeyId"`
+	StringToSign      string
+	SignatureProvided string
+	CanonicalRequest  string
+}
+
+var _ errorResponse = &signatureDoesNotMatchResponse{}
+
+func signatureDoesNotMatch(accessKeyID, stringToSign, signatureProvided, canonicalRequest string) error {
+	code := ErrSignatureDoesNotMatch
+	return &signatureDoesNotMatchResponse{
+		ErrorResponse{Code: code, Message: code.Message()},
+		accessKeyID, stringToSign, signatureProvided, canonicalRequest,
+	}
+}
+
+// requestExpiredResponse is returned when a presigned request is used after
+// its X-Amz-Expires has elapsed.
+type requestExpiredResponse struct {
+	ErrorResponse
+	XAmzExpires int64 `xml:"X-Amz-Expires"`
+	Expires     time.Time
+	ServerTime  time.Time
+}
+
+var _ errorResponse = &requestExpiredResponse{}
+
+func requestExpired(expires time.Duration, expiredAt time.Time, at time.Time) error {
+	return &requestExpiredResponse{
+		ErrorResponse{Code: ErrAccessDenied, Message: "Request has expired"},
+		int64(expires / time.Second), expiredAt, at,
+	}
+}
+
 // durationAsMilliseconds tricks xml.Marshal into serialising a time.Duration as
 // truncated milliseconds instead of nanoseconds.
 type durationAsMilliseconds time.Duration
@@ -24,8 +24,15 @@ import (
 type GoFakeS3 struct {
 	requestID uint64
 
-	storage   Backend
-	versioned VersionedBackend
+	storage                   Backend
+	versioned                 VersionedBackend
+	acls                      ACLBackend
+	tagging                   ObjectTaggingBackend
+	bucketTagging             BucketTaggingBackend
+	metadata                  ObjectMetadataBackend
+	conditionalDeletes        ConditionalDeleteBackend
+	conditionalVersionDeletes ConditionalVersionDeleteBackend
+	conditionalCopies         ConditionalCopyBackend
 
 	wrapCORS                func(h http.Handler) http.Handler // WithInsecureCORS
 	timeSource              TimeSource                        // WithTimeSource
@@ -36,7 +43,17 @@ type GoFakeS3 struct {
 	hostBucket              bool                              // WithHostBucket
 	hostBucketBases         []string                          // WithHostBucketBase
 	autoBucket              bool                              // WithAutoBucket
+	credentials             CredentialProvider                // WithCredentials
+	accounts                AccountProvider                   // WithAccounts
+	kmsKeys                 []KMSKey                          // WithKMSKeys
+	restoreDelay            time.Duration                     // WithRestoreDelay
 	uploader                MultipartBackend
+	policies                BucketPolicyBackend
+	encryption              BucketEncryptionBackend
+	lifecycles              BucketLifecycleBackend
+	objectLocks             BucketObjectLockBackend
+	owners                  *bucketOwners
+	restores                *objectRestores
 	log                     Logger
 }
 
@@ -51,10 +68,19 @@ func New(backend Backend, options ...Option) *GoFakeS3 {
 		integrityCheck:    true,
 		requestID:         0,
 		wrapCORS:          wrapCORS,
+		owners:            newBucketOwners(),
+		restores:          newObjectRestores(),
 	}
 
 	// versioned MUST be set before options as one of the options disables it:
 	s3.versioned, _ = backend.(VersionedBackend)
+	s3.acls, _ = backend.(ACLBackend)
+	s3.tagging, _ = backend.(ObjectTaggingBackend)
+	s3.bucketTagging, _ = backend.(BucketTaggingBackend)
+	s3.metadata, _ = backend.(ObjectMetadataBackend)
+	s3.conditionalDeletes, _ = backend.(ConditionalDeleteBackend)
+	s3.conditionalVersionDeletes, _ = backend.(ConditionalVersionDeleteBackend)
+	s3.conditionalCopies, _ = backend.(ConditionalCopyBackend)
 
 	for _, opt := range options {
 		opt(s3)
@@ -62,6 +88,7 @@ func New(backend Backend, options ...Option) *GoFakeS3 {
 	if s3.log == nil {
 		s3.log = DiscardLog()
 	}
+	s3.accounts, _ = s3.credentials.(AccountProvider)
 	if s3.timeSource == nil {
 		s3.timeSource = DefaultTimeSource()
 	}
@@ -70,6 +97,26 @@ func New(backend Backend, options ...Option) *GoFakeS3 {
 	} else {
 		s3.uploader = newUploader(backend, s3.timeSource)
 	}
+	if pb, ok := backend.(BucketPolicyBackend); ok {
+		s3.policies = pb
+	} else {
+		s3.policies = newBucketPolicies(backend)
+	}
+	if eb, ok := backend.(BucketEncryptionBackend); ok {
+		s3.encryption = eb
+	} else {
+		s3.encryption = newBucketEncryptions(backend)
+	}
+	if lb, ok := backend.(BucketLifecycleBackend); ok {
+		s3.lifecycles = lb
+	} else {
+		s3.lifecycles = newBucketLifecycles(backend)
+	}
+	if lb, ok := backend.(BucketObjectLockBackend); ok {
+		s3.objectLocks = lb
+	} else {
+		s3.objectLocks = newBucketObjectLocks(backend)
+	}
 
 	return s3
 }
@@ -82,6 +129,10 @@ func (g *GoFakeS3) nextRequestID() uint64 {
 func (g *GoFakeS3) Server() http.Handler {
 	var handler http.Handler = g.wrapCORS(http.HandlerFunc(g.routeBase))
 
+	if g.credentials != nil {
+		handler = g.authMiddleware(handler)
+	}
+
 	if g.timeSkew != 0 {
 		handler = g.timeSkewMiddleware(handler)
 	}
@@ -193,13 +244,31 @@ func (g *GoFakeS3) listBuckets(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	owner, err := g.requestOwner(r)
+	if err != nil {
+		return err
+	}
+	if g.accounts != nil {
+		// Each account only sees its own buckets:
+		owned := buckets[:0:0]
+		for _, bucket := range buckets {
+			bucketOwner, err := g.bucketOwner(bucket.Name)
+			if HasErrorCode(err, ErrNoSuchBucket) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if bucketOwner.ID == owner.ID {
+				owned = append(owned, bucket)
+			}
+		}
+		buckets = owned
+	}
+
 	s := &Storage{
 		Xmlns:   "http://s3.amazonaws.com/doc/2006-03-01/",
 		Buckets: buckets,
-		Owner: &UserInfo{
-			ID:          "fe7272ea58be830e56fe1663b10fafef",
-			DisplayName: "GoFakeS3",
-		},
+		Owner:   &owner,
 	}
 
 	return g.xmlEncoder(w).Encode(s)
@@ -254,6 +323,16 @@ func (g *GoFakeS3) listBucket(bucketName string, w http.ResponseWriter, r *http.
 		}
 	}
 
+	owner, err := g.bucketOwner(bucketName)
+	if err != nil {
+		return err
+	}
+	for _, content := range objects.Contents {
+		if content.Owner == nil {
+			content.Owner = &owner
+		}
+	}
+
 	base := ListBucketResultBase{
 		Xmlns:          "http://s3.amazonaws.com/doc/2006-03-01/",
 		Name:           bucketName,
@@ -364,7 +443,23 @@ func (g *GoFakeS3) listBucketVersions(bucketName string, w http.ResponseWriter,
 		return err
 	}
 
+	owner, err := g.bucketOwner(bucketName)
+	if err != nil {
+		return err
+	}
+
 	for _, ver := range bucket.Versions {
+		switch ver := ver.(type) {
+		case *Version:
+			if ver.Owner == nil {
+				ver.Owner = &owner
+			}
+		case *DeleteMarker:
+			if ver.Owner == nil {
+				ver.Owner = &owner
+			}
+		}
+
 		// S300005: S3 returns the _string_ 'null' for the version ID if the
 		// bucket has never had versioning enabled. GoFakeS3 backend
 		// implementers should be able to simply return the empty string;
@@ -385,10 +480,55 @@ func (g *GoFakeS3) createBucket(bucket string, w http.ResponseWriter, r *http.Re
 	if err := ValidateBucketName(bucket); err != nil {
 		return err
 	}
-	if err := g.storage.CreateBucket(bucket); err != nil {
+	owner, err := g.requestOwner(r)
+	if err != nil {
+		return err
+	}
+	acl, err := aclFromHeaders(r.Header.Get, owner, owner)
+	if err != nil {
+		return err
+	}
+	objectLock, _ := strconv.ParseBool(r.Header.Get("x-amz-bucket-object-lock-enabled"))
+	if objectLock && g.versioned == nil {
+		return ErrNotImplemented
+	}
+	if err := g.storage.CreateBucket(bucket); IsAlreadyExists(err) {
+		existingOwner, ownerErr := g.bucketOwner(bucket)
+		if ownerErr == nil && existingOwner.ID == owner.ID {
+			return ResourceError(ErrBucketAlreadyOwnedByYou, bucket)
+		}
+		return err
+	} else if err != nil {
 		return err
 	}
 
+	if g.acls != nil {
+		if acl == nil && owner.ID != defaultOwner.ID {
+			// The bucket's ACL records its owner:
+			acl = privateACL(owner)
+		}
+		if acl != nil {
+			if err := g.acls.PutBucketACL(bucket, acl); err != nil {
+				return err
+			}
+		}
+	} else {
+		g.owners.set(bucket, owner)
+		if acl != nil {
+			g.log.Print(LogWarn, "backend does not support ACLs; ignoring the ACL of bucket", bucket)
+		}
+	}
+
+	// Object Lock requires versioning, which is enabled with it:
+	if objectLock {
+		if err := g.versioned.SetVersioningConfiguration(bucket, VersioningConfiguration{Status: VersioningEnabled}); err != nil {
+			return err
+		}
+		if err := g.objectLocks.PutObjectLockConfiguration(bucket, &ObjectLockConfiguration{ObjectLockEnabled: "Enabled"}); err != nil {
+			return err
+		}
+	}
+
 	w.Header().Set("Location", "/"+bucket)
 	w.Write([]byte{})
 	return nil
@@ -419,6 +559,15 @@ func (g *GoFakeS3) deleteBucket(bucket string, w http.ResponseWriter, r *http.Re
 	if err := g.storage.DeleteBucket(bucket); err != nil {
 		return err
 	}
+	// The configurations GoFakeS3 keeps for backends that can't must not
+	// apply to a new bucket with the same name:
+	for _, store := range []interface{}{g.policies, g.encryption, g.lifecycles, g.objectLocks} {
+		if f, ok := store.(interface{ forget(bucket string) }); ok {
+			f.forget(bucket)
+		}
+	}
+	g.owners.forget(bucket)
+	g.restores.forget(bucket)
 
 	w.WriteHeader(http.StatusNoContent)
 	return nil
@@ -458,6 +607,35 @@ func (g *GoFakeS3) getObject(
 	if err != nil {
 		return err
 	}
+	partNumber, err := parsePartNumber(r)
+	if err != nil {
+		return err
+	}
+	var partsCount int
+	if partNumber != 0 {
+		// The parts of the object are kept in its metadata, so it is looked
+		// up first; errors are left for the read to report:
+		if head, err := g.headObjectOrVersion(bucket, object, versionID); err == nil {
+			head.Contents.Close()
+			if rnge, partsCount, err = objectPartRange(head.Metadata, head.Size, partNumber); err != nil {
+				return err
+			}
+		}
+	}
+	if rnge != nil && r.Header.Get("If-Range") != "" {
+		// The object is only known once it has been read with the range, so
+		// it is looked up first; errors are left for the read to report:
+		if head, err := g.headObjectOrVersion(bucket, object, versionID); err == nil {
+			head.Contents.Close()
+			if !ifRangeMatches(r.Header, ObjectETag(head.Hash, head.Metadata), objectLastModified(head)) {
+				rnge = nil
+			}
+		}
+	}
+	key, err := parseCustomerKey(r.Header, sseCustomerHeaderPrefix)
+	if err != nil {
+		return err
+	}
 
 	var obj *Object
 
@@ -489,9 +667,25 @@ func (g *GoFakeS3) getObject(
 		}
 	}(obj.Contents)
 
+	if err := decryptObject(obj, key); err != nil {
+		return err
+	}
+
+	if err := g.checkReadable(bucket, obj); err != nil {
+		return err
+	}
 	if err := g.writeGetOrHeadObjectResponse(obj, w, r); err != nil {
 		return err
 	}
+	if partsCount > 0 {
+		w.Header().Set("x-amz-mp-parts-count", strconv.Itoa(partsCount))
+	}
+	g.writeRestoreHeader(bucket, obj, w)
+	if versionID == "" {
+		if err := g.writeExpirationHeader(bucket, obj, w); err != nil {
+			return err
+		}
+	}
 
 	// Writes Content-Length, and Content-Range if applicable:
 	obj.Range.writeHeader(obj.Size, w)
@@ -527,24 +721,35 @@ func (g *GoFakeS3) writeGetOrHeadObjectResponse(obj *Object, w http.ResponseWrit
 		return KeyNotFound(obj.Name)
 	}
 
+	etag := ObjectETag(obj.Hash, obj.Metadata)
+	lastModified := objectLastModified(obj)
+	if err := checkPreconditions(r.Header, etag, lastModified); err != nil {
+		return err
+	}
+
+	// Checksums are only returned on request, and only for whole objects:
+	withChecksum := strings.EqualFold(r.Header.Get("x-amz-checksum-mode"), "ENABLED") && r.Header.Get("Range") == "" && r.URL.Query().Get("partNumber") == ""
+
 	for mk, mv := range obj.Metadata {
+		if mk == taggingMetadataKey || isPartsMetadata(mk) || mk == sseNonceMetadataKey || (isChecksumMetadata(mk) && !withChecksum) {
+			continue
+		}
 		w.Header().Set(mk, mv)
 	}
+	if tags, _ := tagsFromMetadata(obj.Metadata); len(tags) > 0 {
+		w.Header().Set("x-amz-tagging-count", strconv.Itoa(len(tags)))
+	}
 
 	if obj.VersionID != "" {
 		w.Header().Set("x-amz-version-id", string(obj.VersionID))
 	}
 
-	etag := `"` + hex.EncodeToString(obj.Hash) + `"`
 	w.Header().Set("ETag", etag)
-
-	if r.Header.Get("If-None-Match") == etag {
-		return ErrNotModified
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", formatHeaderTime(lastModified))
 	}
 
-	lastModified, _ := time.Parse(http.TimeFormat, obj.Metadata["Last-Modified"])
-	ifModifiedSince, _ := time.Parse(http.TimeFormat, r.Header.Get("If-Modified-Since"))
-	if !lastModified.IsZero() && !ifModifiedSince.Before(lastModified) {
+	if notModified(r.Header, etag, lastModified) {
 		return ErrNotModified
 	}
 
@@ -576,6 +781,11 @@ func (g *GoFakeS3) headObject(
 		return err
 	}
 
+	key, err := parseCustomerKey(r.Header, sseCustomerHeaderPrefix)
+	if err != nil {
+		return err
+	}
+
 	obj, err := g.storage.HeadObject(bucket, object)
 	if err != nil {
 		return err
@@ -586,9 +796,17 @@ func (g *GoFakeS3) headObject(
 	}
 	defer obj.Contents.Close()
 
+	if err := decryptObject(obj, key); err != nil {
+		return err
+	}
+
 	if err := g.writeGetOrHeadObjectResponse(obj, w, r); err != nil {
 		return err
 	}
+	g.writeRestoreHeader(bucket, obj, w)
+	if err := g.writeExpirationHeader(bucket, obj, w); err != nil {
+		return err
+	}
 
 	// HeadObject does not fetch a ranged body, but S3 still honours the Range
 	// header on HEAD: it responds with 206 and a Content-Range/Content-Length
@@ -597,6 +815,22 @@ func (g *GoFakeS3) headObject(
 	if err != nil {
 		return err
 	}
+	if !ifRangeMatches(r.Header, ObjectETag(obj.Hash, obj.Metadata), objectLastModified(obj)) {
+		rngeReq = nil
+	}
+	partNumber, err := parsePartNumber(r)
+	if err != nil {
+		return err
+	}
+	if partNumber != 0 {
+		var partsCount int
+		if rngeReq, partsCount, err = objectPartRange(obj.Metadata, obj.Size, partNumber); err != nil {
+			return err
+		}
+		if partsCount > 0 {
+			w.Header().Set("x-amz-mp-parts-count", strconv.Itoa(partsCount))
+		}
+	}
 	rnge, err := rngeReq.Range(obj.Size)
 	if err != nil {
 		return err
@@ -640,16 +874,70 @@ func (g *GoFakeS3) createObjectBrowserUpload(bucket string, w http.ResponseWrite
 	}
 	fileHeader := fileValues[0]
 
+	// Form field names are not case sensitive:
+	fields := map[string]string{"bucket": bucket}
+	formHeaders := make(http.Header, len(r.MultipartForm.Value))
+	for name, values := range r.MultipartForm.Value {
+		fields[strings.ToLower(name)] = values[0]
+		formHeaders[textproto.CanonicalMIMEHeaderKey(name)] = values
+	}
+
+	policy, err := g.checkPostPolicy(fields, r)
+	if err != nil {
+		return err
+	}
+	if policy != nil {
+		if err := policy.checkSize(fileHeader.Size); err != nil {
+			return err
+		}
+	}
+
+	key = strings.ReplaceAll(key, "${filename}", fileHeader.Filename)
+	if err := g.authorize(r, "s3:PutObject", bucket, key); err != nil {
+		return err
+	}
+
 	infile, err := fileHeader.Open()
 	if err != nil {
 		return err
 	}
 	defer infile.Close()
 
-	meta, err := metadataHeaders(r.MultipartForm.Value, g.timeSource.Now(), g.metadataSizeLimit)
+	// The fields that sign the form describe the upload, not the object:
+	for _, name := range []string{"X-Amz-Algorithm", "X-Amz-Credential", "X-Amz-Date", "X-Amz-Signature"} {
+		delete(formHeaders, name)
+	}
+	if acl := fields["acl"]; acl != "" {
+		formHeaders.Set("X-Amz-Acl", acl)
+	}
+	if tagging := fields["tagging"]; tagging != "" {
+		// Browser uploads send their tags as a Tagging document:
+		var in Tagging
+		if err := xml.Unmarshal([]byte(tagging), &in); err != nil {
+			return ErrorMessage(ErrMalformedXML, ErrMalformedXML.Message())
+		}
+		formHeaders.Set(taggingMetadataKey, encodeTaggingHeader(in.TagSet))
+	}
+	meta, err := metadataHeaders(formHeaders, g.timeSource.Now(), g.metadataSizeLimit)
+	if err != nil {
+		return err
+	}
+	if err := g.checkObjectACL(bucket, meta); err != nil {
+		return err
+	}
+	if err := normalizeTaggingMetadata(meta); err != nil {
+		return err
+	}
+	if err := validateStorageClass(meta); err != nil {
+		return err
+	}
+	enc, err := g.requestEncryption(bucket, meta, nil)
 	if err != nil {
 		return err
 	}
+	if err := g.applyObjectLock(bucket, meta); err != nil {
+		return err
+	}
 
 	if len(key) > KeySizeLimit {
 		return ResourceError(ErrKeyTooLong, key)
@@ -661,16 +949,107 @@ func (g *GoFakeS3) createObjectBrowserUpload(bucket string, w http.ResponseWrite
 		return err
 	}
 
-	result, err := g.storage.PutObject(bucket, key, meta, rdr, fileHeader.Size, nil)
+	var input io.Reader = rdr
+	if algorithm, expected, trailing, err := requestChecksum(meta); err != nil {
+		return err
+	} else if trailing {
+		return ErrorMessage(ErrInvalidRequest, "The x-amz-trailer header can only be used with an aws-chunked upload.")
+	} else if algorithm != "" {
+		if !g.integrityCheck {
+			expected = ""
+		}
+		if input, err = newChecksumReader(rdr, algorithm, expected, meta); err != nil {
+			return err
+		}
+	}
+
+	hash := rdr
+	if dataKey, nonce, err := newObjectEncryption(meta, nil, enc); err != nil {
+		return err
+	} else if dataKey != nil {
+		if hash, err = newHashingReader(dataKey.encrypt(input, nonce, 0), ""); err != nil {
+			return err
+		}
+		input = hash
+	}
+
+	result, err := g.storage.PutObject(bucket, key, meta, input, fileHeader.Size, nil)
 	if err != nil {
 		return err
 	}
 	if result.VersionID != "" {
 		w.Header().Set("x-amz-version-id", string(result.VersionID))
 	}
+	enc.writeHeaders(w)
 
-	w.Header().Set("ETag", `"`+hex.EncodeToString(rdr.Sum(nil))+`"`)
-	return nil
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+	location := g.objectLocation(bucket, key, r)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Location", location)
+
+	redirect := fields["success_action_redirect"]
+	if redirect == "" {
+		redirect = fields["redirect"] // Deprecated, but still honoured by S3
+	}
+	if u, err := url.Parse(redirect); redirect != "" && err == nil && u.IsAbs() {
+		query := u.Query()
+		query.Set("bucket", bucket)
+		query.Set("key", key)
+		query.Set("etag", etag)
+		u.RawQuery = query.Encode()
+		http.Redirect(w, r, u.String(), http.StatusSeeOther)
+		return nil
+	}
+
+	status := postUploadStatus(fields["success_action_status"])
+	if status != http.StatusCreated {
+		w.WriteHeader(status)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	return g.xmlEncoder(w).Encode(&PostResponse{
+		Location: location,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     etag,
+	})
+}
+
+// checkPostPolicy checks the policy of a browser upload against the form's
+// fields. If authentication is enabled, a policy must be signed; a form
+// without one is an anonymous upload, which the bucket's policy or ACL must
+// allow.
+func (g *GoFakeS3) checkPostPolicy(fields map[string]string, r *http.Request) (*postPolicy, error) {
+	// authMiddleware lets unsigned browser uploads through, as the signature
+	// is in the form:
+	mustSign := g.credentials != nil && authFromRequest(r) == nil
+
+	encoded, ok := fields["policy"]
+	if !ok {
+		// Without a policy there is nothing to check the credential against,
+		// so requestAccessKeyID must not be handed one:
+		if _, signed := fields["x-amz-credential"]; signed && mustSign {
+			return nil, ErrorInvalidArgument("Policy", "", "Bucket POST must contain a field named 'policy'.")
+		}
+		return nil, nil
+	}
+
+	if mustSign {
+		if err := g.verifyPostPolicySignature(fields); err != nil {
+			return nil, err
+		}
+	}
+
+	policy, err := parsePostPolicy(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.check(fields, g.timeSource.Now()); err != nil {
+		return nil, err
+	}
+	return policy, nil
 }
 
 // CreateObject creates a new S3 object.
@@ -685,6 +1064,15 @@ func (g *GoFakeS3) createObject(bucket, object string, w http.ResponseWriter, r
 	if err != nil {
 		return err
 	}
+	if err := g.checkObjectACL(bucket, meta); err != nil {
+		return err
+	}
+	if err := normalizeTaggingMetadata(meta); err != nil {
+		return err
+	}
+	if err := validateStorageClass(meta); err != nil {
+		return err
+	}
 
 	if _, ok := meta["X-Amz-Copy-Source"]; ok {
 		return g.copyObject(bucket, object, meta, w, r)
@@ -695,6 +1083,17 @@ func (g *GoFakeS3) createObject(bucket, object string, w http.ResponseWriter, r
 	if err != nil {
 		return err
 	}
+	key, err := parseCustomerKey(r.Header, sseCustomerHeaderPrefix)
+	if err != nil {
+		return err
+	}
+	enc, err := g.requestEncryption(bucket, meta, key)
+	if err != nil {
+		return err
+	}
+	if err := g.applyObjectLock(bucket, meta); err != nil {
+		return err
+	}
 
 	contentLength := r.Header.Get("Content-Length")
 	if contentLength == "" {
@@ -721,14 +1120,17 @@ func (g *GoFakeS3) createObject(bucket, object string, w http.ResponseWriter, r
 	}
 
 	var reader io.Reader
+	var chunked *chunkedReader
 
-	if sha, ok := meta["X-Amz-Content-Sha256"]; ok && sha == "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
-		reader = newChunkedReader(r.Body)
+	if sha, ok := meta["X-Amz-Content-Sha256"]; ok && isStreamingPayload(sha) {
 		size, err = strconv.ParseInt(meta["X-Amz-Decoded-Content-Length"], 10, 64)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest) // XXX: no code for this, according to s3tests
 			return nil
 		}
+		chunked = newStreamingReader(r, size)
+		reader = chunked
+		removeChunkedEncoding(meta)
 	} else {
 		reader = r.Body
 	}
@@ -741,7 +1143,38 @@ func (g *GoFakeS3) createObject(bucket, object string, w http.ResponseWriter, r
 		return err
 	}
 
-	result, err := g.storage.PutObject(bucket, object, meta, rdr, size, conditions)
+	var input io.Reader = rdr
+	var checksum *checksumReader
+	if algorithm, expected, trailing, err := requestChecksum(meta); err != nil {
+		return err
+	} else if algorithm != "" {
+		if !g.integrityCheck {
+			expected = ""
+		}
+		if checksum, err = newChecksumReader(rdr, algorithm, expected, meta); err != nil {
+			return err
+		}
+		if trailing && g.integrityCheck {
+			if err := checksum.expectTrailer(chunked); err != nil {
+				return err
+			}
+		}
+		input = checksum
+	}
+
+	// The ETag of an encrypted object is the MD5 of what the backend stores,
+	// which is what GetObject returns for it:
+	etag := rdr
+	if dataKey, nonce, err := newObjectEncryption(meta, key, enc); err != nil {
+		return err
+	} else if dataKey != nil {
+		if etag, err = newHashingReader(dataKey.encrypt(input, nonce, 0), ""); err != nil {
+			return err
+		}
+		input = etag
+	}
+
+	result, err := g.storage.PutObject(bucket, object, meta, input, size, conditions)
 	if err != nil {
 		return err
 	}
@@ -750,7 +1183,13 @@ func (g *GoFakeS3) createObject(bucket, object string, w http.ResponseWriter, r
 		g.log.Print(LogInfo, "CREATED VERSION:", bucket, object, result.VersionID)
 		w.Header().Set("x-amz-version-id", string(result.VersionID))
 	}
-	w.Header().Set("ETag", `"`+hex.EncodeToString(rdr.Sum(nil))+`"`)
+	if checksum != nil {
+		w.Header().Set(checksum.algorithm.header(), checksum.Value())
+		w.Header().Set(checksumTypeMetadataKey, string(ChecksumTypeFullObject))
+	}
+	key.writeHeaders(w)
+	enc.writeHeaders(w)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(etag.Sum(nil))+`"`)
 
 	return nil
 }
@@ -768,82 +1207,198 @@ func (g *GoFakeS3) copyObject(bucket, object string, meta map[string]string, w h
 		return ResourceError(ErrKeyTooLong, object)
 	}
 
-	// XXX No support for versionId subresource
-	parts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
-	sourceDecoded := false
-	if len(parts) < 2 {
-		// The source may be fully URL-encoded (including "/" as "%2F").
-		// Try decoding and splitting again.
-		decoded, err := url.QueryUnescape(source)
-		if err != nil {
-			return err
-		}
-		parts = strings.SplitN(strings.TrimPrefix(decoded, "/"), "/", 2)
-		sourceDecoded = true
+	src, err := parseCopySource(source)
+	if err != nil {
+		return err
+	}
+	if err := g.authorizeCopySource(r, src); err != nil {
+		return err
 	}
-	if len(parts) < 2 {
-		return ErrorMessage(ErrInvalidArgument, "X-Amz-Copy-Source must contain bucket and key separated by '/'")
+	srcObj, err := g.headCopySource(src)
+	if err != nil {
+		return err
 	}
-	srcBucket := parts[0]
-	srcKey := strings.SplitN(parts[1], "?", 2)[0]
 
-	// Only decode the key if we didn't already decode the entire source,
-	// to avoid double-decoding (which corrupts "+" characters).
-	if !sourceDecoded {
-		srcKey, err = url.QueryUnescape(srcKey)
-		if err != nil {
-			return err
-		}
+	srcSSE, err := parseCustomerKey(r.Header, copySourceSSECustomerHeaderPrefix)
+	if err != nil {
+		return err
+	}
+	if err := checkCustomerKey(srcObj.Metadata, srcSSE); err != nil {
+		return err
+	}
+	if err := g.checkReadable(src.bucket, srcObj); err != nil {
+		return err
 	}
-	srcObj, err := g.storage.HeadObject(srcBucket, srcKey)
+	if err := checkCopySourceConditions(r.Header, srcObj); err != nil {
+		return err
+	}
+	dstSSE, err := parseCustomerKey(r.Header, sseCustomerHeaderPrefix)
+	if err != nil {
+		return err
+	}
+	conditions, err := parsePutConditions(r.Header)
 	if err != nil {
 		return err
 	}
 
-	// XXX No support for delete marker
-	// "If the current version of the object is a delete marker, Amazon S3
-	// behaves as if the object was deleted."
+	directive := meta["X-Amz-Metadata-Directive"]
+	if directive != "" && directive != "COPY" && directive != "REPLACE" {
+		return ErrorInvalidArgument("x-amz-metadata-directive", directive, "Unknown metadata directive.")
+	}
+	if src.bucket == bucket && src.object == object && src.versionID == "" && directive != "REPLACE" && !copyChangesObject(meta, dstSSE) {
+		return ErrorMessage(ErrInvalidRequest, "This copy request is illegal because it is trying to copy an object to itself without changing the object's metadata, storage class, website redirect location or encryption attributes.")
+	}
 
-	// merge metadata, ACL is not preserved
-	for k, v := range srcObj.Metadata {
-		if _, found := meta[k]; !found && k != "X-Amz-Acl" {
-			meta[k] = v
+	enc, err := g.requestEncryption(bucket, meta, dstSSE)
+	if err != nil {
+		return err
+	}
+	if err := g.applyObjectLock(bucket, meta); err != nil {
+		return err
+	}
+
+	// Tags are copied from the source unless they are replaced by the
+	// request's:
+	switch directive := meta["X-Amz-Tagging-Directive"]; directive {
+	case "", "COPY":
+		delete(meta, taggingMetadataKey)
+		if tagging, ok := srcObj.Metadata[taggingMetadataKey]; ok {
+			meta[taggingMetadataKey] = tagging
+		}
+	case "REPLACE":
+	default:
+		return ErrorInvalidArgument("x-amz-tagging-directive", directive, "Unknown tagging directive.")
+	}
+	delete(meta, "X-Amz-Tagging-Directive")
+
+	// User metadata and the headers that describe the contents are copied
+	// from the source unless they are replaced by the request's. The headers
+	// of the copy request itself are not kept:
+	for k := range meta {
+		if (isContentMetadata(k) && directive != "REPLACE") || strings.HasPrefix(k, "X-Amz-Copy-Source") {
+			delete(meta, k)
+		}
+	}
+	delete(meta, "X-Amz-Metadata-Directive")
+
+	// The object keeps the checksum of the source, which still matches its
+	// contents, unless it was made from the parts of the source; the copy is
+	// not a multipart object:
+	for k := range meta {
+		if isChecksumMetadata(k) {
+			delete(meta, k)
 		}
 	}
+	delete(meta, sdkChecksumAlgorithmMetadataKey)
+	_, _, checksumType := objectChecksum(srcObj.Metadata)
+	keepChecksum := checksumType != ChecksumTypeComposite
 
-	result, err := g.storage.CopyObject(srcBucket, srcKey, bucket, object, meta)
+	// merge metadata, ACL, Object Lock and the storage class are not
+	// preserved, and the copy is only encrypted if the request or the
+	// bucket's default encryption asks for it
+	for k, v := range srcObj.Metadata {
+		if _, found := meta[k]; found || isACLHeader(k) || isEncryptionMetadata(k) || isObjectLockMetadata(k) || k == taggingMetadataKey || isPartsMetadata(k) || k == storageClassMetadataKey {
+			continue
+		}
+		if isContentMetadata(k) && directive == "REPLACE" {
+			continue
+		}
+		if isChecksumMetadata(k) && !keepChecksum {
+			continue
+		}
+		meta[k] = v
+	}
+
+	var result CopyObjectResult
+	_, srcEncrypted := srcObj.Metadata[sseNonceMetadataKey]
+	backendCopy := !srcEncrypted && dstSSE == nil && enc.dataKey() == nil && src.versionID == ""
+	switch {
+	case backendCopy && conditions == nil:
+		enc.setMetadata(meta)
+		result, err = g.storage.CopyObject(src.bucket, src.object, bucket, object, meta)
+	case backendCopy && g.conditionalCopies != nil:
+		enc.setMetadata(meta)
+		result, err = g.conditionalCopies.CopyObjectConditional(src.bucket, src.object, bucket, object, meta, conditions)
+	default:
+		result, err = g.copyObjectContents(src, srcSSE, bucket, object, dstSSE, enc, meta, conditions)
+	}
 	if err != nil {
 		return err
 	}
+	dstSSE.writeHeaders(w)
+	enc.writeHeaders(w)
 
 	if srcObj.VersionID != "" {
 		w.Header().Set("x-amz-copy-source-version-id", string(srcObj.VersionID))
 	}
-	if srcObj.VersionID != "" {
-		w.Header().Set("x-amz-version-id", string(srcObj.VersionID))
+	if result.VersionID != "" {
+		w.Header().Set("x-amz-version-id", string(result.VersionID))
 	}
 
 	return g.xmlEncoder(w).Encode(result)
 }
 
-func (g *GoFakeS3) deleteObject(bucket, object string, w http.ResponseWriter, r *http.Request) error {
-	g.log.Print(LogInfo, "DELETE:", bucket, object)
-	if err := g.ensureBucketExists(bucket); err != nil {
-		return err
+// copyObjectContents copies an object by reading it and writing it again. This
+// is needed for objects that are encrypted with SSE-C or SSE-KMS, or that are
+// to be, as the backend only copies the bytes it stores, and for copies of
+// specific versions, as Backend.CopyObject only copies current versions.
+func (g *GoFakeS3) copyObjectContents(from copySource, srcSSE *customerKey, bucket, object string, dstSSE *customerKey, enc *objectEncryption, meta map[string]string, conditions *PutConditions) (result CopyObjectResult, err error) {
+	src, err := g.getCopySource(from, nil)
+	if err != nil {
+		return result, err
 	}
+	defer src.Contents.Close()
 
-	result, err := g.storage.DeleteObject(bucket, object)
-	if err != nil {
-		return err
+	if err := decryptObject(src, srcSSE); err != nil {
+		return result, err
 	}
 
-	if result.IsDeleteMarker {
-		w.Header().Set("x-amz-delete-marker", "true")
-	} else {
-		w.Header().Set("x-amz-delete-marker", "false")
+	var input io.Reader = src.Contents
+	if dataKey, nonce, err := newObjectEncryption(meta, dstSSE, enc); err != nil {
+		return result, err
+	} else if dataKey != nil {
+		input = dataKey.encrypt(input, nonce, 0)
 	}
 
-	if result.VersionID != "" {
+	etag, err := newHashingReader(input, "")
+	if err != nil {
+		return result, err
+	}
+	put, err := g.storage.PutObject(bucket, object, meta, etag, src.Size, conditions)
+	if err != nil {
+		return result, err
+	}
+
+	return CopyObjectResult{
+		ETag:         `"` + hex.EncodeToString(etag.Sum(nil)) + `"`,
+		LastModified: NewContentTime(g.timeSource.Now()),
+		VersionID:    put.VersionID,
+	}, nil
+}
+
+func (g *GoFakeS3) deleteObject(bucket, object string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "DELETE:", bucket, object)
+	if err := g.ensureBucketExists(bucket); err != nil {
+		return err
+	}
+
+	conditions, err := parseDeleteConditions(r.Header)
+	if err != nil {
+		return err
+	}
+
+	result, err := g.deleteObjectConditional(bucket, object, "", conditions)
+	if err != nil {
+		return err
+	}
+
+	if result.IsDeleteMarker {
+		w.Header().Set("x-amz-delete-marker", "true")
+	} else {
+		w.Header().Set("x-amz-delete-marker", "false")
+	}
+
+	if result.VersionID != "" {
 		w.Header().Set("x-amz-version-id", string(result.VersionID))
 	}
 
@@ -861,7 +1416,18 @@ func (g *GoFakeS3) deleteObjectVersion(bucket, object string, version VersionID,
 		return err
 	}
 
-	result, err := g.versioned.DeleteObjectVersion(bucket, object, version)
+	// Versions that don't exist are left for the backend to report:
+	if obj, err := g.versioned.HeadObjectVersion(bucket, object, version); err == nil {
+		if err := g.checkObjectLock(r, bucket, obj); err != nil {
+			return err
+		}
+	}
+	conditions, err := parseDeleteConditions(r.Header)
+	if err != nil {
+		return err
+	}
+
+	result, err := g.deleteObjectConditional(bucket, object, version, conditions)
 	if err != nil {
 		return err
 	}
@@ -881,6 +1447,39 @@ func (g *GoFakeS3) deleteObjectVersion(bucket, object string, version VersionID,
 	return nil
 }
 
+// deleteObjectConditional deletes an object, or a version of it if version is
+// not empty. If conditions is not nil, the backend checks them as it deletes
+// the object; backends that can't return ErrNotImplemented.
+func (g *GoFakeS3) deleteObjectConditional(bucket, object string, version VersionID, conditions *DeleteConditions) (ObjectDeleteResult, error) {
+	switch {
+	case version != "" && g.versioned == nil:
+		return ObjectDeleteResult{}, ErrNotImplemented
+	case version != "" && conditions == nil:
+		return g.versioned.DeleteObjectVersion(bucket, object, version)
+	case version != "" && g.conditionalVersionDeletes == nil:
+		return ObjectDeleteResult{}, ErrNotImplemented
+	case version != "":
+		return g.conditionalVersionDeletes.DeleteObjectVersionConditional(bucket, object, version, conditions)
+	case conditions == nil:
+		return g.storage.DeleteObject(bucket, object)
+	case g.conditionalDeletes == nil:
+		return ObjectDeleteResult{}, ErrNotImplemented
+	default:
+		return g.conditionalDeletes.DeleteObjectConditional(bucket, object, conditions)
+	}
+}
+
+// deletedObjectID returns the entry of a DeleteObjects response for an object
+// that was deleted.
+func deletedObjectID(object string, version VersionID, result ObjectDeleteResult) ObjectID {
+	id := ObjectID{Key: object, VersionID: string(version)}
+	if result.IsDeleteMarker {
+		id.DeleteMarker = true
+		id.DeleteMarkerVersionID = string(result.VersionID)
+	}
+	return id
+}
+
 // deleteMulti deletes multiple S3 objects from the bucket.
 // https://docs.aws.amazon.com/AmazonS3/latest/API/multiobjectdeleteapi.html
 func (g *GoFakeS3) deleteMulti(bucket string, w http.ResponseWriter, r *http.Request) error {
@@ -898,6 +1497,46 @@ func (g *GoFakeS3) deleteMulti(bucket string, w http.ResponseWriter, r *http.Req
 		return ErrorMessage(ErrMalformedXML, err.Error())
 	}
 
+	// Each key is authorised separately; keys the policy denies, versions
+	// that are protected by Object Lock, and objects that don't match their
+	// conditions are reported as errors without being deleted:
+	var denied []ErrorResult
+	var deleted []ObjectID
+	allowed := make([]ObjectID, 0, len(in.Objects))
+	for _, o := range in.Objects {
+		action := "s3:DeleteObject"
+		if o.VersionID != "" {
+			action = "s3:DeleteObjectVersion"
+		}
+		conditions, err := o.deleteConditions()
+		if err == nil {
+			err = g.authorize(r, action, bucket, o.Key)
+		}
+		if err == nil && o.VersionID != "" && g.versioned != nil {
+			if obj, headErr := g.versioned.HeadObjectVersion(bucket, o.Key, VersionID(o.VersionID)); headErr == nil {
+				err = g.checkObjectLock(r, bucket, obj)
+			}
+		}
+		if err == nil && conditions != nil {
+			// The backend checks the conditions as it deletes the object:
+			var result ObjectDeleteResult
+			result, err = g.deleteObjectConditional(bucket, o.Key, VersionID(o.VersionID), conditions)
+			if err == nil {
+				deleted = append(deleted, deletedObjectID(o.Key, VersionID(o.VersionID), result))
+				continue
+			}
+		}
+		if err != nil {
+			result := ErrorResultFromError(err)
+			result.Key = o.Key
+			result.VersionID = o.VersionID
+			denied = append(denied, result)
+			continue
+		}
+		allowed = append(allowed, ObjectID{Key: o.Key, VersionID: o.VersionID})
+	}
+	in.Objects = allowed
+
 	var err error
 	var out MultiDeleteResult
 	if g.versioned == nil {
@@ -914,6 +1553,8 @@ func (g *GoFakeS3) deleteMulti(bucket string, w http.ResponseWriter, r *http.Req
 	if err != nil {
 		return err
 	}
+	out.Deleted = append(out.Deleted, deleted...)
+	out.Error = append(out.Error, denied...)
 
 	if in.Quiet {
 		out.Deleted = nil
@@ -929,14 +1570,57 @@ func (g *GoFakeS3) initiateMultipartUpload(bucket, object string, w http.Respons
 	if err != nil {
 		return err
 	}
+	if err := g.checkObjectACL(bucket, meta); err != nil {
+		return err
+	}
+	if err := normalizeTaggingMetadata(meta); err != nil {
+		return err
+	}
+	if err := validateStorageClass(meta); err != nil {
+		return err
+	}
+	algorithm, checksumType, err := multipartChecksum(meta)
+	if err != nil {
+		return err
+	}
+	key, err := parseCustomerKey(r.Header, sseCustomerHeaderPrefix)
+	if err != nil {
+		return err
+	}
 	if err := g.ensureBucketExists(bucket); err != nil {
 		return err
 	}
+	enc, err := g.requestEncryption(bucket, meta, key)
+	if err != nil {
+		return err
+	}
+	if err := g.applyObjectLock(bucket, meta); err != nil {
+		return err
+	}
+
+	// Parts have to be encrypted by the uploader, which needs to know their
+	// contents to work out their checksums. Other MultipartBackends store
+	// the parts of SSE-KMS uploads as they are:
+	if _, ok := g.uploader.(*uploader); ok {
+		if _, _, err := newObjectEncryption(meta, key, enc); err != nil {
+			return err
+		}
+	} else if key != nil {
+		return ErrNotImplemented
+	} else {
+		enc.setMetadata(meta)
+	}
 
 	uploadID, err := g.uploader.CreateMultipartUpload(bucket, object, meta)
 	if err != nil {
 		return err
 	}
+	if algorithm != "" {
+		w.Header().Set(checksumAlgorithmMetadataKey, string(algorithm))
+		w.Header().Set(checksumTypeMetadataKey, string(checksumType))
+	}
+	key.writeHeaders(w)
+	enc.writeHeaders(w)
 	out := InitiateMultipartUploadResult{
 		UploadID: uploadID,
 		Bucket:   bucket,
@@ -959,6 +1643,9 @@ func (g *GoFakeS3) putMultipartUploadPart(bucket, object string, uploadID Upload
 	if err != nil || partNumber <= 0 || partNumber > MaxUploadPartNumber {
 		return ErrInvalidPart
 	}
+	if _, ok := r.Header["X-Amz-Copy-Source"]; ok {
+		return g.copyMultipartUploadPart(bucket, object, uploadID, int(partNumber), w, r)
+	}
 
 	size, err := strconv.ParseInt(r.Header.Get("Content-Length"), 10, 64)
 	if err != nil || size <= 0 {
@@ -967,6 +1654,16 @@ func (g *GoFakeS3) putMultipartUploadPart(bucket, object string, uploadID Upload
 
 	defer r.Body.Close()
 	var rdr io.Reader = r.Body
+	var chunked *chunkedReader
+
+	if isStreamingPayload(r.Header.Get("X-Amz-Content-Sha256")) {
+		size, err = strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err != nil || size < 0 {
+			return ErrMissingContentLength
+		}
+		chunked = newStreamingReader(r, size)
+		rdr = chunked
+	}
 
 	if g.integrityCheck {
 		md5Base64 := r.Header.Get("Content-MD5")
@@ -983,15 +1680,126 @@ func (g *GoFakeS3) putMultipartUploadPart(bucket, object string, uploadID Upload
 		}
 	}
 
-	etag, err := g.uploader.UploadPart(bucket, object, uploadID, int(partNumber), r.ContentLength, rdr)
+	algorithm, expected, trailing, err := requestChecksum(checksumHeaders(r.Header))
+	if err != nil {
+		return err
+	}
+	var checksum *checksumReader
+	if algorithm != "" {
+		if !g.integrityCheck {
+			expected = ""
+		}
+		if checksum, err = newChecksumReader(rdr, algorithm, expected, nil); err != nil {
+			return err
+		}
+		if trailing && g.integrityCheck {
+			if err := checksum.expectTrailer(chunked); err != nil {
+				return err
+			}
+		}
+		rdr = checksum
+	}
+
+	key, err := parseCustomerKey(r.Header, sseCustomerHeaderPrefix)
+	if err != nil {
+		return err
+	}
+
+	var etag string
+	if u, ok := g.uploader.(*uploader); ok {
+		etag, err = u.uploadPart(bucket, object, uploadID, int(partNumber), size, rdr, key)
+	} else if key != nil {
+		return ErrNotImplemented
+	} else {
+		etag, err = g.uploader.UploadPart(bucket, object, uploadID, int(partNumber), size, rdr)
+	}
 	if err != nil {
 		return err
 	}
+	key.writeHeaders(w)
 
+	if checksum != nil {
+		w.Header().Set(algorithm.header(), checksum.Value())
+	}
 	w.Header().Add("ETag", etag)
 	return nil
 }
 
+// copyMultipartUploadPart uploads a part of a multipart upload from an
+// existing object, or a range of it, for UploadPartCopy requests.
+func (g *GoFakeS3) copyMultipartUploadPart(bucket, object string, uploadID UploadID, partNumber int, w http.ResponseWriter, r *http.Request) error {
+	source := r.Header.Get("X-Amz-Copy-Source")
+	g.log.Print(LogInfo, "COPY PART:", source, "TO", bucket, object, uploadID, partNumber)
+
+	src, err := parseCopySource(source)
+	if err != nil {
+		return err
+	}
+	if err := g.authorizeCopySource(r, src); err != nil {
+		return err
+	}
+	srcObj, err := g.headCopySource(src)
+	if err != nil {
+		return err
+	}
+
+	srcSSE, err := parseCustomerKey(r.Header, copySourceSSECustomerHeaderPrefix)
+	if err != nil {
+		return err
+	}
+	if err := checkCustomerKey(srcObj.Metadata, srcSSE); err != nil {
+		return err
+	}
+	if err := g.checkReadable(src.bucket, srcObj); err != nil {
+		return err
+	}
+	if err := checkCopySourceConditions(r.Header, srcObj); err != nil {
+		return err
+	}
+	rnge, err := parseCopySourceRange(r.Header.Get("X-Amz-Copy-Source-Range"), srcObj.Size)
+	if err != nil {
+		return err
+	}
+	dstSSE, err := parseCustomerKey(r.Header, sseCustomerHeaderPrefix)
+	if err != nil {
+		return err
+	}
+
+	srcContents, err := g.getCopySource(src, rnge)
+	if err != nil {
+		return err
+	}
+	defer srcContents.Contents.Close()
+	if err := decryptObject(srcContents, srcSSE); err != nil {
+		return err
+	}
+	size := srcContents.Size
+	if srcContents.Range != nil {
+		size = srcContents.Range.Length
+	}
+
+	var etag string
+	if u, ok := g.uploader.(*uploader); ok {
+		etag, err = u.uploadPart(bucket, object, uploadID, partNumber, size, srcContents.Contents, dstSSE)
+	} else if dstSSE != nil {
+		return ErrNotImplemented
+	} else {
+		etag, err = g.uploader.UploadPart(bucket, object, uploadID, partNumber, size, srcContents.Contents)
+	}
+	if err != nil {
+		return err
+	}
+	dstSSE.writeHeaders(w)
+
+	if srcObj.VersionID != "" {
+		w.Header().Set("x-amz-copy-source-version-id", string(srcObj.VersionID))
+	}
+	return g.xmlEncoder(w).Encode(CopyPartResult{
+		ETag:         etag,
+		LastModified: NewContentTime(g.timeSource.Now()),
+	})
+}
+
 func (g *GoFakeS3) abortMultipartUpload(bucket, object string, uploadID UploadID, w http.ResponseWriter, r *http.Request) error {
 	g.log.Print(LogInfo, "abort multipart upload", bucket, object, uploadID)
 	if err := g.uploader.AbortMultipartUpload(bucket, object, uploadID); err != nil {
@@ -1009,7 +1817,26 @@ func (g *GoFakeS3) completeMultipartUpload(bucket, object string, uploadID Uploa
 		return err
 	}
 
-	versionID, etag, err := g.uploader.CompleteMultipartUpload(bucket, object, uploadID, &in)
+	key, err := parseCustomerKey(r.Header, sseCustomerHeaderPrefix)
+	if err != nil {
+		return err
+	}
+	conditions, err := parsePutConditions(r.Header)
+	if err != nil {
+		return err
+	}
+
+	var versionID VersionID
+	var etag string
+	if u, ok := g.uploader.(*uploader); ok {
+		versionID, etag, err = u.completeMultipartUpload(bucket, object, uploadID, &in, key, conditions)
+	} else if conditions == nil {
+		versionID, etag, err = g.uploader.CompleteMultipartUpload(bucket, object, uploadID, &in)
+	} else if cu, ok := g.uploader.(ConditionalMultipartBackend); ok {
+		versionID, etag, err = cu.CompleteMultipartUploadConditional(bucket, object, uploadID, &in, conditions)
+	} else {
+		return ErrNotImplemented
+	}
 	if err != nil {
 		return err
 	}
@@ -1018,24 +1845,38 @@ func (g *GoFakeS3) completeMultipartUpload(bucket, object string, uploadID Uploa
 		w.Header().Set("x-amz-version-id", string(versionID))
 	}
 
+	out := &CompleteMultipartUploadResult{
+		ETag:     etag,
+		Bucket:   bucket,
+		Key:      object,
+		Location: g.objectLocation(bucket, object, r),
+	}
+
+	// The checksum and encryption of the object are worked out by the
+	// MultipartBackend, so they have to be read back from the object:
+	if obj, err := g.headObjectOrVersion(bucket, object, versionID); err == nil {
+		if algorithm, value, typ := objectChecksum(obj.Metadata); algorithm != "" {
+			out.Set(algorithm, value)
+			out.ChecksumType = typ
+		}
+		storedEncryption(obj.Metadata).writeHeaders(w)
+	}
+
+	return g.xmlEncoder(w).Encode(out)
+}
+
+// objectLocation returns the URL of an object, for responses that include a
+// Location.
+func (g *GoFakeS3) objectLocation(bucket, object string, r *http.Request) string {
 	protocol := "http"
 	if r.TLS != nil {
 		protocol = "https"
 	}
 
-	var location string
 	if g.hostBucket {
-		location = fmt.Sprintf("%s://%s/%s", protocol, r.Host, object)
-	} else {
-		location = fmt.Sprintf("%s://%s/%s/%s", protocol, r.Host, bucket, object)
+		return fmt.Sprintf("%s://%s/%s", protocol, r.Host, object)
 	}
-
-	return g.xmlEncoder(w).Encode(&CompleteMultipartUploadResult{
-		ETag:     etag,
-		Bucket:   bucket,
-		Key:      object,
-		Location: location,
-	})
+	return fmt.Sprintf("%s://%s/%s/%s", protocol, r.Host, bucket, object)
 }
 
 func (g *GoFakeS3) listMultipartUploads(bucket string, w http.ResponseWriter, r *http.Request) error {
@@ -1128,88 +1969,776 @@ func (g *GoFakeS3) putBucketVersioning(bucket string, w http.ResponseWriter, r *
 		}
 	}
 
+	if in.Status == VersioningSuspended {
+		if config, err := g.bucketObjectLock(bucket); err != nil {
+			return err
+		} else if config != nil {
+			return ErrorMessage(ErrInvalidBucketState, "An Object Lock configuration is present on this bucket, so the versioning state cannot be changed.")
+		}
+	}
+
 	g.log.Print(LogInfo, "PUT VERSIONING:", in.Status)
 	return g.versioned.SetVersioningConfiguration(bucket, in)
 }
 
-func (g *GoFakeS3) ensureBucketExists(bucket string) error {
-	exists, err := g.storage.BucketExists(bucket)
+func (g *GoFakeS3) getBucketPolicy(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET POLICY:", bucket)
+
+	policy, err := g.policies.BucketPolicy(bucket)
 	if err != nil {
 		return err
 	}
-	if !exists && g.autoBucket {
-		if err := g.storage.CreateBucket(bucket); err != nil {
-			g.log.Print(LogErr, "autobucket create failed:", err)
-			return ResourceError(ErrNoSuchBucket, bucket)
-		}
-	} else if !exists {
-		return ResourceError(ErrNoSuchBucket, bucket)
-	}
-	return nil
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(policy)))
+	_, err = w.Write(policy)
+	return err
 }
 
-func (g *GoFakeS3) xmlEncoder(w http.ResponseWriter) *xml.Encoder {
-	w.Write([]byte(xml.Header))
-	w.Header().Set("Content-Type", "application/xml")
+func (g *GoFakeS3) putBucketPolicy(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT POLICY:", bucket)
 
-	xe := xml.NewEncoder(w)
-	xe.Indent("", "  ")
-	return xe
-}
+	if err := g.ensureBucketExists(bucket); err != nil {
+		return err
+	}
 
-func (g *GoFakeS3) xmlDecodeBody(rdr io.ReadCloser, into interface{}) error {
-	body, err := ioutil.ReadAll(rdr)
-	defer rdr.Close()
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, bucketPolicySizeLimit+1))
 	if err != nil {
 		return err
 	}
+	if len(body) > bucketPolicySizeLimit {
+		return ErrorMessage(ErrMalformedPolicy, "Policy exceeds the maximum allowed document size.")
+	}
 
-	if err := xml.Unmarshal(body, into); err != nil {
-		return ErrorMessage(ErrMalformedXML, err.Error())
+	if _, err := parseBucketPolicy(bucket, body); err != nil {
+		return err
+	}
+	if err := g.policies.PutBucketPolicy(bucket, body); err != nil {
+		return err
 	}
 
+	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
 
-func formatHeaderTime(t time.Time) string {
-	// .Format("Mon, 2 Jan 2006 15:04:05 MST")
+func (g *GoFakeS3) deleteBucketPolicy(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "DELETE POLICY:", bucket)
 
-	tc := t.In(time.UTC)
-	return tc.Format("Mon, 02 Jan 2006 15:04:05") + " GMT"
+	if err := g.policies.DeleteBucketPolicy(bucket); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
 }
 
-func metadataSize(meta map[string]string) int {
-	total := 0
-	for k, v := range meta {
-		total += len(k) + len(v)
+func (g *GoFakeS3) getBucketEncryption(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET BUCKET ENCRYPTION:", bucket)
+
+	config, err := g.encryption.BucketEncryption(bucket)
+	if err != nil {
+		return err
 	}
-	return total
+
+	out := *config
+	out.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+	return g.xmlEncoder(w).Encode(&out)
 }
 
-func metadataHeaders(headers map[string][]string, at time.Time, sizeLimit int) (map[string]string, error) {
-	meta := make(map[string]string)
-	for hk, hv := range headers {
-		if strings.HasPrefix(hk, "X-Amz-") ||
-			hk == "Content-Type" ||
-			hk == "Content-Disposition" ||
-			hk == "Content-Encoding" {
-			meta[hk] = hv[0]
-		}
-	}
-	meta["Last-Modified"] = formatHeaderTime(at)
+func (g *GoFakeS3) putBucketEncryption(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT BUCKET ENCRYPTION:", bucket)
 
-	if sizeLimit > 0 && metadataSize(meta) > sizeLimit {
-		return meta, ErrMetadataTooLarge
+	if err := g.ensureBucketExists(bucket); err != nil {
+		return err
 	}
 
-	return meta, nil
+	var in ServerSideEncryptionConfiguration
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if err := g.validateEncryptionConfiguration(&in); err != nil {
+		return err
+	}
+	return g.encryption.PutBucketEncryption(bucket, &in)
 }
 
-func listBucketPageFromQuery(query url.Values) (page ListBucketPage, rerr error) {
-	maxKeys, err := parseClampedInt(query.Get("max-keys"), DefaultMaxBucketKeys, 0, MaxBucketKeys)
-	if err != nil {
-		return page, err
-	}
+func (g *GoFakeS3) deleteBucketEncryption(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "DELETE BUCKET ENCRYPTION:", bucket)
+
+	if err := g.encryption.DeleteBucketEncryption(bucket); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (g *GoFakeS3) getBucketLifecycle(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET BUCKET LIFECYCLE:", bucket)
+
+	config, err := g.lifecycles.BucketLifecycle(bucket)
+	if err != nil {
+		return err
+	}
+
+	out := *config
+	out.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+	return g.xmlEncoder(w).Encode(&out)
+}
+
+func (g *GoFakeS3) putBucketLifecycle(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT BUCKET LIFECYCLE:", bucket)
+
+	if err := g.ensureBucketExists(bucket); err != nil {
+		return err
+	}
+
+	var in LifecycleConfiguration
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if err := validateLifecycleConfiguration(&in); err != nil {
+		return err
+	}
+	return g.lifecycles.PutBucketLifecycle(bucket, &in)
+}
+
+func (g *GoFakeS3) deleteBucketLifecycle(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "DELETE BUCKET LIFECYCLE:", bucket)
+
+	if err := g.lifecycles.DeleteBucketLifecycle(bucket); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (g *GoFakeS3) getBucketACL(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET BUCKET ACL:", bucket)
+
+	acl, err := g.bucketACL(bucket)
+	if err != nil {
+		return err
+	}
+	return g.xmlEncoder(w).Encode(aclResponse(acl))
+}
+
+func (g *GoFakeS3) putBucketACL(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT BUCKET ACL:", bucket)
+
+	if err := g.ensureBucketExists(bucket); err != nil {
+		return err
+	}
+	if g.acls == nil {
+		return ErrNotImplemented
+	}
+
+	acl, err := g.aclFromRequest(bucket, r)
+	if err != nil {
+		return err
+	}
+	return g.acls.PutBucketACL(bucket, acl)
+}
+
+func (g *GoFakeS3) getObjectACL(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET OBJECT ACL:", bucket, object, versionID)
+
+	if err := g.ensureBucketExists(bucket); err != nil {
+		return err
+	}
+
+	acl, err := g.objectACL(bucket, object, versionID)
+	if err != nil {
+		return err
+	}
+	if versionID != "" {
+		w.Header().Set("x-amz-version-id", string(versionID))
+	}
+	return g.xmlEncoder(w).Encode(aclResponse(acl))
+}
+
+func (g *GoFakeS3) putObjectACL(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT OBJECT ACL:", bucket, object, versionID)
+
+	if err := g.ensureBucketExists(bucket); err != nil {
+		return err
+	}
+	if g.acls == nil {
+		return ErrNotImplemented
+	}
+
+	acl, err := g.aclFromRequest(bucket, r)
+	if err != nil {
+		return err
+	}
+	if err := g.acls.PutObjectACL(bucket, object, versionID, acl); err != nil {
+		return err
+	}
+	if versionID != "" {
+		w.Header().Set("x-amz-version-id", string(versionID))
+	}
+	return nil
+}
+
+// aclFromRequest reads the ACL sent to the '?acl' subresource, which may be
+// sent in the x-amz-acl or x-amz-grant-* headers, or as an
+// AccessControlPolicy in the body. The ACL is always owned by the owner of the
+// bucket.
+func (g *GoFakeS3) aclFromRequest(bucket string, r *http.Request) (*AccessControlPolicy, error) {
+	owner, err := g.bucketOwner(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	acl, err := aclFromHeaders(r.Header.Get, owner, owner)
+	if err != nil || acl != nil {
+		return acl, err
+	}
+
+	var in AccessControlPolicy
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return nil, ErrorMessage(ErrMalformedACLError, ErrMalformedACLError.Message())
+	}
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+	if in.Owner != nil && in.Owner.ID != owner.ID {
+		return nil, ErrorMessage(ErrAccessDenied, ErrAccessDenied.Message())
+	}
+	return &AccessControlPolicy{Owner: &owner, Grants: in.Grants}, nil
+}
+
+// aclResponse copies an ACL for encoding, as it may be shared with the
+// Backend.
+func aclResponse(acl *AccessControlPolicy) *AccessControlPolicy {
+	out := *acl
+	out.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+	return &out
+}
+
+func (g *GoFakeS3) getBucketTagging(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET BUCKET TAGGING:", bucket)
+
+	if g.bucketTagging == nil {
+		return ErrNotImplemented
+	}
+	tags, err := g.bucketTagging.BucketTagging(bucket)
+	if err != nil {
+		return err
+	}
+	return g.xmlEncoder(w).Encode(Tagging{
+		Xmlns:  "http://s3.amazonaws.com/doc/2006-03-01/",
+		TagSet: tags,
+	})
+}
+
+func (g *GoFakeS3) putBucketTagging(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT BUCKET TAGGING:", bucket)
+
+	if g.bucketTagging == nil {
+		return ErrNotImplemented
+	}
+
+	var in Tagging
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if len(in.TagSet) > bucketTagLimit {
+		return ErrorMessagef(ErrInvalidTag, "Bucket tag count cannot be greater than %d", bucketTagLimit)
+	}
+	if err := validateTags(in.TagSet); err != nil {
+		return err
+	}
+
+	var err error
+	if len(in.TagSet) == 0 {
+		err = g.bucketTagging.DeleteBucketTagging(bucket)
+	} else {
+		err = g.bucketTagging.PutBucketTagging(bucket, in.TagSet)
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (g *GoFakeS3) deleteBucketTagging(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "DELETE BUCKET TAGGING:", bucket)
+
+	if g.bucketTagging == nil {
+		return ErrNotImplemented
+	}
+	if err := g.bucketTagging.DeleteBucketTagging(bucket); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (g *GoFakeS3) getObjectTagging(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET OBJECT TAGGING:", bucket, object, versionID)
+
+	if err := g.ensureBucketExists(bucket); err != nil {
+		return err
+	}
+
+	obj, err := g.headObjectOrVersion(bucket, object, versionID)
+	if err != nil {
+		return err
+	}
+	tags, err := tagsFromMetadata(obj.Metadata)
+	if err != nil {
+		return err
+	}
+
+	if obj.VersionID != "" {
+		w.Header().Set("x-amz-version-id", string(obj.VersionID))
+	}
+	return g.xmlEncoder(w).Encode(Tagging{
+		Xmlns:  "http://s3.amazonaws.com/doc/2006-03-01/",
+		TagSet: tags,
+	})
+}
+
+func (g *GoFakeS3) putObjectTagging(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT OBJECT TAGGING:", bucket, object, versionID)
+
+	var in Tagging
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if err := validateObjectTags(in.TagSet); err != nil {
+		return err
+	}
+	return g.setObjectTagging(bucket, object, versionID, encodeTaggingHeader(in.TagSet), w)
+}
+
+func (g *GoFakeS3) deleteObjectTagging(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "DELETE OBJECT TAGGING:", bucket, object, versionID)
+
+	if err := g.setObjectTagging(bucket, object, versionID, "", w); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (g *GoFakeS3) setObjectTagging(bucket, object string, versionID VersionID, tagging string, w http.ResponseWriter) error {
+	if err := g.ensureBucketExists(bucket); err != nil {
+		return err
+	}
+	if g.tagging == nil {
+		return ErrNotImplemented
+	}
+
+	obj, err := g.headObjectOrVersion(bucket, object, versionID)
+	if err != nil {
+		return err
+	}
+	if err := g.tagging.PutObjectTagging(bucket, object, versionID, tagging); err != nil {
+		return err
+	}
+
+	if obj.VersionID != "" {
+		w.Header().Set("x-amz-version-id", string(obj.VersionID))
+	}
+	return nil
+}
+
+func (g *GoFakeS3) getObjectLockConfiguration(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET OBJECT LOCK CONFIGURATION:", bucket)
+
+	config, err := g.objectLocks.ObjectLockConfiguration(bucket)
+	if err != nil {
+		return err
+	}
+
+	out := *config
+	out.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+	return g.xmlEncoder(w).Encode(&out)
+}
+
+func (g *GoFakeS3) putObjectLockConfiguration(bucket string, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT OBJECT LOCK CONFIGURATION:", bucket)
+
+	if err := g.ensureBucketExists(bucket); err != nil {
+		return err
+	}
+
+	var in ObjectLockConfiguration
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if err := validateObjectLockConfiguration(&in); err != nil {
+		return err
+	}
+
+	if g.versioned == nil {
+		return ErrNotImplemented
+	}
+	versioning, err := g.versioned.VersioningConfiguration(bucket)
+	if err != nil {
+		return err
+	} else if !versioning.Enabled() {
+		return ErrorMessage(ErrInvalidBucketState, "Versioning must be 'Enabled' on the bucket to apply a Object Lock configuration")
+	}
+
+	return g.objectLocks.PutObjectLockConfiguration(bucket, &in)
+}
+
+func (g *GoFakeS3) getObjectRetention(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET OBJECT RETENTION:", bucket, object, versionID)
+
+	obj, err := g.objectLockTarget(bucket, object, versionID)
+	if err != nil {
+		return err
+	}
+	retention := objectRetention(obj.Metadata)
+	if retention.Mode == "" {
+		return ErrorMessage(ErrNoSuchObjectLockConfiguration, ErrNoSuchObjectLockConfiguration.Message())
+	}
+
+	retention.Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+	return g.xmlEncoder(w).Encode(&retention)
+}
+
+func (g *GoFakeS3) putObjectRetention(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT OBJECT RETENTION:", bucket, object, versionID)
+
+	var in ObjectLockRetention
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if err := validateRetention(in, g.timeSource.Now()); err != nil {
+		return err
+	}
+
+	obj, err := g.objectLockTarget(bucket, object, versionID)
+	if err != nil {
+		return err
+	}
+	if err := g.checkRetentionChange(r, bucket, obj, in); err != nil {
+		return err
+	}
+	return g.setObjectLock(bucket, obj, in.metadata(), w)
+}
+
+func (g *GoFakeS3) getObjectLegalHold(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET OBJECT LEGAL HOLD:", bucket, object, versionID)
+
+	obj, err := g.objectLockTarget(bucket, object, versionID)
+	if err != nil {
+		return err
+	}
+	status, ok := obj.Metadata[objectLockLegalHoldMetadataKey]
+	if !ok {
+		return ErrorMessage(ErrNoSuchObjectLockConfiguration, ErrNoSuchObjectLockConfiguration.Message())
+	}
+
+	return g.xmlEncoder(w).Encode(&ObjectLockLegalHold{
+		Xmlns:  "http://s3.amazonaws.com/doc/2006-03-01/",
+		Status: ObjectLockLegalHoldStatus(status),
+	})
+}
+
+func (g *GoFakeS3) putObjectLegalHold(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "PUT OBJECT LEGAL HOLD:", bucket, object, versionID)
+
+	var in ObjectLockLegalHold
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if !in.Status.valid() {
+		return ErrorMessage(ErrMalformedXML, ErrMalformedXML.Message())
+	}
+
+	obj, err := g.objectLockTarget(bucket, object, versionID)
+	if err != nil {
+		return err
+	}
+	return g.setObjectLock(bucket, obj, map[string]string{objectLockLegalHoldMetadataKey: string(in.Status)}, w)
+}
+
+// objectLockTarget returns the object version whose retention or legal hold a
+// request reads or changes, which must be in a bucket with Object Lock
+// enabled.
+func (g *GoFakeS3) objectLockTarget(bucket, object string, versionID VersionID) (*Object, error) {
+	if err := g.ensureBucketExists(bucket); err != nil {
+		return nil, err
+	}
+	if config, err := g.bucketObjectLock(bucket); err != nil {
+		return nil, err
+	} else if config == nil {
+		return nil, ErrorMessage(ErrInvalidRequest, "Bucket is missing Object Lock Configuration")
+	}
+	return g.headObjectOrVersion(bucket, object, versionID)
+}
+
+func (g *GoFakeS3) setObjectLock(bucket string, obj *Object, lock map[string]string, w http.ResponseWriter) error {
+	if g.metadata == nil {
+		return ErrNotImplemented
+	}
+	if err := g.metadata.PutObjectMetadata(bucket, obj.Name, obj.VersionID, lock); err != nil {
+		return err
+	}
+	if obj.VersionID != "" {
+		w.Header().Set("x-amz-version-id", string(obj.VersionID))
+	}
+	return nil
+}
+
+// restoreObject makes an archived object readable for the number of days in
+// the request, once the delay set with WithRestoreDelay has passed. Restoring
+// an object that has already been restored only changes when the restore
+// expires.
+func (g *GoFakeS3) restoreObject(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "RESTORE OBJECT:", bucket, object, versionID)
+
+	if err := g.ensureBucketExists(bucket); err != nil {
+		return err
+	}
+
+	var in RestoreRequest
+	if err := g.xmlDecodeBody(r.Body, &in); err != nil {
+		return err
+	}
+	if in.Days < 1 {
+		return ErrorMessage(ErrMalformedXML, ErrMalformedXML.Message())
+	}
+
+	obj, err := g.headObjectOrVersion(bucket, object, versionID)
+	if err != nil {
+		return err
+	}
+	obj.Contents.Close()
+	if !StorageClassFromMetadata(obj.Metadata).archived() {
+		return ErrorMessage(ErrInvalidObjectState, "Restore is not allowed for the object's current storage class")
+	}
+
+	now := g.timeSource.Now()
+	if obj.VersionID != "" {
+		w.Header().Set("x-amz-version-id", string(obj.VersionID))
+	}
+
+	if or := g.restores.restore(bucket, obj, now); or != nil {
+		if or.ongoing(now) {
+			return ErrRestoreAlreadyInProgress
+		}
+		g.restores.set(bucket, obj, &objectRestore{readyAt: or.readyAt, expiresAt: now.AddDate(0, 0, in.Days)})
+		return nil
+	}
+
+	readyAt := now.Add(g.restoreDelay)
+	g.restores.set(bucket, obj, &objectRestore{readyAt: readyAt, expiresAt: readyAt.AddDate(0, 0, in.Days)})
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+func (g *GoFakeS3) getObjectAttributes(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	g.log.Print(LogInfo, "GET OBJECT ATTRIBUTES:", bucket, object, versionID)
+
+	// The SDKs send each attribute in a header of its own:
+	attrs, err := parseObjectAttributes(strings.Join(r.Header.Values("x-amz-object-attributes"), ","))
+	if err != nil {
+		return err
+	}
+	maxParts, err := parseClampedInt(r.Header.Get("x-amz-max-parts"), DefaultMaxUploadParts, 0, MaxUploadPartsLimit)
+	if err != nil {
+		return ErrorInvalidArgument("x-amz-max-parts", r.Header.Get("x-amz-max-parts"), "Argument max-parts must be an integer between 0 and 2147483647")
+	}
+	marker, err := parseClampedInt(r.Header.Get("x-amz-part-number-marker"), 0, 0, MaxUploadPartNumber)
+	if err != nil {
+		return ErrorInvalidArgument("x-amz-part-number-marker", r.Header.Get("x-amz-part-number-marker"), "Argument part-number-marker must be an integer between 0 and 2147483647")
+	}
+	key, err := parseCustomerKey(r.Header, sseCustomerHeaderPrefix)
+	if err != nil {
+		return err
+	}
+
+	if err := g.ensureBucketExists(bucket); err != nil {
+		return err
+	}
+	obj, err := g.headObjectOrVersion(bucket, object, versionID)
+	if err != nil {
+		return err
+	}
+	if err := checkCustomerKey(obj.Metadata, key); err != nil {
+		return err
+	}
+
+	out := GetObjectAttributesResponse{Xmlns: "http://s3.amazonaws.com/doc/2006-03-01/"}
+	if attrs[ObjectAttributeETag] {
+		out.ETag = strings.Trim(ObjectETag(obj.Hash, obj.Metadata), `"`)
+	}
+	if attrs[ObjectAttributeChecksum] {
+		if algorithm, value, typ := objectChecksum(obj.Metadata); algorithm != "" {
+			out.Checksum = &ObjectAttributesChecksum{ChecksumType: typ}
+			out.Checksum.Set(algorithm, value)
+		}
+	}
+	if attrs[ObjectAttributeObjectParts] {
+		parts, err := objectParts(obj.Metadata)
+		if err != nil {
+			return err
+		}
+		if parts != nil {
+			algorithm, _, _ := objectChecksum(obj.Metadata)
+			out.ObjectParts = &GetObjectAttributesParts{
+				PartsCount:       len(parts),
+				PartNumberMarker: int(marker),
+				MaxParts:         int(maxParts),
+			}
+			for _, part := range parts {
+				if part.Number <= int(marker) {
+					continue
+				}
+				if len(out.ObjectParts.Parts) >= int(maxParts) {
+					out.ObjectParts.IsTruncated = true
+					break
+				}
+				item := ObjectAttributesPart{PartNumber: part.Number, Size: part.Size}
+				item.Set(algorithm, part.Checksum)
+				out.ObjectParts.Parts = append(out.ObjectParts.Parts, item)
+				out.ObjectParts.NextPartNumberMarker = part.Number
+			}
+		}
+	}
+	if attrs[ObjectAttributeStorageClass] {
+		out.StorageClass = StorageClassFromMetadata(obj.Metadata)
+	}
+	if attrs[ObjectAttributeObjectSize] {
+		out.ObjectSize = &obj.Size
+	}
+
+	if obj.VersionID != "" {
+		w.Header().Set("x-amz-version-id", string(obj.VersionID))
+	}
+	if lastModified, ok := obj.Metadata["Last-Modified"]; ok {
+		w.Header().Set("Last-Modified", lastModified)
+	}
+	return g.xmlEncoder(w).Encode(out)
+}
+
+// headObjectOrVersion returns the object without its contents, or the version
+// of it if versionID is not empty. Delete markers are reported as missing
+// objects.
+func (g *GoFakeS3) headObjectOrVersion(bucket, object string, versionID VersionID) (*Object, error) {
+	var obj *Object
+	var err error
+	if versionID != "" {
+		if g.versioned == nil {
+			return nil, ErrNotImplemented
+		}
+		obj, err = g.versioned.HeadObjectVersion(bucket, object, versionID)
+	} else {
+		obj, err = g.storage.HeadObject(bucket, object)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if obj.IsDeleteMarker {
+		return nil, KeyNotFound(object)
+	}
+	return obj, nil
+}
+
+func (g *GoFakeS3) ensureBucketExists(bucket string) error {
+	exists, err := g.storage.BucketExists(bucket)
+	if err != nil {
+		return err
+	}
+	if !exists && g.autoBucket {
+		if err := g.storage.CreateBucket(bucket); err != nil {
+			g.log.Print(LogErr, "autobucket create failed:", err)
+			return ResourceError(ErrNoSuchBucket, bucket)
+		}
+	} else if !exists {
+		return ResourceError(ErrNoSuchBucket, bucket)
+	}
+	return nil
+}
+
+func (g *GoFakeS3) xmlEncoder(w http.ResponseWriter) *xml.Encoder {
+	w.Write([]byte(xml.Header))
+	w.Header().Set("Content-Type", "application/xml")
+
+	xe := xml.NewEncoder(w)
+	xe.Indent("", "  ")
+	return xe
+}
+
+func (g *GoFakeS3) xmlDecodeBody(rdr io.ReadCloser, into interface{}) error {
+	body, err := ioutil.ReadAll(rdr)
+	defer rdr.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := xml.Unmarshal(body, into); err != nil {
+		return ErrorMessage(ErrMalformedXML, err.Error())
+	}
+
+	return nil
+}
+
+func formatHeaderTime(t time.Time) string {
+	// .Format("Mon, 2 Jan 2006 15:04:05 MST")
+
+	tc := t.In(time.UTC)
+	return tc.Format("Mon, 02 Jan 2006 15:04:05") + " GMT"
+}
+
+func metadataSize(meta map[string]string) int {
+	total := 0
+	for k, v := range meta {
+		total += len(k) + len(v)
+	}
+	return total
+}
+
+func metadataHeaders(headers map[string][]string, at time.Time, sizeLimit int) (map[string]string, error) {
+	meta := make(map[string]string)
+	for hk, hv := range headers {
+		if strings.HasPrefix(hk, "X-Amz-") ||
+			hk == "Content-Type" ||
+			hk == "Content-Disposition" ||
+			hk == "Content-Encoding" ||
+			hk == "Content-Language" ||
+			hk == "Cache-Control" ||
+			hk == "Expires" {
+			meta[hk] = hv[0]
+		}
+	}
+	meta["Last-Modified"] = formatHeaderTime(at)
+
+	// Only multipart uploads may set the parts of an object:
+	delete(meta, partsMetadataKey)
+
+	// SSE-C keys must never be stored; the metadata that records how an
+	// object is encrypted is added once the key has been checked:
+	for hk := range meta {
+		if isCustomerKeyMetadata(hk) {
+			delete(meta, hk)
+		}
+	}
+	delete(meta, sseNonceMetadataKey)
+	delete(meta, restoreHeader)
+
+	if sizeLimit > 0 && metadataSize(meta) > sizeLimit {
+		return meta, ErrMetadataTooLarge
+	}
+
+	return meta, nil
+}
+
+func listBucketPageFromQuery(query url.Values) (page ListBucketPage, rerr error) {
+	maxKeys, err := parseClampedInt(query.Get("max-keys"), DefaultMaxBucketKeys, 0, MaxBucketKeys)
+	if err != nil {
+		return page, err
+	}
 
 	page.MaxKeys = maxKeys
 
@@ -1253,6 +2782,46 @@ func listBucketVersionsPageFromQuery(query url.Values) (page ListBucketVersionsP
 	return page, nil
 }
 
+// parseDeleteConditions extracts the conditional headers of a DeleteObject
+// request, or returns nil if none are present.
+func parseDeleteConditions(headers http.Header) (*DeleteConditions, error) {
+	var conditions DeleteConditions
+
+	if ifMatch := headers.Get("If-Match"); ifMatch != "" {
+		conditions.IfMatch = &ifMatch
+	}
+
+	if value := headers.Get("x-amz-if-match-last-modified-time"); value != "" {
+		lastModified, err := parseConditionTime(value)
+		if err != nil {
+			return nil, ErrorInvalidArgument("x-amz-if-match-last-modified-time", value, "Invalid date format.")
+		}
+		conditions.IfMatchLastModifiedTime = &lastModified
+	}
+
+	if value := headers.Get("x-amz-if-match-size"); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < 0 {
+			return nil, ErrorInvalidArgument("x-amz-if-match-size", value, "Invalid size.")
+		}
+		conditions.IfMatchSize = &size
+	}
+
+	if conditions == (DeleteConditions{}) {
+		return nil, nil
+	}
+	return &conditions, nil
+}
+
+// parseConditionTime parses the last modified time of a conditional delete,
+// which the AWS SDKs send as an HTTP date, or may be an ISO 8601 timestamp.
+func parseConditionTime(value string) (time.Time, error) {
+	if at, err := http.ParseTime(value); err == nil {
+		return at, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
 // parsePutConditions extracts conditional headers from HTTP request headers
 // and returns a PutConditions struct, or nil if no conditional headers are present.
 func parsePutConditions(headers http.Header) (*PutConditions, error) {
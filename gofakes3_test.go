@@ -422,16 +422,122 @@ func TestCopyObject(t *testing.T) {
 		t.Fatal("object copying failed")
 	}
 
-	if v := obj.Metadata["X-Amz-Meta-One"]; v != "src" {
+	// The metadata of the request is ignored unless it replaces the source's:
+	if v := obj.Metadata["Content-Type"]; v != "text/plain" {
 		t.Fatalf("bad Content-Type: %q", v)
 	}
 
-	if v := obj.Metadata["X-Amz-Meta-Two"]; v != "dst" {
-		t.Fatalf("bad Content-Encoding: %q", v)
+	if v := obj.Metadata["X-Amz-Meta-One"]; v != "src" {
+		t.Fatalf("bad X-Amz-Meta-One: %q", v)
+	}
+
+	if v := obj.Metadata["X-Amz-Meta-Two"]; v != "src" {
+		t.Fatalf("bad X-Amz-Meta-Two: %q", v)
+	}
+
+	if v, ok := obj.Metadata["X-Amz-Meta-Three"]; ok {
+		t.Fatalf("bad X-Amz-Meta-Three: %q", v)
+	}
+}
+
+func TestCopyObjectMetadataDirective(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.PutObject(t.Context(), &s3.PutObjectInput{
+		Bucket:       aws.String(defaultBucket),
+		Key:          aws.String("object"),
+		Body:         strings.NewReader("content"),
+		ContentType:  aws.String("text/plain"),
+		CacheControl: aws.String("no-cache"),
+		Metadata:     map[string]string{"One": "src", "Two": "src"},
+	})
+	ts.OK(err)
+
+	// Copying an object onto itself must change something:
+	_, err = svc.CopyObject(t.Context(), &s3.CopyObjectInput{
+		Bucket:     aws.String(defaultBucket),
+		Key:        aws.String("object"),
+		CopySource: aws.String(defaultBucket + "/object"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+		t.Fatal("expected InvalidRequest, found", err)
+	}
+
+	_, err = svc.CopyObject(t.Context(), &s3.CopyObjectInput{
+		Bucket:            aws.String(defaultBucket),
+		Key:               aws.String("object"),
+		CopySource:        aws.String(defaultBucket + "/object"),
+		MetadataDirective: s3types.MetadataDirectiveReplace,
+		ContentType:       aws.String("application/json"),
+		Metadata:          map[string]string{"Two": "dst"},
+	})
+	ts.OK(err)
+
+	head, err := svc.HeadObject(t.Context(), &s3.HeadObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+	if aws.ToString(head.ContentType) != "application/json" || head.CacheControl != nil {
+		t.Fatal("unexpected headers", aws.ToString(head.ContentType), aws.ToString(head.CacheControl))
+	}
+	if len(head.Metadata) != 1 || head.Metadata["two"] != "dst" {
+		t.Fatal("unexpected metadata", head.Metadata)
+	}
+
+	_, err = svc.CopyObject(t.Context(), &s3.CopyObjectInput{
+		Bucket:            aws.String(defaultBucket),
+		Key:               aws.String("object"),
+		CopySource:        aws.String(defaultBucket + "/object"),
+		MetadataDirective: "MERGE",
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+		t.Fatal("expected InvalidArgument, found", err)
 	}
+}
 
-	if v := obj.Metadata["X-Amz-Meta-Three"]; v != "dst" {
-		t.Fatalf("bad Content-Encoding: %q", v)
+func TestCopyObjectConditions(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	put, err := svc.PutObject(t.Context(), &s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+		Body:   strings.NewReader("content"),
+	})
+	ts.OK(err)
+	before, after := defaultDate.Add(-time.Hour), defaultDate.Add(time.Hour)
+
+	for idx, tc := range []struct {
+		in *s3.CopyObjectInput
+		ok bool
+	}{
+		{in: &s3.CopyObjectInput{CopySourceIfMatch: put.ETag}, ok: true},
+		{in: &s3.CopyObjectInput{CopySourceIfMatch: aws.String(`"nope"`)}, ok: false},
+		{in: &s3.CopyObjectInput{CopySourceIfNoneMatch: put.ETag}, ok: false},
+		{in: &s3.CopyObjectInput{CopySourceIfNoneMatch: aws.String(`"nope"`)}, ok: true},
+		{in: &s3.CopyObjectInput{CopySourceIfModifiedSince: aws.Time(before)}, ok: true},
+		{in: &s3.CopyObjectInput{CopySourceIfModifiedSince: aws.Time(after)}, ok: false},
+		{in: &s3.CopyObjectInput{CopySourceIfUnmodifiedSince: aws.Time(after)}, ok: true},
+		{in: &s3.CopyObjectInput{CopySourceIfUnmodifiedSince: aws.Time(before)}, ok: false},
+
+		// If-Match takes precedence over If-Unmodified-Since, and
+		// If-None-Match over If-Modified-Since:
+		{in: &s3.CopyObjectInput{CopySourceIfMatch: put.ETag, CopySourceIfUnmodifiedSince: aws.Time(before)}, ok: true},
+		{in: &s3.CopyObjectInput{CopySourceIfNoneMatch: aws.String(`"nope"`), CopySourceIfModifiedSince: aws.Time(after)}, ok: true},
+	} {
+		tc.in.Bucket = aws.String(defaultBucket)
+		tc.in.Key = aws.String("copy")
+		tc.in.CopySource = aws.String(defaultBucket + "/object")
+		_, err := svc.CopyObject(t.Context(), tc.in)
+		if tc.ok {
+			ts.OK(err)
+		} else if !hasErrorCode(err, gofakes3.ErrPreconditionFailed) {
+			t.Fatal(idx, "expected PreconditionFailed, found", err)
+		}
 	}
 }
 
@@ -561,6 +667,72 @@ func TestCopyObjectFullyEncodedSourceWithSpecialChars(t *testing.T) {
 	}
 }
 
+func TestCopyObjectVersion(t *testing.T) {
+	ts := newTestServer(t, withVersioning())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	v1, err := svc.PutObject(t.Context(), &s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+		Body:   strings.NewReader("one"),
+	})
+	ts.OK(err)
+	v2, err := svc.PutObject(t.Context(), &s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+		Body:   strings.NewReader("two"),
+	})
+	ts.OK(err)
+
+	// Restore the previous version by copying it over the current one:
+	out, err := svc.CopyObject(t.Context(), &s3.CopyObjectInput{
+		Bucket:     aws.String(defaultBucket),
+		Key:        aws.String("object"),
+		CopySource: aws.String(defaultBucket + "/object?versionId=" + aws.ToString(v1.VersionId)),
+	})
+	ts.OK(err)
+	if aws.ToString(out.CopySourceVersionId) != aws.ToString(v1.VersionId) {
+		t.Fatal("unexpected source version", aws.ToString(out.CopySourceVersionId))
+	}
+	if v := aws.ToString(out.VersionId); v == "" || v == aws.ToString(v1.VersionId) || v == aws.ToString(v2.VersionId) {
+		t.Fatal("unexpected version", v)
+	}
+	ts.assertObject(defaultBucket, "object", nil, "one")
+
+	del, err := svc.DeleteObject(t.Context(), &s3.DeleteObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+
+	_, err = svc.CopyObject(t.Context(), &s3.CopyObjectInput{
+		Bucket:     aws.String(defaultBucket),
+		Key:        aws.String("copy"),
+		CopySource: aws.String(defaultBucket + "/object"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchKey) {
+		t.Fatal("expected NoSuchKey, found", err)
+	}
+	_, err = svc.CopyObject(t.Context(), &s3.CopyObjectInput{
+		Bucket:     aws.String(defaultBucket),
+		Key:        aws.String("copy"),
+		CopySource: aws.String(defaultBucket + "/object?versionId=" + aws.ToString(del.VersionId)),
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+		t.Fatal("expected InvalidRequest, found", err)
+	}
+
+	// Older versions can still be copied:
+	_, err = svc.CopyObject(t.Context(), &s3.CopyObjectInput{
+		Bucket:     aws.String(defaultBucket),
+		Key:        aws.String("copy"),
+		CopySource: aws.String(defaultBucket + "/object?versionId=" + aws.ToString(v2.VersionId)),
+	})
+	ts.OK(err)
+	ts.assertObject(defaultBucket, "copy", nil, "two")
+}
+
 func TestDeleteBucket(t *testing.T) {
 	t.Run("delete-empty", func(t *testing.T) {
 		ts := newTestServer(t, withoutInitialBuckets())
@@ -926,7 +1098,8 @@ func TestCreateObjectBrowserUpload(t *testing.T) {
 	assertUpload := func(ts *testServer, bucket string, w *multipart.Writer, body io.Reader, etag string) {
 		res, err := upload(ts, bucket, w, body)
 		ts.OK(err)
-		if res.StatusCode != http.StatusOK {
+		// S3 responds with 204 unless success_action_status asks otherwise:
+		if res.StatusCode != http.StatusNoContent {
 			ts.Fatal("bad status", res.StatusCode, tryDumpResponse(res, true))
 		}
 		if etag != "" && res.Header.Get("ETag") != etag {
@@ -1219,6 +1392,58 @@ func TestObjectVersions(t *testing.T) {
 	})
 }
 
+func TestVersioningBackends(t *testing.T) {
+	runWithAllBackends(t, testVersioningBackends)
+}
+
+func testVersioningBackends(t *testing.T, ts *testServer) {
+	if _, ok := ts.backend.(gofakes3.VersionedBackend); !ok {
+		t.Skip("backend does not support versioning")
+	}
+	svc := ts.s3Client()
+	_, err := svc.PutBucketVersioning(t.Context(), &s3.PutBucketVersioningInput{
+		Bucket:                  aws.String(defaultBucket),
+		VersioningConfiguration: &s3types.VersioningConfiguration{Status: s3types.BucketVersioningStatusEnabled},
+	})
+	ts.OK(err)
+
+	for _, key := range []string{"a", "a", "b", "b"} {
+		ts.putString(svc, key, "body "+key)
+	}
+	listVersions := func() []s3types.ObjectVersion {
+		rs, err := svc.ListObjectVersions(t.Context(), &s3.ListObjectVersionsInput{Bucket: aws.String(defaultBucket)})
+		ts.OK(err)
+		return rs.Versions
+	}
+	versions := listVersions()
+	if len(versions) != 4 {
+		t.Fatal("unexpected versions", len(versions))
+	}
+
+	// Deleting an object hides it from ordinary listings (S300008):
+	_, err = svc.DeleteObjects(t.Context(), &s3.DeleteObjectsInput{
+		Bucket: aws.String(defaultBucket),
+		Delete: &s3types.Delete{Objects: []s3types.ObjectIdentifier{{Key: aws.String("a")}}},
+	})
+	ts.OK(err)
+	ts.assertLs(defaultBucket, "", nil, []string{"b"})
+
+	// Deleting every version leaves nothing behind (S300009):
+	objects := make([]s3types.ObjectIdentifier, len(versions))
+	for i, version := range versions {
+		objects[i] = s3types.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId}
+	}
+	_, err = svc.DeleteObjects(t.Context(), &s3.DeleteObjectsInput{
+		Bucket: aws.String(defaultBucket),
+		Delete: &s3types.Delete{Objects: objects},
+	})
+	ts.OK(err)
+	if versions := listVersions(); len(versions) != 0 {
+		t.Fatal("unexpected versions", len(versions))
+	}
+	ts.assertLs(defaultBucket, "", nil, nil)
+}
+
 func TestListBucketPages(t *testing.T) {
 	createData := func(ts *testServer, prefix string, n int32) []string {
 		keys := make([]string, n)
@@ -3,7 +3,9 @@ package gofakes3
 import (
 	"bytes"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"hash"
 	"io"
@@ -19,6 +21,9 @@ type hashingReader struct {
 	expected []byte
 	hash     hash.Hash
 	sum      []byte
+
+	// Returned by Read in place of io.EOF if the expected hash is not matched.
+	mismatch error
 }
 
 func newHashingReader(inner io.Reader, expectedMD5Base64 string) (*hashingReader, error) {
@@ -39,6 +44,24 @@ func newHashingReader(inner io.Reader, expectedMD5Base64 string) (*hashingReader
 		inner:    inner,
 		expected: md5Bytes,
 		hash:     md5.New(),
+		mismatch: ErrBadDigest,
+	}, nil
+}
+
+// newContentSHA256Reader checks the data read from inner against the hex encoded
+// SHA256 hash that signed requests send in the X-Amz-Content-Sha256 header.
+func newContentSHA256Reader(inner io.Reader, expectedSHA256Hex string) (*hashingReader, error) {
+	sha256Bytes, err := hex.DecodeString(expectedSHA256Hex)
+	if err != nil || len(sha256Bytes) != sha256.Size {
+		return nil, ErrorInvalidArgument("x-amz-content-sha256", expectedSHA256Hex,
+			"x-amz-content-sha256 must be UNSIGNED-PAYLOAD, STREAMING-AWS4-HMAC-SHA256-PAYLOAD or a valid sha256 value.")
+	}
+
+	return &hashingReader{
+		inner:    inner,
+		expected: sha256Bytes,
+		hash:     sha256.New(),
+		mismatch: ErrXAmzContentSHA256Mismatch,
 	}, nil
 }
 
@@ -68,7 +91,7 @@ func (h *hashingReader) Read(p []byte) (n int, err error) {
 			if h.expected != nil && !bytes.Equal(h.sum, h.expected) {
 				// FIXME: some more context here would be useful; need to flush out
 				// what S3 responds with in this case.
-				return n, ErrBadDigest
+				return n, h.mismatch
 			}
 		}
 		return n, err
@@ -178,7 +178,10 @@ func withVersioning() testServerOption {
 	return func(ts *testServer) { ts.versioning = true }
 }
 func withFakerOptions(opts ...gofakes3.Option) testServerOption {
-	return func(ts *testServer) { ts.options = opts }
+	return func(ts *testServer) { ts.options = append(ts.options, opts...) }
+}
+func withTimeSource(timeSource gofakes3.TimeSourceAdvancer) testServerOption {
+	return func(ts *testServer) { ts.TimeSourceAdvancer = timeSource }
 }
 func withBackend(backend gofakes3.Backend) testServerOption {
 	return func(ts *testServer) { ts.backend = backend }
@@ -221,11 +224,11 @@ func newTestServer(t *testing.T, opts ...testServerOption) *testServer {
 	}
 
 	if ts.versioning {
-		mem, ok := ts.backend.(*s3mem.Backend)
+		versioned, ok := ts.backend.(gofakes3.VersionedBackend)
 		if !ok {
 			panic("backend is not a versioned backend")
 		}
-		ts.versioned = mem
+		ts.versioned = versioned
 		for _, bucket := range ts.initialBuckets {
 			ts.TT.OK(ts.versioned.SetVersioningConfiguration(bucket, gofakes3.VersioningConfiguration{
 				Status: gofakes3.VersioningEnabled,
@@ -284,6 +287,11 @@ func (ts *testServer) backendGetString(bucket, key string, rnge *gofakes3.Object
 
 func (ts *testServer) s3Client() *s3.Client {
 	ts.Helper()
+	return ts.s3ClientWithCredentials("dummy-access", "dummy-secret")
+}
+
+func (ts *testServer) s3ClientWithCredentials(accessKeyID, secret string) *s3.Client {
+	ts.Helper()
 
 	// Parse server URL to get the correct hostname for resolver configuration
 	u, err := url.Parse(ts.server.URL)
@@ -303,7 +311,7 @@ func (ts *testServer) s3Client() *s3.Client {
 		BaseEndpoint: aws.String(ts.server.URL),
 		Region:       "region",
 		HTTPClient:   ara.NewClient(ara.NewCustomResolver(resolverMap)),
-		Credentials:  credentials.NewStaticCredentialsProvider("dummy-access", "dummy-secret", ""),
+		Credentials:  credentials.NewStaticCredentialsProvider(accessKeyID, secret, ""),
 	}
 	svc := s3.NewFromConfig(config, func(o *s3.Options) {
 		o.UsePathStyle = !ts.useHostBucket
@@ -0,0 +1,770 @@
+package gofakes3
+
+import (
+	"context"
+	"encoding/xml"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Lifecycle configuration, as described here:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/object-lifecycle-mgmt.html
+//
+// Rules are not applied as objects age: ApplyLifecycle applies them to every
+// bucket at the time of the TimeSource, so that tests can advance a
+// FixedTimeSource and apply them, and RunLifecycle applies them periodically.
+// As in S3, objects expire and transition at midnight UTC following the number
+// of days set by a rule.
+
+// LifecycleConfiguration is the lifecycle configuration of a bucket, set with
+// PutBucketLifecycleConfiguration.
+type LifecycleConfiguration struct {
+	XMLName xml.Name        `xml:"LifecycleConfiguration"`
+	Xmlns   string          `xml:"xmlns,attr,omitempty"`
+	Rules   []LifecycleRule `xml:"Rule"`
+}
+
+type LifecycleRule struct {
+	ID     string               `xml:"ID,omitempty"`
+	Status LifecycleRuleStatus  `xml:"Status"`
+	Filter *LifecycleRuleFilter `xml:"Filter,omitempty"`
+
+	// Prefix is the deprecated alternative to a Filter with a prefix.
+	Prefix *string `xml:"Prefix,omitempty"`
+
+	Expiration                     *LifecycleExpiration            `xml:"Expiration,omitempty"`
+	Transitions                    []LifecycleTransition           `xml:"Transition,omitempty"`
+	NoncurrentVersionExpiration    *NoncurrentVersionExpiration    `xml:"NoncurrentVersionExpiration,omitempty"`
+	AbortIncompleteMultipartUpload *AbortIncompleteMultipartUpload `xml:"AbortIncompleteMultipartUpload,omitempty"`
+}
+
+type LifecycleRuleStatus string
+
+const (
+	LifecycleRuleEnabled  LifecycleRuleStatus = "Enabled"
+	LifecycleRuleDisabled LifecycleRuleStatus = "Disabled"
+)
+
+// LifecycleRuleFilter selects the objects a rule applies to. At most one of
+// its fields may be set; And combines several conditions.
+type LifecycleRuleFilter struct {
+	Prefix                *string                 `xml:"Prefix,omitempty"`
+	Tag                   *Tag                    `xml:"Tag,omitempty"`
+	ObjectSizeGreaterThan *int64                  `xml:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    *int64                  `xml:"ObjectSizeLessThan,omitempty"`
+	And                   *LifecycleRuleAndFilter `xml:"And,omitempty"`
+}
+
+type LifecycleRuleAndFilter struct {
+	Prefix                *string `xml:"Prefix,omitempty"`
+	Tags                  []Tag   `xml:"Tag,omitempty"`
+	ObjectSizeGreaterThan *int64  `xml:"ObjectSizeGreaterThan,omitempty"`
+	ObjectSizeLessThan    *int64  `xml:"ObjectSizeLessThan,omitempty"`
+}
+
+// LifecycleExpiration expires the current version of objects, either a
+// number of Days after they were created, or at a Date. With
+// ExpiredObjectDeleteMarker, it instead removes delete markers that no longer
+// have any noncurrent versions behind them.
+type LifecycleExpiration struct {
+	Days                      int         `xml:"Days,omitempty"`
+	Date                      ContentTime `xml:"Date,omitempty"`
+	ExpiredObjectDeleteMarker bool        `xml:"ExpiredObjectDeleteMarker,omitempty"`
+}
+
+// LifecycleTransition moves the current version of objects to another
+// storage class, either a number of Days after they were created, or at a
+// Date.
+type LifecycleTransition struct {
+	Days         *int         `xml:"Days,omitempty"`
+	Date         ContentTime  `xml:"Date,omitempty"`
+	StorageClass StorageClass `xml:"StorageClass"`
+}
+
+// NoncurrentVersionExpiration removes object versions a number of days after
+// they became noncurrent, except for the most recent NewerNoncurrentVersions.
+type NoncurrentVersionExpiration struct {
+	NoncurrentDays          int `xml:"NoncurrentDays"`
+	NewerNoncurrentVersions int `xml:"NewerNoncurrentVersions,omitempty"`
+}
+
+// AbortIncompleteMultipartUpload aborts multipart uploads a number of days
+// after they were initiated.
+type AbortIncompleteMultipartUpload struct {
+	DaysAfterInitiation int `xml:"DaysAfterInitiation"`
+}
+
+// lifecycleDue returns the midnight UTC following days after t, when rules
+// that count days from t take effect.
+func lifecycleDue(t time.Time, days int) time.Time {
+	return t.UTC().AddDate(0, 0, days).Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+func isMidnight(t time.Time) bool {
+	return t.UTC().Equal(t.UTC().Truncate(24 * time.Hour))
+}
+
+func validateLifecycleConfiguration(config *LifecycleConfiguration) error {
+	if len(config.Rules) == 0 || len(config.Rules) > 1000 {
+		return ErrorMessage(ErrMalformedXML, ErrMalformedXML.Message())
+	}
+
+	ids := make(map[string]bool, len(config.Rules))
+	for _, rule := range config.Rules {
+		if len(rule.ID) > 255 {
+			return ErrorMessage(ErrInvalidArgument, "ID length should not exceed allowed limit of 255")
+		}
+		if rule.ID != "" {
+			if ids[rule.ID] {
+				return ErrorMessage(ErrInvalidArgument, "Rule ID must be unique. Found same ID for more than one rule")
+			}
+			ids[rule.ID] = true
+		}
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rule *LifecycleRule) validate() error {
+	if rule.Status != LifecycleRuleEnabled && rule.Status != LifecycleRuleDisabled {
+		return ErrorMessage(ErrMalformedXML, ErrMalformedXML.Message())
+	}
+	if rule.Filter != nil && rule.Prefix != nil {
+		return ErrorMessage(ErrMalformedXML, ErrMalformedXML.Message())
+	}
+	if rule.Filter != nil {
+		if err := rule.Filter.validate(); err != nil {
+			return err
+		}
+	}
+
+	if rule.Expiration == nil && len(rule.Transitions) == 0 && rule.NoncurrentVersionExpiration == nil && rule.AbortIncompleteMultipartUpload == nil {
+		return ErrorMessage(ErrInvalidRequest, "At least one action needs to be specified in a rule")
+	}
+
+	if exp := rule.Expiration; exp != nil {
+		set := 0
+		for _, ok := range []bool{exp.Days != 0, !exp.Date.IsZero(), exp.ExpiredObjectDeleteMarker} {
+			if ok {
+				set++
+			}
+		}
+		switch {
+		case set != 1:
+			return ErrorMessage(ErrMalformedXML, ErrMalformedXML.Message())
+		case exp.Days < 0:
+			return ErrorMessage(ErrInvalidArgument, "'Days' for Expiration action must be a positive integer")
+		case !exp.Date.IsZero() && !isMidnight(exp.Date.Time):
+			return ErrorMessage(ErrInvalidArgument, "'Date' must be at midnight GMT")
+		case exp.ExpiredObjectDeleteMarker && rule.hasObjectConditions():
+			return ErrorMessage(ErrInvalidRequest, "ExpiredObjectDeleteMarker cannot be specified with tags or object size conditions")
+		}
+	}
+
+	for _, tr := range rule.Transitions {
+		switch {
+		case (tr.Days != nil) == !tr.Date.IsZero():
+			return ErrorMessage(ErrMalformedXML, ErrMalformedXML.Message())
+		case tr.Days != nil && *tr.Days < 0:
+			return ErrorMessage(ErrInvalidArgument, "'Days' in Transition action must be nonnegative")
+		case !tr.Date.IsZero() && !isMidnight(tr.Date.Time):
+			return ErrorMessage(ErrInvalidArgument, "'Date' must be at midnight GMT")
+		case !tr.StorageClass.valid() || tr.StorageClass == StorageStandard:
+			return ErrorMessage(ErrInvalidStorageClass, ErrInvalidStorageClass.Message())
+		}
+	}
+
+	if nve := rule.NoncurrentVersionExpiration; nve != nil {
+		if nve.NoncurrentDays <= 0 {
+			return ErrorMessage(ErrInvalidArgument, "'NoncurrentDays' for NoncurrentVersionExpiration action must be a positive integer")
+		}
+		if nve.NewerNoncurrentVersions < 0 {
+			return ErrorMessage(ErrInvalidArgument, "'NewerNoncurrentVersions' for NoncurrentVersionExpiration action must be a positive integer")
+		}
+	}
+
+	if abort := rule.AbortIncompleteMultipartUpload; abort != nil {
+		if abort.DaysAfterInitiation <= 0 {
+			return ErrorMessage(ErrInvalidArgument, "'DaysAfterInitiation' for AbortIncompleteMultipartUpload action must be a positive integer")
+		}
+		if rule.hasObjectConditions() {
+			return ErrorMessage(ErrInvalidRequest, "AbortIncompleteMultipartUpload cannot be specified with tags or object size conditions")
+		}
+	}
+
+	return nil
+}
+
+func (filter *LifecycleRuleFilter) validate() error {
+	set := 0
+	for _, ok := range []bool{filter.Prefix != nil, filter.Tag != nil, filter.ObjectSizeGreaterThan != nil, filter.ObjectSizeLessThan != nil, filter.And != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return ErrorMessage(ErrMalformedXML, ErrMalformedXML.Message())
+	}
+	if and := filter.And; and != nil {
+		for _, tag := range and.Tags {
+			if tag.Key == "" {
+				return ErrorMessage(ErrInvalidTag, "The TagKey you have provided is invalid")
+			}
+		}
+		if and.ObjectSizeGreaterThan != nil && and.ObjectSizeLessThan != nil && *and.ObjectSizeGreaterThan >= *and.ObjectSizeLessThan {
+			return ErrorMessage(ErrInvalidArgument, "ObjectSizeGreaterThan must be less than ObjectSizeLessThan in the And filter")
+		}
+	}
+	if filter.Tag != nil && filter.Tag.Key == "" {
+		return ErrorMessage(ErrInvalidTag, "The TagKey you have provided is invalid")
+	}
+	return nil
+}
+
+// conditions returns the prefix, tags and size bounds of the objects the rule
+// applies to. The size bounds are exclusive; greaterThan is -1 if there is
+// no lower bound, and lessThan is math.MaxInt64 if there is no upper bound.
+func (rule *LifecycleRule) conditions() (prefix string, tags []Tag, greaterThan, lessThan int64) {
+	greaterThan, lessThan = -1, math.MaxInt64
+	sizes := func(gt, lt *int64) {
+		if gt != nil {
+			greaterThan = *gt
+		}
+		if lt != nil {
+			lessThan = *lt
+		}
+	}
+
+	if rule.Prefix != nil {
+		prefix = *rule.Prefix
+	}
+	if filter := rule.Filter; filter != nil {
+		if filter.Prefix != nil {
+			prefix = *filter.Prefix
+		}
+		if filter.Tag != nil {
+			tags = []Tag{*filter.Tag}
+		}
+		sizes(filter.ObjectSizeGreaterThan, filter.ObjectSizeLessThan)
+		if and := filter.And; and != nil {
+			if and.Prefix != nil {
+				prefix = *and.Prefix
+			}
+			tags = and.Tags
+			sizes(and.ObjectSizeGreaterThan, and.ObjectSizeLessThan)
+		}
+	}
+	return prefix, tags, greaterThan, lessThan
+}
+
+// hasObjectConditions reports whether the rule selects objects by their tags
+// or size, which delete markers and multipart uploads don't have.
+func (rule *LifecycleRule) hasObjectConditions() bool {
+	_, tags, greaterThan, lessThan := rule.conditions()
+	return len(tags) > 0 || greaterThan >= 0 || lessThan != math.MaxInt64
+}
+
+// lifecycleObject is an object version that lifecycle rules are matched
+// against. Its metadata is only fetched if a rule needs its tags.
+type lifecycleObject struct {
+	key          string
+	versionID    VersionID
+	size         int64
+	lastModified time.Time
+	storageClass StorageClass
+	deleteMarker bool
+	meta         func() (map[string]string, error)
+}
+
+func (rule *LifecycleRule) matches(obj *lifecycleObject) (bool, error) {
+	prefix, tags, greaterThan, lessThan := rule.conditions()
+	if !strings.HasPrefix(obj.key, prefix) {
+		return false, nil
+	}
+	if obj.deleteMarker {
+		return !rule.hasObjectConditions(), nil
+	}
+	if obj.size <= greaterThan || obj.size >= lessThan {
+		return false, nil
+	}
+	if len(tags) == 0 {
+		return true, nil
+	}
+
+	meta, err := obj.meta()
+	if err != nil {
+		return false, err
+	}
+	objectTags, err := tagsFromMetadata(meta)
+	if err != nil {
+		return false, err
+	}
+	for _, tag := range tags {
+		found := false
+		for _, objectTag := range objectTags {
+			if objectTag == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// expiration returns when the current version of obj expires according to
+// the rule, or a zero time if the rule does not expire it.
+func (rule *LifecycleRule) expiration(obj *lifecycleObject) time.Time {
+	switch exp := rule.Expiration; {
+	case exp == nil:
+		return time.Time{}
+	case exp.Days > 0:
+		return lifecycleDue(obj.lastModified, exp.Days)
+	default:
+		return exp.Date.Time
+	}
+}
+
+// objectExpiration returns when the current version of obj expires according
+// to the enabled rules of config, and the ID of the rule that expires it
+// first. It returns a zero time if no rule expires it.
+func objectExpiration(config *LifecycleConfiguration, obj *lifecycleObject) (at time.Time, ruleID string, err error) {
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		if rule.Status != LifecycleRuleEnabled {
+			continue
+		}
+		due := rule.expiration(obj)
+		if due.IsZero() || (!at.IsZero() && !due.Before(at)) {
+			continue
+		}
+		if ok, err := rule.matches(obj); err != nil {
+			return at, ruleID, err
+		} else if ok {
+			at, ruleID = due, rule.ID
+		}
+	}
+	return at, ruleID, nil
+}
+
+// bucketLifecycle returns the lifecycle configuration of a bucket, or nil if
+// it does not have one.
+func (g *GoFakeS3) bucketLifecycle(bucket string) (*LifecycleConfiguration, error) {
+	config, err := g.lifecycles.BucketLifecycle(bucket)
+	if HasErrorCode(err, ErrNoSuchLifecycleConfiguration) {
+		return nil, nil
+	}
+	return config, err
+}
+
+// writeExpirationHeader writes the x-amz-expiration header of the current
+// version of an object that a lifecycle rule expires.
+func (g *GoFakeS3) writeExpirationHeader(bucket string, obj *Object, w http.ResponseWriter) error {
+	config, err := g.bucketLifecycle(bucket)
+	if err != nil || config == nil {
+		return err
+	}
+
+	// The backend may not know when the object was created, so there are no
+	// days to count from:
+	lastModified := objectLastModified(obj)
+	if lastModified.IsZero() {
+		return nil
+	}
+	at, ruleID, err := objectExpiration(config, &lifecycleObject{
+		key:          obj.Name,
+		size:         obj.Size,
+		lastModified: lastModified,
+		meta:         func() (map[string]string, error) { return obj.Metadata, nil },
+	})
+	if err != nil || at.IsZero() {
+		return err
+	}
+	w.Header().Set("x-amz-expiration", `expiry-date="`+formatHeaderTime(at)+`", rule-id="`+ruleID+`"`)
+	return nil
+}
+
+// RunLifecycle applies the lifecycle rules of every bucket with
+// ApplyLifecycle at each interval, until ctx is done. Errors are logged.
+func (g *GoFakeS3) RunLifecycle(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := g.ApplyLifecycle(); err != nil {
+				g.log.Print(LogErr, "LIFECYCLE:", err)
+			}
+		}
+	}
+}
+
+// ApplyLifecycle applies the lifecycle rules of every bucket at the time of
+// the TimeSource: it expires objects and object versions, removes expired
+// delete markers, transitions objects to other storage classes and aborts
+// incomplete multipart uploads.
+//
+// Noncurrent versions and delete markers are only expired if the Backend is a
+// VersionedBackend, and transitions are only applied if it is an
+// ObjectMetadataBackend. Versions that are protected by Object Lock are not
+// expired.
+func (g *GoFakeS3) ApplyLifecycle() error {
+	buckets, err := g.storage.ListBuckets()
+	if err != nil {
+		return err
+	}
+
+	now := g.timeSource.Now()
+	for _, bucket := range buckets {
+		config, err := g.bucketLifecycle(bucket.Name)
+		if err != nil {
+			return err
+		} else if config == nil {
+			continue
+		}
+		if err := g.applyBucketLifecycle(bucket.Name, config, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *GoFakeS3) applyBucketLifecycle(bucket string, config *LifecycleConfiguration, now time.Time) error {
+	var rules []*LifecycleRule
+	for i := range config.Rules {
+		if config.Rules[i].Status == LifecycleRuleEnabled {
+			rules = append(rules, &config.Rules[i])
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	versioned := false
+	if g.versioned != nil {
+		versioning, err := g.versioned.VersioningConfiguration(bucket)
+		if err != nil {
+			return err
+		}
+		versioned = versioning.Status != VersioningNone
+	}
+
+	var err error
+	if versioned {
+		err = g.applyVersionsLifecycle(bucket, rules, now)
+	} else {
+		err = g.applyObjectsLifecycle(bucket, rules, now)
+	}
+	if err != nil {
+		return err
+	}
+	return g.applyUploadsLifecycle(bucket, rules, now)
+}
+
+// applyObjectsLifecycle applies rules to the objects of a bucket that does
+// not have versioning enabled.
+func (g *GoFakeS3) applyObjectsLifecycle(bucket string, rules []*LifecycleRule, now time.Time) error {
+	objects, err := g.storage.ListBucket(bucket, &Prefix{}, ListBucketPage{})
+	if err != nil {
+		return err
+	}
+
+	for _, item := range objects.Contents {
+		key := item.Key
+		obj := &lifecycleObject{
+			key:          key,
+			size:         item.Size,
+			lastModified: item.LastModified.Time,
+			storageClass: item.StorageClass,
+			meta:         g.lifecycleMeta(bucket, key, ""),
+		}
+		if err := g.applyCurrentLifecycle(bucket, obj, rules, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyVersionsLifecycle applies rules to the object versions of a bucket that
+// has versioning enabled or suspended.
+func (g *GoFakeS3) applyVersionsLifecycle(bucket string, rules []*LifecycleRule, now time.Time) error {
+	versions, err := g.versioned.ListBucketVersions(bucket, &Prefix{}, &ListBucketVersionsPage{})
+	if err != nil {
+		return err
+	}
+
+	// Versions are grouped by key, with the current version first and the
+	// noncurrent versions from the most to the least recent:
+	type objectVersions struct {
+		current    *lifecycleObject
+		noncurrent []*lifecycleObject
+	}
+	var keys []string
+	objects := map[string]*objectVersions{}
+
+	for _, item := range versions.Versions {
+		var obj *lifecycleObject
+		var latest bool
+		switch item := item.(type) {
+		case *Version:
+			obj = &lifecycleObject{
+				key:          item.Key,
+				versionID:    item.VersionID,
+				size:         item.Size,
+				lastModified: item.LastModified.Time,
+				storageClass: item.StorageClass,
+			}
+			latest = item.IsLatest
+		case *DeleteMarker:
+			obj = &lifecycleObject{
+				key:          item.Key,
+				versionID:    item.VersionID,
+				lastModified: item.LastModified.Time,
+				deleteMarker: true,
+			}
+			latest = item.IsLatest
+		default:
+			continue
+		}
+		obj.meta = g.lifecycleMeta(bucket, obj.key, obj.versionID)
+
+		ov := objects[obj.key]
+		if ov == nil {
+			ov = &objectVersions{}
+			objects[obj.key] = ov
+			keys = append(keys, obj.key)
+		}
+		if latest {
+			ov.current = obj
+		} else {
+			ov.noncurrent = append(ov.noncurrent, obj)
+		}
+	}
+
+	for _, key := range keys {
+		ov := objects[key]
+		sort.SliceStable(ov.noncurrent, func(i, j int) bool {
+			return ov.noncurrent[i].lastModified.After(ov.noncurrent[j].lastModified)
+		})
+
+		// A version becomes noncurrent when the next one is created:
+		remaining := len(ov.noncurrent)
+		for i, obj := range ov.noncurrent {
+			since := now
+			if i > 0 {
+				since = ov.noncurrent[i-1].lastModified
+			} else if ov.current != nil {
+				since = ov.current.lastModified
+			}
+			expired, err := g.applyNoncurrentLifecycle(bucket, obj, i, since, rules, now)
+			if err != nil {
+				return err
+			} else if expired {
+				remaining--
+			}
+		}
+
+		switch {
+		case ov.current == nil:
+		case ov.current.deleteMarker:
+			if remaining > 0 {
+				continue
+			}
+			if err := g.applyDeleteMarkerLifecycle(bucket, ov.current, rules); err != nil {
+				return err
+			}
+		default:
+			if err := g.applyCurrentLifecycle(bucket, ov.current, rules, now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyCurrentLifecycle expires or transitions the current version of an
+// object. If versioning is enabled, expiring it creates a delete marker.
+func (g *GoFakeS3) applyCurrentLifecycle(bucket string, obj *lifecycleObject, rules []*LifecycleRule, now time.Time) error {
+	var transition *LifecycleTransition
+	var transitionAt time.Time
+
+	for _, rule := range rules {
+		ok, err := rule.matches(obj)
+		if err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+
+		if due := rule.expiration(obj); !due.IsZero() && !now.Before(due) {
+			g.log.Print(LogInfo, "LIFECYCLE EXPIRE:", bucket, obj.key, "Rule:", rule.ID)
+			_, err := g.storage.DeleteObject(bucket, obj.key)
+			return ignoreNotFound(err)
+		}
+
+		for i, tr := range rule.Transitions {
+			due := tr.Date.Time
+			if tr.Days != nil {
+				due = lifecycleDue(obj.lastModified, *tr.Days)
+			}
+			if !now.Before(due) && (transition == nil || due.After(transitionAt)) {
+				transition, transitionAt = &rule.Transitions[i], due
+			}
+		}
+	}
+
+	if transition == nil || transition.StorageClass == obj.storageClass || g.metadata == nil {
+		return nil
+	}
+	g.log.Print(LogInfo, "LIFECYCLE TRANSITION:", bucket, obj.key, transition.StorageClass)
+	err := g.metadata.PutObjectMetadata(bucket, obj.key, obj.versionID, map[string]string{
+		storageClassMetadataKey: string(transition.StorageClass),
+	})
+	return ignoreNotFound(err)
+}
+
+// applyNoncurrentLifecycle expires a noncurrent object version, which is the
+// index'th most recent, and has been noncurrent since the given time. It
+// reports whether the version was expired.
+func (g *GoFakeS3) applyNoncurrentLifecycle(bucket string, obj *lifecycleObject, index int, since time.Time, rules []*LifecycleRule, now time.Time) (bool, error) {
+	for _, rule := range rules {
+		nve := rule.NoncurrentVersionExpiration
+		if nve == nil || index < nve.NewerNoncurrentVersions || now.Before(lifecycleDue(since, nve.NoncurrentDays)) {
+			continue
+		}
+		if ok, err := rule.matches(obj); err != nil {
+			return false, err
+		} else if !ok {
+			continue
+		}
+
+		if !obj.deleteMarker {
+			meta, err := obj.meta()
+			if err != nil {
+				return false, ignoreNotFound(err)
+			}
+			if objectLocked(meta, now) {
+				return false, nil
+			}
+		}
+		g.log.Print(LogInfo, "LIFECYCLE EXPIRE VERSION:", bucket, obj.key, obj.versionID, "Rule:", rule.ID)
+		_, err := g.versioned.DeleteObjectVersion(bucket, obj.key, obj.versionID)
+		return err == nil, ignoreNotFound(err)
+	}
+	return false, nil
+}
+
+// applyDeleteMarkerLifecycle removes a delete marker that is the only version
+// of an object left, if a rule asks for it.
+func (g *GoFakeS3) applyDeleteMarkerLifecycle(bucket string, obj *lifecycleObject, rules []*LifecycleRule) error {
+	for _, rule := range rules {
+		if rule.Expiration == nil || !rule.Expiration.ExpiredObjectDeleteMarker {
+			continue
+		}
+		if ok, err := rule.matches(obj); err != nil || !ok {
+			continue
+		}
+		g.log.Print(LogInfo, "LIFECYCLE EXPIRE DELETE MARKER:", bucket, obj.key, obj.versionID, "Rule:", rule.ID)
+		_, err := g.versioned.DeleteObjectVersion(bucket, obj.key, obj.versionID)
+		return ignoreNotFound(err)
+	}
+	return nil
+}
+
+// applyUploadsLifecycle aborts the incomplete multipart uploads of a bucket.
+func (g *GoFakeS3) applyUploadsLifecycle(bucket string, rules []*LifecycleRule, now time.Time) error {
+	abort := false
+	for _, rule := range rules {
+		abort = abort || rule.AbortIncompleteMultipartUpload != nil
+	}
+	if !abort {
+		return nil
+	}
+
+	uploads, err := g.uploader.ListMultipartUploads(bucket, &UploadListMarker{}, Prefix{}, math.MaxInt32)
+	if HasErrorCode(err, ErrNoSuchUpload) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, upload := range uploads.Uploads {
+		for _, rule := range rules {
+			ab := rule.AbortIncompleteMultipartUpload
+			if ab == nil || now.Before(lifecycleDue(upload.Initiated.Time, ab.DaysAfterInitiation)) {
+				continue
+			}
+			prefix, _, _, _ := rule.conditions()
+			if !strings.HasPrefix(upload.Key, prefix) {
+				continue
+			}
+			g.log.Print(LogInfo, "LIFECYCLE ABORT UPLOAD:", bucket, upload.Key, upload.UploadID, "Rule:", rule.ID)
+			if err := g.uploader.AbortMultipartUpload(bucket, upload.Key, upload.UploadID); err != nil && !HasErrorCode(err, ErrNoSuchUpload) {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// lifecycleMeta returns a function that fetches the metadata of an object
+// version once.
+func (g *GoFakeS3) lifecycleMeta(bucket, key string, versionID VersionID) func() (map[string]string, error) {
+	var meta map[string]string
+	return func() (map[string]string, error) {
+		if meta != nil {
+			return meta, nil
+		}
+		obj, err := g.headObjectOrVersion(bucket, key, versionID)
+		if err != nil {
+			return nil, err
+		}
+		obj.Contents.Close()
+		meta = obj.Metadata
+		return meta, nil
+	}
+}
+
+// ignoreNotFound ignores errors for objects that have been removed since the
+// bucket was listed.
+func ignoreNotFound(err error) error {
+	if HasErrorCode(err, ErrNoSuchKey) || HasErrorCode(err, ErrNoSuchVersion) {
+		return nil
+	}
+	return err
+}
+
+var _ BucketLifecycleBackend = &bucketLifecycles{}
+
+// bucketLifecycles stores the lifecycle configuration of buckets in memory
+// for backends that do not implement BucketLifecycleBackend.
+type bucketLifecycles struct {
+	*bucketConfigs[*LifecycleConfiguration]
+}
+
+func newBucketLifecycles(storage Backend) *bucketLifecycles {
+	return &bucketLifecycles{newBucketConfigs[*LifecycleConfiguration](storage, ErrNoSuchLifecycleConfiguration)}
+}
+
+func (bl *bucketLifecycles) BucketLifecycle(bucket string) (*LifecycleConfiguration, error) {
+	return bl.get(bucket)
+}
+
+func (bl *bucketLifecycles) PutBucketLifecycle(bucket string, config *LifecycleConfiguration) error {
+	return bl.put(bucket, config)
+}
+
+func (bl *bucketLifecycles) DeleteBucketLifecycle(bucket string) error {
+	return bl.delete(bucket)
+}
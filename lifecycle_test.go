@@ -0,0 +1,421 @@
+package gofakes3_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/johannesboyne/gofakes3"
+)
+
+func (ts *testServer) putLifecycle(svc *s3.Client, rules ...s3types.LifecycleRule) error {
+	ts.Helper()
+	_, err := svc.PutBucketLifecycleConfiguration(context.TODO(), &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(defaultBucket),
+		LifecycleConfiguration: &s3types.BucketLifecycleConfiguration{Rules: rules},
+	})
+	return err
+}
+
+func (ts *testServer) objectKeys(svc *s3.Client) []string {
+	ts.Helper()
+	list, err := svc.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
+		Bucket: aws.String(defaultBucket),
+	})
+	ts.OK(err)
+	var keys []string
+	for _, item := range list.Contents {
+		keys = append(keys, aws.ToString(item.Key))
+	}
+	return keys
+}
+
+func (ts *testServer) putString(svc *s3.Client, object, body string) {
+	ts.Helper()
+	_, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String(object),
+		Body:   strings.NewReader(body),
+	})
+	ts.OK(err)
+}
+
+func TestBucketLifecycleConfiguration(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.GetBucketLifecycleConfiguration(context.TODO(), &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(defaultBucket),
+	})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchLifecycleConfiguration) {
+		t.Fatal("expected NoSuchLifecycleConfiguration, found", err)
+	}
+
+	ts.OK(ts.putLifecycle(svc, s3types.LifecycleRule{
+		ID:         aws.String("logs"),
+		Status:     s3types.ExpirationStatusEnabled,
+		Filter:     &s3types.LifecycleRuleFilter{Prefix: aws.String("logs/")},
+		Expiration: &s3types.LifecycleExpiration{Days: aws.Int32(30)},
+		Transitions: []s3types.Transition{
+			{Days: aws.Int32(10), StorageClass: s3types.TransitionStorageClassGlacier},
+		},
+	}))
+
+	out, err := svc.GetBucketLifecycleConfiguration(context.TODO(), &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(defaultBucket),
+	})
+	ts.OK(err)
+	if len(out.Rules) != 1 {
+		t.Fatal("unexpected rules", out.Rules)
+	}
+	rule := out.Rules[0]
+	if aws.ToString(rule.ID) != "logs" || aws.ToString(rule.Filter.Prefix) != "logs/" || aws.ToInt32(rule.Expiration.Days) != 30 {
+		t.Fatal("unexpected rule", rule)
+	}
+	if len(rule.Transitions) != 1 || rule.Transitions[0].StorageClass != s3types.TransitionStorageClassGlacier {
+		t.Fatal("unexpected transitions", rule.Transitions)
+	}
+
+	_, err = svc.DeleteBucketLifecycle(context.TODO(), &s3.DeleteBucketLifecycleInput{
+		Bucket: aws.String(defaultBucket),
+	})
+	ts.OK(err)
+	_, err = svc.GetBucketLifecycleConfiguration(context.TODO(), &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(defaultBucket),
+	})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchLifecycleConfiguration) {
+		t.Fatal("expected NoSuchLifecycleConfiguration, found", err)
+	}
+}
+
+func TestBucketLifecycleConfigurationInvalid(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	prefix := &s3types.LifecycleRuleFilter{Prefix: aws.String("")}
+	for idx, tc := range []struct {
+		rules []s3types.LifecycleRule
+		code  gofakes3.ErrorCode
+	}{
+		{
+			rules: []s3types.LifecycleRule{{Status: s3types.ExpirationStatusEnabled, Filter: prefix}},
+			code:  gofakes3.ErrInvalidRequest,
+		},
+		{
+			rules: []s3types.LifecycleRule{
+				{ID: aws.String("a"), Status: s3types.ExpirationStatusEnabled, Filter: prefix, Expiration: &s3types.LifecycleExpiration{Days: aws.Int32(1)}},
+				{ID: aws.String("a"), Status: s3types.ExpirationStatusEnabled, Filter: prefix, Expiration: &s3types.LifecycleExpiration{Days: aws.Int32(2)}},
+			},
+			code: gofakes3.ErrInvalidArgument,
+		},
+		{
+			rules: []s3types.LifecycleRule{{
+				Status:     s3types.ExpirationStatusEnabled,
+				Filter:     prefix,
+				Expiration: &s3types.LifecycleExpiration{Date: aws.Time(defaultDate)},
+			}},
+			code: gofakes3.ErrInvalidArgument,
+		},
+		{
+			rules: []s3types.LifecycleRule{{
+				Status:      s3types.ExpirationStatusEnabled,
+				Filter:      prefix,
+				Transitions: []s3types.Transition{{Days: aws.Int32(1), StorageClass: "STANDARD"}},
+			}},
+			code: gofakes3.ErrInvalidStorageClass,
+		},
+		{
+			rules: []s3types.LifecycleRule{{
+				Status: s3types.ExpirationStatusEnabled,
+				Filter: &s3types.LifecycleRuleFilter{Tag: &s3types.Tag{Key: aws.String("a"), Value: aws.String("b")}},
+				AbortIncompleteMultipartUpload: &s3types.AbortIncompleteMultipartUpload{
+					DaysAfterInitiation: aws.Int32(1),
+				},
+			}},
+			code: gofakes3.ErrInvalidRequest,
+		},
+		{
+			rules: []s3types.LifecycleRule{{
+				Status:                      s3types.ExpirationStatusEnabled,
+				Filter:                      prefix,
+				NoncurrentVersionExpiration: &s3types.NoncurrentVersionExpiration{NoncurrentDays: aws.Int32(0)},
+			}},
+			code: gofakes3.ErrInvalidArgument,
+		},
+	} {
+		if err := ts.putLifecycle(svc, tc.rules...); !hasErrorCode(err, tc.code) {
+			t.Fatal(idx, "expected", tc.code, "found", err)
+		}
+	}
+}
+
+func TestLifecycleExpiration(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.putString(svc, "logs/small", "a")
+	ts.putString(svc, "logs/large", "hello world")
+	ts.putString(svc, "keep", "hello world")
+
+	ts.OK(ts.putLifecycle(svc, s3types.LifecycleRule{
+		ID:     aws.String("logs"),
+		Status: s3types.ExpirationStatusEnabled,
+		Filter: &s3types.LifecycleRuleFilter{And: &s3types.LifecycleRuleAndOperator{
+			Prefix:                aws.String("logs/"),
+			ObjectSizeGreaterThan: aws.Int64(5),
+		}},
+		Expiration: &s3types.LifecycleExpiration{Days: aws.Int32(1)},
+	}))
+
+	expiration := func(object string) string {
+		t.Helper()
+		rq, err := http.NewRequest("HEAD", ts.url("/"+defaultBucket+"/"+object), nil)
+		ts.OK(err)
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		rs.Body.Close()
+		return rs.Header.Get("x-amz-expiration")
+	}
+
+	// Objects expire at the midnight following the number of days:
+	expiry := time.Date(2018, 1, 3, 0, 0, 0, 0, time.UTC)
+	if h := expiration("logs/large"); h != `expiry-date="`+expiry.Format(http.TimeFormat)+`", rule-id="logs"` {
+		t.Fatal("unexpected expiration", h)
+	}
+	if h := expiration("logs/small"); h != "" {
+		t.Fatal("unexpected expiration", h)
+	}
+
+	ts.Advance(expiry.Sub(defaultDate) - time.Second)
+	ts.OK(ts.ApplyLifecycle())
+	if keys := ts.objectKeys(svc); len(keys) != 3 {
+		t.Fatal("unexpected objects", keys)
+	}
+
+	ts.Advance(time.Second)
+	ts.OK(ts.ApplyLifecycle())
+	if keys := ts.objectKeys(svc); strings.Join(keys, ",") != "keep,logs/small" {
+		t.Fatal("unexpected objects", keys)
+	}
+
+	// Disabled rules are not applied:
+	ts.putString(svc, "logs/large", "hello world")
+	ts.OK(ts.putLifecycle(svc, s3types.LifecycleRule{
+		Status:     s3types.ExpirationStatusDisabled,
+		Filter:     &s3types.LifecycleRuleFilter{Prefix: aws.String("")},
+		Expiration: &s3types.LifecycleExpiration{Days: aws.Int32(1)},
+	}))
+	ts.Advance(30 * 24 * time.Hour)
+	ts.OK(ts.ApplyLifecycle())
+	if keys := ts.objectKeys(svc); len(keys) != 3 {
+		t.Fatal("unexpected objects", keys)
+	}
+}
+
+func TestLifecycleExpirationTags(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	for _, object := range []string{"tagged", "untagged"} {
+		in := &s3.PutObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String(object),
+			Body:   strings.NewReader("hello"),
+		}
+		if object == "tagged" {
+			in.Tagging = aws.String("temporary=true")
+		}
+		_, err := svc.PutObject(context.TODO(), in)
+		ts.OK(err)
+	}
+
+	ts.OK(ts.putLifecycle(svc, s3types.LifecycleRule{
+		Status:     s3types.ExpirationStatusEnabled,
+		Filter:     &s3types.LifecycleRuleFilter{Tag: &s3types.Tag{Key: aws.String("temporary"), Value: aws.String("true")}},
+		Expiration: &s3types.LifecycleExpiration{Date: aws.Time(time.Date(2018, 2, 1, 0, 0, 0, 0, time.UTC))},
+	}))
+
+	ts.Advance(31 * 24 * time.Hour)
+	ts.OK(ts.ApplyLifecycle())
+	if keys := ts.objectKeys(svc); strings.Join(keys, ",") != "untagged" {
+		t.Fatal("unexpected objects", keys)
+	}
+}
+
+func TestLifecycleTransition(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.putStorageClassObject(svc, "object", "")
+	ts.OK(ts.putLifecycle(svc, s3types.LifecycleRule{
+		Status: s3types.ExpirationStatusEnabled,
+		Filter: &s3types.LifecycleRuleFilter{Prefix: aws.String("")},
+		Transitions: []s3types.Transition{
+			{Days: aws.Int32(30), StorageClass: s3types.TransitionStorageClassStandardIa},
+			{Days: aws.Int32(90), StorageClass: s3types.TransitionStorageClassGlacier},
+		},
+	}))
+
+	storageClass := func() s3types.StorageClass {
+		t.Helper()
+		head, err := svc.HeadObject(context.TODO(), &s3.HeadObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("object"),
+		})
+		ts.OK(err)
+		return head.StorageClass
+	}
+
+	ts.Advance(31 * 24 * time.Hour)
+	ts.OK(ts.ApplyLifecycle())
+	if sc := storageClass(); sc != s3types.StorageClassStandardIa {
+		t.Fatal("unexpected storage class", sc)
+	}
+	ts.OK(ts.getObjectError(svc, "object"))
+
+	ts.Advance(60 * 24 * time.Hour)
+	ts.OK(ts.ApplyLifecycle())
+	if sc := storageClass(); sc != s3types.StorageClassGlacier {
+		t.Fatal("unexpected storage class", sc)
+	}
+	if err := ts.getObjectError(svc, "object"); !hasErrorCode(err, gofakes3.ErrInvalidObjectState) {
+		t.Fatal("expected InvalidObjectState, found", err)
+	}
+}
+
+func TestLifecycleNoncurrentVersions(t *testing.T) {
+	ts := newTestServer(t, withVersioning())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	for i := 0; i < 3; i++ {
+		ts.putStorageClassObject(svc, "object", "")
+		ts.Advance(24 * time.Hour)
+	}
+
+	ts.OK(ts.putLifecycle(svc, s3types.LifecycleRule{
+		Status: s3types.ExpirationStatusEnabled,
+		Filter: &s3types.LifecycleRuleFilter{Prefix: aws.String("")},
+		NoncurrentVersionExpiration: &s3types.NoncurrentVersionExpiration{
+			NoncurrentDays:          aws.Int32(1),
+			NewerNoncurrentVersions: aws.Int32(1),
+		},
+	}))
+
+	versions := func() []s3types.ObjectVersion {
+		t.Helper()
+		out, err := svc.ListObjectVersions(context.TODO(), &s3.ListObjectVersionsInput{
+			Bucket: aws.String(defaultBucket),
+		})
+		ts.OK(err)
+		return out.Versions
+	}
+
+	// The oldest version has been noncurrent for more than a day:
+	ts.OK(ts.ApplyLifecycle())
+	if v := versions(); len(v) != 2 {
+		t.Fatal("unexpected versions", len(v))
+	}
+
+	// The most recent noncurrent version is always kept:
+	ts.Advance(30 * 24 * time.Hour)
+	ts.OK(ts.ApplyLifecycle())
+	if v := versions(); len(v) != 2 {
+		t.Fatal("unexpected versions", len(v))
+	}
+}
+
+func TestLifecycleExpiredObjectDeleteMarker(t *testing.T) {
+	ts := newTestServer(t, withVersioning())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.putStorageClassObject(svc, "object", "")
+	_, err := svc.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+
+	ts.OK(ts.putLifecycle(svc,
+		s3types.LifecycleRule{
+			ID:     aws.String("noncurrent"),
+			Status: s3types.ExpirationStatusEnabled,
+			Filter: &s3types.LifecycleRuleFilter{Prefix: aws.String("")},
+			NoncurrentVersionExpiration: &s3types.NoncurrentVersionExpiration{
+				NoncurrentDays: aws.Int32(1),
+			},
+		},
+		s3types.LifecycleRule{
+			ID:         aws.String("markers"),
+			Status:     s3types.ExpirationStatusEnabled,
+			Filter:     &s3types.LifecycleRuleFilter{Prefix: aws.String("")},
+			Expiration: &s3types.LifecycleExpiration{ExpiredObjectDeleteMarker: aws.Bool(true)},
+		},
+	))
+
+	ts.OK(ts.ApplyLifecycle())
+	out, err := svc.ListObjectVersions(context.TODO(), &s3.ListObjectVersionsInput{
+		Bucket: aws.String(defaultBucket),
+	})
+	ts.OK(err)
+	if len(out.Versions) != 1 || len(out.DeleteMarkers) != 1 {
+		t.Fatal("unexpected versions", len(out.Versions), len(out.DeleteMarkers))
+	}
+
+	// Both the noncurrent version and the delete marker left behind by it
+	// are removed in the same sweep:
+	ts.Advance(2 * 24 * time.Hour)
+	ts.OK(ts.ApplyLifecycle())
+	out, err = svc.ListObjectVersions(context.TODO(), &s3.ListObjectVersionsInput{
+		Bucket: aws.String(defaultBucket),
+	})
+	ts.OK(err)
+	if len(out.Versions) != 0 || len(out.DeleteMarkers) != 0 {
+		t.Fatal("unexpected versions", len(out.Versions), len(out.DeleteMarkers))
+	}
+}
+
+func TestLifecycleAbortIncompleteMultipartUpload(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	for _, object := range []string{"uploads/object", "object"} {
+		_, err := svc.CreateMultipartUpload(context.TODO(), &s3.CreateMultipartUploadInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String(object),
+		})
+		ts.OK(err)
+	}
+
+	ts.OK(ts.putLifecycle(svc, s3types.LifecycleRule{
+		Status: s3types.ExpirationStatusEnabled,
+		Filter: &s3types.LifecycleRuleFilter{Prefix: aws.String("uploads/")},
+		AbortIncompleteMultipartUpload: &s3types.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int32(7),
+		},
+	}))
+
+	ts.Advance(8 * 24 * time.Hour)
+	ts.OK(ts.ApplyLifecycle())
+
+	uploads, err := svc.ListMultipartUploads(context.TODO(), &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(defaultBucket),
+	})
+	ts.OK(err)
+	if len(uploads.Uploads) != 1 || aws.ToString(uploads.Uploads[0].Key) != "object" {
+		t.Fatal("unexpected uploads", uploads.Uploads)
+	}
+}
@@ -50,6 +50,7 @@ type CommonPrefix struct {
 type CompletedPart struct {
 	PartNumber int    `xml:"PartNumber"`
 	ETag       string `xml:"ETag"`
+	Checksums
 }
 
 type CompleteMultipartUploadRequest struct {
@@ -74,6 +75,18 @@ type CompleteMultipartUploadResult struct {
 	Bucket   string `xml:"Bucket"`
 	Key      string `xml:"Key"`
 	ETag     string `xml:"ETag"`
+	Checksums
+	ChecksumType ChecksumType `xml:"ChecksumType,omitempty"`
+}
+
+// PostResponse is returned by a browser upload if the form's
+// success_action_status field is 201.
+type PostResponse struct {
+	XMLName  xml.Name `xml:"PostResponse"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
 }
 
 type Content struct {
@@ -137,6 +150,7 @@ func (d MultiDeleteResult) AsError() error {
 type ErrorResult struct {
 	XMLName   xml.Name  `xml:"Error"`
 	Key       string    `xml:"Key,omitempty"`
+	VersionID string    `xml:"VersionId,omitempty"`
 	Code      ErrorCode `xml:"Code,omitempty"`
 	Message   string    `xml:"Message,omitempty"`
 	Resource  string    `xml:"Resource,omitempty"`
@@ -272,7 +286,6 @@ type Version struct {
 	LastModified ContentTime `xml:"LastModified,omitempty"`
 	Size         int64       `xml:"Size"`
 
-	// According to the S3 docs, this is always STANDARD for a Version:
 	StorageClass StorageClass `xml:"StorageClass"`
 
 	ETag  string    `xml:"ETag"`
@@ -428,6 +441,7 @@ type ListMultipartUploadPartItem struct {
 	LastModified ContentTime `xml:"LastModified,omitempty"`
 	ETag         string      `xml:"ETag,omitempty"`
 	Size         int64       `xml:"Size"`
+	Checksums
 }
 
 // CopyObjectResult contains the response from a CopyObject operation.
@@ -435,6 +449,18 @@ type CopyObjectResult struct {
 	XMLName      xml.Name    `xml:"CopyObjectResult"`
 	ETag         string      `xml:"ETag,omitempty"`
 	LastModified ContentTime `xml:"LastModified,omitempty"`
+
+	// If versioning is enabled on the destination bucket, this should be set
+	// to the version ID of the copy. If versioning is not enabled, this
+	// should be empty.
+	VersionID VersionID `xml:"-"`
+}
+
+// CopyPartResult contains the response from an UploadPartCopy operation.
+type CopyPartResult struct {
+	XMLName      xml.Name    `xml:"CopyPartResult"`
+	ETag         string      `xml:"ETag,omitempty"`
+	LastModified ContentTime `xml:"LastModified,omitempty"`
 }
 
 // MFADeleteStatus is used by VersioningConfiguration.
@@ -470,6 +496,37 @@ type ObjectID struct {
 
 	// Versions not supported in GoFakeS3 yet.
 	VersionID string `xml:"VersionId,omitempty" json:"VersionId,omitempty"`
+
+	// Set in a DeleteObjects response if deleting the object created a
+	// delete marker, or deleted the delete marker VersionID names.
+	DeleteMarker          bool   `xml:"DeleteMarker,omitempty" json:"DeleteMarker,omitempty"`
+	DeleteMarkerVersionID string `xml:"DeleteMarkerVersionId,omitempty" json:"DeleteMarkerVersionId,omitempty"`
+
+	// The conditions an object of a DeleteObjects request must match to be
+	// deleted. They are never set in a DeleteObjects response.
+	ETag             string `xml:"ETag,omitempty" json:"ETag,omitempty"`
+	LastModifiedTime string `xml:"LastModifiedTime,omitempty" json:"LastModifiedTime,omitempty"`
+	Size             *int64 `xml:"Size,omitempty" json:"Size,omitempty"`
+}
+
+// deleteConditions returns the conditions of an object of a DeleteObjects
+// request, or nil if it has none.
+func (o ObjectID) deleteConditions() (*DeleteConditions, error) {
+	if o.ETag == "" && o.LastModifiedTime == "" && o.Size == nil {
+		return nil, nil
+	}
+	conditions := &DeleteConditions{IfMatchSize: o.Size}
+	if o.ETag != "" {
+		conditions.IfMatch = &o.ETag
+	}
+	if o.LastModifiedTime != "" {
+		lastModified, err := parseConditionTime(o.LastModifiedTime)
+		if err != nil {
+			return nil, ErrorInvalidArgument("LastModifiedTime", o.LastModifiedTime, "Invalid date format.")
+		}
+		conditions.IfMatchLastModifiedTime = &lastModified
+	}
+	return conditions, nil
 }
 
 type StorageClass string
@@ -482,7 +539,14 @@ func (s StorageClass) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 }
 
 const (
-	StorageStandard StorageClass = "STANDARD"
+	StorageStandard           StorageClass = "STANDARD"
+	StorageReducedRedundancy  StorageClass = "REDUCED_REDUNDANCY"
+	StorageStandardIA         StorageClass = "STANDARD_IA"
+	StorageOnezoneIA          StorageClass = "ONEZONE_IA"
+	StorageIntelligentTiering StorageClass = "INTELLIGENT_TIERING"
+	StorageGlacierIR          StorageClass = "GLACIER_IR"
+	StorageGlacier            StorageClass = "GLACIER"
+	StorageDeepArchive        StorageClass = "DEEP_ARCHIVE"
 )
 
 // UploadID uses a string as the underlying type, but the string should only
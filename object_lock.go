@@ -0,0 +1,310 @@
+package gofakes3
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Object Lock, as described here:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/object-lock.html
+//
+// The retention and legal hold of an object version are kept in its metadata,
+// under the same keys as the headers that set them when the object is created
+// and that return them from GetObject and HeadObject. Object Lock requires
+// versioning, so it is only available with a VersionedBackend.
+const (
+	objectLockModeMetadataKey            = "X-Amz-Object-Lock-Mode"
+	objectLockRetainUntilDateMetadataKey = "X-Amz-Object-Lock-Retain-Until-Date"
+	objectLockLegalHoldMetadataKey       = "X-Amz-Object-Lock-Legal-Hold"
+
+	// The header that lets a request shorten or remove GOVERNANCE retention,
+	// or delete an object version under it, if the requester is allowed
+	// s3:BypassGovernanceRetention.
+	bypassGovernanceRetentionHeader = "X-Amz-Bypass-Governance-Retention"
+
+	objectLockDateFormat = "2006-01-02T15:04:05.000Z"
+)
+
+type ObjectLockMode string
+
+const (
+	ObjectLockGovernance ObjectLockMode = "GOVERNANCE"
+	ObjectLockCompliance ObjectLockMode = "COMPLIANCE"
+)
+
+func (m ObjectLockMode) valid() bool {
+	return m == ObjectLockGovernance || m == ObjectLockCompliance
+}
+
+type ObjectLockLegalHoldStatus string
+
+const (
+	ObjectLockLegalHoldOn  ObjectLockLegalHoldStatus = "ON"
+	ObjectLockLegalHoldOff ObjectLockLegalHoldStatus = "OFF"
+)
+
+func (s ObjectLockLegalHoldStatus) valid() bool {
+	return s == ObjectLockLegalHoldOn || s == ObjectLockLegalHoldOff
+}
+
+// ObjectLockConfiguration is the Object Lock configuration of a bucket, set
+// when the bucket is created with x-amz-bucket-object-lock-enabled, or with
+// PutObjectLockConfiguration.
+type ObjectLockConfiguration struct {
+	XMLName           xml.Name        `xml:"ObjectLockConfiguration"`
+	Xmlns             string          `xml:"xmlns,attr,omitempty"`
+	ObjectLockEnabled string          `xml:"ObjectLockEnabled,omitempty"`
+	Rule              *ObjectLockRule `xml:"Rule,omitempty"`
+}
+
+type ObjectLockRule struct {
+	DefaultRetention DefaultRetention `xml:"DefaultRetention"`
+}
+
+// DefaultRetention is the retention of new objects in a bucket that are
+// created without any. Only one of Days and Years may be set.
+type DefaultRetention struct {
+	Mode  ObjectLockMode `xml:"Mode"`
+	Days  int            `xml:"Days,omitempty"`
+	Years int            `xml:"Years,omitempty"`
+}
+
+// retention returns the retention of an object created at now.
+func (d DefaultRetention) retention(now time.Time) ObjectLockRetention {
+	return ObjectLockRetention{
+		Mode:            d.Mode,
+		RetainUntilDate: NewContentTime(now.AddDate(d.Years, 0, d.Days)),
+	}
+}
+
+// ObjectLockRetention is the retention of an object version, set with
+// PutObjectRetention.
+type ObjectLockRetention struct {
+	XMLName         xml.Name       `xml:"Retention"`
+	Xmlns           string         `xml:"xmlns,attr,omitempty"`
+	Mode            ObjectLockMode `xml:"Mode,omitempty"`
+	RetainUntilDate ContentTime    `xml:"RetainUntilDate,omitempty"`
+}
+
+// ObjectLockLegalHold is the legal hold of an object version, set with
+// PutObjectLegalHold.
+type ObjectLockLegalHold struct {
+	XMLName xml.Name                  `xml:"LegalHold"`
+	Xmlns   string                    `xml:"xmlns,attr,omitempty"`
+	Status  ObjectLockLegalHoldStatus `xml:"Status"`
+}
+
+// isObjectLockMetadata reports whether the metadata key holds the retention
+// or legal hold of an object.
+func isObjectLockMetadata(key string) bool {
+	return strings.HasPrefix(key, "X-Amz-Object-Lock-")
+}
+
+// objectRetention returns the retention of an object version, from its
+// metadata. The Mode is empty if the version has none.
+func objectRetention(meta map[string]string) ObjectLockRetention {
+	until, _ := time.Parse(time.RFC3339, meta[objectLockRetainUntilDateMetadataKey])
+	return ObjectLockRetention{
+		Mode:            ObjectLockMode(meta[objectLockModeMetadataKey]),
+		RetainUntilDate: NewContentTime(until),
+	}
+}
+
+// metadata returns the metadata keys that record the retention, with empty
+// values if there is none.
+func (r ObjectLockRetention) metadata() map[string]string {
+	if r.Mode == "" {
+		return map[string]string{objectLockModeMetadataKey: "", objectLockRetainUntilDateMetadataKey: ""}
+	}
+	return map[string]string{
+		objectLockModeMetadataKey:            string(r.Mode),
+		objectLockRetainUntilDateMetadataKey: r.RetainUntilDate.UTC().Format(objectLockDateFormat),
+	}
+}
+
+// activeAt reports whether the retention prevents the object version from
+// being deleted at now.
+func (r ObjectLockRetention) activeAt(now time.Time) bool {
+	return r.Mode != "" && now.Before(r.RetainUntilDate.Time)
+}
+
+// objectLocked reports whether an object version, with the given metadata, is
+// under a legal hold or retention at now.
+func objectLocked(meta map[string]string, now time.Time) bool {
+	return meta[objectLockLegalHoldMetadataKey] == string(ObjectLockLegalHoldOn) || objectRetention(meta).activeAt(now)
+}
+
+// validateRetention checks a retention sent by a request. A retention without
+// a mode and a date removes the retention of an object.
+func validateRetention(r ObjectLockRetention, now time.Time) error {
+	if r.Mode == "" && r.RetainUntilDate.IsZero() {
+		return nil
+	}
+	if r.Mode == "" || r.RetainUntilDate.IsZero() {
+		return ErrorMessage(ErrInvalidArgument, "x-amz-object-lock-retain-until-date and x-amz-object-lock-mode must both be supplied")
+	}
+	if !r.Mode.valid() {
+		return ErrorInvalidArgument("x-amz-object-lock-mode", string(r.Mode), "Unknown wormMode directive.")
+	}
+	if !r.RetainUntilDate.After(now) {
+		return ErrorMessage(ErrInvalidArgument, "The retain until date must be in the future!")
+	}
+	return nil
+}
+
+// validateObjectLockConfiguration checks the configuration sent with
+// PutObjectLockConfiguration.
+func validateObjectLockConfiguration(config *ObjectLockConfiguration) error {
+	if config.ObjectLockEnabled != "Enabled" {
+		return ErrorMessage(ErrMalformedXML, ErrMalformedXML.Message())
+	}
+	if config.Rule == nil {
+		return nil
+	}
+
+	def := config.Rule.DefaultRetention
+	if !def.Mode.valid() {
+		return ErrorMessage(ErrMalformedXML, ErrMalformedXML.Message())
+	}
+	if (def.Days == 0) == (def.Years == 0) {
+		return ErrorMessage(ErrMalformedXML, ErrMalformedXML.Message())
+	}
+	if def.Days < 0 || def.Years < 0 {
+		return ErrorMessage(ErrInvalidArgument, "Default retention period must be a positive integer value.")
+	}
+	return nil
+}
+
+// bucketObjectLock returns the Object Lock configuration of a bucket, or nil
+// if Object Lock is not enabled for it.
+func (g *GoFakeS3) bucketObjectLock(bucket string) (*ObjectLockConfiguration, error) {
+	config, err := g.objectLocks.ObjectLockConfiguration(bucket)
+	if HasErrorCode(err, ErrObjectLockConfigurationNotFound) {
+		return nil, nil
+	}
+	return config, err
+}
+
+// applyObjectLock checks the Object Lock headers of a request that creates an
+// object, and replaces them in meta with the retention and legal hold the
+// object is created with, which include the default retention of the bucket
+// if the request does not set any.
+func (g *GoFakeS3) applyObjectLock(bucket string, meta map[string]string) error {
+	var (
+		mode  = meta[objectLockModeMetadataKey]
+		until = meta[objectLockRetainUntilDateMetadataKey]
+		hold  = meta[objectLockLegalHoldMetadataKey]
+	)
+	for k := range meta {
+		if isObjectLockMetadata(k) {
+			delete(meta, k)
+		}
+	}
+
+	config, err := g.bucketObjectLock(bucket)
+	if err != nil {
+		return err
+	} else if config == nil {
+		if mode != "" || until != "" || hold != "" {
+			return ErrorMessage(ErrInvalidRequest, "Bucket is missing Object Lock Configuration")
+		}
+		return nil
+	}
+
+	now := g.timeSource.Now()
+	retention := ObjectLockRetention{Mode: ObjectLockMode(mode)}
+	if until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return ErrorInvalidArgument("x-amz-object-lock-retain-until-date", until, "The retain until date is not a valid ISO 8601 date.")
+		}
+		retention.RetainUntilDate = NewContentTime(t)
+	}
+	if err := validateRetention(retention, now); err != nil {
+		return err
+	}
+	if retention.Mode == "" && config.Rule != nil {
+		retention = config.Rule.DefaultRetention.retention(now)
+	}
+	for k, v := range retention.metadata() {
+		if v != "" {
+			meta[k] = v
+		}
+	}
+
+	if hold != "" {
+		if !ObjectLockLegalHoldStatus(hold).valid() {
+			return ErrorInvalidArgument("x-amz-object-lock-legal-hold", hold, "Legal Hold must be either of 'ON' or 'OFF'")
+		}
+		meta[objectLockLegalHoldMetadataKey] = hold
+	}
+	return nil
+}
+
+// canBypassGovernance reports whether the request asks to bypass GOVERNANCE
+// retention, and is allowed to.
+func (g *GoFakeS3) canBypassGovernance(r *http.Request, bucket, object string) bool {
+	if bypass, _ := strconv.ParseBool(r.Header.Get(bypassGovernanceRetentionHeader)); !bypass {
+		return false
+	}
+	return g.authorize(r, "s3:BypassGovernanceRetention", bucket, object) == nil
+}
+
+// checkObjectLock fails with ErrAccessDenied if the object version may not be
+// deleted, because it is under a legal hold, or under retention that the
+// request may not bypass.
+func (g *GoFakeS3) checkObjectLock(r *http.Request, bucket string, obj *Object) error {
+	if obj.IsDeleteMarker {
+		return nil
+	}
+
+	locked := obj.Metadata[objectLockLegalHoldMetadataKey] == string(ObjectLockLegalHoldOn)
+	if retention := objectRetention(obj.Metadata); retention.activeAt(g.timeSource.Now()) {
+		locked = locked || retention.Mode == ObjectLockCompliance || !g.canBypassGovernance(r, bucket, obj.Name)
+	}
+	if locked {
+		return ErrorMessage(ErrAccessDenied, "Access Denied because object protected by object lock.")
+	}
+	return nil
+}
+
+// checkRetentionChange fails with ErrAccessDenied if the retention of an
+// object version may not be replaced, because the new retention would end
+// sooner or in a different mode, which COMPLIANCE retention never allows, and
+// GOVERNANCE retention only allows requests that may bypass it.
+func (g *GoFakeS3) checkRetentionChange(r *http.Request, bucket string, obj *Object, to ObjectLockRetention) error {
+	from := objectRetention(obj.Metadata)
+	if !from.activeAt(g.timeSource.Now()) {
+		return nil
+	}
+	if to.Mode == from.Mode && !to.RetainUntilDate.Before(from.RetainUntilDate.Time) {
+		return nil
+	}
+	if from.Mode == ObjectLockGovernance && g.canBypassGovernance(r, bucket, obj.Name) {
+		return nil
+	}
+	return ErrorMessage(ErrAccessDenied, ErrAccessDenied.Message())
+}
+
+var _ BucketObjectLockBackend = &bucketObjectLocks{}
+
+// bucketObjectLocks stores the Object Lock configuration of buckets in memory
+// for backends that do not implement BucketObjectLockBackend.
+type bucketObjectLocks struct {
+	*bucketConfigs[*ObjectLockConfiguration]
+}
+
+func newBucketObjectLocks(storage Backend) *bucketObjectLocks {
+	return &bucketObjectLocks{newBucketConfigs[*ObjectLockConfiguration](storage, ErrObjectLockConfigurationNotFound)}
+}
+
+func (bl *bucketObjectLocks) ObjectLockConfiguration(bucket string) (*ObjectLockConfiguration, error) {
+	return bl.get(bucket)
+}
+
+func (bl *bucketObjectLocks) PutObjectLockConfiguration(bucket string, config *ObjectLockConfiguration) error {
+	return bl.put(bucket, config)
+}
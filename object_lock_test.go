@@ -0,0 +1,333 @@
+package gofakes3_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/johannesboyne/gofakes3"
+)
+
+const lockedBucket = "locked"
+
+func (ts *testServer) createLockedBucket(svc *s3.Client) {
+	ts.Helper()
+	_, err := svc.CreateBucket(context.TODO(), &s3.CreateBucketInput{
+		Bucket:                     aws.String(lockedBucket),
+		ObjectLockEnabledForBucket: aws.Bool(true),
+	})
+	ts.OK(err)
+}
+
+func (ts *testServer) putLockedObject(svc *s3.Client, object string, mode s3types.ObjectLockMode, until time.Time) string {
+	ts.Helper()
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(lockedBucket),
+		Key:    aws.String(object),
+		Body:   strings.NewReader("hello"),
+	}
+	if mode != "" {
+		input.ObjectLockMode = mode
+		input.ObjectLockRetainUntilDate = aws.Time(until)
+	}
+	out, err := svc.PutObject(context.TODO(), input)
+	ts.OK(err)
+	return aws.ToString(out.VersionId)
+}
+
+func (ts *testServer) deleteVersion(svc *s3.Client, object, versionID string, bypass bool) error {
+	ts.Helper()
+	input := &s3.DeleteObjectInput{
+		Bucket:    aws.String(lockedBucket),
+		Key:       aws.String(object),
+		VersionId: aws.String(versionID),
+	}
+	if bypass {
+		input.BypassGovernanceRetention = aws.Bool(true)
+	}
+	_, err := svc.DeleteObject(context.TODO(), input)
+	return err
+}
+
+func (ts *testServer) putRetention(svc *s3.Client, object, versionID string, mode s3types.ObjectLockRetentionMode, until time.Time, bypass bool) error {
+	ts.Helper()
+	input := &s3.PutObjectRetentionInput{
+		Bucket:    aws.String(lockedBucket),
+		Key:       aws.String(object),
+		VersionId: aws.String(versionID),
+		Retention: &s3types.ObjectLockRetention{
+			Mode:            mode,
+			RetainUntilDate: aws.Time(until),
+		},
+	}
+	if bypass {
+		input.BypassGovernanceRetention = aws.Bool(true)
+	}
+	_, err := svc.PutObjectRetention(context.TODO(), input)
+	return err
+}
+
+func TestObjectLockBucket(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.createLockedBucket(svc)
+
+	versioning, err := svc.GetBucketVersioning(context.TODO(), &s3.GetBucketVersioningInput{
+		Bucket: aws.String(lockedBucket),
+	})
+	ts.OK(err)
+	if versioning.Status != s3types.BucketVersioningStatusEnabled {
+		t.Fatal("versioning was not enabled", versioning.Status)
+	}
+
+	config, err := svc.GetObjectLockConfiguration(context.TODO(), &s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(lockedBucket),
+	})
+	ts.OK(err)
+	if config.ObjectLockConfiguration.ObjectLockEnabled != s3types.ObjectLockEnabledEnabled {
+		t.Fatal("Object Lock was not enabled", config.ObjectLockConfiguration.ObjectLockEnabled)
+	}
+
+	_, err = svc.PutBucketVersioning(context.TODO(), &s3.PutBucketVersioningInput{
+		Bucket: aws.String(lockedBucket),
+		VersioningConfiguration: &s3types.VersioningConfiguration{
+			Status: s3types.BucketVersioningStatusSuspended,
+		},
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidBucketState) {
+		t.Fatal("expected InvalidBucketState, found", err)
+	}
+
+	_, err = svc.GetObjectLockConfiguration(context.TODO(), &s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(defaultBucket),
+	})
+	if !hasErrorCode(err, gofakes3.ErrObjectLockConfigurationNotFound) {
+		t.Fatal("expected ObjectLockConfigurationNotFoundError, found", err)
+	}
+
+	_, err = svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:                    aws.String(defaultBucket),
+		Key:                       aws.String("object"),
+		Body:                      strings.NewReader("hello"),
+		ObjectLockMode:            s3types.ObjectLockModeGovernance,
+		ObjectLockRetainUntilDate: aws.Time(defaultDate.AddDate(0, 0, 1)),
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+		t.Fatal("expected InvalidRequest, found", err)
+	}
+}
+
+func TestObjectLockCompliance(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.createLockedBucket(svc)
+
+	until := defaultDate.Add(24 * time.Hour)
+	version := ts.putLockedObject(svc, "object", s3types.ObjectLockModeCompliance, until)
+
+	head, err := svc.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(lockedBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+	if head.ObjectLockMode != s3types.ObjectLockModeCompliance || !aws.ToTime(head.ObjectLockRetainUntilDate).Equal(until) {
+		t.Fatal("unexpected lock", head.ObjectLockMode, aws.ToTime(head.ObjectLockRetainUntilDate))
+	}
+
+	retention, err := svc.GetObjectRetention(context.TODO(), &s3.GetObjectRetentionInput{
+		Bucket:    aws.String(lockedBucket),
+		Key:       aws.String("object"),
+		VersionId: aws.String(version),
+	})
+	ts.OK(err)
+	if retention.Retention.Mode != s3types.ObjectLockRetentionModeCompliance || !aws.ToTime(retention.Retention.RetainUntilDate).Equal(until) {
+		t.Fatal("unexpected retention", retention.Retention)
+	}
+
+	// Not even a request that bypasses governance can delete the version or
+	// shorten its retention:
+	for _, bypass := range []bool{false, true} {
+		if err := ts.deleteVersion(svc, "object", version, bypass); !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+			t.Fatal("expected AccessDenied, found", err)
+		}
+		err := ts.putRetention(svc, "object", version, s3types.ObjectLockRetentionModeCompliance, until.Add(-time.Hour), bypass)
+		if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+			t.Fatal("expected AccessDenied, found", err)
+		}
+		err = ts.putRetention(svc, "object", version, s3types.ObjectLockRetentionModeGovernance, until, bypass)
+		if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+			t.Fatal("expected AccessDenied, found", err)
+		}
+	}
+
+	out, err := svc.DeleteObjects(context.TODO(), &s3.DeleteObjectsInput{
+		Bucket: aws.String(lockedBucket),
+		Delete: &s3types.Delete{
+			Objects: []s3types.ObjectIdentifier{{Key: aws.String("object"), VersionId: aws.String(version)}},
+		},
+	})
+	ts.OK(err)
+	if len(out.Deleted) != 0 || len(out.Errors) != 1 ||
+		aws.ToString(out.Errors[0].Code) != string(gofakes3.ErrAccessDenied) ||
+		aws.ToString(out.Errors[0].VersionId) != version {
+		t.Fatal("unexpected result", out.Deleted, out.Errors)
+	}
+
+	// A delete marker can still be placed on top of the version:
+	_, err = svc.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: aws.String(lockedBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+
+	// Retention can be extended:
+	until = until.Add(24 * time.Hour)
+	ts.OK(ts.putRetention(svc, "object", version, s3types.ObjectLockRetentionModeCompliance, until, false))
+
+	ts.Advance(47 * time.Hour)
+	if err := ts.deleteVersion(svc, "object", version, false); !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+	ts.Advance(time.Hour)
+	ts.OK(ts.deleteVersion(svc, "object", version, false))
+}
+
+func TestObjectLockGovernance(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.createLockedBucket(svc)
+
+	until := defaultDate.Add(24 * time.Hour)
+	version := ts.putLockedObject(svc, "object", s3types.ObjectLockModeGovernance, until)
+
+	if err := ts.deleteVersion(svc, "object", version, false); !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+
+	err := ts.putRetention(svc, "object", version, s3types.ObjectLockRetentionModeGovernance, until.Add(-time.Hour), false)
+	if !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+	ts.OK(ts.putRetention(svc, "object", version, s3types.ObjectLockRetentionModeGovernance, until.Add(-time.Hour), true))
+
+	out, err := svc.DeleteObjects(context.TODO(), &s3.DeleteObjectsInput{
+		Bucket:                    aws.String(lockedBucket),
+		BypassGovernanceRetention: aws.Bool(true),
+		Delete: &s3types.Delete{
+			Objects: []s3types.ObjectIdentifier{{Key: aws.String("object"), VersionId: aws.String(version)}},
+		},
+	})
+	ts.OK(err)
+	if len(out.Deleted) != 1 || len(out.Errors) != 0 {
+		t.Fatal("unexpected result", out.Deleted, out.Errors)
+	}
+}
+
+func TestObjectLockLegalHold(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.createLockedBucket(svc)
+
+	version := ts.putLockedObject(svc, "object", "", time.Time{})
+
+	_, err := svc.GetObjectLegalHold(context.TODO(), &s3.GetObjectLegalHoldInput{
+		Bucket: aws.String(lockedBucket),
+		Key:    aws.String("object"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchObjectLockConfiguration) {
+		t.Fatal("expected NoSuchObjectLockConfiguration, found", err)
+	}
+
+	putLegalHold := func(status s3types.ObjectLockLegalHoldStatus) {
+		t.Helper()
+		_, err := svc.PutObjectLegalHold(context.TODO(), &s3.PutObjectLegalHoldInput{
+			Bucket:    aws.String(lockedBucket),
+			Key:       aws.String("object"),
+			VersionId: aws.String(version),
+			LegalHold: &s3types.ObjectLockLegalHold{Status: status},
+		})
+		ts.OK(err)
+	}
+
+	putLegalHold(s3types.ObjectLockLegalHoldStatusOn)
+	hold, err := svc.GetObjectLegalHold(context.TODO(), &s3.GetObjectLegalHoldInput{
+		Bucket: aws.String(lockedBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+	if hold.LegalHold.Status != s3types.ObjectLockLegalHoldStatusOn {
+		t.Fatal("unexpected legal hold", hold.LegalHold.Status)
+	}
+	if err := ts.deleteVersion(svc, "object", version, true); !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+		t.Fatal("expected AccessDenied, found", err)
+	}
+
+	putLegalHold(s3types.ObjectLockLegalHoldStatusOff)
+	ts.OK(ts.deleteVersion(svc, "object", version, false))
+}
+
+func TestObjectLockDefaultRetention(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.createLockedBucket(svc)
+
+	_, err := svc.PutObjectLockConfiguration(context.TODO(), &s3.PutObjectLockConfigurationInput{
+		Bucket: aws.String(lockedBucket),
+		ObjectLockConfiguration: &s3types.ObjectLockConfiguration{
+			ObjectLockEnabled: s3types.ObjectLockEnabledEnabled,
+			Rule: &s3types.ObjectLockRule{
+				DefaultRetention: &s3types.DefaultRetention{
+					Mode: s3types.ObjectLockRetentionModeGovernance,
+					Days: aws.Int32(2),
+				},
+			},
+		},
+	})
+	ts.OK(err)
+
+	version := ts.putLockedObject(svc, "object", "", time.Time{})
+	retention, err := svc.GetObjectRetention(context.TODO(), &s3.GetObjectRetentionInput{
+		Bucket:    aws.String(lockedBucket),
+		Key:       aws.String("object"),
+		VersionId: aws.String(version),
+	})
+	ts.OK(err)
+	if retention.Retention.Mode != s3types.ObjectLockRetentionModeGovernance ||
+		!aws.ToTime(retention.Retention.RetainUntilDate).Equal(defaultDate.AddDate(0, 0, 2)) {
+		t.Fatal("unexpected retention", retention.Retention.Mode, aws.ToTime(retention.Retention.RetainUntilDate))
+	}
+
+	// Retention set by the request takes precedence:
+	until := defaultDate.Add(time.Hour)
+	version = ts.putLockedObject(svc, "other", s3types.ObjectLockModeCompliance, until)
+	retention, err = svc.GetObjectRetention(context.TODO(), &s3.GetObjectRetentionInput{
+		Bucket:    aws.String(lockedBucket),
+		Key:       aws.String("other"),
+		VersionId: aws.String(version),
+	})
+	ts.OK(err)
+	if retention.Retention.Mode != s3types.ObjectLockRetentionModeCompliance || !aws.ToTime(retention.Retention.RetainUntilDate).Equal(until) {
+		t.Fatal("unexpected retention", retention.Retention.Mode, aws.ToTime(retention.Retention.RetainUntilDate))
+	}
+
+	// Object Lock can't be enabled for a bucket without versioning:
+	_, err = svc.PutObjectLockConfiguration(context.TODO(), &s3.PutObjectLockConfigurationInput{
+		Bucket: aws.String(defaultBucket),
+		ObjectLockConfiguration: &s3types.ObjectLockConfiguration{
+			ObjectLockEnabled: s3types.ObjectLockEnabledEnabled,
+		},
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidBucketState) {
+		t.Fatal("expected InvalidBucketState, found", err)
+	}
+}
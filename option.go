@@ -31,8 +31,9 @@ func WithMetadataSizeLimit(size int) Option {
 	return func(g *GoFakeS3) { g.metadataSizeLimit = size }
 }
 
-// WithIntegrityCheck enables or disables Content-MD5 validation when
-// putting an Object.
+// WithIntegrityCheck enables or disables Content-MD5 and x-amz-checksum-*
+// validation when putting an Object. Checksums are still computed and stored
+// with the Object if the check is disabled.
 func WithIntegrityCheck(check bool) Option {
 	return func(g *GoFakeS3) { g.integrityCheck = check }
 }
@@ -102,6 +103,49 @@ func WithAutoBucket(enabled bool) Option {
 	return func(g *GoFakeS3) { g.autoBucket = enabled }
 }
 
+// WithCredentials enables authentication using AWS Signature Version 4. Requests
+// must be signed with a secret access key that the CredentialProvider knows
+// about, otherwise they will fail with ErrSignatureDoesNotMatch or
+// ErrInvalidAccessKeyID. Anonymous requests will fail with ErrAccessDenied.
+//
+// Authentication is disabled by default; GoFakeS3 will accept any
+// Authorization header, or none at all.
+//
+// See gofakes3.StaticCredentials for a simple CredentialProvider.
+func WithCredentials(provider CredentialProvider) Option {
+	return func(g *GoFakeS3) { g.credentials = provider }
+}
+
+// WithAccounts enables authentication like WithCredentials, with each access
+// key belonging to one of the accounts. Accounts own the buckets they create,
+// and are isolated from each other unless a bucket policy or ACL grants
+// access to another account.
+//
+// Buckets that were not created through GoFakeS3, such as those created
+// directly in the Backend, belong to none of the accounts.
+func WithAccounts(accounts ...Account) Option {
+	return WithCredentials(Accounts(accounts))
+}
+
+// WithKMSKeys sets the registry of KMS keys that objects may be encrypted with
+// using SSE-KMS. Requests that refer to any other key fail with
+// ErrKMSNotFound. Requests that don't name a key use the AWS managed key of
+// the account, which is always available.
+//
+// By default, requests may refer to any key.
+func WithKMSKeys(keys ...KMSKey) Option {
+	return func(g *GoFakeS3) { g.kmsKeys = append([]KMSKey{}, keys...) }
+}
+
+// WithRestoreDelay sets how long RestoreObject takes to restore an archived
+// object, measured on the TimeSource. Until then, HeadObject reports the
+// restore as ongoing, and GetObject fails with ErrInvalidObjectState.
+//
+// By default, objects are restored immediately.
+func WithRestoreDelay(delay time.Duration) Option {
+	return func(g *GoFakeS3) { g.restoreDelay = delay }
+}
+
 // WithInsecureCORS responds with * for all Access-Control-Allow headers.
 func WithInsecureCORS() Option {
 	return func(g *GoFakeS3) { g.wrapCORS = wrapInsecureCORS }
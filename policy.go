@@ -0,0 +1,523 @@
+package gofakes3
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bucketPolicy is an IAM-style resource policy attached to a bucket, as
+// described here:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/bucket-policies.html
+//
+//	{ "Version": "2012-10-17",
+//	  "Statement": [{
+//	    "Effect": "Allow",
+//	    "Principal": {"AWS": ["ACCESS_KEY"]},
+//	    "Action": ["s3:GetObject"],
+//	    "Resource": ["arn:aws:s3:::mybucket/public/*"],
+//	    "Condition": {"Bool": {"aws:SecureTransport": "true"}}
+//	  }]
+//	}
+//
+// Principals are matched against the access key ID that signed the request,
+// rather than a user ARN, as GoFakeS3 has no notion of IAM users. Accounts
+// can be named with {"CanonicalUser": ["CANONICAL_USER_ID"]}.
+type bucketPolicy struct {
+	Version   string
+	ID        string `json:"Id"`
+	Statement policyStatements
+}
+
+type policyStatement struct {
+	Sid          string
+	Effect       string
+	Principal    *policyPrincipal
+	NotPrincipal *policyPrincipal
+	Action       policyValues
+	NotAction    policyValues
+	Resource     policyValues
+	NotResource  policyValues
+
+	// Maps a condition operator to the keys it checks, and the values it
+	// checks them against, i.e. {"StringLike": {"s3:prefix": ["home/*"]}}.
+	Condition map[string]map[string]policyValues
+}
+
+const (
+	policyEffectAllow = "Allow"
+	policyEffectDeny  = "Deny"
+)
+
+// policyStatements accepts either a single statement or a list of them, as
+// both are valid in a policy document.
+type policyStatements []policyStatement
+
+func (s *policyStatements) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var one policyStatement
+		if err := json.Unmarshal(data, &one); err != nil {
+			return err
+		}
+		*s = policyStatements{one}
+		return nil
+	}
+	var many []policyStatement
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*s = many
+	return nil
+}
+
+// policyValues accepts either a single value or a list of them. Condition
+// values may also be written as JSON booleans or numbers, which are kept in
+// their string form.
+type policyValues []string
+
+func (v *policyValues) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+	} else {
+		raw = []json.RawMessage{data}
+	}
+
+	values := make(policyValues, 0, len(raw))
+	for _, item := range raw {
+		var str string
+		if err := json.Unmarshal(item, &str); err == nil {
+			values = append(values, str)
+			continue
+		}
+		var scalar interface{}
+		if err := json.Unmarshal(item, &scalar); err != nil {
+			return err
+		}
+		switch scalar.(type) {
+		case bool, float64:
+			values = append(values, string(bytes.TrimSpace(item)))
+		default:
+			return fmt.Errorf("gofakes3: policy value must be a string, got %s", item)
+		}
+	}
+	*v = values
+	return nil
+}
+
+// policyPrincipal is either "*", which matches everyone, or an object such as
+// {"AWS": ["ACCESS_KEY"]}. Only the "AWS" and "CanonicalUser" principal types
+// can match a request; other types are accepted so that policies written for
+// S3 can be stored.
+type policyPrincipal struct {
+	Any   bool
+	AWS   policyValues
+	Other map[string]policyValues
+}
+
+func (p *policyPrincipal) UnmarshalJSON(data []byte) error {
+	var wildcard string
+	if err := json.Unmarshal(data, &wildcard); err == nil {
+		if wildcard != "*" {
+			return fmt.Errorf("gofakes3: invalid principal %q", wildcard)
+		}
+		p.Any = true
+		return nil
+	}
+
+	var typed map[string]policyValues
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return err
+	}
+	for kind, values := range typed {
+		if kind == "AWS" {
+			p.AWS = values
+			continue
+		}
+		if p.Other == nil {
+			p.Other = make(map[string]policyValues)
+		}
+		p.Other[kind] = values
+	}
+	return nil
+}
+
+func (p *policyPrincipal) empty() bool {
+	return !p.Any && len(p.AWS) == 0 && len(p.Other) == 0
+}
+
+// matches reports whether the principal includes the access key ID, or the
+// canonical user ID of its account; anonymous requests are only matched by
+// "*".
+func (p *policyPrincipal) matches(rq *policyRequest) bool {
+	if p.Any {
+		return true
+	}
+	for _, principal := range p.AWS {
+		if principal == "*" || (rq.AccessKeyID != "" && principal == rq.AccessKeyID) {
+			return true
+		}
+	}
+	for _, principal := range p.Other["CanonicalUser"] {
+		if rq.CanonicalUserID != "" && principal == rq.CanonicalUserID {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBucketPolicy decodes and validates a policy for the bucket. Errors are
+// reported as ErrMalformedPolicy, with messages matching those S3 returns
+// where they are known.
+func parseBucketPolicy(bucket string, data []byte) (*bucketPolicy, error) {
+	trimmed := bytes.TrimSpace(data)
+	if !bytes.HasPrefix(trimmed, []byte("{")) {
+		return nil, ErrorMessage(ErrMalformedPolicy, "Policies must be valid JSON and the first byte must be '{'")
+	}
+
+	var policy bucketPolicy
+	if err := json.Unmarshal(trimmed, &policy); err != nil {
+		return nil, ErrorMessagef(ErrMalformedPolicy, "Policies must be valid JSON: %v", err)
+	}
+	if len(policy.Statement) == 0 {
+		return nil, ErrorMessage(ErrMalformedPolicy, "Missing required field Statement")
+	}
+
+	for _, st := range policy.Statement {
+		if err := st.validate(bucket); err != nil {
+			return nil, err
+		}
+	}
+	return &policy, nil
+}
+
+func (st *policyStatement) validate(bucket string) error {
+	if st.Effect != policyEffectAllow && st.Effect != policyEffectDeny {
+		return ErrorMessagef(ErrMalformedPolicy, "Invalid effect: %s", st.Effect)
+	}
+
+	if st.Principal == nil && st.NotPrincipal == nil {
+		return ErrorMessage(ErrMalformedPolicy, "Missing required field Principal")
+	} else if (st.Principal != nil && st.Principal.empty()) || (st.NotPrincipal != nil && st.NotPrincipal.empty()) {
+		return ErrorMessage(ErrMalformedPolicy, "Invalid principal in policy")
+	}
+
+	if len(st.Action) == 0 && len(st.NotAction) == 0 {
+		return ErrorMessage(ErrMalformedPolicy, "Missing required field Action")
+	}
+	for _, actions := range []policyValues{st.Action, st.NotAction} {
+		for _, action := range actions {
+			if action != "*" && !strings.HasPrefix(strings.ToLower(action), "s3:") {
+				return ErrorMessage(ErrMalformedPolicy, "Policy has invalid action")
+			}
+		}
+	}
+
+	if len(st.Resource) == 0 && len(st.NotResource) == 0 {
+		return ErrorMessage(ErrMalformedPolicy, "Missing required field Resource")
+	}
+	for _, resources := range []policyValues{st.Resource, st.NotResource} {
+		for _, resource := range resources {
+			if !policyResourceInBucket(resource, bucket) {
+				return ErrorMessage(ErrMalformedPolicy, "Policy has invalid resource")
+			}
+		}
+	}
+
+	for op, block := range st.Condition {
+		if _, _, ok := parsePolicyConditionOperator(op); !ok {
+			return ErrorMessagef(ErrMalformedPolicy, "Invalid Condition type : %s", op)
+		}
+		for key := range block {
+			if key == "" {
+				return ErrorMessage(ErrMalformedPolicy, "Policy has an invalid condition key")
+			}
+		}
+	}
+
+	return nil
+}
+
+// policyResourceInBucket reports whether the resource ARN refers to the
+// bucket, or to objects inside it. S3 rejects policies that mention other
+// buckets.
+func policyResourceInBucket(resource, bucket string) bool {
+	name, ok := strings.CutPrefix(resource, "arn:aws:s3:::")
+	if !ok {
+		return false
+	}
+	if idx := strings.IndexByte(name, '/'); idx >= 0 {
+		name = name[:idx]
+	}
+	return policyGlobMatch(name, bucket, false)
+}
+
+func policyResourceARN(bucket, object string) string {
+	if object == "" {
+		return "arn:aws:s3:::" + bucket
+	}
+	return "arn:aws:s3:::" + bucket + "/" + object
+}
+
+// policyRequest describes a request in the terms a policy is written in.
+type policyRequest struct {
+	// The access key ID that signed the request, and the canonical user ID of
+	// its account; both are empty if the request is anonymous.
+	AccessKeyID     string
+	CanonicalUserID string
+
+	Action   string // i.e. "s3:GetObject"
+	Resource string // i.e. "arn:aws:s3:::bucket/key"
+
+	// Condition keys, such as "aws:SourceIp", in lower case. Keys that do not
+	// apply to the request are absent.
+	Context map[string]string
+}
+
+type policyDecision int
+
+const (
+	// No statement applied to the request; S3 denies these implicitly.
+	policyImplicitDeny policyDecision = iota
+	policyAllowed
+	policyExplicitDeny
+)
+
+// evaluate follows the IAM evaluation logic: an explicit Deny in any statement
+// wins, otherwise any Allow grants the request, otherwise it is implicitly
+// denied.
+func (p *bucketPolicy) evaluate(rq *policyRequest) policyDecision {
+	decision := policyImplicitDeny
+	for i := range p.Statement {
+		st := &p.Statement[i]
+		if !st.applies(rq) {
+			continue
+		}
+		if st.Effect == policyEffectDeny {
+			return policyExplicitDeny
+		}
+		decision = policyAllowed
+	}
+	return decision
+}
+
+func (st *policyStatement) applies(rq *policyRequest) bool {
+	if st.Principal != nil && !st.Principal.matches(rq) {
+		return false
+	}
+	if st.NotPrincipal != nil && st.NotPrincipal.matches(rq) {
+		return false
+	}
+
+	if len(st.Action) > 0 && !policyAnyMatch(st.Action, rq.Action, true) {
+		return false
+	}
+	if len(st.NotAction) > 0 && policyAnyMatch(st.NotAction, rq.Action, true) {
+		return false
+	}
+
+	if len(st.Resource) > 0 && !policyAnyMatch(st.Resource, rq.Resource, false) {
+		return false
+	}
+	if len(st.NotResource) > 0 && policyAnyMatch(st.NotResource, rq.Resource, false) {
+		return false
+	}
+
+	// All operators in the Condition block, and all keys for each operator,
+	// must be satisfied:
+	for op, block := range st.Condition {
+		for key, values := range block {
+			if !evaluatePolicyCondition(op, key, values, rq.Context) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func policyAnyMatch(patterns []string, value string, foldCase bool) bool {
+	for _, pattern := range patterns {
+		if policyGlobMatch(pattern, value, foldCase) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyGlobMatch matches value against a pattern in which '*' matches any
+// sequence of characters, and '?' matches any single character.
+func policyGlobMatch(pattern, value string, foldCase bool) bool {
+	if foldCase {
+		pattern, value = strings.ToLower(pattern), strings.ToLower(value)
+	}
+
+	// Iterative matching with backtracking to the most recent '*', which
+	// avoids exponential behaviour with patterns like "a*a*a*a*b".
+	var p, v int
+	star, mark := -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, v
+			p++
+		case star >= 0:
+			p = star + 1
+			mark++
+			v = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// policyConditionFunc compares a value from the request context with a value
+// from the policy.
+type policyConditionFunc func(actual, expected string) bool
+
+var policyConditionOperators = map[string]struct {
+	match   policyConditionFunc
+	negated bool
+}{
+	"stringequals":              {policyStringEquals, false},
+	"stringnotequals":           {policyStringEquals, true},
+	"stringequalsignorecase":    {strings.EqualFold, false},
+	"stringnotequalsignorecase": {strings.EqualFold, true},
+	"stringlike":                {policyStringLike, false},
+	"stringnotlike":             {policyStringLike, true},
+	"numericequals":             {policyNumericCompare(func(c int) bool { return c == 0 }), false},
+	"numericnotequals":          {policyNumericCompare(func(c int) bool { return c == 0 }), true},
+	"numericlessthan":           {policyNumericCompare(func(c int) bool { return c < 0 }), false},
+	"numericlessthanequals":     {policyNumericCompare(func(c int) bool { return c <= 0 }), false},
+	"numericgreaterthan":        {policyNumericCompare(func(c int) bool { return c > 0 }), false},
+	"numericgreaterthanequals":  {policyNumericCompare(func(c int) bool { return c >= 0 }), false},
+	"dateequals":                {policyDateCompare(func(c int) bool { return c == 0 }), false},
+	"datenotequals":             {policyDateCompare(func(c int) bool { return c == 0 }), true},
+	"datelessthan":              {policyDateCompare(func(c int) bool { return c < 0 }), false},
+	"datelessthanequals":        {policyDateCompare(func(c int) bool { return c <= 0 }), false},
+	"dategreaterthan":           {policyDateCompare(func(c int) bool { return c > 0 }), false},
+	"dategreaterthanequals":     {policyDateCompare(func(c int) bool { return c >= 0 }), false},
+	"bool":                      {strings.EqualFold, false},
+	"ipaddress":                 {policyIPMatch, false},
+	"notipaddress":              {policyIPMatch, true},
+	"arnequals":                 {policyStringLike, false},
+	"arnlike":                   {policyStringLike, false},
+	"arnnotequals":              {policyStringLike, true},
+	"arnnotlike":                {policyStringLike, true},
+}
+
+// parsePolicyConditionOperator splits a condition operator such as
+// "ForAnyValue:StringLikeIfExists" into its base operator and whether the
+// IfExists suffix is present. All condition keys GoFakeS3 supports are
+// single-valued, so the set operator prefixes make no difference.
+func parsePolicyConditionOperator(op string) (base string, ifExists bool, ok bool) {
+	base = strings.ToLower(op)
+	base = strings.TrimPrefix(base, "foranyvalue:")
+	base = strings.TrimPrefix(base, "forallvalues:")
+	if base == "null" {
+		return base, false, true
+	}
+	base, ifExists = strings.CutSuffix(base, "ifexists")
+	_, ok = policyConditionOperators[base]
+	return base, ifExists, ok
+}
+
+// evaluatePolicyCondition checks a single condition key; the condition is
+// satisfied if the value in the request matches any of the values. If the
+// key is absent from the request, the condition is only satisfied by negated
+// operators, or if the operator has the IfExists suffix.
+func evaluatePolicyCondition(op, key string, values []string, context map[string]string) bool {
+	base, ifExists, ok := parsePolicyConditionOperator(op)
+	if !ok {
+		return false
+	}
+	actual, present := context[strings.ToLower(key)]
+
+	if base == "null" {
+		for _, value := range values {
+			if strings.EqualFold(value, "true") != present {
+				return true
+			}
+		}
+		return false
+	}
+
+	operator := policyConditionOperators[base]
+	if !present {
+		return ifExists || operator.negated
+	}
+
+	for _, expected := range values {
+		if operator.match(actual, expected) {
+			return !operator.negated
+		}
+	}
+	return operator.negated
+}
+
+func policyStringEquals(actual, expected string) bool { return actual == expected }
+
+func policyStringLike(actual, expected string) bool {
+	return policyGlobMatch(expected, actual, false)
+}
+
+func policyNumericCompare(cmp func(c int) bool) policyConditionFunc {
+	return func(actual, expected string) bool {
+		a, err := strconv.ParseFloat(actual, 64)
+		if err != nil {
+			return false
+		}
+		e, err := strconv.ParseFloat(expected, 64)
+		if err != nil {
+			return false
+		}
+		switch {
+		case a < e:
+			return cmp(-1)
+		case a > e:
+			return cmp(1)
+		default:
+			return cmp(0)
+		}
+	}
+}
+
+func policyDateCompare(cmp func(c int) bool) policyConditionFunc {
+	return func(actual, expected string) bool {
+		a, err := time.Parse(time.RFC3339, actual)
+		if err != nil {
+			return false
+		}
+		e, err := time.Parse(time.RFC3339, expected)
+		if err != nil {
+			return false
+		}
+		return cmp(a.Compare(e))
+	}
+}
+
+// policyIPMatch matches an IP address against a CIDR block, or against a
+// single address.
+func policyIPMatch(actual, expected string) bool {
+	ip := net.ParseIP(actual)
+	if ip == nil {
+		return false
+	}
+	if _, block, err := net.ParseCIDR(expected); err == nil {
+		return block.Contains(ip)
+	}
+	other := net.ParseIP(expected)
+	return other != nil && other.Equal(ip)
+}
@@ -0,0 +1,59 @@
+package gofakes3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyGlobMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, value string
+		foldCase       bool
+		match          bool
+	}{
+		{"*", "", false, true},
+		{"*", "anything", false, true},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket/a/b", false, true},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket", false, false},
+		{"arn:aws:s3:::bucket/a?c", "arn:aws:s3:::bucket/abc", false, true},
+		{"arn:aws:s3:::bucket/a?c", "arn:aws:s3:::bucket/ac", false, false},
+		{"a*b*c", "aXXbYYc", false, true},
+		{"a*a*a*a*b", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", false, false},
+		{"s3:Get*", "s3:getobject", true, true},
+		{"s3:Get*", "s3:getobject", false, false},
+	} {
+		assert.Equal(t, tc.match, policyGlobMatch(tc.pattern, tc.value, tc.foldCase), "%q %q", tc.pattern, tc.value)
+	}
+}
+
+func TestPolicyCondition(t *testing.T) {
+	context := map[string]string{
+		"aws:sourceip": "192.168.1.10",
+		"s3:prefix":    "home/user/",
+		"s3:max-keys":  "100",
+	}
+
+	for _, tc := range []struct {
+		op, key string
+		values  []string
+		match   bool
+	}{
+		{"StringEquals", "s3:prefix", []string{"other/", "home/user/"}, true},
+		{"StringNotEquals", "s3:prefix", []string{"home/user/"}, false},
+		{"StringNotEquals", "s3:delimiter", []string{"/"}, true}, // Absent keys satisfy negated operators
+		{"StringLike", "s3:Prefix", []string{"home/*"}, true},
+		{"StringEqualsIgnoreCase", "s3:prefix", []string{"HOME/USER/"}, true},
+		{"ForAnyValue:StringLike", "s3:prefix", []string{"home/*"}, true},
+		{"StringLikeIfExists", "s3:delimiter", []string{"/"}, true},
+		{"NumericLessThanEquals", "s3:max-keys", []string{"100"}, true},
+		{"NumericLessThan", "s3:max-keys", []string{"100"}, false},
+		{"IpAddress", "aws:SourceIp", []string{"192.168.0.0/16"}, true},
+		{"NotIpAddress", "aws:SourceIp", []string{"192.168.1.10"}, false},
+		{"Null", "s3:delimiter", []string{"true"}, true},
+		{"Null", "s3:prefix", []string{"true"}, false},
+		{"Unknown", "s3:prefix", []string{"home/user/"}, false},
+	} {
+		assert.Equal(t, tc.match, evaluatePolicyCondition(tc.op, tc.key, tc.values, context), "%s %s", tc.op, tc.key)
+	}
+}
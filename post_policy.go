@@ -0,0 +1,233 @@
+package gofakes3
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// postPolicy is the policy document that authorises a browser upload, as
+// described here:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-HTTPPOSTConstructPolicy.html
+//
+//	{ "expiration": "2007-12-01T12:00:00.000Z",
+//	  "conditions": [
+//	    {"bucket": "johnsmith"},
+//	    ["starts-with", "$key", "user/eric/"],
+//	    ["content-length-range", 1048576, 10485760]
+//	  ]
+//	}
+type postPolicy struct {
+	Expiration time.Time
+	Conditions []postPolicyCondition
+
+	// Set by a content-length-range condition; MaxSize is -1 if there is no
+	// upper limit.
+	MinSize int64
+	MaxSize int64
+}
+
+type postPolicyCondition struct {
+	Operator string // "eq" or "starts-with"
+
+	// Name of the form field the condition applies to, in lower case and
+	// without the leading '$'.
+	Field string
+	Value string
+}
+
+func (c postPolicyCondition) String() string {
+	return fmt.Sprintf("[%q, %q, %q]", c.Operator, "$"+c.Field, c.Value)
+}
+
+// parsePostPolicy decodes the base64-encoded JSON policy from the 'policy'
+// field of a browser upload form.
+func parsePostPolicy(encoded string) (*postPolicy, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrorMessage(ErrInvalidPolicyDocument, "Invalid Policy: Invalid 'Policy' encoding.")
+	}
+
+	var doc struct {
+		Expiration *string           `json:"expiration"`
+		Conditions []json.RawMessage `json:"conditions"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, ErrorMessage(ErrInvalidPolicyDocument, "Invalid Policy: Invalid JSON.")
+	}
+	if doc.Expiration == nil {
+		return nil, ErrorMessage(ErrInvalidPolicyDocument, "Invalid Policy: Policy missing expiration.")
+	}
+	if doc.Conditions == nil {
+		return nil, ErrorMessage(ErrInvalidPolicyDocument, "Invalid Policy: Policy missing conditions.")
+	}
+
+	policy := &postPolicy{MaxSize: -1}
+	policy.Expiration, err = time.Parse(time.RFC3339, *doc.Expiration)
+	if err != nil {
+		return nil, ErrorMessagef(ErrInvalidPolicyDocument, "Invalid Policy: Invalid 'expiration' value: '%s'", *doc.Expiration)
+	}
+
+	for _, rawCond := range doc.Conditions {
+		if err := policy.parseCondition(rawCond); err != nil {
+			return nil, err
+		}
+	}
+
+	return policy, nil
+}
+
+func (p *postPolicy) parseCondition(raw json.RawMessage) error {
+	// Exact matches can be written as an object, i.e. {"acl": "public-read"}:
+	var exact map[string]string
+	if err := json.Unmarshal(raw, &exact); err == nil {
+		if len(exact) != 1 {
+			return ErrorMessagef(ErrInvalidPolicyDocument, "Invalid Policy: Invalid Simple-Condition: Simple-Conditions must have exactly one property specified.")
+		}
+		for k, v := range exact {
+			p.Conditions = append(p.Conditions, postPolicyCondition{
+				Operator: "eq", Field: strings.ToLower(k), Value: v,
+			})
+		}
+		return nil
+	}
+
+	var parts []json.RawMessage
+	if err := json.Unmarshal(raw, &parts); err != nil || len(parts) != 3 {
+		return ErrorMessagef(ErrInvalidPolicyDocument, "Invalid Policy: Invalid Condition: %s", raw)
+	}
+
+	var op string
+	if err := json.Unmarshal(parts[0], &op); err != nil {
+		return ErrorMessagef(ErrInvalidPolicyDocument, "Invalid Policy: Invalid Condition: %s", raw)
+	}
+	op = strings.ToLower(op)
+
+	switch op {
+	case "content-length-range":
+		var min, max int64
+		if json.Unmarshal(parts[1], &min) != nil || json.Unmarshal(parts[2], &max) != nil || min < 0 || max < min {
+			return ErrorMessagef(ErrInvalidPolicyDocument, "Invalid Policy: Invalid content-length-range Condition: %s", raw)
+		}
+		p.MinSize, p.MaxSize = min, max
+		return nil
+
+	case "eq", "starts-with":
+		var field, value string
+		if json.Unmarshal(parts[1], &field) != nil || json.Unmarshal(parts[2], &value) != nil || !strings.HasPrefix(field, "$") {
+			return ErrorMessagef(ErrInvalidPolicyDocument, "Invalid Policy: Invalid %s Condition: %s", op, raw)
+		}
+		p.Conditions = append(p.Conditions, postPolicyCondition{
+			Operator: op, Field: strings.ToLower(field[1:]), Value: value,
+		})
+		return nil
+
+	default:
+		return ErrorMessagef(ErrInvalidPolicyDocument, "Invalid Policy: Invalid Condition: unknown operation %q", op)
+	}
+}
+
+// check evaluates the policy against the fields of the form, which must have
+// lower case names, and must include the bucket. Each field must be covered
+// by at least one condition, except for the fields that S3 exempts.
+func (p *postPolicy) check(fields map[string]string, at time.Time) error {
+	if !at.Before(p.Expiration) {
+		return ErrorMessage(ErrAccessDenied, "Invalid according to Policy: Policy expired.")
+	}
+
+	covered := make(map[string]bool, len(p.Conditions))
+	for _, cond := range p.Conditions {
+		covered[cond.Field] = true
+
+		value, ok := fields[cond.Field]
+		var matched bool
+		switch cond.Operator {
+		case "eq":
+			matched = ok && value == cond.Value
+		case "starts-with":
+			matched = strings.HasPrefix(value, cond.Value)
+		}
+		if !matched {
+			return ErrorMessagef(ErrAccessDenied, "Invalid according to Policy: Policy Condition failed: %s", cond)
+		}
+	}
+
+	for field := range fields {
+		if covered[field] || postPolicyExemptField(field) {
+			continue
+		}
+		return ErrorMessagef(ErrAccessDenied, "Invalid according to Policy: Extra input fields: %s", field)
+	}
+
+	return nil
+}
+
+// checkSize enforces the content-length-range condition, if any.
+func (p *postPolicy) checkSize(size int64) error {
+	if size < p.MinSize {
+		return ErrorMessage(ErrEntityTooSmall, ErrEntityTooSmall.Message())
+	}
+	if p.MaxSize >= 0 && size > p.MaxSize {
+		return ErrorMessage(ErrEntityTooLarge, ErrEntityTooLarge.Message())
+	}
+	return nil
+}
+
+func postPolicyExemptField(field string) bool {
+	switch field {
+	case "bucket", "file", "policy", "x-amz-signature":
+		return true
+	}
+	return strings.HasPrefix(field, "x-ignore-")
+}
+
+// verifyPostPolicySignature checks the x-amz-signature field of a browser
+// upload form, which signs the base64-encoded policy:
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-authentication-HTTPPOST.html
+func (g *GoFakeS3) verifyPostPolicySignature(fields map[string]string) error {
+	if algorithm := fields["x-amz-algorithm"]; algorithm != signV4Algorithm {
+		return ErrorInvalidArgument("X-Amz-Algorithm", algorithm, `X-Amz-Algorithm only supports "AWS4-HMAC-SHA256"`)
+	}
+
+	accessKeyID, scope, err := parseSignV4Credential(fields["x-amz-credential"],
+		ErrInvalidArgument, "Error parsing the X-Amz-Credential parameter; ")
+	if err != nil {
+		return err
+	}
+
+	signedAt, err := time.Parse(signV4TimeFormat, fields["x-amz-date"])
+	if err != nil || signedAt.Format(signV4ScopeFormat) != scope.Date {
+		return ErrorInvalidArgument("X-Amz-Date", fields["x-amz-date"], "X-Amz-Date must be in the ISO8601 Long Format and match the date in X-Amz-Credential")
+	}
+
+	secret, err := g.credentials.SecretAccessKey(accessKeyID)
+	if HasErrorCode(err, ErrInvalidAccessKeyID) {
+		return invalidAccessKeyID(accessKeyID)
+	} else if err != nil {
+		return err
+	}
+
+	expected := hex.EncodeToString(hmacSHA256(signingKey(secret, scope), fields["policy"]))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(fields["x-amz-signature"]))) {
+		return ErrorMessage(ErrSignatureDoesNotMatch, ErrSignatureDoesNotMatch.Message())
+	}
+	return nil
+}
+
+// postUploadStatus returns the status code for a successful browser upload,
+// as requested by the success_action_status field. S3 ignores invalid values.
+func postUploadStatus(value string) int {
+	status, _ := strconv.Atoi(value)
+	switch status {
+	case http.StatusOK, http.StatusCreated:
+		return status
+	default:
+		return http.StatusNoContent
+	}
+}
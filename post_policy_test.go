@@ -0,0 +1,310 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+)
+
+type postForm struct {
+	fields   [][2]string
+	filename string
+	body     []byte
+}
+
+func newPostForm(key string, body string) *postForm {
+	return &postForm{
+		fields:   [][2]string{{"key", key}},
+		filename: "upload.txt",
+		body:     []byte(body),
+	}
+}
+
+func (f *postForm) set(name, value string) *postForm {
+	f.fields = append(f.fields, [2]string{name, value})
+	return f
+}
+
+// withPolicy adds a policy with the conditions to the form, which expires an
+// hour after defaultDate. If secret is not empty, the policy is signed.
+func (f *postForm) withPolicy(secret string, conditions ...interface{}) *postForm {
+	const date = "20180101"
+	credential := "dummy-access/" + date + "/region/s3/aws4_request"
+	if secret != "" {
+		f.set("x-amz-algorithm", "AWS4-HMAC-SHA256")
+		f.set("x-amz-credential", credential)
+		f.set("x-amz-date", date+"T120000Z")
+		conditions = append(conditions,
+			map[string]string{"x-amz-algorithm": "AWS4-HMAC-SHA256"},
+			map[string]string{"x-amz-credential": credential},
+			map[string]string{"x-amz-date": date + "T120000Z"})
+	}
+
+	doc, err := json.Marshal(map[string]interface{}{
+		"expiration": defaultDate.Add(time.Hour).Format(time.RFC3339),
+		"conditions": conditions,
+	})
+	if err != nil {
+		panic(err)
+	}
+	policy := base64.StdEncoding.EncodeToString(doc)
+	f.set("policy", policy)
+
+	if secret != "" {
+		key := []byte("AWS4" + secret)
+		for _, v := range []string{date, "region", "s3", "aws4_request", policy} {
+			h := hmac.New(sha256.New, key)
+			h.Write([]byte(v))
+			key = h.Sum(nil)
+		}
+		f.set("x-amz-signature", hex.EncodeToString(key))
+	}
+	return f
+}
+
+func (f *postForm) post(ts *testServer, bucket string) *http.Response {
+	ts.Helper()
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	for _, field := range f.fields {
+		ts.OK(w.WriteField(field[0], field[1]))
+	}
+	fw, err := w.CreateFormFile("file", f.filename)
+	ts.OK(err)
+	ts.OKAll(fw.Write(f.body))
+	ts.OK(w.Close())
+
+	rq, err := http.NewRequest("POST", ts.url("/"+bucket), &b)
+	ts.OK(err)
+	rq.Header.Set("Content-Type", w.FormDataContentType())
+
+	client := httpClient()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	rs, err := client.Do(rq)
+	ts.OK(err)
+	return rs
+}
+
+func assertPostFails(ts *testServer, rs *http.Response, code gofakes3.ErrorCode, message string) {
+	ts.Helper()
+	defer rs.Body.Close()
+
+	var errResp gofakes3.ErrorResponse
+	ts.OK(xml.NewDecoder(rs.Body).Decode(&errResp))
+	if rs.StatusCode != code.Status() || errResp.Code != code {
+		ts.Fatal("expected", code, "found", rs.StatusCode, errResp.Code, errResp.Message)
+	}
+	if !strings.Contains(errResp.Message, message) {
+		ts.Fatalf("expected message containing %q, found %q", message, errResp.Message)
+	}
+}
+
+func TestBrowserUploadPolicy(t *testing.T) {
+	conditions := []interface{}{
+		map[string]string{"bucket": defaultBucket},
+		[]interface{}{"starts-with", "$key", "user/"},
+		[]interface{}{"eq", "$Content-Type", "text/plain"},
+		[]interface{}{"content-length-range", 2, 10},
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+
+		rs := newPostForm("user/file", "hello").set("Content-Type", "text/plain").withPolicy("", conditions...).post(ts, defaultBucket)
+		rs.Body.Close()
+		if rs.StatusCode != http.StatusNoContent {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+		ts.assertObject(defaultBucket, "user/file", map[string]string{
+			"Content-Type":  "text/plain",
+			"Last-Modified": "Mon, 01 Jan 2018 12:00:00 GMT",
+		}, "hello")
+	})
+
+	for _, tc := range []struct {
+		name    string
+		form    *postForm
+		code    gofakes3.ErrorCode
+		message string
+	}{
+		{"key", newPostForm("other/file", "hello").set("Content-Type", "text/plain"),
+			gofakes3.ErrAccessDenied, `Policy Condition failed: ["starts-with", "$key", "user/"]`},
+		{"content-type", newPostForm("user/file", "hello").set("Content-Type", "text/html"),
+			gofakes3.ErrAccessDenied, `Policy Condition failed: ["eq", "$content-type", "text/plain"]`},
+		{"missing-field", newPostForm("user/file", "hello"),
+			gofakes3.ErrAccessDenied, `Policy Condition failed`},
+		{"extra-field", newPostForm("user/file", "hello").set("Content-Type", "text/plain").set("acl", "public-read"),
+			gofakes3.ErrAccessDenied, "Extra input fields: acl"},
+		{"too-large", newPostForm("user/file", "hello world").set("Content-Type", "text/plain"),
+			gofakes3.ErrEntityTooLarge, ""},
+		{"too-small", newPostForm("user/file", "h").set("Content-Type", "text/plain"),
+			gofakes3.ErrEntityTooSmall, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			defer ts.Close()
+
+			assertPostFails(ts, tc.form.withPolicy("", conditions...).post(ts, defaultBucket), tc.code, tc.message)
+			if exists, _ := ts.backendObjectExists(defaultBucket, "user/file"); exists {
+				t.Fatal("object should not exist")
+			}
+		})
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+
+		form := newPostForm("user/file", "hello").set("Content-Type", "text/plain").withPolicy("", conditions...)
+		ts.Advance(2 * time.Hour)
+		assertPostFails(ts, form.post(ts, defaultBucket), gofakes3.ErrAccessDenied, "Policy expired.")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+
+		form := newPostForm("user/file", "hello").set("policy", base64.StdEncoding.EncodeToString([]byte(`{"conditions": []}`)))
+		assertPostFails(ts, form.post(ts, defaultBucket), gofakes3.ErrInvalidPolicyDocument, "Policy missing expiration.")
+	})
+}
+
+func TestBrowserUploadSignedPolicy(t *testing.T) {
+	conditions := []interface{}{
+		map[string]string{"bucket": defaultBucket},
+		[]interface{}{"starts-with", "$key", ""},
+	}
+
+	t.Run("signed", func(t *testing.T) {
+		ts := newTestServer(t, withCredentials())
+		defer ts.Close()
+
+		rs := newPostForm("file", "hello").withPolicy("dummy-secret", conditions...).post(ts, defaultBucket)
+		rs.Body.Close()
+		if rs.StatusCode != http.StatusNoContent {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+		ts.assertObject(defaultBucket, "file", nil, "hello")
+	})
+
+	t.Run("wrong-secret", func(t *testing.T) {
+		ts := newTestServer(t, withCredentials())
+		defer ts.Close()
+
+		rs := newPostForm("file", "hello").withPolicy("wrong-secret", conditions...).post(ts, defaultBucket)
+		assertPostFails(ts, rs, gofakes3.ErrSignatureDoesNotMatch, "")
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		ts := newTestServer(t, withCredentials())
+		defer ts.Close()
+
+		rs := newPostForm("file", "hello").withPolicy("", conditions...).post(ts, defaultBucket)
+		assertPostFails(ts, rs, gofakes3.ErrInvalidArgument, "X-Amz-Algorithm")
+	})
+
+	t.Run("no-policy", func(t *testing.T) {
+		ts := newTestServer(t, withCredentials())
+		defer ts.Close()
+
+		rs := newPostForm("file", "hello").post(ts, defaultBucket)
+		assertPostFails(ts, rs, gofakes3.ErrAccessDenied, "")
+	})
+
+	t.Run("no-policy-public-bucket", func(t *testing.T) {
+		ts := newTestServer(t, withCredentials())
+		defer ts.Close()
+		ts.putBucketPolicy(ts.s3Client(), `{
+			"Statement": [{
+				"Effect": "Allow",
+				"Principal": "*",
+				"Action": "s3:PutObject",
+				"Resource": "arn:aws:s3:::mybucket/*"
+			}]
+		}`)
+
+		rs := newPostForm("file", "hello").post(ts, defaultBucket)
+		rs.Body.Close()
+		if rs.StatusCode != http.StatusNoContent {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+		ts.assertObject(defaultBucket, "file", nil, "hello")
+	})
+
+	t.Run("no-policy-credential", func(t *testing.T) {
+		ts := newTestServer(t, withCredentials())
+		defer ts.Close()
+
+		rs := newPostForm("file", "hello").
+			set("x-amz-credential", "dummy-access/20180101/region/s3/aws4_request").
+			post(ts, defaultBucket)
+		assertPostFails(ts, rs, gofakes3.ErrInvalidArgument, "policy")
+	})
+}
+
+func TestBrowserUploadResponse(t *testing.T) {
+	t.Run("success-action-status", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+
+		rs := newPostForm("dir/${filename}", "hello").set("success_action_status", "201").post(ts, defaultBucket)
+		defer rs.Body.Close()
+		if rs.StatusCode != http.StatusCreated {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+
+		var result gofakes3.PostResponse
+		ts.OK(xml.NewDecoder(rs.Body).Decode(&result))
+		if result.Bucket != defaultBucket || result.Key != "dir/upload.txt" || result.ETag != rs.Header.Get("ETag") {
+			t.Fatal("unexpected response", result)
+		}
+		if !strings.HasSuffix(result.Location, "/"+defaultBucket+"/dir/upload.txt") {
+			t.Fatal("unexpected location", result.Location)
+		}
+		ts.assertObject(defaultBucket, "dir/upload.txt", nil, "hello")
+	})
+
+	t.Run("success-action-status-invalid", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+
+		rs := newPostForm("file", "hello").set("success_action_status", "404").post(ts, defaultBucket)
+		rs.Body.Close()
+		if rs.StatusCode != http.StatusNoContent {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+	})
+
+	t.Run("success-action-redirect", func(t *testing.T) {
+		ts := newTestServer(t)
+		defer ts.Close()
+
+		rs := newPostForm("file", "hello").set("success_action_redirect", "http://example.com/done?x=1").post(ts, defaultBucket)
+		rs.Body.Close()
+		if rs.StatusCode != http.StatusSeeOther {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+
+		location, err := url.Parse(rs.Header.Get("Location"))
+		ts.OK(err)
+		query := location.Query()
+		if location.Host != "example.com" || query.Get("x") != "1" || query.Get("bucket") != defaultBucket ||
+			query.Get("key") != "file" || query.Get("etag") != rs.Header.Get("ETag") {
+			t.Fatal("unexpected redirect", location)
+		}
+	})
+}
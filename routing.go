@@ -39,12 +39,46 @@ func (g *GoFakeS3) routeBase(w http.ResponseWriter, r *http.Request) {
 		object = parts[1]
 	}
 
+	if err := g.authorizeRoute(r, bucket, object); err != nil {
+		g.httpError(w, r, err)
+		return
+	}
+
 	if uploadID := UploadID(query.Get("uploadId")); uploadID != "" {
 		err = g.routeMultipartUpload(bucket, object, uploadID, w, r)
 
 	} else if _, ok := query["uploads"]; ok {
 		err = g.routeMultipartUploadBase(bucket, object, w, r)
 
+	} else if _, ok := query["policy"]; ok {
+		err = g.routeBucketPolicy(bucket, w, r)
+
+	} else if _, ok := query["encryption"]; ok && object == "" {
+		err = g.routeBucketEncryption(bucket, w, r)
+	} else if _, ok := query["lifecycle"]; ok && object == "" {
+		err = g.routeBucketLifecycle(bucket, w, r)
+
+	} else if _, ok := query["object-lock"]; ok && object == "" {
+		err = g.routeObjectLockConfiguration(bucket, w, r)
+
+	} else if _, ok := query["retention"]; ok && object != "" {
+		err = g.routeObjectRetention(bucket, object, VersionID(versionFromQuery(query["versionId"])), w, r)
+
+	} else if _, ok := query["legal-hold"]; ok && object != "" {
+		err = g.routeObjectLegalHold(bucket, object, VersionID(versionFromQuery(query["versionId"])), w, r)
+
+	} else if _, ok := query["restore"]; ok && object != "" {
+		err = g.routeObjectRestore(bucket, object, VersionID(versionFromQuery(query["versionId"])), w, r)
+
+	} else if _, ok := query["acl"]; ok {
+		err = g.routeACL(bucket, object, VersionID(versionFromQuery(query["versionId"])), w, r)
+
+	} else if _, ok := query["tagging"]; ok && object != "" {
+		err = g.routeObjectTagging(bucket, object, VersionID(versionFromQuery(query["versionId"])), w, r)
+
+	} else if _, ok := query["attributes"]; ok && object != "" {
+		err = g.routeObjectAttributes(bucket, object, VersionID(versionFromQuery(query["versionId"])), w, r)
+
 	} else if _, ok := query["versioning"]; ok {
 		err = g.routeVersioning(bucket, w, r)
 
@@ -93,16 +127,26 @@ func (g *GoFakeS3) routeObject(bucket, object string, w http.ResponseWriter, r *
 // routeBucket handles URLs that contain only a bucket path segment, not an
 // object path segment.
 func (g *GoFakeS3) routeBucket(bucket string, w http.ResponseWriter, r *http.Request) (err error) {
+	_, tagging := r.URL.Query()["tagging"]
+
 	switch r.Method {
 	case "GET":
 		if _, ok := r.URL.Query()["location"]; ok {
 			return g.getBucketLocation(bucket, w, r)
+		} else if tagging {
+			return g.getBucketTagging(bucket, w, r)
 		} else {
 			return g.listBucket(bucket, w, r)
 		}
 	case "PUT":
+		if tagging {
+			return g.putBucketTagging(bucket, w, r)
+		}
 		return g.createBucket(bucket, w, r)
 	case "DELETE":
+		if tagging {
+			return g.deleteBucketTagging(bucket, w, r)
+		}
 		return g.deleteBucket(bucket, w, r)
 	case "HEAD":
 		return g.headBucket(bucket, w, r)
@@ -145,6 +189,145 @@ func (g *GoFakeS3) routeVersioning(bucket string, w http.ResponseWriter, r *http
 	}
 }
 
+// routeBucketPolicy operates on routes that contain '?policy' in the query
+// string.
+func (g *GoFakeS3) routeBucketPolicy(bucket string, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.getBucketPolicy(bucket, w, r)
+	case "PUT":
+		return g.putBucketPolicy(bucket, w, r)
+	case "DELETE":
+		return g.deleteBucketPolicy(bucket, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+// routeBucketEncryption operates on routes that contain '?encryption' in the
+// query string and no object path segment.
+func (g *GoFakeS3) routeBucketEncryption(bucket string, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.getBucketEncryption(bucket, w, r)
+	case "PUT":
+		return g.putBucketEncryption(bucket, w, r)
+	case "DELETE":
+		return g.deleteBucketEncryption(bucket, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+// routeBucketLifecycle operates on routes that contain '?lifecycle' in the
+// query string and no object path segment.
+func (g *GoFakeS3) routeBucketLifecycle(bucket string, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.getBucketLifecycle(bucket, w, r)
+	case "PUT":
+		return g.putBucketLifecycle(bucket, w, r)
+	case "DELETE":
+		return g.deleteBucketLifecycle(bucket, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+// routeObjectLockConfiguration operates on routes that contain '?object-lock'
+// in the query string and no object path segment.
+func (g *GoFakeS3) routeObjectLockConfiguration(bucket string, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.getObjectLockConfiguration(bucket, w, r)
+	case "PUT":
+		return g.putObjectLockConfiguration(bucket, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+// routeObjectRetention operates on routes that contain '?retention' in the
+// query string and an object path segment.
+func (g *GoFakeS3) routeObjectRetention(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.getObjectRetention(bucket, object, versionID, w, r)
+	case "PUT":
+		return g.putObjectRetention(bucket, object, versionID, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+// routeObjectLegalHold operates on routes that contain '?legal-hold' in the
+// query string and an object path segment.
+func (g *GoFakeS3) routeObjectLegalHold(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.getObjectLegalHold(bucket, object, versionID, w, r)
+	case "PUT":
+		return g.putObjectLegalHold(bucket, object, versionID, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+// routeObjectRestore operates on routes that contain '?restore' in the query
+// string and an object path segment.
+func (g *GoFakeS3) routeObjectRestore(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "POST":
+		return g.restoreObject(bucket, object, versionID, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+// routeACL operates on routes that contain '?acl' in the query string, which
+// may refer to a bucket, or to an object if the route has an object path
+// segment.
+func (g *GoFakeS3) routeACL(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	switch {
+	case r.Method == "GET" && object != "":
+		return g.getObjectACL(bucket, object, versionID, w, r)
+	case r.Method == "PUT" && object != "":
+		return g.putObjectACL(bucket, object, versionID, w, r)
+	case r.Method == "GET":
+		return g.getBucketACL(bucket, w, r)
+	case r.Method == "PUT":
+		return g.putBucketACL(bucket, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+// routeObjectTagging operates on routes that contain '?tagging' in the query
+// string and an object path segment.
+func (g *GoFakeS3) routeObjectTagging(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.getObjectTagging(bucket, object, versionID, w, r)
+	case "PUT":
+		return g.putObjectTagging(bucket, object, versionID, w, r)
+	case "DELETE":
+		return g.deleteObjectTagging(bucket, object, versionID, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
+// routeObjectAttributes operates on routes that contain '?attributes' in the
+// query string and an object path segment.
+func (g *GoFakeS3) routeObjectAttributes(bucket, object string, versionID VersionID, w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case "GET":
+		return g.getObjectAttributes(bucket, object, versionID, w, r)
+	default:
+		return ErrMethodNotAllowed
+	}
+}
+
 // routeVersions operates on routes that contain '?versions' in the query string.
 func (g *GoFakeS3) routeVersions(bucket string, w http.ResponseWriter, r *http.Request) error {
 	switch r.Method {
@@ -0,0 +1,274 @@
+package gofakes3
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Server-side encryption with customer-provided keys (SSE-C), as described
+// here:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/ServerSideEncryptionCustomerKeys.html
+//
+// Objects are encrypted with AES-256 in CTR mode before they are passed to the
+// Backend, so that a range of an object can be decrypted without reading the
+// rest of it. Each part of a multipart object is encrypted on its own, with a
+// counter block made from a random nonce kept with the object, the number of
+// the part, and the offset of the block within the part:
+//
+//	nonce (8 bytes) | part number (4 bytes) | block offset (4 bytes)
+//
+// Objects that were not uploaded in parts use part number 0. Parts are at most
+// 5 GiB, so the block offset never overflows into the part number.
+const (
+	sseCustomerAlgorithmHeader = "X-Amz-Server-Side-Encryption-Customer-Algorithm"
+	sseCustomerKeyHeader       = "X-Amz-Server-Side-Encryption-Customer-Key"
+	sseCustomerKeyMD5Header    = "X-Amz-Server-Side-Encryption-Customer-Key-Md5"
+
+	// The metadata key objects encrypted in the Backend keep their nonce in,
+	// whether with SSE-C or SSE-KMS. It is never returned as a header.
+	sseNonceMetadataKey = "X-Amz-Server-Side-Encryption-Nonce"
+
+	// The prefixes of the headers that carry the key for the object a request
+	// writes or reads, and the key CopyObject decrypts the source with:
+	sseCustomerHeaderPrefix           = "X-Amz-"
+	copySourceSSECustomerHeaderPrefix = "X-Amz-Copy-Source-"
+
+	sseCustomerAlgorithmAES256 = "AES256"
+	sseNonceSize               = 8
+)
+
+// customerKey is the key sent with a request that uses SSE-C.
+type customerKey struct {
+	key []byte
+
+	// The base64 encoded MD5 of the key, which is kept with the object to
+	// check the key sent with later requests against.
+	md5 string
+}
+
+// parseCustomerKey returns the key sent in the SSE-C headers of a request that
+// start with prefix, or nil if the request does not send them.
+func parseCustomerKey(header http.Header, prefix string) (*customerKey, error) {
+	var (
+		algorithmHeader = prefix + "Server-Side-Encryption-Customer-Algorithm"
+		keyHeader       = prefix + "Server-Side-Encryption-Customer-Key"
+		md5Header       = prefix + "Server-Side-Encryption-Customer-Key-Md5"
+		algorithm       = header.Get(algorithmHeader)
+		value           = header.Get(keyHeader)
+		keyMD5          = header.Get(md5Header)
+	)
+
+	if algorithm == "" && value == "" && keyMD5 == "" {
+		return nil, nil
+	}
+	if algorithm == "" {
+		return nil, ErrorInvalidArgument(strings.ToLower(algorithmHeader), "",
+			"Requests specifying Server Side Encryption with Customer provided keys must provide a valid encryption algorithm.")
+	}
+	if algorithm != sseCustomerAlgorithmAES256 {
+		return nil, ErrorMessage(ErrInvalidEncryptionAlgorithm, ErrInvalidEncryptionAlgorithm.Message())
+	}
+	if value == "" {
+		return nil, ErrorInvalidArgument(strings.ToLower(keyHeader), "",
+			"Requests specifying Server Side Encryption with Customer provided keys must provide an appropriate secret key.")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != 32 {
+		return nil, ErrorInvalidArgument(strings.ToLower(keyHeader), "",
+			"The secret key was invalid for the specified algorithm.")
+	}
+	if keyMD5 == "" {
+		return nil, ErrorInvalidArgument(strings.ToLower(md5Header), "",
+			"Requests specifying Server Side Encryption with Customer provided keys must provide the client calculated MD5 of the secret key.")
+	}
+	sum := md5.Sum(key)
+	if base64.StdEncoding.EncodeToString(sum[:]) != keyMD5 {
+		return nil, ErrorInvalidArgument(strings.ToLower(md5Header), keyMD5,
+			"The calculated MD5 hash of the key did not match the hash that was provided.")
+	}
+
+	return &customerKey{key: key, md5: keyMD5}, nil
+}
+
+// isCustomerKeyMetadata reports whether the metadata key describes how an
+// object is encrypted with SSE-C. This includes the key itself, which must
+// never be stored.
+func isCustomerKeyMetadata(key string) bool {
+	return strings.HasPrefix(key, "X-Amz-Server-Side-Encryption-Customer-") ||
+		strings.HasPrefix(key, "X-Amz-Copy-Source-Server-Side-Encryption-Customer-")
+}
+
+// newObjectMetadata records in the metadata of an object or upload that it is
+// encrypted with the key, using a new nonce, which it returns.
+func (k *customerKey) newObjectMetadata(meta map[string]string) ([]byte, error) {
+	meta[sseCustomerAlgorithmHeader] = sseCustomerAlgorithmAES256
+	meta[sseCustomerKeyMD5Header] = k.md5
+	return newNonce(meta)
+}
+
+// writeHeaders echoes the algorithm and the MD5 of the key, which S3 returns
+// from every request that uses SSE-C.
+func (k *customerKey) writeHeaders(w http.ResponseWriter) {
+	if k != nil {
+		w.Header().Set(sseCustomerAlgorithmHeader, sseCustomerAlgorithmAES256)
+		w.Header().Set(sseCustomerKeyMD5Header, k.md5)
+	}
+}
+
+// stream returns the key stream for the part of an object, starting at offset
+// within the part.
+func (k *customerKey) stream(nonce []byte, part int, offset int64) cipher.Stream {
+	block, err := aes.NewCipher(k.key)
+	if err != nil {
+		panic(err) // parseCustomerKey has checked the size of the key.
+	}
+
+	var iv [aes.BlockSize]byte
+	copy(iv[:sseNonceSize], nonce)
+	binary.BigEndian.PutUint32(iv[8:12], uint32(part))
+	binary.BigEndian.PutUint32(iv[12:], uint32(offset/aes.BlockSize))
+	stream := cipher.NewCTR(block, iv[:])
+
+	if skip := offset % aes.BlockSize; skip > 0 {
+		var discard [aes.BlockSize]byte
+		stream.XORKeyStream(discard[:skip], discard[:skip])
+	}
+	return stream
+}
+
+// encrypt returns a reader that encrypts the part of an object read from r.
+func (k *customerKey) encrypt(r io.Reader, nonce []byte, part int) io.Reader {
+	return &cipher.StreamReader{S: k.stream(nonce, part, 0), R: r}
+}
+
+// encryptionNonce returns the nonce an object or upload was encrypted with,
+// or nil if its contents are not encrypted in the Backend.
+func encryptionNonce(meta map[string]string) ([]byte, error) {
+	value, ok := meta[sseNonceMetadataKey]
+	if !ok {
+		return nil, nil
+	}
+	nonce, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(nonce) != sseNonceSize {
+		return nil, ErrorMessagef(ErrInternal, "invalid nonce stored in metadata: %q", value)
+	}
+	return nonce, nil
+}
+
+// checkCustomerKey checks the key sent with a request that reads an object
+// against the key the object was encrypted with, if it was.
+func checkCustomerKey(meta map[string]string, key *customerKey) error {
+	stored, encrypted := meta[sseCustomerKeyMD5Header]
+	switch {
+	case encrypted && key == nil:
+		return ErrorMessage(ErrInvalidRequest, "The object was stored using a form of Server Side Encryption. The correct parameters must be provided to retrieve the object.")
+	case encrypted && key.md5 != stored:
+		return ErrorMessage(ErrAccessDenied, ErrAccessDenied.Message())
+	case !encrypted && key != nil:
+		return ErrorMessage(ErrInvalidRequest, "The encryption parameters are not applicable to this object.")
+	}
+	return nil
+}
+
+// checkUploadCustomerKey checks the key sent with UploadPart or
+// CompleteMultipartUpload against the key the upload was created with, if it
+// was.
+func checkUploadCustomerKey(meta map[string]string, key *customerKey) error {
+	stored, encrypted := meta[sseCustomerKeyMD5Header]
+	switch {
+	case encrypted && key == nil:
+		return ErrorMessage(ErrInvalidRequest, "The multipart upload initiate requested encryption. Subsequent part requests must include the appropriate encryption parameters.")
+	case encrypted && key.md5 != stored:
+		return ErrorMessage(ErrInvalidRequest, "The provided encryption parameters did not match the ones used originally.")
+	case !encrypted && key != nil:
+		return ErrorMessage(ErrInvalidRequest, "The multipart upload initiate did not request encryption. Subsequent part requests must not include encryption parameters.")
+	}
+	return nil
+}
+
+// decryptObject checks the key sent with a request that reads an object, and
+// replaces the contents of the object with a reader that decrypts them, if the
+// object is encrypted with SSE-C or SSE-KMS.
+func decryptObject(obj *Object, key *customerKey) error {
+	if obj.IsDeleteMarker {
+		return nil
+	}
+	if err := checkCustomerKey(obj.Metadata, key); err != nil {
+		return err
+	}
+	if key == nil {
+		if key = kmsDataKey(obj.Metadata); key == nil {
+			return nil
+		}
+	}
+
+	nonce, err := encryptionNonce(obj.Metadata)
+	if err != nil {
+		return err
+	}
+	parts, err := objectParts(obj.Metadata)
+	if err != nil {
+		return err
+	} else if parts == nil {
+		parts = []objectPart{{Number: 0, Size: obj.Size}}
+	}
+
+	rdr := &customerKeyReader{
+		ReadCloser: obj.Contents,
+		key:        key,
+		nonce:      nonce,
+		parts:      parts,
+	}
+	if obj.Range != nil {
+		rdr.offset = obj.Range.Start
+	}
+	obj.Contents = rdr
+	return nil
+}
+
+// customerKeyReader decrypts the contents of an object encrypted with SSE-C or
+// SSE-KMS, starting at offset, which may be anywhere in any of its parts.
+type customerKeyReader struct {
+	io.ReadCloser
+	key   *customerKey
+	nonce []byte
+	parts []objectPart
+
+	offset int64
+	stream cipher.Stream
+	remain int64 // The number of bytes left in the current part.
+}
+
+func (r *customerKeyReader) Read(p []byte) (n int, err error) {
+	if r.remain == 0 {
+		var start int64
+		for _, part := range r.parts {
+			if r.offset < start+part.Size {
+				r.stream = r.key.stream(r.nonce, part.Number, r.offset-start)
+				r.remain = start + part.Size - r.offset
+				break
+			}
+			start += part.Size
+		}
+		if r.remain == 0 {
+			// Past the end of the object, so there is nothing left to decrypt:
+			return r.ReadCloser.Read(p)
+		}
+	}
+
+	if int64(len(p)) > r.remain {
+		p = p[:r.remain]
+	}
+	n, err = r.ReadCloser.Read(p)
+	r.stream.XORKeyStream(p[:n], p[:n])
+	r.offset += int64(n)
+	r.remain -= int64(n)
+	return n, err
+}
@@ -0,0 +1,298 @@
+package gofakes3_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/johannesboyne/gofakes3"
+)
+
+// customerKey returns a base64 encoded SSE-C key made of b, and its MD5, in
+// the form the SDK expects them.
+func customerKey(b byte) (key, keyMD5 string) {
+	raw := bytes.Repeat([]byte{b}, 32)
+	sum := md5.Sum(raw)
+	return base64.StdEncoding.EncodeToString(raw), base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (ts *testServer) getEncryptedObject(svc *s3.Client, object string, rnge string, key byte) (string, error) {
+	ts.Helper()
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String(object),
+	}
+	if rnge != "" {
+		input.Range = aws.String(rnge)
+	}
+	if key != 0 {
+		input.SSECustomerAlgorithm = aws.String("AES256")
+		input.SSECustomerKey, input.SSECustomerKeyMD5 = customerKeyPointers(key)
+	}
+	out, err := svc.GetObject(context.TODO(), input)
+	if err != nil {
+		return "", err
+	}
+	defer out.Body.Close()
+	body, err := io.ReadAll(out.Body)
+	return string(body), err
+}
+
+func customerKeyPointers(b byte) (key, keyMD5 *string) {
+	k, m := customerKey(b)
+	return aws.String(k), aws.String(m)
+}
+
+func TestSSECustomerKey(t *testing.T) {
+	runWithAllBackends(t, func(t *testing.T, ts *testServer) {
+		svc := ts.s3Client()
+		contents := strings.Repeat("0123456789", 10)
+
+		key, keyMD5 := customerKeyPointers('a')
+		put, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+			Bucket:               aws.String(defaultBucket),
+			Key:                  aws.String("object"),
+			Body:                 strings.NewReader(contents),
+			SSECustomerAlgorithm: aws.String("AES256"),
+			SSECustomerKey:       key,
+			SSECustomerKeyMD5:    keyMD5,
+		})
+		ts.OK(err)
+		if aws.ToString(put.SSECustomerAlgorithm) != "AES256" || aws.ToString(put.SSECustomerKeyMD5) != aws.ToString(keyMD5) {
+			t.Fatal("unexpected encryption headers", aws.ToString(put.SSECustomerAlgorithm), aws.ToString(put.SSECustomerKeyMD5))
+		}
+
+		// The backend only ever sees the encrypted object:
+		if stored := ts.backendGetString(defaultBucket, "object", nil); stored == contents || len(stored) != len(contents) {
+			t.Fatal("object was not encrypted:", stored)
+		}
+
+		body, err := ts.getEncryptedObject(svc, "object", "", 'a')
+		ts.OK(err)
+		if body != contents {
+			t.Fatal("unexpected contents", body)
+		}
+
+		// Ranges can start anywhere in the object, not just at a block:
+		body, err = ts.getEncryptedObject(svc, "object", "bytes=21-56", 'a')
+		ts.OK(err)
+		if body != contents[21:57] {
+			t.Fatal("unexpected range", body)
+		}
+
+		head, err := svc.HeadObject(context.TODO(), &s3.HeadObjectInput{
+			Bucket:               aws.String(defaultBucket),
+			Key:                  aws.String("object"),
+			SSECustomerAlgorithm: aws.String("AES256"),
+			SSECustomerKey:       key,
+			SSECustomerKeyMD5:    keyMD5,
+		})
+		ts.OK(err)
+		if aws.ToInt64(head.ContentLength) != int64(len(contents)) || aws.ToString(head.ETag) != aws.ToString(put.ETag) {
+			t.Fatal("unexpected head", aws.ToInt64(head.ContentLength), aws.ToString(head.ETag))
+		}
+
+		if _, err := ts.getEncryptedObject(svc, "object", "", 0); !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+			t.Fatal("expected InvalidRequest without a key, found", err)
+		}
+		if _, err := ts.getEncryptedObject(svc, "object", "", 'b'); !hasErrorCode(err, gofakes3.ErrAccessDenied) {
+			t.Fatal("expected AccessDenied with the wrong key, found", err)
+		}
+
+		ts.backendPutString(defaultBucket, "plain", nil, contents)
+		if _, err := ts.getEncryptedObject(svc, "plain", "", 'a'); !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+			t.Fatal("expected InvalidRequest for an unencrypted object, found", err)
+		}
+
+		// Overwriting the object without a key leaves it unencrypted:
+		_, err = svc.PutObject(context.TODO(), &s3.PutObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("object"),
+			Body:   strings.NewReader(contents),
+		})
+		ts.OK(err)
+		body, err = ts.getEncryptedObject(svc, "object", "", 0)
+		ts.OK(err)
+		if body != contents {
+			t.Fatal("unexpected contents", body)
+		}
+	})
+}
+
+func TestSSECustomerKeyInvalid(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	key, keyMD5 := customerKey('a')
+	short := base64.StdEncoding.EncodeToString([]byte("short"))
+
+	for idx, tc := range []struct {
+		algorithm, key, keyMD5 string
+		code                   gofakes3.ErrorCode
+	}{
+		{"AES128", key, keyMD5, gofakes3.ErrInvalidEncryptionAlgorithm},
+		{"AES256", "", keyMD5, gofakes3.ErrInvalidArgument},
+		{"AES256", short, keyMD5, gofakes3.ErrInvalidArgument},
+		{"AES256", key, "", gofakes3.ErrInvalidArgument},
+		{"AES256", key, short, gofakes3.ErrInvalidArgument},
+	} {
+		_, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+			Bucket:               aws.String(defaultBucket),
+			Key:                  aws.String("object"),
+			Body:                 strings.NewReader("hello"),
+			SSECustomerAlgorithm: aws.String(tc.algorithm),
+			SSECustomerKey:       aws.String(tc.key),
+			SSECustomerKeyMD5:    aws.String(tc.keyMD5),
+		})
+		if !hasErrorCode(err, tc.code) {
+			t.Fatal(idx, "expected", tc.code, "found", err)
+		}
+	}
+}
+
+func TestSSECustomerKeyMultipart(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	key, keyMD5 := customerKeyPointers('a')
+	mpu, err := svc.CreateMultipartUpload(context.TODO(), &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(defaultBucket),
+		Key:                  aws.String("object"),
+		ChecksumAlgorithm:    s3types.ChecksumAlgorithmCrc32,
+		ChecksumType:         s3types.ChecksumTypeFullObject,
+		SSECustomerAlgorithm: aws.String("AES256"),
+		SSECustomerKey:       key,
+		SSECustomerKeyMD5:    keyMD5,
+	})
+	ts.OK(err)
+
+	parts := []string{strings.Repeat("a", 5*1024*1024), "hello world"}
+	var completed []s3types.CompletedPart
+	for idx, body := range parts {
+		out, err := svc.UploadPart(context.TODO(), &s3.UploadPartInput{
+			Bucket:               aws.String(defaultBucket),
+			Key:                  aws.String("object"),
+			UploadId:             mpu.UploadId,
+			PartNumber:           aws.Int32(int32(idx + 1)),
+			Body:                 strings.NewReader(body),
+			ChecksumAlgorithm:    s3types.ChecksumAlgorithmCrc32,
+			SSECustomerAlgorithm: aws.String("AES256"),
+			SSECustomerKey:       key,
+			SSECustomerKeyMD5:    keyMD5,
+		})
+		ts.OK(err)
+		completed = append(completed, s3types.CompletedPart{
+			ETag:          out.ETag,
+			PartNumber:    aws.Int32(int32(idx + 1)),
+			ChecksumCRC32: out.ChecksumCRC32,
+		})
+	}
+
+	// Parts must be sent with the key the upload was created with:
+	_, err = svc.UploadPart(context.TODO(), &s3.UploadPartInput{
+		Bucket:     aws.String(defaultBucket),
+		Key:        aws.String("object"),
+		UploadId:   mpu.UploadId,
+		PartNumber: aws.Int32(3),
+		Body:       strings.NewReader("unencrypted"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+		t.Fatal("expected InvalidRequest, found", err)
+	}
+
+	// The full object checksum can only be worked out with the key:
+	complete := &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(defaultBucket),
+		Key:             aws.String("object"),
+		UploadId:        mpu.UploadId,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: completed},
+	}
+	if _, err := svc.CompleteMultipartUpload(context.TODO(), complete); !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+		t.Fatal("expected InvalidRequest, found", err)
+	}
+	complete.SSECustomerAlgorithm, complete.SSECustomerKey, complete.SSECustomerKeyMD5 = aws.String("AES256"), key, keyMD5
+	_, err = svc.CompleteMultipartUpload(context.TODO(), complete)
+	ts.OK(err)
+
+	contents := strings.Join(parts, "")
+	body, err := ts.getEncryptedObject(svc, "object", "", 'a')
+	ts.OK(err)
+	if body != contents {
+		t.Fatal("unexpected contents")
+	}
+
+	// A range across the boundary between the parts:
+	body, err = ts.getEncryptedObject(svc, "object", "bytes=5242870-5242885", 'a')
+	ts.OK(err)
+	if body != contents[5242870:5242886] {
+		t.Fatal("unexpected range", body)
+	}
+}
+
+func TestSSECustomerKeyCopy(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	key, keyMD5 := customerKeyPointers('a')
+	_, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:               aws.String(defaultBucket),
+		Key:                  aws.String("object"),
+		Body:                 strings.NewReader("hello"),
+		SSECustomerAlgorithm: aws.String("AES256"),
+		SSECustomerKey:       key,
+		SSECustomerKeyMD5:    keyMD5,
+	})
+	ts.OK(err)
+
+	_, err = svc.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:     aws.String(defaultBucket),
+		Key:        aws.String("copy"),
+		CopySource: aws.String(defaultBucket + "/object"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+		t.Fatal("expected InvalidRequest without the source key, found", err)
+	}
+
+	// Decrypt with the source's key, and encrypt with another:
+	newKey, newKeyMD5 := customerKeyPointers('b')
+	_, err = svc.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:                         aws.String(defaultBucket),
+		Key:                            aws.String("copy"),
+		CopySource:                     aws.String(defaultBucket + "/object"),
+		CopySourceSSECustomerAlgorithm: aws.String("AES256"),
+		CopySourceSSECustomerKey:       key,
+		CopySourceSSECustomerKeyMD5:    keyMD5,
+		SSECustomerAlgorithm:           aws.String("AES256"),
+		SSECustomerKey:                 newKey,
+		SSECustomerKeyMD5:              newKeyMD5,
+	})
+	ts.OK(err)
+	body, err := ts.getEncryptedObject(svc, "copy", "", 'b')
+	ts.OK(err)
+	if body != "hello" {
+		t.Fatal("unexpected contents", body)
+	}
+
+	// Decrypt without encrypting the copy:
+	_, err = svc.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:                         aws.String(defaultBucket),
+		Key:                            aws.String("plain"),
+		CopySource:                     aws.String(defaultBucket + "/copy"),
+		CopySourceSSECustomerAlgorithm: aws.String("AES256"),
+		CopySourceSSECustomerKey:       newKey,
+		CopySourceSSECustomerKeyMD5:    newKeyMD5,
+	})
+	ts.OK(err)
+	ts.assertObject(defaultBucket, "plain", nil, "hello")
+}
@@ -0,0 +1,184 @@
+package gofakes3
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Storage classes, as described here:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/storage-class-intro.html
+//
+// The storage class of an object is kept in its metadata, under the same key
+// as the header that sets it when the object is created and that returns it
+// from GetObject and HeadObject. As in S3, objects in the STANDARD class
+// don't have the header.
+const (
+	storageClassMetadataKey = "X-Amz-Storage-Class"
+
+	// The header that reports the restore of an archived object.
+	restoreHeader = "X-Amz-Restore"
+)
+
+func (s StorageClass) valid() bool {
+	switch s {
+	case StorageStandard,
+		StorageReducedRedundancy,
+		StorageStandardIA,
+		StorageOnezoneIA,
+		StorageIntelligentTiering,
+		StorageGlacierIR,
+		StorageGlacier,
+		StorageDeepArchive:
+		return true
+	}
+	return false
+}
+
+// archived reports whether objects in the storage class must be restored
+// before they can be read.
+func (s StorageClass) archived() bool {
+	return s == StorageGlacier || s == StorageDeepArchive
+}
+
+// StorageClassFromMetadata returns the storage class of an object from its
+// metadata, for Backends to report in ListBucket and ListBucketVersions.
+func StorageClassFromMetadata(meta map[string]string) StorageClass {
+	if s := StorageClass(meta[storageClassMetadataKey]); s != "" {
+		return s
+	}
+	return StorageStandard
+}
+
+// validateStorageClass checks the storage class that the request stored in
+// meta. STANDARD is removed, as it is the default.
+func validateStorageClass(meta map[string]string) error {
+	s, ok := meta[storageClassMetadataKey]
+	if !ok {
+		return nil
+	}
+	if !StorageClass(s).valid() {
+		return ErrInvalidStorageClass
+	}
+	if StorageClass(s) == StorageStandard {
+		delete(meta, storageClassMetadataKey)
+	}
+	return nil
+}
+
+// RestoreRequest is the body of a RestoreObject request. Only the restore of
+// archived objects is supported, not SELECT requests.
+type RestoreRequest struct {
+	XMLName              xml.Name              `xml:"RestoreRequest"`
+	Days                 int                   `xml:"Days"`
+	GlacierJobParameters *GlacierJobParameters `xml:"GlacierJobParameters,omitempty"`
+}
+
+type GlacierJobParameters struct {
+	Tier string `xml:"Tier"`
+}
+
+// objectRestore is the restore of an archived object version, which is
+// readable from readyAt until expiresAt.
+type objectRestore struct {
+	hash      string
+	readyAt   time.Time
+	expiresAt time.Time
+}
+
+func (or *objectRestore) ongoing(now time.Time) bool {
+	return now.Before(or.readyAt)
+}
+
+// header returns the value of the x-amz-restore header.
+func (or *objectRestore) header(now time.Time) string {
+	if or.ongoing(now) {
+		return `ongoing-request="true"`
+	}
+	return `ongoing-request="false", expiry-date="` + formatHeaderTime(or.expiresAt) + `"`
+}
+
+type objectRestoreKey struct {
+	bucket    string
+	object    string
+	versionID VersionID
+}
+
+// objectRestores keeps track of the objects that have been restored with
+// RestoreObject. Restores are not kept by the Backend: as in S3, the restored
+// copy of an object is temporary.
+type objectRestores struct {
+	restores map[objectRestoreKey]*objectRestore
+	mu       sync.Mutex
+}
+
+func newObjectRestores() *objectRestores {
+	return &objectRestores{restores: make(map[objectRestoreKey]*objectRestore)}
+}
+
+// restore returns the restore of obj that has not expired by now, or nil.
+// The restore of an object that has since been replaced under the same
+// version, which happens when versioning is not enabled, is not returned.
+func (ors *objectRestores) restore(bucket string, obj *Object, now time.Time) *objectRestore {
+	ors.mu.Lock()
+	defer ors.mu.Unlock()
+
+	key := objectRestoreKey{bucket, obj.Name, obj.VersionID}
+	or := ors.restores[key]
+	if or == nil {
+		return nil
+	}
+	if or.hash != hex.EncodeToString(obj.Hash) || !now.Before(or.expiresAt) {
+		delete(ors.restores, key)
+		return nil
+	}
+	return or
+}
+
+func (ors *objectRestores) set(bucket string, obj *Object, or *objectRestore) {
+	ors.mu.Lock()
+	defer ors.mu.Unlock()
+
+	or.hash = hex.EncodeToString(obj.Hash)
+	ors.restores[objectRestoreKey{bucket, obj.Name, obj.VersionID}] = or
+}
+
+// forget removes the restores of the objects in a bucket that has been
+// deleted.
+func (ors *objectRestores) forget(bucket string) {
+	ors.mu.Lock()
+	defer ors.mu.Unlock()
+
+	for key := range ors.restores {
+		if key.bucket == bucket {
+			delete(ors.restores, key)
+		}
+	}
+}
+
+// checkReadable returns ErrInvalidObjectState if obj is archived and has not
+// been restored.
+func (g *GoFakeS3) checkReadable(bucket string, obj *Object) error {
+	if !StorageClassFromMetadata(obj.Metadata).archived() {
+		return nil
+	}
+	now := g.timeSource.Now()
+	if or := g.restores.restore(bucket, obj, now); or == nil || or.ongoing(now) {
+		return ErrInvalidObjectState
+	}
+	return nil
+}
+
+// writeRestoreHeader writes the x-amz-restore header of an archived object
+// that is being, or has been, restored.
+func (g *GoFakeS3) writeRestoreHeader(bucket string, obj *Object, w http.ResponseWriter) {
+	if !StorageClassFromMetadata(obj.Metadata).archived() {
+		return
+	}
+	now := g.timeSource.Now()
+	if or := g.restores.restore(bucket, obj, now); or != nil {
+		w.Header().Set(restoreHeader, or.header(now))
+	}
+}
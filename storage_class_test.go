@@ -0,0 +1,270 @@
+package gofakes3_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/johannesboyne/gofakes3"
+)
+
+func (ts *testServer) putStorageClassObject(svc *s3.Client, object string, storageClass s3types.StorageClass) {
+	ts.Helper()
+	_, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:       aws.String(defaultBucket),
+		Key:          aws.String(object),
+		Body:         strings.NewReader("hello"),
+		StorageClass: storageClass,
+	})
+	ts.OK(err)
+}
+
+func (ts *testServer) restoreObject(svc *s3.Client, object string, days int32) error {
+	ts.Helper()
+	_, err := svc.RestoreObject(context.TODO(), &s3.RestoreObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String(object),
+		RestoreRequest: &s3types.RestoreRequest{
+			Days:                 aws.Int32(days),
+			GlacierJobParameters: &s3types.GlacierJobParameters{Tier: s3types.TierStandard},
+		},
+	})
+	return err
+}
+
+func (ts *testServer) getObjectError(svc *s3.Client, object string) error {
+	ts.Helper()
+	out, err := svc.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String(object),
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+	_, err = io.ReadAll(out.Body)
+	return err
+}
+
+func TestStorageClass(t *testing.T) {
+	runWithAllBackends(t, func(t *testing.T, ts *testServer) {
+		svc := ts.s3Client()
+
+		ts.putStorageClassObject(svc, "standard", "")
+		ts.putStorageClassObject(svc, "infrequent", s3types.StorageClassStandardIa)
+		ts.putStorageClassObject(svc, "glacier", s3types.StorageClassGlacier)
+
+		expected := map[string]s3types.ObjectStorageClass{
+			"standard":   s3types.ObjectStorageClassStandard,
+			"infrequent": s3types.ObjectStorageClassStandardIa,
+			"glacier":    s3types.ObjectStorageClassGlacier,
+		}
+		list, err := svc.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
+			Bucket: aws.String(defaultBucket),
+		})
+		ts.OK(err)
+		if len(list.Contents) != len(expected) {
+			t.Fatal("unexpected objects", len(list.Contents))
+		}
+		for _, item := range list.Contents {
+			if item.StorageClass != expected[aws.ToString(item.Key)] {
+				t.Fatal("unexpected storage class for", aws.ToString(item.Key), item.StorageClass)
+			}
+		}
+
+		head, err := svc.HeadObject(context.TODO(), &s3.HeadObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("infrequent"),
+		})
+		ts.OK(err)
+		if head.StorageClass != s3types.StorageClassStandardIa {
+			t.Fatal("unexpected storage class", head.StorageClass)
+		}
+		head, err = svc.HeadObject(context.TODO(), &s3.HeadObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("standard"),
+		})
+		ts.OK(err)
+		if head.StorageClass != "" {
+			t.Fatal("STANDARD objects should not report their storage class", head.StorageClass)
+		}
+
+		if err := ts.getObjectError(svc, "infrequent"); err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.getObjectError(svc, "glacier"); !hasErrorCode(err, gofakes3.ErrInvalidObjectState) {
+			t.Fatal("expected InvalidObjectState, found", err)
+		}
+
+		_, err = svc.CopyObject(context.TODO(), &s3.CopyObjectInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("copy"),
+			CopySource: aws.String(defaultBucket + "/glacier"),
+		})
+		if !hasErrorCode(err, gofakes3.ErrInvalidObjectState) {
+			t.Fatal("expected InvalidObjectState, found", err)
+		}
+
+		// The storage class of a copy is set by the request, not the source:
+		_, err = svc.CopyObject(context.TODO(), &s3.CopyObjectInput{
+			Bucket:       aws.String(defaultBucket),
+			Key:          aws.String("copy"),
+			CopySource:   aws.String(defaultBucket + "/infrequent"),
+			StorageClass: s3types.StorageClassDeepArchive,
+		})
+		ts.OK(err)
+		head, err = svc.HeadObject(context.TODO(), &s3.HeadObjectInput{
+			Bucket: aws.String(defaultBucket),
+			Key:    aws.String("copy"),
+		})
+		ts.OK(err)
+		if head.StorageClass != s3types.StorageClassDeepArchive {
+			t.Fatal("unexpected storage class", head.StorageClass)
+		}
+	})
+}
+
+func TestStorageClassInvalid(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	_, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:       aws.String(defaultBucket),
+		Key:          aws.String("object"),
+		Body:         strings.NewReader("hello"),
+		StorageClass: "TAPE",
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidStorageClass) {
+		t.Fatal("expected InvalidStorageClass, found", err)
+	}
+
+	ts.putStorageClassObject(svc, "object", "")
+	if err := ts.restoreObject(svc, "object", 1); !hasErrorCode(err, gofakes3.ErrInvalidObjectState) {
+		t.Fatal("expected InvalidObjectState, found", err)
+	}
+}
+
+func TestStorageClassMultipartUpload(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	mpu, err := svc.CreateMultipartUpload(context.TODO(), &s3.CreateMultipartUploadInput{
+		Bucket:       aws.String(defaultBucket),
+		Key:          aws.String("object"),
+		StorageClass: s3types.StorageClassGlacier,
+	})
+	ts.OK(err)
+
+	uploads, err := svc.ListMultipartUploads(context.TODO(), &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(defaultBucket),
+	})
+	ts.OK(err)
+	if len(uploads.Uploads) != 1 || uploads.Uploads[0].StorageClass != s3types.StorageClassGlacier {
+		t.Fatal("unexpected uploads", uploads.Uploads)
+	}
+
+	part := ts.uploadPart(defaultBucket, "object", *mpu.UploadId, 1, []byte("hello"))
+	_, err = svc.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(defaultBucket),
+		Key:      aws.String("object"),
+		UploadId: mpu.UploadId,
+		MultipartUpload: &s3types.CompletedMultipartUpload{
+			Parts: []s3types.CompletedPart{part},
+		},
+	})
+	ts.OK(err)
+
+	if err := ts.getObjectError(svc, "object"); !hasErrorCode(err, gofakes3.ErrInvalidObjectState) {
+		t.Fatal("expected InvalidObjectState, found", err)
+	}
+}
+
+func TestRestoreObject(t *testing.T) {
+	ts := newTestServer(t, withFakerOptions(gofakes3.WithRestoreDelay(4*time.Hour)))
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.putStorageClassObject(svc, "object", s3types.StorageClassDeepArchive)
+
+	restoreHeader := func() string {
+		t.Helper()
+		rq, err := http.NewRequest("HEAD", ts.url("/"+defaultBucket+"/object"), nil)
+		ts.OK(err)
+		rs, err := httpClient().Do(rq)
+		ts.OK(err)
+		rs.Body.Close()
+		if rs.StatusCode != http.StatusOK {
+			t.Fatal("unexpected status", rs.StatusCode)
+		}
+		return rs.Header.Get("x-amz-restore")
+	}
+
+	if h := restoreHeader(); h != "" {
+		t.Fatal("unexpected restore", h)
+	}
+
+	ts.OK(ts.restoreObject(svc, "object", 2))
+	if h := restoreHeader(); h != `ongoing-request="true"` {
+		t.Fatal("unexpected restore", h)
+	}
+	if err := ts.restoreObject(svc, "object", 2); !hasErrorCode(err, gofakes3.ErrRestoreAlreadyInProgress) {
+		t.Fatal("expected RestoreAlreadyInProgress, found", err)
+	}
+	if err := ts.getObjectError(svc, "object"); !hasErrorCode(err, gofakes3.ErrInvalidObjectState) {
+		t.Fatal("expected InvalidObjectState, found", err)
+	}
+
+	ts.Advance(4 * time.Hour)
+	expiry := defaultDate.Add(4*time.Hour).AddDate(0, 0, 2)
+	if h := restoreHeader(); h != `ongoing-request="false", expiry-date="`+expiry.Format(http.TimeFormat)+`"` {
+		t.Fatal("unexpected restore", h)
+	}
+	ts.OK(ts.getObjectError(svc, "object"))
+
+	head, err := svc.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+	if aws.ToString(head.Restore) == "" {
+		t.Fatal("missing restore")
+	}
+
+	// Restoring it again extends the restore from now:
+	ts.Advance(24 * time.Hour)
+	ts.OK(ts.restoreObject(svc, "object", 3))
+	ts.Advance(3*24*time.Hour - time.Second)
+	ts.OK(ts.getObjectError(svc, "object"))
+
+	ts.Advance(time.Second)
+	if err := ts.getObjectError(svc, "object"); !hasErrorCode(err, gofakes3.ErrInvalidObjectState) {
+		t.Fatal("expected InvalidObjectState, found", err)
+	}
+	if h := restoreHeader(); h != "" {
+		t.Fatal("unexpected restore", h)
+	}
+
+	// Replacing the object discards its restore:
+	ts.OK(ts.restoreObject(svc, "object", 1))
+	ts.Advance(4 * time.Hour)
+	ts.OK(ts.getObjectError(svc, "object"))
+	_, err = svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:       aws.String(defaultBucket),
+		Key:          aws.String("object"),
+		Body:         strings.NewReader("changed"),
+		StorageClass: s3types.StorageClassDeepArchive,
+	})
+	ts.OK(err)
+	if err := ts.getObjectError(svc, "object"); !hasErrorCode(err, gofakes3.ErrInvalidObjectState) {
+		t.Fatal("expected InvalidObjectState, found", err)
+	}
+}
@@ -0,0 +1,141 @@
+package gofakes3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits on tags, from here:
+// https://docs.aws.amazon.com/AmazonS3/latest/userguide/object-tagging.html
+const (
+	objectTagLimit      = 10
+	bucketTagLimit      = 50
+	tagKeyLengthLimit   = 128
+	tagValueLengthLimit = 256
+)
+
+// The metadata key objects keep their tags in, encoded as in the
+// x-amz-tagging header.
+const taggingMetadataKey = "X-Amz-Tagging"
+
+// The characters S3 allows in tag keys and values: letters, numbers and
+// spaces representable in UTF-8, and "_ . : / = + - @".
+var tagPattern = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]*$`)
+
+type Tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+// Tagging is the body of the '?tagging' subresource.
+type Tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	TagSet  []Tag    `xml:"TagSet>Tag"`
+}
+
+// validateObjectTags checks the tags of an object against the limits S3
+// imposes.
+func validateObjectTags(tags []Tag) error {
+	if len(tags) > objectTagLimit {
+		return ErrorMessagef(ErrInvalidTag, "Object tags cannot be greater than %d", objectTagLimit)
+	}
+	return validateTags(tags)
+}
+
+// validateTags checks the keys and values of tags, which are limited in the
+// same way for objects and buckets.
+func validateTags(tags []Tag) error {
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		switch {
+		case utf8.RuneCountInString(tag.Key) > tagKeyLengthLimit:
+			return ErrorMessagef(ErrInvalidTag, "The TagKey you have provided is too long, max %d", tagKeyLengthLimit)
+		case tag.Key == "" || !tagPattern.MatchString(tag.Key):
+			return ErrorMessage(ErrInvalidTag, "The TagKey you have provided is invalid")
+		case strings.HasPrefix(tag.Key, "aws:"):
+			return ErrorMessage(ErrInvalidTag, "Your TagKey cannot be prefixed with aws:")
+		case utf8.RuneCountInString(tag.Value) > tagValueLengthLimit:
+			return ErrorMessagef(ErrInvalidTag, "The TagValue you have provided is too long, max %d", tagValueLengthLimit)
+		case !tagPattern.MatchString(tag.Value):
+			return ErrorMessage(ErrInvalidTag, "The TagValue you have provided is invalid")
+		case seen[tag.Key]:
+			return ErrorMessage(ErrInvalidTag, "Cannot provide multiple Tags with the same key")
+		}
+		seen[tag.Key] = true
+	}
+	return nil
+}
+
+// parseTaggingHeader parses tags encoded as URL query parameters, as they are
+// sent in the x-amz-tagging header, i.e. "Key1=Value1&Key2=Value2". The tags
+// are returned in order of their keys.
+func parseTaggingHeader(value string) ([]Tag, error) {
+	query, err := url.ParseQuery(value)
+	if err != nil {
+		return nil, ErrorInvalidArgument("x-amz-tagging", value,
+			"The header 'x-amz-tagging' shall be encoded as UTF-8 then URLEncoded URL query parameters without tag name duplicates.")
+	}
+
+	tags := make([]Tag, 0, len(query))
+	for key, values := range query {
+		if len(values) > 1 {
+			return nil, ErrorMessage(ErrInvalidTag, "Cannot provide multiple Tags with the same key")
+		}
+		tags = append(tags, Tag{Key: key, Value: values[0]})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Key < tags[j].Key })
+	return tags, nil
+}
+
+// encodeTaggingHeader is the inverse of parseTaggingHeader.
+func encodeTaggingHeader(tags []Tag) string {
+	query := make(url.Values, len(tags))
+	for _, tag := range tags {
+		query.Set(tag.Key, tag.Value)
+	}
+	return query.Encode()
+}
+
+// tagsFromMetadata returns the tags of an object.
+func tagsFromMetadata(meta map[string]string) ([]Tag, error) {
+	value, ok := meta[taggingMetadataKey]
+	if !ok {
+		return nil, nil
+	}
+	tags, err := parseTaggingHeader(value)
+	if err != nil {
+		return nil, fmt.Errorf("gofakes3: invalid tags in metadata: %w", err)
+	}
+	return tags, nil
+}
+
+// normalizeTaggingMetadata validates the x-amz-tagging header an object is
+// written with, and stores it in the same form as tags set through the
+// '?tagging' subresource.
+func normalizeTaggingMetadata(meta map[string]string) error {
+	value, ok := meta[taggingMetadataKey]
+	if !ok {
+		return nil
+	}
+
+	tags, err := parseTaggingHeader(value)
+	if err != nil {
+		return err
+	}
+	if err := validateObjectTags(tags); err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		delete(meta, taggingMetadataKey)
+	} else {
+		meta[taggingMetadataKey] = encodeTaggingHeader(tags)
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package gofakes3_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/johannesboyne/gofakes3"
+)
+
+func (ts *testServer) putObjectWithTagging(svc *s3.Client, key, tagging string) *s3.PutObjectOutput {
+	ts.Helper()
+	out, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:  aws.String(defaultBucket),
+		Key:     aws.String(key),
+		Body:    strings.NewReader("hello"),
+		Tagging: aws.String(tagging),
+	})
+	ts.OK(err)
+	return out
+}
+
+// assertTags checks the tags of the object, or of the version of it if
+// versionID is not empty, which are given as "Key=Value" pairs.
+func (ts *testServer) assertTags(svc *s3.Client, key, versionID string, expected ...string) {
+	ts.Helper()
+	in := &s3.GetObjectTaggingInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String(key),
+	}
+	if versionID != "" {
+		in.VersionId = aws.String(versionID)
+	}
+	out, err := svc.GetObjectTagging(context.TODO(), in)
+	ts.OK(err)
+
+	var found []string
+	for _, tag := range out.TagSet {
+		found = append(found, aws.ToString(tag.Key)+"="+aws.ToString(tag.Value))
+	}
+	if strings.Join(found, "&") != strings.Join(expected, "&") {
+		ts.Fatal("unexpected tags", found, "expected", expected)
+	}
+}
+
+func TestObjectTagging(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.putObjectWithTagging(svc, "object", "b=2&a=1")
+	ts.assertTags(svc, "object", "", "a=1", "b=2")
+
+	out, err := svc.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+	out.Body.Close()
+	if aws.ToInt32(out.TagCount) != 2 {
+		t.Fatal("expected tag count 2, found", aws.ToInt32(out.TagCount))
+	}
+
+	_, err = svc.PutObjectTagging(context.TODO(), &s3.PutObjectTaggingInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+		Tagging: &s3types.Tagging{TagSet: []s3types.Tag{
+			{Key: aws.String("project"), Value: aws.String("gofakes3")},
+		}},
+	})
+	ts.OK(err)
+	ts.assertTags(svc, "object", "", "project=gofakes3")
+	ts.assertObject(defaultBucket, "object", nil, "hello")
+
+	_, err = svc.DeleteObjectTagging(context.TODO(), &s3.DeleteObjectTaggingInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+	ts.assertTags(svc, "object", "")
+
+	out, err = svc.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("object"),
+	})
+	ts.OK(err)
+	out.Body.Close()
+	if out.TagCount != nil {
+		t.Fatal("expected no tag count, found", aws.ToInt32(out.TagCount))
+	}
+
+	// Overwriting the object replaces its tags:
+	ts.putObjectWithTagging(svc, "object", "a=1")
+	ts.putObjectWithTagging(svc, "object", "")
+	ts.assertTags(svc, "object", "")
+
+	_, err = svc.GetObjectTagging(context.TODO(), &s3.GetObjectTaggingInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("missing"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchKey) {
+		t.Fatal("expected NoSuchKey, found", err)
+	}
+}
+
+func TestObjectTaggingInvalid(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.putObjectWithTagging(svc, "object", "")
+
+	var tooMany []s3types.Tag
+	for i := 0; i < 11; i++ {
+		tooMany = append(tooMany, s3types.Tag{Key: aws.String(fmt.Sprint("key", i)), Value: aws.String("value")})
+	}
+
+	for idx, tags := range [][]s3types.Tag{
+		tooMany,
+		{{Key: aws.String(strings.Repeat("k", 129)), Value: aws.String("value")}},
+		{{Key: aws.String("key"), Value: aws.String(strings.Repeat("v", 257))}},
+		{{Key: aws.String("key"), Value: aws.String("a")}, {Key: aws.String("key"), Value: aws.String("b")}},
+		{{Key: aws.String("aws:reserved"), Value: aws.String("value")}},
+		{{Key: aws.String("bad*key"), Value: aws.String("value")}},
+		{{Key: aws.String(""), Value: aws.String("value")}},
+	} {
+		_, err := svc.PutObjectTagging(context.TODO(), &s3.PutObjectTaggingInput{
+			Bucket:  aws.String(defaultBucket),
+			Key:     aws.String("object"),
+			Tagging: &s3types.Tagging{TagSet: tags},
+		})
+		if !hasErrorCode(err, gofakes3.ErrInvalidTag) {
+			t.Fatal(idx, "expected InvalidTag, found", err)
+		}
+	}
+
+	_, err := svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:  aws.String(defaultBucket),
+		Key:     aws.String("object"),
+		Body:    strings.NewReader("hello"),
+		Tagging: aws.String("key=a&key=b"),
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidTag) {
+		t.Fatal("expected InvalidTag, found", err)
+	}
+}
+
+func TestObjectTaggingCopy(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+	ts.putObjectWithTagging(svc, "src", "a=1")
+
+	for _, tc := range []struct {
+		directive s3types.TaggingDirective
+		tagging   *string
+		expected  []string
+	}{
+		{"", aws.String("b=2"), []string{"a=1"}},
+		{s3types.TaggingDirectiveCopy, nil, []string{"a=1"}},
+		{s3types.TaggingDirectiveReplace, aws.String("b=2"), []string{"b=2"}},
+		{s3types.TaggingDirectiveReplace, nil, nil},
+	} {
+		_, err := svc.CopyObject(context.TODO(), &s3.CopyObjectInput{
+			Bucket:           aws.String(defaultBucket),
+			Key:              aws.String("dst"),
+			CopySource:       aws.String(defaultBucket + "/src"),
+			TaggingDirective: tc.directive,
+			Tagging:          tc.tagging,
+		})
+		ts.OK(err)
+		ts.assertTags(svc, "dst", "", tc.expected...)
+	}
+
+	_, err := svc.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:           aws.String(defaultBucket),
+		Key:              aws.String("dst"),
+		CopySource:       aws.String(defaultBucket + "/src"),
+		TaggingDirective: "MERGE",
+	})
+	if !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+		t.Fatal("expected InvalidArgument, found", err)
+	}
+}
+
+func TestObjectTaggingVersioned(t *testing.T) {
+	ts := newTestServer(t, withVersioning())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	v1 := aws.ToString(ts.putObjectWithTagging(svc, "object", "v=1").VersionId)
+	v2 := aws.ToString(ts.putObjectWithTagging(svc, "object", "v=2").VersionId)
+
+	ts.assertTags(svc, "object", "", "v=2")
+	ts.assertTags(svc, "object", v1, "v=1")
+
+	_, err := svc.PutObjectTagging(context.TODO(), &s3.PutObjectTaggingInput{
+		Bucket:    aws.String(defaultBucket),
+		Key:       aws.String("object"),
+		VersionId: aws.String(v1),
+		Tagging: &s3types.Tagging{TagSet: []s3types.Tag{
+			{Key: aws.String("v"), Value: aws.String("old")},
+		}},
+	})
+	ts.OK(err)
+	ts.assertTags(svc, "object", v1, "v=old")
+	ts.assertTags(svc, "object", v2, "v=2")
+}
+
+func TestObjectTaggingMultipartUpload(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	mpu, err := svc.CreateMultipartUpload(context.TODO(), &s3.CreateMultipartUploadInput{
+		Bucket:  aws.String(defaultBucket),
+		Key:     aws.String("object"),
+		Tagging: aws.String("upload=multipart"),
+	})
+	ts.OK(err)
+	part := ts.uploadPart(defaultBucket, "object", aws.ToString(mpu.UploadId), 1, []byte("hello"))
+	_, err = svc.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(defaultBucket),
+		Key:             aws.String("object"),
+		UploadId:        mpu.UploadId,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: []s3types.CompletedPart{part}},
+	})
+	ts.OK(err)
+	ts.assertTags(svc, "object", "", "upload=multipart")
+}
+
+func TestObjectTaggingBrowserUpload(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+
+	rs := newPostForm("object", "hello").
+		set("tagging", "<Tagging><TagSet><Tag><Key>source</Key><Value>browser</Value></Tag></TagSet></Tagging>").
+		post(ts, defaultBucket)
+	defer rs.Body.Close()
+	if rs.StatusCode != http.StatusNoContent {
+		t.Fatal("expected 204, found", rs.StatusCode)
+	}
+	ts.assertTags(ts.s3Client(), "object", "", "source=browser")
+}
+
+func TestBucketTagging(t *testing.T) {
+	runWithAllBackends(t, testBucketTagging)
+}
+
+func testBucketTagging(t *testing.T, ts *testServer) {
+	svc := ts.s3Client()
+
+	_, err := svc.GetBucketTagging(context.TODO(), &s3.GetBucketTaggingInput{Bucket: aws.String(defaultBucket)})
+	if _, ok := ts.backend.(gofakes3.BucketTaggingBackend); !ok {
+		if !hasErrorCode(err, gofakes3.ErrNotImplemented) {
+			t.Fatal("expected NotImplemented, found", err)
+		}
+		return
+	}
+	if !hasErrorCode(err, gofakes3.ErrNoSuchTagSet) {
+		t.Fatal("expected NoSuchTagSet, found", err)
+	}
+
+	_, err = svc.PutBucketTagging(context.TODO(), &s3.PutBucketTaggingInput{
+		Bucket: aws.String(defaultBucket),
+		Tagging: &s3types.Tagging{TagSet: []s3types.Tag{
+			{Key: aws.String("cost-center"), Value: aws.String("1234")},
+			{Key: aws.String("team"), Value: aws.String("storage")},
+		}},
+	})
+	ts.OK(err)
+
+	out, err := svc.GetBucketTagging(context.TODO(), &s3.GetBucketTaggingInput{Bucket: aws.String(defaultBucket)})
+	ts.OK(err)
+	if len(out.TagSet) != 2 || aws.ToString(out.TagSet[0].Key) != "cost-center" || aws.ToString(out.TagSet[1].Value) != "storage" {
+		t.Fatal("unexpected tags", out.TagSet)
+	}
+
+	// The tags must not be mistaken for a listing:
+	ts.assertLs(defaultBucket, "", nil, nil)
+
+	_, err = svc.DeleteBucketTagging(context.TODO(), &s3.DeleteBucketTaggingInput{Bucket: aws.String(defaultBucket)})
+	ts.OK(err)
+	_, err = svc.GetBucketTagging(context.TODO(), &s3.GetBucketTaggingInput{Bucket: aws.String(defaultBucket)})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchTagSet) {
+		t.Fatal("expected NoSuchTagSet, found", err)
+	}
+
+	_, err = svc.GetBucketTagging(context.TODO(), &s3.GetBucketTaggingInput{Bucket: aws.String("missing")})
+	if !hasErrorCode(err, gofakes3.ErrNoSuchBucket) {
+		t.Fatal("expected NoSuchBucket, found", err)
+	}
+}
+
+func TestBucketTaggingInvalid(t *testing.T) {
+	ts := newTestServer(t)
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	var tooMany []s3types.Tag
+	for i := 0; i < 51; i++ {
+		tooMany = append(tooMany, s3types.Tag{Key: aws.String(fmt.Sprint("key", i)), Value: aws.String("value")})
+	}
+
+	for idx, tags := range [][]s3types.Tag{
+		tooMany,
+		{{Key: aws.String("aws:reserved"), Value: aws.String("value")}},
+		{{Key: aws.String("key"), Value: aws.String("a")}, {Key: aws.String("key"), Value: aws.String("b")}},
+	} {
+		_, err := svc.PutBucketTagging(context.TODO(), &s3.PutBucketTaggingInput{
+			Bucket:  aws.String(defaultBucket),
+			Tagging: &s3types.Tagging{TagSet: tags},
+		})
+		if !hasErrorCode(err, gofakes3.ErrInvalidTag) {
+			t.Fatal(idx, "expected InvalidTag, found", err)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package gofakes3
 import (
 	"bytes"
 	"crypto/md5"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -212,7 +213,7 @@ func (u *uploader) ListParts(bucket, object string, uploadID UploadID, marker in
 		UploadID:         uploadID,
 		MaxParts:         limit,
 		PartNumberMarker: marker,
-		StorageClass:     "STANDARD", // FIXME
+		StorageClass:     StorageClassFromMetadata(mpu.Meta),
 	}
 
 	var cnt int64
@@ -227,12 +228,14 @@ func (u *uploader) ListParts(bucket, object string, uploadID UploadID, marker in
 			break
 		}
 
-		result.Parts = append(result.Parts, ListMultipartUploadPartItem{
+		item := ListMultipartUploadPartItem{
 			ETag:         part.ETag,
 			Size:         int64(len(part.Body)),
 			PartNumber:   partNumber,
 			LastModified: part.LastModified,
-		})
+		}
+		item.Set(mpu.checksumAlgorithm(), part.Checksum)
+		result.Parts = append(result.Parts, item)
 
 		cnt++
 	}
@@ -310,7 +313,7 @@ func (u *uploader) ListMultipartUploads(bucket string, marker *UploadListMarker,
 			} else {
 				for idx, upload := range uploads {
 					result.Uploads = append(result.Uploads, ListMultipartUploadItem{
-						StorageClass: "STANDARD", // FIXME
+						StorageClass: StorageClassFromMetadata(upload.Meta),
 						Key:          object,
 						UploadID:     upload.ID,
 						Initiated:    ContentTime{Time: upload.Initiated},
@@ -368,6 +371,14 @@ func (u *uploader) AbortMultipartUpload(bucket, object string, id UploadID) erro
 }
 
 func (u *uploader) UploadPart(bucket, object string, id UploadID, partNumber int, contentLength int64, input io.Reader) (etag string, err error) {
+	return u.uploadPart(bucket, object, id, partNumber, contentLength, input, nil)
+}
+
+// uploadPart uploads a part of an upload that may be encrypted with SSE-C,
+// in which case key must match the key the upload was created with, or with
+// SSE-KMS. The checksum of the part is worked out before the part is
+// encrypted.
+func (u *uploader) uploadPart(bucket, object string, id UploadID, partNumber int, contentLength int64, input io.Reader, key *customerKey) (etag string, err error) {
 	if partNumber > MaxUploadPartNumber {
 		return "", ErrInvalidPart
 	}
@@ -388,6 +399,27 @@ func (u *uploader) UploadPart(bucket, object string, id UploadID, partNumber int
 	mpu.mu.Lock()
 	defer mpu.mu.Unlock()
 
+	if err := checkUploadCustomerKey(mpu.Meta, key); err != nil {
+		return "", err
+	} else if key == nil {
+		key = kmsDataKey(mpu.Meta)
+	}
+
+	var checksum string
+	if algorithm := mpu.checksumAlgorithm(); algorithm != "" {
+		var err error
+		if checksum, err = algorithm.sum(body); err != nil {
+			return "", err
+		}
+	}
+	if key != nil {
+		nonce, err := encryptionNonce(mpu.Meta)
+		if err != nil {
+			return "", err
+		}
+		key.stream(nonce, partNumber, 0).XORKeyStream(body, body)
+	}
+
 	// What the ETag actually is is not specified, so let's just invent any old thing
 	// from guaranteed unique input:
 	hash := md5.New()
@@ -399,6 +431,7 @@ func (u *uploader) UploadPart(bucket, object string, id UploadID, partNumber int
 		Body:         body,
 		ETag:         etag,
 		LastModified: NewContentTime(u.timeSource.Now()),
+		Checksum:     checksum,
 	}
 	if partNumber >= len(mpu.parts) {
 		mpu.parts = append(mpu.parts, make([]*multipartUploadPart, partNumber-len(mpu.parts)+1)...)
@@ -408,6 +441,18 @@ func (u *uploader) UploadPart(bucket, object string, id UploadID, partNumber int
 }
 
 func (u *uploader) CompleteMultipartUpload(bucket, object string, id UploadID, input *CompleteMultipartUploadRequest) (version VersionID, etag string, err error) {
+	return u.completeMultipartUpload(bucket, object, id, input, nil, nil)
+}
+
+func (u *uploader) CompleteMultipartUploadConditional(bucket, object string, id UploadID, input *CompleteMultipartUploadRequest, conditions *PutConditions) (version VersionID, etag string, err error) {
+	return u.completeMultipartUpload(bucket, object, id, input, nil, conditions)
+}
+
+// completeMultipartUpload completes an upload that may be encrypted with
+// SSE-C. The key is only needed to work out a FULL_OBJECT checksum, which
+// covers the decrypted contents of the parts. The conditions are checked by
+// the backend as it stores the object.
+func (u *uploader) completeMultipartUpload(bucket, object string, id UploadID, input *CompleteMultipartUploadRequest, key *customerKey, conditions *PutConditions) (version VersionID, etag string, err error) {
 	u.mu.Lock()
 	defer u.mu.Unlock()
 
@@ -433,6 +478,7 @@ func (u *uploader) CompleteMultipartUpload(bucket, object string, id UploadID, i
 	}
 
 	var size int64
+	algorithm := mpu.checksumAlgorithm()
 
 	for _, inPart := range input.Parts {
 		if inPart.PartNumber >= mpuPartsLen || mpu.parts[inPart.PartNumber] == nil {
@@ -444,6 +490,15 @@ func (u *uploader) CompleteMultipartUpload(bucket, object string, id UploadID, i
 			return "", "", ErrorMessagef(ErrInvalidPart, "unexpected part etag for number %d in complete request", inPart.PartNumber)
 		}
 
+		if algorithm != "" {
+			checksum := inPart.Get(algorithm)
+			if checksum == "" {
+				return "", "", ErrorMessagef(ErrInvalidRequest, "The upload was created using a %s checksum. The complete request must include the checksum for each part. It was missing for part %d in the request.", strings.ToLower(string(algorithm)), inPart.PartNumber)
+			} else if checksum != upPart.Checksum {
+				return "", "", ErrorMessagef(ErrInvalidPart, "unexpected part checksum for number %d in complete request", inPart.PartNumber)
+			}
+		}
+
 		size += int64(len(upPart.Body))
 	}
 
@@ -461,7 +516,40 @@ func (u *uploader) CompleteMultipartUpload(bucket, object string, id UploadID, i
 
 	etag = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(hash.Sum(nil)), len(input.Parts))
 
-	result, err := u.storage.PutObject(bucket, object, mpu.Meta, bytes.NewReader(body), int64(len(body)), nil)
+	// The upload is kept if storing the object fails, so its metadata must
+	// not be modified:
+	meta := make(map[string]string, len(mpu.Meta)+1)
+	for k, v := range mpu.Meta {
+		meta[k] = v
+	}
+
+	parts := make([]objectPart, 0, len(input.Parts))
+	for _, inPart := range input.Parts {
+		upPart := mpu.parts[inPart.PartNumber]
+		parts = append(parts, objectPart{Number: inPart.PartNumber, Size: int64(len(upPart.Body)), Checksum: upPart.Checksum})
+	}
+	meta[partsMetadataKey] = encodeObjectParts(parts)
+	meta[multipartETagMetadataKey] = etag
+
+	if algorithm != "" {
+		delete(meta, checksumAlgorithmMetadataKey)
+
+		if ChecksumType(meta[checksumTypeMetadataKey]) == ChecksumTypeFullObject {
+			if meta[algorithm.header()], err = mpu.fullObjectChecksum(algorithm, input.Parts, key); err != nil {
+				return "", "", err
+			}
+		} else {
+			checksums := make([]string, 0, len(parts))
+			for _, part := range parts {
+				checksums = append(checksums, part.Checksum)
+			}
+			if meta[algorithm.header()], err = algorithm.compositeChecksum(checksums); err != nil {
+				return "", "", err
+			}
+		}
+	}
+
+	result, err := u.storage.PutObject(bucket, object, meta, bytes.NewReader(body), int64(len(body)), conditions)
 	if err != nil {
 		return "", "", err
 	}
@@ -528,6 +616,10 @@ type multipartUploadPart struct {
 	ETag         string
 	Body         []byte
 	LastModified ContentTime
+
+	// The base64 encoded checksum of the part, if the upload was created with
+	// a checksum algorithm.
+	Checksum string
 }
 
 type multipartUpload struct {
@@ -553,3 +645,44 @@ type multipartUpload struct {
 
 	mu sync.Mutex
 }
+
+// checksumAlgorithm returns the algorithm the upload was created with, or an
+// empty string if it was created without one.
+func (mpu *multipartUpload) checksumAlgorithm() ChecksumAlgorithm {
+	return ChecksumAlgorithm(mpu.Meta[checksumAlgorithmMetadataKey])
+}
+
+// fullObjectChecksum returns the checksum of the contents of the parts, which
+// are decrypted first if the upload is encrypted with SSE-C or SSE-KMS.
+func (mpu *multipartUpload) fullObjectChecksum(algorithm ChecksumAlgorithm, parts []CompletedPart, key *customerKey) (string, error) {
+	nonce, err := encryptionNonce(mpu.Meta)
+	if err != nil {
+		return "", err
+	}
+	_, customer := mpu.Meta[sseCustomerKeyMD5Header]
+	switch {
+	case !customer:
+		key = kmsDataKey(mpu.Meta)
+	case key == nil:
+		return "", ErrorMessage(ErrInvalidRequest, "The multipart upload was created using a checksum and server-side encryption with a customer-provided key. The complete request must include the encryption parameters.")
+	default:
+		if err := checkUploadCustomerKey(mpu.Meta, key); err != nil {
+			return "", err
+		}
+	}
+
+	h, err := algorithm.newHash()
+	if err != nil {
+		return "", err
+	}
+	for _, inPart := range parts {
+		data := mpu.parts[inPart.PartNumber].Body
+		if nonce != nil {
+			decrypted := make([]byte, len(data))
+			key.stream(nonce, inPart.PartNumber, 0).XORKeyStream(decrypted, data)
+			data = decrypted
+		}
+		h.Write(data)
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
@@ -1,9 +1,15 @@
 package gofakes3_test
 
 import (
-	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"context"
+	"io"
+	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
 	"github.com/johannesboyne/gofakes3"
 )
 
@@ -170,3 +176,173 @@ func TestListMultipartUploadParts(t *testing.T) {
 		doUpload(ts)
 	})
 }
+
+func TestUploadPartCopy(t *testing.T) {
+	ts := newTestServer(t, withVersioning())
+	defer ts.Close()
+	svc := ts.s3Client()
+
+	ts.putString(svc, "source", "abcdefghij")
+	current, err := svc.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("source"),
+	})
+	ts.OK(err)
+	ts.putString(svc, "source", "0123456789")
+
+	id := ts.createMultipartUpload(defaultBucket, "foo", nil)
+	copyPart := func(num int32, source, rnge, ifMatch string) (*s3.UploadPartCopyOutput, error) {
+		in := &s3.UploadPartCopyInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("foo"),
+			UploadId:   aws.String(id),
+			PartNumber: aws.Int32(num),
+			CopySource: aws.String(source),
+		}
+		if rnge != "" {
+			in.CopySourceRange = aws.String(rnge)
+		}
+		if ifMatch != "" {
+			in.CopySourceIfMatch = aws.String(ifMatch)
+		}
+		return svc.UploadPartCopy(context.TODO(), in)
+	}
+
+	out1, err := copyPart(1, defaultBucket+"/source?versionId="+aws.ToString(current.VersionId), "bytes=0-4", aws.ToString(current.ETag))
+	ts.OK(err)
+	if aws.ToString(out1.CopySourceVersionId) != aws.ToString(current.VersionId) {
+		t.Fatal("unexpected source version", aws.ToString(out1.CopySourceVersionId))
+	}
+	out2, err := copyPart(2, defaultBucket+"/source", "bytes=5-9", "")
+	ts.OK(err)
+	out3, err := copyPart(3, defaultBucket+"/source", "", "")
+	ts.OK(err)
+
+	ts.assertCompleteUpload(defaultBucket, "foo", id, []s3types.CompletedPart{
+		{PartNumber: aws.Int32(1), ETag: out1.CopyPartResult.ETag},
+		{PartNumber: aws.Int32(2), ETag: out2.CopyPartResult.ETag},
+		{PartNumber: aws.Int32(3), ETag: out3.CopyPartResult.ETag},
+	}, []byte("abcde567890123456789"))
+
+	id = ts.createMultipartUpload(defaultBucket, "foo", nil)
+	if _, err := copyPart(1, defaultBucket+"/source", "bytes=5-10", ""); !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+		t.Fatal("expected InvalidArgument, found", err)
+	}
+	if _, err := copyPart(1, defaultBucket+"/source", "bytes=5-", ""); !hasErrorCode(err, gofakes3.ErrInvalidArgument) {
+		t.Fatal("expected InvalidArgument, found", err)
+	}
+	if _, err := copyPart(1, defaultBucket+"/source", "", aws.ToString(current.ETag)); !hasErrorCode(err, gofakes3.ErrPreconditionFailed) {
+		t.Fatal("expected PreconditionFailed, found", err)
+	}
+	if _, err := copyPart(1, defaultBucket+"/missing", "", ""); !hasErrorCode(err, gofakes3.ErrNoSuchKey) {
+		t.Fatal("expected NoSuchKey, found", err)
+	}
+}
+
+func TestGetObjectPartNumber(t *testing.T) {
+	runWithAllBackends(t, testGetObjectPartNumber)
+}
+
+func testGetObjectPartNumber(t *testing.T, ts *testServer) {
+	svc := ts.s3Client()
+
+	id := ts.createMultipartUpload(defaultBucket, "multi", nil)
+	parts := []s3types.CompletedPart{
+		ts.uploadPart(defaultBucket, "multi", id, 1, []byte("hello ")),
+		ts.uploadPart(defaultBucket, "multi", id, 2, []byte("multipart ")),
+		ts.uploadPart(defaultBucket, "multi", id, 3, []byte("world")),
+	}
+	ts.assertCompleteUpload(defaultBucket, "multi", id, parts, []byte("hello multipart world"))
+	etag := ts.calculateETagBodyByParts(parts)
+	if !strings.HasSuffix(etag, `-3"`) {
+		t.Fatal("unexpected multipart etag", etag)
+	}
+
+	head, err := svc.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(defaultBucket),
+		Key:    aws.String("multi"),
+	})
+	ts.OK(err)
+	if aws.ToString(head.ETag) != etag || head.PartsCount != nil {
+		t.Fatal("unexpected head", aws.ToString(head.ETag), head.PartsCount)
+	}
+	list, err := svc.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{Bucket: aws.String(defaultBucket)})
+	ts.OK(err)
+	if len(list.Contents) != 1 || aws.ToString(list.Contents[0].ETag) != etag {
+		t.Fatal("unexpected listing", list.Contents)
+	}
+
+	for idx, tc := range []struct {
+		part int32
+		body string
+		rnge string
+	}{
+		{part: 1, body: "hello ", rnge: "bytes 0-5/21"},
+		{part: 2, body: "multipart ", rnge: "bytes 6-15/21"},
+		{part: 3, body: "world", rnge: "bytes 16-20/21"},
+	} {
+		out, err := svc.GetObject(context.TODO(), &s3.GetObjectInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("multi"),
+			PartNumber: aws.Int32(tc.part),
+		})
+		ts.OK(err)
+		body, err := io.ReadAll(out.Body)
+		out.Body.Close()
+		ts.OK(err)
+		if string(body) != tc.body || aws.ToString(out.ContentRange) != tc.rnge || aws.ToInt32(out.PartsCount) != 3 || aws.ToString(out.ETag) != etag {
+			t.Fatal(idx, "unexpected part", string(body), aws.ToString(out.ContentRange), aws.ToInt32(out.PartsCount), aws.ToString(out.ETag))
+		}
+
+		head, err := svc.HeadObject(context.TODO(), &s3.HeadObjectInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String("multi"),
+			PartNumber: aws.Int32(tc.part),
+		})
+		ts.OK(err)
+		if aws.ToInt64(head.ContentLength) != int64(len(tc.body)) || aws.ToInt32(head.PartsCount) != 3 {
+			t.Fatal(idx, "unexpected part head", aws.ToInt64(head.ContentLength), aws.ToInt32(head.PartsCount))
+		}
+	}
+
+	getPart := func(object string, part int32, rnge string) (*s3.GetObjectOutput, error) {
+		in := &s3.GetObjectInput{
+			Bucket:     aws.String(defaultBucket),
+			Key:        aws.String(object),
+			PartNumber: aws.Int32(part),
+		}
+		if rnge != "" {
+			in.Range = aws.String(rnge)
+		}
+		return svc.GetObject(context.TODO(), in)
+	}
+	if _, err := getPart("multi", 4, ""); !hasErrorCode(err, gofakes3.ErrInvalidPartNumber) {
+		t.Fatal("expected InvalidPartNumber, found", err)
+	}
+	if _, err := getPart("multi", 1, "bytes=0-1"); !hasErrorCode(err, gofakes3.ErrInvalidRequest) {
+		t.Fatal("expected InvalidRequest, found", err)
+	}
+
+	// Objects that were not uploaded in parts are read as a single part:
+	ts.putString(svc, "single", "hello")
+	out, err := getPart("single", 1, "")
+	ts.OK(err)
+	body, err := io.ReadAll(out.Body)
+	out.Body.Close()
+	ts.OK(err)
+	if string(body) != "hello" || out.PartsCount != nil {
+		t.Fatal("unexpected part", string(body), out.PartsCount)
+	}
+	if _, err := getPart("single", 2, ""); !hasErrorCode(err, gofakes3.ErrInvalidPartNumber) {
+		t.Fatal("expected InvalidPartNumber, found", err)
+	}
+
+	// The multipart ETag is the one conditional writes compare with:
+	_, err = svc.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:  aws.String(defaultBucket),
+		Key:     aws.String("multi"),
+		Body:    strings.NewReader("replaced"),
+		IfMatch: aws.String(etag),
+	})
+	ts.OK(err)
+}